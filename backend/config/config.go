@@ -2,21 +2,35 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Database DatabaseConfig
-	APNs     APNsConfig
-	Email    EmailConfig
-	Server   ServerConfig
+	Database  DatabaseConfig
+	APNs      APNsConfig
+	Email     EmailConfig
+	SMS       SMSConfig
+	Webhook   WebhookConfig
+	Server    ServerConfig
+	Auth      AuthConfig
+	Apple     AppleConfig
+	Account   AccountConfig
+	CheckIn   CheckInConfig
+	RateLimit RateLimitConfig
+	Incident  IncidentConfig
 }
 
 type DatabaseConfig struct {
+	Driver   string // "mysql"、"postgres"、"sqlite"
+	Path     string // SQLite 数据库文件路径
 	Host     string
 	Port     string
 	User     string
 	Password string
 	DBName   string
+	SSLMode  string // PostgreSQL sslmode
 }
 
 type APNsConfig struct {
@@ -25,6 +39,7 @@ type APNsConfig struct {
 	BundleID   string
 	KeyPath    string
 	Production bool
+	Retry      RetryConfig
 }
 
 type EmailConfig struct {
@@ -38,20 +53,103 @@ type EmailConfig struct {
 	SMTPPassword string
 	FromEmail    string
 	FromName     string
+	Retry        RetryConfig
+}
+
+type SMSConfig struct {
+	Provider           string // "aliyun"、"twilio"，为空时不启用短信
+	DefaultCountryCode string // 未带国际区号的手机号默认使用的区号
+	AliyunEndpoint     string
+	AliyunKey          string
+	AliyunSecret       string
+	AliyunSignName     string
+	AliyunTemplateCode string // 模板变量：name、days、overdue、content（完整正文）、link（一键打卡链接，只有发给用户本人时有）
+	TwilioBaseURL      string
+	TwilioAccountSID   string
+	TwilioAuthToken    string
+	TwilioFrom         string
+	Retry              RetryConfig
+}
+
+type WebhookConfig struct {
+	Timeout       time.Duration // 单次投递的超时时间
+	AllowInsecure bool          // 是否允许 http:// 和内网地址（仅用于本地调试）
+	Retry         RetryConfig
+}
+
+// RetryConfig 通知渠道的重试配置
+type RetryConfig struct {
+	MaxRetries int
+	Delays     []time.Duration
 }
 
 type ServerConfig struct {
-	Port string
+	Port      string
+	BaseURL   string // 对外访问地址，用于生成邮件中的链接
+	SecretKey string // 签名链接使用的密钥
+	// TrustedProxies 可信的反向代理（IP 或 CIDR），只有来自这些地址的请求才使用 X-Forwarded-For 中的客户端 IP
+	// 为空时不信任任何代理，客户端 IP 为连接的对端地址
+	TrustedProxies []string
+}
+
+type AuthConfig struct {
+	AccessTokenExpiry  time.Duration // Access Token 有效期
+	RefreshTokenExpiry time.Duration // Refresh Token 有效期，到期后需要重新登录
+}
+
+// AppleConfig Sign in with Apple 的 identity token 校验配置
+type AppleConfig struct {
+	ClientIDs []string // 允许的 aud，即 App 的 Bundle ID 或 Services ID，为空时不启用
+	Issuer    string
+	JWKSURL   string // Apple 公钥地址，测试时可指向本地的 JWKS
+}
+
+type AccountConfig struct {
+	DeletionGracePeriod time.Duration // 申请注销后到真正删除数据的等待时间，期间可以撤销
+}
+
+// CheckInConfig 客户端提交的打卡时间的容差
+type CheckInConfig struct {
+	MaxPastSkew    time.Duration // 客户端时间早于服务器时间的最大容差，超出时按服务器时间记录
+	MaxFutureSkew  time.Duration // 客户端时间晚于服务器时间的最大容差，超出时按服务器时间记录
+	BackfillWindow time.Duration // 补打卡最多可以补多久以前的打卡，0 表示不允许补打卡
+}
+
+type RateLimitConfig struct {
+	Enabled bool
+	Store   string        // "memory" 或 "database"，多实例部署时使用 database 共享限流状态
+	Auth    RateLimitRule // 登录、Sign in with Apple、配对码、找回账号
+	Refresh RateLimitRule // 刷新 Token
+	CheckIn RateLimitRule // 打卡和一键打卡链接
+}
+
+// RateLimitRule 同时按 IP 和按用户（已登录）或设备ID 限流
+type RateLimitRule struct {
+	PerIP     RateLimit
+	PerClient RateLimit
+}
+
+// RateLimit 令牌桶：容量为 Requests，每 Per 时间补满，Requests 为 0 时不限制
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+type IncidentConfig struct {
+	AckPauseDuration time.Duration // 紧急联系人确认后暂停升级的时长
 }
 
 func Load() *Config {
 	return &Config{
 		Database: DatabaseConfig{
+			Driver:   getEnv("DB_DRIVER", "mysql"),
+			Path:     getEnv("DB_PATH", "deadornot.db"),
 			Host:     getEnv("DB_HOST", "localhost"),
 			Port:     getEnv("DB_PORT", "3306"),
 			User:     getEnv("DB_USER", "root"),
 			Password: getEnv("DB_PASSWORD", ""),
 			DBName:   getEnv("DB_NAME", "deadornot"),
+			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
 		APNs: APNsConfig{
 			KeyID:      getEnv("APNS_KEY_ID", ""),
@@ -59,6 +157,7 @@ func Load() *Config {
 			BundleID:   getEnv("APNS_BUNDLE_ID", ""),
 			KeyPath:    getEnv("APNS_KEY_PATH", ""),
 			Production: getEnv("APNS_PRODUCTION", "false") == "true",
+			Retry:      getRetryConfig("APNS", 3),
 		},
 		Email: EmailConfig{
 			Provider:     getEnv("EMAIL_PROVIDER", "aliyun"),
@@ -71,9 +170,68 @@ func Load() *Config {
 			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
 			FromEmail:    getEnv("FROM_EMAIL", ""),
 			FromName:     getEnv("FROM_NAME", "死了么"),
+			Retry:        getRetryConfig("EMAIL", 3),
+		},
+		SMS: SMSConfig{
+			Provider:           getEnv("SMS_PROVIDER", ""),
+			DefaultCountryCode: getEnv("SMS_DEFAULT_COUNTRY_CODE", "86"),
+			AliyunEndpoint:     getEnv("ALIYUN_SMS_ENDPOINT", "https://dysmsapi.aliyuncs.com/"),
+			AliyunKey:          getEnv("ALIYUN_SMS_ACCESS_KEY", getEnv("ALIYUN_ACCESS_KEY", "")),
+			AliyunSecret:       getEnv("ALIYUN_SMS_ACCESS_SECRET", getEnv("ALIYUN_ACCESS_SECRET", "")),
+			AliyunSignName:     getEnv("ALIYUN_SMS_SIGN_NAME", ""),
+			AliyunTemplateCode: getEnv("ALIYUN_SMS_TEMPLATE_CODE", ""),
+			TwilioBaseURL:      getEnv("TWILIO_BASE_URL", "https://api.twilio.com"),
+			TwilioAccountSID:   getEnv("TWILIO_ACCOUNT_SID", ""),
+			TwilioAuthToken:    getEnv("TWILIO_AUTH_TOKEN", ""),
+			TwilioFrom:         getEnv("TWILIO_FROM", ""),
+			Retry:              getRetryConfig("SMS", 3),
+		},
+		Webhook: WebhookConfig{
+			Timeout:       time.Duration(getEnvInt("WEBHOOK_TIMEOUT_SECONDS", 10)) * time.Second,
+			AllowInsecure: getEnv("WEBHOOK_ALLOW_INSECURE", "false") == "true",
+			Retry:         getRetryConfig("WEBHOOK", 5),
 		},
 		Server: ServerConfig{
-			Port: getEnv("PORT", "8080"),
+			Port:           getEnv("PORT", "8080"),
+			BaseURL:        getEnv("PUBLIC_BASE_URL", "http://localhost:8080"),
+			SecretKey:      getEnv("APP_SECRET", ""),
+			TrustedProxies: getEnvList("TRUSTED_PROXIES", ""),
+		},
+		Auth: AuthConfig{
+			AccessTokenExpiry:  time.Duration(getEnvInt("ACCESS_TOKEN_EXPIRY_HOURS", 7*24)) * time.Hour,
+			RefreshTokenExpiry: time.Duration(getEnvInt("REFRESH_TOKEN_EXPIRY_DAYS", 30)) * 24 * time.Hour,
+		},
+		Apple: AppleConfig{
+			ClientIDs: getEnvList("APPLE_CLIENT_IDS", getEnv("APNS_BUNDLE_ID", "")),
+			Issuer:    getEnv("APPLE_ISSUER", "https://appleid.apple.com"),
+			JWKSURL:   getEnv("APPLE_JWKS_URL", "https://appleid.apple.com/auth/keys"),
+		},
+		Account: AccountConfig{
+			DeletionGracePeriod: time.Duration(getEnvInt("ACCOUNT_DELETION_GRACE_DAYS", 7)) * 24 * time.Hour,
+		},
+		CheckIn: CheckInConfig{
+			MaxPastSkew:    time.Duration(getEnvInt("CHECKIN_MAX_PAST_SKEW_MINUTES", 10)) * time.Minute,
+			MaxFutureSkew:  time.Duration(getEnvInt("CHECKIN_MAX_FUTURE_SKEW_MINUTES", 2)) * time.Minute,
+			BackfillWindow: time.Duration(getEnvInt("CHECKIN_BACKFILL_HOURS", 48)) * time.Hour,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: getEnv("RATE_LIMIT_ENABLED", "true") == "true",
+			Store:   getEnv("RATE_LIMIT_STORE", "memory"),
+			Auth: RateLimitRule{
+				PerIP:     getEnvRateLimit("RATE_LIMIT_AUTH_IP", "60/1h"),
+				PerClient: getEnvRateLimit("RATE_LIMIT_AUTH_DEVICE", "20/1h"),
+			},
+			Refresh: RateLimitRule{
+				PerIP:     getEnvRateLimit("RATE_LIMIT_REFRESH_IP", "120/1h"),
+				PerClient: getEnvRateLimit("RATE_LIMIT_REFRESH_DEVICE", "30/1h"),
+			},
+			CheckIn: RateLimitRule{
+				PerIP:     getEnvRateLimit("RATE_LIMIT_CHECKIN_IP", "300/1h"),
+				PerClient: getEnvRateLimit("RATE_LIMIT_CHECKIN_USER", "30/1h"),
+			},
+		},
+		Incident: IncidentConfig{
+			AckPauseDuration: time.Duration(getEnvInt("INCIDENT_ACK_PAUSE_HOURS", 24)) * time.Hour,
 		},
 	}
 }
@@ -84,3 +242,78 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if intValue, err := strconv.Atoi(value); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvList 解析逗号分隔的列表，忽略空项
+func getEnvList(key, defaultValue string) []string {
+	var list []string
+	for _, part := range strings.Split(getEnv(key, defaultValue), ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
+
+// getEnvDurations 解析逗号分隔的时长列表，例如 "1m,5m,30m"
+func getEnvDurations(key string, defaultValue []time.Duration) []time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var durations []time.Duration
+	for _, part := range strings.Split(value, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil {
+			return defaultValue
+		}
+		durations = append(durations, d)
+	}
+	return durations
+}
+
+// getEnvRateLimit 解析 "次数/时长" 格式的限流配置，例如 "60/1h"，"0" 表示不限制
+func getEnvRateLimit(key, defaultValue string) RateLimit {
+	if limit, ok := parseRateLimit(getEnv(key, defaultValue)); ok {
+		return limit
+	}
+	limit, _ := parseRateLimit(defaultValue)
+	return limit
+}
+
+func parseRateLimit(value string) (RateLimit, bool) {
+	if strings.TrimSpace(value) == "0" {
+		return RateLimit{}, true
+	}
+
+	requests, per, found := strings.Cut(value, "/")
+	if !found {
+		return RateLimit{}, false
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(requests))
+	if err != nil || n < 0 {
+		return RateLimit{}, false
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(per))
+	if err != nil || d <= 0 {
+		return RateLimit{}, false
+	}
+	return RateLimit{Requests: n, Per: d}, true
+}
+
+// getRetryConfig 读取渠道的重试配置：<PREFIX>_MAX_RETRIES 和 <PREFIX>_RETRY_DELAYS
+func getRetryConfig(prefix string, defaultMaxRetries int) RetryConfig {
+	return RetryConfig{
+		MaxRetries: getEnvInt(prefix+"_MAX_RETRIES", defaultMaxRetries),
+		Delays:     getEnvDurations(prefix+"_RETRY_DELAYS", nil),
+	}
+}
@@ -4,22 +4,35 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"net/url"
+	"time"
 
 	"github.com/deadornot/backend/config"
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 )
 
-// InitDB 初始化数据库连接
-func InitDB(cfg *config.Config) (*sql.DB, error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=UTC",
-		cfg.Database.User,
-		cfg.Database.Password,
-		cfg.Database.Host,
-		cfg.Database.Port,
-		cfg.Database.DBName,
-	)
-
-	db, err := sql.Open("mysql", dsn)
+// DB 数据库连接，按 Dialect 转换占位符，使同一条 SQL 可以在不同数据库上执行
+type DB struct {
+	*sql.DB
+	dialect Dialect
+}
+
+// Tx 数据库事务，与 DB 一样转换占位符
+type Tx struct {
+	*sql.Tx
+	dialect Dialect
+}
+
+// InitDB 按配置的数据库类型初始化数据库连接
+func InitDB(cfg *config.Config) (*DB, error) {
+	dialect, err := NewDialect(cfg.Database.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(dialect.Name(), dataSourceName(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -28,97 +41,141 @@ func InitDB(cfg *config.Config) (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	log.Println("Database connection established")
-	return db, nil
+	log.Printf("Database connection established (%s)", dialect.Name())
+	return &DB{DB: db, dialect: dialect}, nil
 }
 
-// RunMigrations 运行数据库迁移
-func RunMigrations(db *sql.DB) error {
-	migrations := []string{
-		createUsersTable,
-		createCheckInsTable,
-		createNotificationsTable,
-		createTokensTable,
+// dataSourceName 生成各数据库驱动的连接字符串，统一使用 UTC 时间
+func dataSourceName(cfg *config.Config) string {
+	switch cfg.Database.Driver {
+	case DriverPostgres:
+		dsn := url.URL{
+			Scheme: "postgres",
+			User:   url.UserPassword(cfg.Database.User, cfg.Database.Password),
+			Host:   cfg.Database.Host + ":" + cfg.Database.Port,
+			Path:   cfg.Database.DBName,
+		}
+		query := url.Values{}
+		query.Set("sslmode", cfg.Database.SSLMode)
+		query.Set("timezone", "UTC")
+		dsn.RawQuery = query.Encode()
+		return dsn.String()
+	case DriverSQLite:
+		// WAL 模式下读写互不阻塞；写入冲突时等待而不是直接报错
+		return "file:" + cfg.Database.Path +
+			"?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_time_format=sqlite"
+	default:
+		return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=UTC",
+			cfg.Database.User,
+			cfg.Database.Password,
+			cfg.Database.Host,
+			cfg.Database.Port,
+			cfg.Database.DBName,
+		)
 	}
+}
+
+// Dialect 当前数据库的 Dialect
+func (db *DB) Dialect() Dialect {
+	return db.dialect
+}
 
-	for i, migration := range migrations {
-		if _, err := db.Exec(migration); err != nil {
-			return fmt.Errorf("migration %d failed: %w", i+1, err)
+// Exec 执行 SQL
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(db.dialect.Rebind(query), bindArgs(args)...)
+}
+
+// Query 查询多行
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(db.dialect.Rebind(query), bindArgs(args)...)
+}
+
+// QueryRow 查询单行
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(db.dialect.Rebind(query), bindArgs(args)...)
+}
+
+// Insert 执行 INSERT 并返回新记录的 id
+// PostgreSQL 不支持 LastInsertId，改用 RETURNING id
+func (db *DB) Insert(query string, args ...interface{}) (int64, error) {
+	return insert(db.dialect, db.DB.QueryRow, db.DB.Exec, query, args)
+}
+
+// Begin 开始事务
+func (db *DB) Begin() (*Tx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, dialect: db.dialect}, nil
+}
+
+// Exec 在事务中执行 SQL
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.dialect.Rebind(query), bindArgs(args)...)
+}
+
+// Query 在事务中查询多行
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.dialect.Rebind(query), bindArgs(args)...)
+}
+
+// QueryRow 在事务中查询单行
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(tx.dialect.Rebind(query), bindArgs(args)...)
+}
+
+// Insert 在事务中执行 INSERT 并返回新记录的 id
+func (tx *Tx) Insert(query string, args ...interface{}) (int64, error) {
+	return insert(tx.dialect, tx.Tx.QueryRow, tx.Tx.Exec, query, args)
+}
+
+// insert DB.Insert 和 Tx.Insert 的实现
+func insert(dialect Dialect, queryRow func(string, ...interface{}) *sql.Row, exec func(string, ...interface{}) (sql.Result, error), query string, args []interface{}) (int64, error) {
+	query = dialect.Rebind(query)
+	args = bindArgs(args)
+
+	if dialect.Name() == DriverPostgres {
+		var id int64
+		err := queryRow(query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// bindArgs 时间参数统一转换为 UTC
+// PostgreSQL 的 TIMESTAMP 和 SQLite 的文本时间都不保存时区，按 UTC 存储才能正确比较
+func bindArgs(args []interface{}) []interface{} {
+	bound := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			bound[i] = v.UTC()
+		case *time.Time:
+			if v != nil {
+				bound[i] = v.UTC()
+			} else {
+				bound[i] = v
+			}
+		default:
+			bound[i] = arg
 		}
-		log.Printf("Migration %d completed", i+1)
 	}
+	return bound
+}
 
-	log.Println("All migrations completed")
+// RunMigrations 执行所有未执行的数据库迁移
+func RunMigrations(db *DB) error {
+	applied, err := NewMigrator(db).Up()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("All migrations completed (%d applied)", applied)
 	return nil
 }
-
-const createUsersTable = `
-CREATE TABLE IF NOT EXISTS users (
-    id BIGINT AUTO_INCREMENT PRIMARY KEY,
-    device_id VARCHAR(255) UNIQUE NOT NULL,
-    name VARCHAR(100) DEFAULT '',
-    emergency_contact_emails JSON,
-    apns_token TEXT,
-    push_enabled BOOLEAN DEFAULT TRUE,
-    email_enabled BOOLEAN DEFAULT TRUE,
-    timezone VARCHAR(50) DEFAULT 'UTC',
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-    INDEX idx_device_id (device_id)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
-`
-
-const createCheckInsTable = `
-CREATE TABLE IF NOT EXISTS checkins (
-    id BIGINT AUTO_INCREMENT PRIMARY KEY,
-    user_id BIGINT NOT NULL,
-    checkin_datetime DATETIME NOT NULL,
-    checkin_date DATE GENERATED ALWAYS AS (DATE(checkin_datetime)) STORED,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-    UNIQUE KEY user_date (user_id, checkin_date)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
-`
-
-const createNotificationsTable = `
-CREATE TABLE IF NOT EXISTS notifications (
-    id BIGINT AUTO_INCREMENT PRIMARY KEY,
-    user_id BIGINT NOT NULL,
-    notification_type ENUM('email', 'sms', 'push') NOT NULL,
-    recipient VARCHAR(255) NOT NULL,
-    status ENUM('pending', 'sending', 'sent', 'failed', 'retrying') NOT NULL DEFAULT 'pending',
-    retry_count INT DEFAULT 0,
-    max_retries INT DEFAULT 3,
-    scheduled_at TIMESTAMP NOT NULL,
-    sent_at TIMESTAMP NULL,
-    failed_at TIMESTAMP NULL,
-    error_message TEXT,
-    content JSON,
-    timezone VARCHAR(50),
-    unique_key VARCHAR(255),
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-    INDEX idx_user_status (user_id, status),
-    INDEX idx_scheduled_status (scheduled_at, status),
-    INDEX idx_unique_key (unique_key)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
-`
-
-const createTokensTable = `
-CREATE TABLE IF NOT EXISTS tokens (
-    id BIGINT AUTO_INCREMENT PRIMARY KEY,
-    user_id BIGINT NOT NULL,
-    device_id VARCHAR(255) NOT NULL,
-    access_token VARCHAR(255) UNIQUE NOT NULL,
-    refresh_token VARCHAR(255) UNIQUE NOT NULL,
-    token_type VARCHAR(20) DEFAULT 'Bearer',
-    expires_at TIMESTAMP NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-    INDEX idx_access_token (access_token),
-    INDEX idx_refresh_token (refresh_token),
-    INDEX idx_user_device (user_id, device_id)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
-`
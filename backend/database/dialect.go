@@ -0,0 +1,162 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// 支持的数据库
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Dialect 不同数据库之间的 SQL 差异
+// 业务代码统一使用 ? 占位符和通用 SQL，只有无法通用的部分通过 Dialect 生成
+type Dialect interface {
+	// Name 数据库名称（DriverMySQL、DriverPostgres、DriverSQLite）
+	Name() string
+	// Rebind 将 ? 占位符转换为数据库使用的占位符
+	Rebind(query string) string
+	// IsDuplicateKey 判断错误是否为唯一键冲突
+	IsDuplicateKey(err error) bool
+	// Upsert 唯一键冲突时用插入的值更新 columns 的子句，conflict 为冲突的唯一键字段
+	Upsert(conflict []string, columns ...string) string
+	// JSONValue 取 JSON 字段中 path 对应的值
+	JSONValue(column string, path ...string) string
+	// Weekday 日期字段的星期，0 为星期日
+	Weekday(column string) string
+}
+
+// NewDialect 按数据库名称获取 Dialect
+func NewDialect(driver string) (Dialect, error) {
+	switch driver {
+	case DriverMySQL:
+		return mysqlDialect{}, nil
+	case DriverPostgres:
+		return postgresDialect{}, nil
+	case DriverSQLite:
+		return sqliteDialect{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %q", driver)
+	}
+}
+
+// mysqlDialect MySQL / MariaDB
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string { return DriverMySQL }
+
+func (mysqlDialect) Rebind(query string) string { return query }
+
+func (mysqlDialect) IsDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+func (mysqlDialect) Upsert(conflict []string, columns ...string) string {
+	assignments := make([]string, len(columns))
+	for i, column := range columns {
+		assignments[i] = fmt.Sprintf("%s = VALUES(%s)", column, column)
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(assignments, ", ")
+}
+
+func (mysqlDialect) JSONValue(column string, path ...string) string {
+	return fmt.Sprintf("JSON_EXTRACT(%s, '$.%s')", column, strings.Join(path, "."))
+}
+
+func (mysqlDialect) Weekday(column string) string {
+	return fmt.Sprintf("(DAYOFWEEK(%s) - 1)", column)
+}
+
+// postgresDialect PostgreSQL
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return DriverPostgres }
+
+// Rebind 将 ? 依次替换为 $1、$2...，忽略字符串常量中的 ?
+func (postgresDialect) Rebind(query string) string {
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+
+	n := 0
+	inString := false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'':
+			inString = !inString
+			b.WriteByte(ch)
+		case ch == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+func (postgresDialect) IsDuplicateKey(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func (postgresDialect) Upsert(conflict []string, columns ...string) string {
+	return onConflictUpdate(conflict, columns)
+}
+
+func (postgresDialect) JSONValue(column string, path ...string) string {
+	return fmt.Sprintf("%s::jsonb #>> '{%s}'", column, strings.Join(path, ","))
+}
+
+func (postgresDialect) Weekday(column string) string {
+	return fmt.Sprintf("CAST(EXTRACT(DOW FROM %s) AS INTEGER)", column)
+}
+
+// sqliteDialect SQLite
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return DriverSQLite }
+
+func (sqliteDialect) Rebind(query string) string { return query }
+
+func (sqliteDialect) IsDuplicateKey(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+func (sqliteDialect) Upsert(conflict []string, columns ...string) string {
+	return onConflictUpdate(conflict, columns)
+}
+
+func (sqliteDialect) JSONValue(column string, path ...string) string {
+	return fmt.Sprintf("json_extract(%s, '$.%s')", column, strings.Join(path, "."))
+}
+
+func (sqliteDialect) Weekday(column string) string {
+	return fmt.Sprintf("CAST(strftime('%%w', %s) AS INTEGER)", column)
+}
+
+// onConflictUpdate PostgreSQL 和 SQLite 通用的 ON CONFLICT 子句
+func onConflictUpdate(conflict []string, columns []string) string {
+	assignments := make([]string, len(columns))
+	for i, column := range columns {
+		assignments[i] = fmt.Sprintf("%s = excluded.%s", column, column)
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(conflict, ", "), strings.Join(assignments, ", "))
+}
@@ -0,0 +1,904 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// migrationsFor 按数据库类型获取迁移列表
+// 各数据库的版本号保持一致：新的结构修改需要在每个列表中追加同一版本
+func migrationsFor(dialect Dialect) []Migration {
+	switch dialect.Name() {
+	case DriverPostgres:
+		return postgresMigrations
+	case DriverSQLite:
+		return sqliteMigrations
+	default:
+		return mysqlMigrations
+	}
+}
+
+// mysqlMigrations 按版本号排列的 MySQL 数据库迁移，已发布的迁移不能修改，只能追加新版本
+// 在引入 schema_migrations 之前启动过的数据库也会从 1 开始执行，因此每个操作都必须可以重复执行
+var mysqlMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: []Step{
+			execSQL(createUsersTable),
+			execSQL(createCheckInsTable),
+			execSQL(createNotificationsTable),
+			execSQL(createTokensTable),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS tokens`),
+			execSQL(`DROP TABLE IF EXISTS notifications`),
+			execSQL(`DROP TABLE IF EXISTS checkins`),
+			execSQL(`DROP TABLE IF EXISTS users`),
+		},
+	},
+	{
+		Version: 2,
+		Name:    "escalation_policies",
+		Up: []Step{
+			execSQL(createEscalationPoliciesTable),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS escalation_policies`),
+		},
+	},
+	{
+		Version: 3,
+		Name:    "emergency_contacts",
+		Up: []Step{
+			execSQL(createEmergencyContactsTable),
+			addColumn("users", "email", "VARCHAR(255) DEFAULT '' AFTER name"),
+			dataMigration("import_legacy_emergency_contacts", importLegacyEmergencyContacts),
+		},
+		Down: []Step{
+			// 把联系人邮箱写回旧字段，旧版本程序仍可使用
+			execSQL(`
+				UPDATE users u SET emergency_contact_emails = (
+					SELECT JSON_ARRAYAGG(ec.email) FROM emergency_contacts ec
+					WHERE ec.user_id = u.id AND ec.opted_out_at IS NULL
+				)
+				WHERE EXISTS (SELECT 1 FROM emergency_contacts ec WHERE ec.user_id = u.id AND ec.opted_out_at IS NULL)
+			`),
+			dropColumn("users", "email"),
+			execSQL(`DROP TABLE IF EXISTS emergency_contacts`),
+		},
+	},
+	{
+		Version: 4,
+		Name:    "checkin_links",
+		Up: []Step{
+			execSQL(createCheckInLinksTable),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS checkin_links`),
+		},
+	},
+	{
+		Version: 5,
+		Name:    "incidents",
+		Up: []Step{
+			execSQL(createIncidentsTable),
+			execSQL(createIncidentContactsTable),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS incident_contacts`),
+			execSQL(`DROP TABLE IF EXISTS incidents`),
+		},
+	},
+	{
+		Version: 6,
+		Name:    "notification_type_varchar",
+		Up: []Step{
+			// 通知渠道改为注册表管理，新增渠道不再需要修改 ENUM
+			modifyColumnIfType("notifications", "notification_type", "enum", "VARCHAR(32) NOT NULL"),
+		},
+		Down: []Step{
+			execSQL(`DELETE FROM notifications WHERE notification_type NOT IN ('email', 'sms', 'push')`),
+			modifyColumnIfType("notifications", "notification_type", "varchar", "ENUM('email', 'sms', 'push') NOT NULL"),
+		},
+	},
+	{
+		Version: 7,
+		Name:    "user_phone",
+		Up: []Step{
+			addColumn("users", "phone", "VARCHAR(32) DEFAULT '' AFTER email"),
+		},
+		Down: []Step{
+			dropColumn("users", "phone"),
+		},
+	},
+	{
+		Version: 8,
+		Name:    "webhooks",
+		Up: []Step{
+			execSQL(createWebhooksTable),
+			addColumn("notifications", "response_status", "INT NULL AFTER error_message"),
+		},
+		Down: []Step{
+			execSQL(`DELETE FROM notifications WHERE notification_type = 'webhook'`),
+			dropColumn("notifications", "response_status"),
+			execSQL(`DROP TABLE IF EXISTS webhooks`),
+		},
+	},
+	{
+		Version: 9,
+		Name:    "user_reminder_schedule",
+		Up: []Step{
+			addColumn("users", "reminder_times", "JSON AFTER timezone"),
+			addColumn("users", "reminder_days", "JSON AFTER reminder_times"),
+		},
+		Down: []Step{
+			dropColumn("users", "reminder_days"),
+			dropColumn("users", "reminder_times"),
+		},
+	},
+	{
+		// 打卡日期改为本地日期后，同一本地日期可能有多条旧记录，全部保留：
+		// 每天只能打卡一次的限制改为 daily_date 上的唯一键，同一天最早的一条记录占用 daily_date，其余为 NULL
+		Version: 10,
+		Name:    "checkin_local_date",
+		Up: []Step{
+			addColumn("checkins", "timezone", "VARCHAR(50) AFTER checkin_date"),
+			addColumn("checkins", "daily_date", "DATE NULL AFTER checkin_date"),
+			// user_date 是外键 user_id 唯一可用的索引，回填时需要先删除它
+			addIndex("checkins", "idx_user_id", "user_id"),
+			addIndex("checkins", "idx_user_date", "user_id, checkin_date"),
+			dataMigration("migrate_checkin_local_dates_keep_duplicates", migrateCheckInLocalDates),
+		},
+		Down: []Step{
+			// 恢复为 UTC 日期，不删除打卡记录：同一 UTC 日期的多条记录都保留，仍由 daily_date 上的唯一键限制每天一次
+			dataMigration("restore_checkin_utc_dates_keep_duplicates", restoreCheckInUTCDates),
+			dropColumn("checkins", "timezone"),
+		},
+	},
+	{
+		Version: 11,
+		Name:    "hash_tokens",
+		Up: []Step{
+			addColumn("tokens", "refresh_expires_at", "TIMESTAMP NULL AFTER expires_at"),
+			dataMigration("hash_existing_tokens", hashExistingTokens(mysqlDialect{})),
+		},
+		Down: []Step{
+			// 哈希无法还原，回滚时所有设备需要重新登录
+			execSQL(`DELETE FROM tokens`),
+			dropColumn("tokens", "refresh_expires_at"),
+		},
+	},
+	{
+		Version: 12,
+		Name:    "token_families",
+		Up: []Step{
+			addColumn("tokens", "family_id", "VARCHAR(64) NULL AFTER device_id"),
+			addColumn("tokens", "rotated_at", "TIMESTAMP NULL AFTER refresh_expires_at"),
+			// 已有的 Token 各自作为一个新的家族
+			execSQL(`UPDATE tokens SET family_id = CONCAT('legacy-', id) WHERE family_id IS NULL`),
+			addIndex("tokens", "idx_family_id", "family_id"),
+			execSQL(createSecurityEventsTable),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS security_events`),
+			execSQL(`DELETE FROM tokens WHERE rotated_at IS NOT NULL`),
+			dropColumn("tokens", "rotated_at"),
+			dropColumn("tokens", "family_id"),
+		},
+	},
+	{
+		Version: 13,
+		Name:    "token_sessions",
+		Up: []Step{
+			addColumn("tokens", "signed_in_at", "TIMESTAMP NULL AFTER rotated_at"),
+			addColumn("tokens", "last_used_at", "TIMESTAMP NULL AFTER signed_in_at"),
+			addColumn("tokens", "ip_address", "VARCHAR(64) DEFAULT '' AFTER last_used_at"),
+			addColumn("tokens", "user_agent", "VARCHAR(255) DEFAULT '' AFTER ip_address"),
+			execSQL(`UPDATE tokens SET signed_in_at = created_at WHERE signed_in_at IS NULL`),
+		},
+		Down: []Step{
+			dropColumn("tokens", "user_agent"),
+			dropColumn("tokens", "ip_address"),
+			dropColumn("tokens", "last_used_at"),
+			dropColumn("tokens", "signed_in_at"),
+		},
+	},
+	{
+		Version: 14,
+		Name:    "account_recovery",
+		Up: []Step{
+			execSQL(createUserDevicesTable),
+			execSQL(`
+				INSERT INTO user_devices (user_id, device_id, created_at)
+				SELECT id, device_id, created_at FROM users u
+				WHERE NOT EXISTS (SELECT 1 FROM user_devices d WHERE d.device_id = u.device_id)
+			`),
+			addColumn("users", "email_verified_at", "TIMESTAMP NULL AFTER email"),
+			execSQL(createAuthCodesTable),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS auth_codes`),
+			dropColumn("users", "email_verified_at"),
+			execSQL(`DROP TABLE IF EXISTS user_devices`),
+		},
+	},
+	{
+		Version: 15,
+		Name:    "apple_sign_in",
+		Up: []Step{
+			addColumn("users", "apple_sub", "VARCHAR(255) NULL UNIQUE AFTER email_verified_at"),
+		},
+		Down: []Step{
+			dropColumn("users", "apple_sub"),
+		},
+	},
+	{
+		Version: 16,
+		Name:    "account_deletion",
+		Up: []Step{
+			addColumn("users", "deletion_scheduled_at", "TIMESTAMP NULL AFTER reminder_days"),
+		},
+		Down: []Step{
+			dropColumn("users", "deletion_scheduled_at"),
+		},
+	},
+	{
+		Version: 17,
+		Name:    "rate_limit_buckets",
+		Up: []Step{
+			execSQL(createRateLimitBucketsTable),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS rate_limit_buckets`),
+		},
+	},
+	{
+		Version: 18,
+		Name:    "user_pauses",
+		Up: []Step{
+			execSQL(createUserPausesTable),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS user_pauses`),
+		},
+	},
+	{
+		// 按间隔打卡的用户一天可以打卡多次，每天只能打卡一次的限制在版本 10 中已改为 daily_date 上的唯一键
+		Version: 19,
+		Name:    "checkin_cadence",
+		Up: []Step{
+			addColumn("users", "checkin_interval_minutes", "INT NOT NULL DEFAULT 0 AFTER reminder_days"),
+		},
+		Down: []Step{
+			dropColumn("users", "checkin_interval_minutes"),
+		},
+	},
+	{
+		Version: 20,
+		Name:    "checkin_deadline",
+		Up: []Step{
+			addColumn("users", "checkin_deadline", "VARCHAR(5) NULL AFTER checkin_interval_minutes"),
+			addColumn("users", "checkin_grace_minutes", "INT NOT NULL DEFAULT 0 AFTER checkin_deadline"),
+		},
+		Down: []Step{
+			dropColumn("users", "checkin_grace_minutes"),
+			dropColumn("users", "checkin_deadline"),
+		},
+	},
+	{
+		Version: 21,
+		Name:    "checkin_details",
+		Up: []Step{
+			addColumn("checkins", "mood", "TINYINT NULL AFTER timezone"),
+			addColumn("checkins", "note", "VARCHAR(280) NULL AFTER mood"),
+			addColumn("checkins", "battery_level", "TINYINT NULL AFTER note"),
+			addColumn("checkins", "latitude", "DOUBLE NULL AFTER battery_level"),
+			addColumn("checkins", "longitude", "DOUBLE NULL AFTER latitude"),
+			addColumn("users", "share_mood", "BOOLEAN NOT NULL DEFAULT FALSE AFTER checkin_grace_minutes"),
+			addColumn("users", "share_note", "BOOLEAN NOT NULL DEFAULT FALSE AFTER share_mood"),
+			addColumn("users", "share_battery", "BOOLEAN NOT NULL DEFAULT FALSE AFTER share_note"),
+			addColumn("users", "share_location", "BOOLEAN NOT NULL DEFAULT FALSE AFTER share_battery"),
+		},
+		Down: []Step{
+			dropColumn("users", "share_location"),
+			dropColumn("users", "share_battery"),
+			dropColumn("users", "share_note"),
+			dropColumn("users", "share_mood"),
+			dropColumn("checkins", "longitude"),
+			dropColumn("checkins", "latitude"),
+			dropColumn("checkins", "battery_level"),
+			dropColumn("checkins", "note"),
+			dropColumn("checkins", "mood"),
+		},
+	},
+	{
+		// 记录打卡时间的来源，以及服务器收到打卡的时间和客户端提交的原始时间
+		Version: 22,
+		Name:    "checkin_time_audit",
+		Up: []Step{
+			addColumn("checkins", "source", "VARCHAR(16) NULL AFTER timezone"),
+			addColumn("checkins", "received_at", "DATETIME NULL AFTER source"),
+			addColumn("checkins", "client_datetime", "DATETIME NULL AFTER received_at"),
+		},
+		Down: []Step{
+			dropColumn("checkins", "client_datetime"),
+			dropColumn("checkins", "received_at"),
+			dropColumn("checkins", "source"),
+		},
+	},
+	{
+		Version: 23,
+		Name:    "notification_claims",
+		Up: []Step{
+			addColumn("notifications", "claimed_at", "TIMESTAMP NULL AFTER scheduled_at"),
+		},
+		Down: []Step{
+			dropColumn("notifications", "claimed_at"),
+		},
+	},
+	{
+		Version: 24,
+		Name:    "auth_code_discard_previous",
+		Up: []Step{
+			addColumn("auth_codes", "discard_previous", "BOOLEAN NOT NULL DEFAULT FALSE AFTER device_id"),
+		},
+		Down: []Step{
+			dropColumn("auth_codes", "discard_previous"),
+		},
+	},
+	{
+		Version: 25,
+		Name:    "checkin_stats",
+		Up: []Step{
+			execSQL(createCheckInStatsTable),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS checkin_stats`),
+		},
+	},
+	{
+		// 退订按用户和邮箱记录，删除后重新添加同一邮箱的联系人时仍然有效；确认邮件限制重发频率
+		Version: 26,
+		Name:    "contact_opt_outs",
+		Up: []Step{
+			addColumn("emergency_contacts", "confirmation_sent_at", "TIMESTAMP NULL AFTER opted_out_at"),
+			addColumn("emergency_contacts", "confirmation_count", "INT NOT NULL DEFAULT 0 AFTER confirmation_sent_at"),
+			execSQL(createContactOptOutsTable),
+			execSQL(`
+				INSERT IGNORE INTO contact_opt_outs (user_id, email, opted_out_at)
+				SELECT user_id, LOWER(email), opted_out_at FROM emergency_contacts WHERE opted_out_at IS NOT NULL
+			`),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS contact_opt_outs`),
+			dropColumn("emergency_contacts", "confirmation_count"),
+			dropColumn("emergency_contacts", "confirmation_sent_at"),
+		},
+	},
+}
+
+// importLegacyEmergencyContacts 将 users.emergency_contact_emails 迁移到 emergency_contacts 表
+// 这些联系人此前已经在接收提醒，直接视为已确认；迁移后清空旧字段，保证只执行一次
+func importLegacyEmergencyContacts(ctx context.Context, conn *sql.Conn) error {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT id, emergency_contact_emails FROM users
+		WHERE emergency_contact_emails IS NOT NULL AND JSON_LENGTH(emergency_contact_emails) > 0
+	`)
+	if err != nil {
+		return err
+	}
+
+	legacy := map[int64][]string{}
+	for rows.Next() {
+		var userID int64
+		var emailsJSON string
+		if err := rows.Scan(&userID, &emailsJSON); err != nil {
+			rows.Close()
+			return err
+		}
+		var emails []string
+		if err := json.Unmarshal([]byte(emailsJSON), &emails); err != nil {
+			log.Printf("Skipping invalid emergency_contact_emails for user %d: %v", userID, err)
+			continue
+		}
+		legacy[userID] = emails
+	}
+	rows.Close()
+
+	for userID, emails := range legacy {
+		for _, email := range emails {
+			// 与 ContactService 一致，邮箱统一小写存储
+			email = strings.ToLower(strings.TrimSpace(email))
+			if email == "" {
+				continue
+			}
+			_, err := conn.ExecContext(ctx, `
+				INSERT IGNORE INTO emergency_contacts (user_id, email, verified_at) VALUES (?, ?, NOW())
+			`, userID, email)
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := conn.ExecContext(ctx, `UPDATE users SET emergency_contact_emails = NULL WHERE id = ?`, userID); err != nil {
+			return err
+		}
+	}
+
+	if len(legacy) > 0 {
+		log.Printf("Imported legacy emergency contacts for %d users", len(legacy))
+	}
+	return nil
+}
+
+// hashExistingTokens 将明文保存的 Token 替换为 SHA-256 哈希，已登录的设备不需要重新登录
+// refresh_expires_at 为空的记录尚未迁移，替换时设置为原来的过期时间，保证只执行一次
+func hashExistingTokens(dialect Dialect) func(ctx context.Context, conn *sql.Conn) error {
+	return func(ctx context.Context, conn *sql.Conn) error {
+		rows, err := conn.QueryContext(ctx, `
+			SELECT id, access_token, refresh_token FROM tokens WHERE refresh_expires_at IS NULL
+		`)
+		if err != nil {
+			return err
+		}
+
+		type plainToken struct {
+			id                        int64
+			accessToken, refreshToken string
+		}
+		var tokens []plainToken
+		for rows.Next() {
+			var t plainToken
+			if err := rows.Scan(&t.id, &t.accessToken, &t.refreshToken); err != nil {
+				rows.Close()
+				return err
+			}
+			tokens = append(tokens, t)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		update := dialect.Rebind(`
+			UPDATE tokens SET access_token = ?, refresh_token = ?, refresh_expires_at = expires_at
+			WHERE id = ? AND refresh_expires_at IS NULL
+		`)
+		for _, t := range tokens {
+			if _, err := conn.ExecContext(ctx, update, sha256Hex(t.accessToken), sha256Hex(t.refreshToken), t.id); err != nil {
+				return err
+			}
+		}
+
+		if len(tokens) > 0 {
+			log.Printf("Hashed %d existing tokens", len(tokens))
+		}
+		return nil
+	}
+}
+
+// sha256Hex 与 services 中 Token 的哈希方式一致
+func sha256Hex(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// migrateCheckInLocalDates 将打卡日期从 UTC 日期改为用户时区的本地日期
+// checkin_date 原为 DATE(checkin_datetime) 生成列；timezone 为空的记录是尚未迁移的旧数据
+func migrateCheckInLocalDates(ctx context.Context, conn *sql.Conn) error {
+	// 生成列转换为普通列，保留已生成的值
+	var extra string
+	err := conn.QueryRowContext(ctx, `
+		SELECT EXTRA FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'checkins' AND COLUMN_NAME = 'checkin_date'
+	`).Scan(&extra)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(strings.ToUpper(extra), "GENERATED") {
+		if _, err := conn.ExecContext(ctx, `ALTER TABLE checkins MODIFY COLUMN checkin_date DATE NOT NULL`); err != nil {
+			return err
+		}
+		log.Println("Column checkins.checkin_date is no longer generated")
+	}
+
+	return rewriteCheckInDates(ctx, conn, toLocalCheckInDate)
+}
+
+// restoreCheckInUTCDates 回滚 migrateCheckInLocalDates，打卡日期恢复为 UTC 日期
+func restoreCheckInUTCDates(ctx context.Context, conn *sql.Conn) error {
+	return rewriteCheckInDates(ctx, conn, toUTCCheckInDate)
+}
+
+// toLocalCheckInDate 尚未迁移的记录按用户当前时区计算本地日期
+func toLocalCheckInDate(c *checkInLocalDate) {
+	if c.timezone != "" {
+		return
+	}
+	loc, err := time.LoadLocation(c.userTimezone)
+	if err != nil || c.userTimezone == "" {
+		loc = time.UTC
+	}
+	c.date = c.datetime.In(loc).Format("2006-01-02")
+	c.timezone = loc.String()
+}
+
+// toUTCCheckInDate 恢复为按 UTC 日期记录
+func toUTCCheckInDate(c *checkInLocalDate) {
+	c.date = c.datetime.UTC().Format("2006-01-02")
+	c.timezone = ""
+}
+
+// checkInLocalDate 重新计算日期的打卡记录
+type checkInLocalDate struct {
+	id           int64
+	userID       int64
+	datetime     time.Time
+	date         string // checkin_date，yyyy-MM-dd
+	timezone     string // 打卡记录的时区，为空表示尚未迁移
+	userTimezone string
+	dailyDate    string // daily_date，为空时保存为 NULL
+}
+
+// rewriteCheckInDates 用 update 重新计算每条打卡记录的日期，再按新的日期分配 daily_date
+// 期间先去掉 checkin_date 和 daily_date 上的唯一键，不删除任何打卡记录
+func rewriteCheckInDates(ctx context.Context, conn *sql.Conn, update func(c *checkInLocalDate)) error {
+	for _, index := range []string{"user_date", "user_daily_date"} {
+		exists, err := indexExists(ctx, conn, "checkins", index)
+		if err != nil {
+			return err
+		}
+		if exists {
+			if _, err := conn.ExecContext(ctx, `ALTER TABLE checkins DROP INDEX `+index); err != nil {
+				return err
+			}
+		}
+	}
+
+	rows, err := conn.QueryContext(ctx, `
+		SELECT c.id, c.user_id, c.checkin_datetime, c.checkin_date, c.timezone, u.timezone
+		FROM checkins c JOIN users u ON u.id = c.user_id
+	`)
+	if err != nil {
+		return err
+	}
+
+	var checkIns []*checkInLocalDate
+	for rows.Next() {
+		var c checkInLocalDate
+		var date time.Time
+		var timezone, userTimezone sql.NullString
+		if err := rows.Scan(&c.id, &c.userID, &c.datetime, &date, &timezone, &userTimezone); err != nil {
+			rows.Close()
+			return err
+		}
+		c.date = date.Format("2006-01-02")
+		c.timezone = timezone.String
+		c.userTimezone = userTimezone.String
+		update(&c)
+		checkIns = append(checkIns, &c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	duplicates := assignDailyDates(checkIns)
+	for _, c := range checkIns {
+		if _, err := conn.ExecContext(ctx, `
+			UPDATE checkins SET checkin_date = ?, timezone = ?, daily_date = ? WHERE id = ?
+		`, c.date, nullIfEmpty(c.timezone), nullIfEmpty(c.dailyDate), c.id); err != nil {
+			return err
+		}
+	}
+	if duplicates > 0 {
+		log.Printf("Kept %d checkins that share a date with an earlier checkin", duplicates)
+	}
+
+	if _, err := conn.ExecContext(ctx, `ALTER TABLE checkins ADD UNIQUE KEY user_daily_date (user_id, daily_date)`); err != nil {
+		return err
+	}
+	log.Printf("Rewrote dates for %d checkins", len(checkIns))
+	return nil
+}
+
+// assignDailyDates 同一用户同一日期最早的一条记录占用 daily_date，其余记录的 daily_date 为空，返回这些记录的数量
+func assignDailyDates(checkIns []*checkInLocalDate) int {
+	sorted := append([]*checkInLocalDate(nil), checkIns...)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.userID != b.userID {
+			return a.userID < b.userID
+		}
+		if a.date != b.date {
+			return a.date < b.date
+		}
+		if !a.datetime.Equal(b.datetime) {
+			return a.datetime.Before(b.datetime)
+		}
+		return a.id < b.id
+	})
+
+	duplicates := 0
+	for i, c := range sorted {
+		if i > 0 && sorted[i-1].userID == c.userID && sorted[i-1].date == c.date {
+			c.dailyDate = ""
+			duplicates++
+			continue
+		}
+		c.dailyDate = c.date
+	}
+	return duplicates
+}
+
+// nullIfEmpty 空字符串保存为 NULL
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// 以下为各表创建时的结构，之后的修改通过新的迁移版本完成
+
+const createUsersTable = `
+CREATE TABLE IF NOT EXISTS users (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    device_id VARCHAR(255) UNIQUE NOT NULL,
+    name VARCHAR(100) DEFAULT '',
+    emergency_contact_emails JSON,
+    apns_token TEXT,
+    push_enabled BOOLEAN DEFAULT TRUE,
+    email_enabled BOOLEAN DEFAULT TRUE,
+    timezone VARCHAR(50) DEFAULT 'UTC',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_device_id (device_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+`
+
+const createCheckInsTable = `
+CREATE TABLE IF NOT EXISTS checkins (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    checkin_datetime DATETIME NOT NULL,
+    checkin_date DATE GENERATED ALWAYS AS (DATE(checkin_datetime)) STORED,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY user_date (user_id, checkin_date)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+`
+
+const createNotificationsTable = `
+CREATE TABLE IF NOT EXISTS notifications (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    notification_type ENUM('email', 'sms', 'push') NOT NULL,
+    recipient VARCHAR(255) NOT NULL,
+    status ENUM('pending', 'sending', 'sent', 'failed', 'retrying') NOT NULL DEFAULT 'pending',
+    retry_count INT DEFAULT 0,
+    max_retries INT DEFAULT 3,
+    scheduled_at TIMESTAMP NOT NULL,
+    sent_at TIMESTAMP NULL,
+    failed_at TIMESTAMP NULL,
+    error_message TEXT,
+    content JSON,
+    timezone VARCHAR(50),
+    unique_key VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user_status (user_id, status),
+    INDEX idx_scheduled_status (scheduled_at, status),
+    INDEX idx_unique_key (unique_key)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+`
+
+const createTokensTable = `
+CREATE TABLE IF NOT EXISTS tokens (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    device_id VARCHAR(255) NOT NULL,
+    access_token VARCHAR(255) UNIQUE NOT NULL,
+    refresh_token VARCHAR(255) UNIQUE NOT NULL,
+    token_type VARCHAR(20) DEFAULT 'Bearer',
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_access_token (access_token),
+    INDEX idx_refresh_token (refresh_token),
+    INDEX idx_user_device (user_id, device_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+`
+
+const createEscalationPoliciesTable = `
+CREATE TABLE IF NOT EXISTS escalation_policies (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNIQUE NOT NULL,
+    steps JSON NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+`
+
+const createEmergencyContactsTable = `
+CREATE TABLE IF NOT EXISTS emergency_contacts (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    name VARCHAR(100) DEFAULT '',
+    email VARCHAR(255) NOT NULL,
+    phone VARCHAR(32) DEFAULT '',
+    relationship VARCHAR(50) DEFAULT '',
+    language VARCHAR(10) DEFAULT 'zh',
+    verified_at TIMESTAMP NULL,
+    opted_out_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY user_email (user_id, email)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+`
+
+const createCheckInLinksTable = `
+CREATE TABLE IF NOT EXISTS checkin_links (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+`
+
+const createIncidentsTable = `
+CREATE TABLE IF NOT EXISTS incidents (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    status ENUM('open', 'acknowledged', 'resolved') NOT NULL DEFAULT 'open',
+    last_checkin_at DATETIME NULL,
+    opened_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    acknowledged_by BIGINT NULL,
+    acknowledged_at TIMESTAMP NULL,
+    paused_until TIMESTAMP NULL,
+    resolved_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (acknowledged_by) REFERENCES emergency_contacts(id) ON DELETE SET NULL,
+    INDEX idx_user_status (user_id, status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+`
+
+const createIncidentContactsTable = `
+CREATE TABLE IF NOT EXISTS incident_contacts (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    incident_id BIGINT NOT NULL,
+    contact_id BIGINT NOT NULL,
+    first_alerted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_alerted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    acknowledged_at TIMESTAMP NULL,
+    FOREIGN KEY (incident_id) REFERENCES incidents(id) ON DELETE CASCADE,
+    FOREIGN KEY (contact_id) REFERENCES emergency_contacts(id) ON DELETE CASCADE,
+    UNIQUE KEY incident_contact (incident_id, contact_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+`
+
+const createSecurityEventsTable = `
+CREATE TABLE IF NOT EXISTS security_events (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    device_id VARCHAR(255) DEFAULT '',
+    ip_address VARCHAR(64) DEFAULT '',
+    user_agent VARCHAR(255) DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user_created (user_id, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+`
+
+const createUserDevicesTable = `
+CREATE TABLE IF NOT EXISTS user_devices (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    device_id VARCHAR(255) UNIQUE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+`
+
+const createAuthCodesTable = `
+CREATE TABLE IF NOT EXISTS auth_codes (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    purpose VARCHAR(32) NOT NULL,
+    code_hash VARCHAR(64) NULL UNIQUE,
+    email VARCHAR(255) NULL,
+    device_id VARCHAR(255) NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user_purpose (user_id, purpose),
+    INDEX idx_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+`
+
+const createRateLimitBucketsTable = `
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    bucket_key VARCHAR(128) NOT NULL PRIMARY KEY,
+    tokens DOUBLE NOT NULL,
+    version BIGINT NOT NULL DEFAULT 0,
+    updated_ms BIGINT NOT NULL,
+    full_at_ms BIGINT NOT NULL,
+    INDEX idx_full_at (full_at_ms)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+`
+
+const createUserPausesTable = `
+CREATE TABLE IF NOT EXISTS user_pauses (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    reason VARCHAR(255) DEFAULT '',
+    notify_contacts BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user_ends_at (user_id, ends_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+`
+
+const createWebhooksTable = `
+CREATE TABLE IF NOT EXISTS webhooks (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    contact_id BIGINT NULL,
+    url VARCHAR(255) NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    events JSON,
+    enabled BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (contact_id) REFERENCES emergency_contacts(id) ON DELETE CASCADE,
+    INDEX idx_user_contact (user_id, contact_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+`
+
+const createCheckInStatsTable = `
+CREATE TABLE IF NOT EXISTS checkin_stats (
+    user_id BIGINT PRIMARY KEY,
+    last_checkin_id BIGINT NOT NULL,
+    last_checkin_at TIMESTAMP NOT NULL,
+    last_checkin_date VARCHAR(10) NOT NULL,
+    streak_length INT NOT NULL DEFAULT 0,
+    longest_streak INT NOT NULL DEFAULT 0,
+    time_sin DOUBLE NOT NULL DEFAULT 0,
+    time_cos DOUBLE NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+`
+
+const createContactOptOutsTable = `
+CREATE TABLE IF NOT EXISTS contact_opt_outs (
+    user_id BIGINT NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    opted_out_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, email),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+`
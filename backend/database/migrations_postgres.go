@@ -0,0 +1,507 @@
+package database
+
+// postgresMigrations PostgreSQL 数据库迁移
+// 支持 PostgreSQL 时 MySQL 的结构已迁移到版本 10，新数据库直接从该版本的完整结构开始
+var postgresMigrations = []Migration{
+	{
+		Version: 10,
+		Name:    "initial_schema",
+		Up: []Step{
+			execSQL(postgresCreateUsersTable),
+			execSQL(postgresCreateCheckInsTable),
+			execSQL(postgresCreateNotificationsTable),
+			execSQL(`CREATE INDEX idx_notifications_user_status ON notifications (user_id, status)`),
+			execSQL(`CREATE INDEX idx_notifications_scheduled_status ON notifications (scheduled_at, status)`),
+			execSQL(`CREATE INDEX idx_notifications_unique_key ON notifications (unique_key)`),
+			execSQL(postgresCreateTokensTable),
+			execSQL(`CREATE INDEX idx_tokens_user_device ON tokens (user_id, device_id)`),
+			execSQL(postgresCreateEscalationPoliciesTable),
+			execSQL(postgresCreateEmergencyContactsTable),
+			execSQL(postgresCreateCheckInLinksTable),
+			execSQL(`CREATE INDEX idx_checkin_links_expires_at ON checkin_links (expires_at)`),
+			execSQL(postgresCreateIncidentsTable),
+			execSQL(`CREATE INDEX idx_incidents_user_status ON incidents (user_id, status)`),
+			execSQL(postgresCreateIncidentContactsTable),
+			execSQL(postgresCreateWebhooksTable),
+			execSQL(`CREATE INDEX idx_webhooks_user_contact ON webhooks (user_id, contact_id)`),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS webhooks`),
+			execSQL(`DROP TABLE IF EXISTS incident_contacts`),
+			execSQL(`DROP TABLE IF EXISTS incidents`),
+			execSQL(`DROP TABLE IF EXISTS checkin_links`),
+			execSQL(`DROP TABLE IF EXISTS emergency_contacts`),
+			execSQL(`DROP TABLE IF EXISTS escalation_policies`),
+			execSQL(`DROP TABLE IF EXISTS tokens`),
+			execSQL(`DROP TABLE IF EXISTS notifications`),
+			execSQL(`DROP TABLE IF EXISTS checkins`),
+			execSQL(`DROP TABLE IF EXISTS users`),
+		},
+	},
+	{
+		Version: 11,
+		Name:    "hash_tokens",
+		Up: []Step{
+			execSQL(`ALTER TABLE tokens ADD COLUMN IF NOT EXISTS refresh_expires_at TIMESTAMP NULL`),
+			dataMigration("hash_existing_tokens", hashExistingTokens(postgresDialect{})),
+		},
+		Down: []Step{
+			execSQL(`DELETE FROM tokens`),
+			execSQL(`ALTER TABLE tokens DROP COLUMN IF EXISTS refresh_expires_at`),
+		},
+	},
+	{
+		Version: 12,
+		Name:    "token_families",
+		Up: []Step{
+			execSQL(`ALTER TABLE tokens ADD COLUMN IF NOT EXISTS family_id VARCHAR(64) NULL`),
+			execSQL(`ALTER TABLE tokens ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMP NULL`),
+			execSQL(`UPDATE tokens SET family_id = 'legacy-' || id WHERE family_id IS NULL`),
+			execSQL(`CREATE INDEX IF NOT EXISTS idx_tokens_family_id ON tokens (family_id)`),
+			execSQL(postgresCreateSecurityEventsTable),
+			execSQL(`CREATE INDEX IF NOT EXISTS idx_security_events_user_created ON security_events (user_id, created_at)`),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS security_events`),
+			execSQL(`DELETE FROM tokens WHERE rotated_at IS NOT NULL`),
+			execSQL(`DROP INDEX IF EXISTS idx_tokens_family_id`),
+			execSQL(`ALTER TABLE tokens DROP COLUMN IF EXISTS rotated_at`),
+			execSQL(`ALTER TABLE tokens DROP COLUMN IF EXISTS family_id`),
+		},
+	},
+	{
+		Version: 13,
+		Name:    "token_sessions",
+		Up: []Step{
+			execSQL(`ALTER TABLE tokens ADD COLUMN IF NOT EXISTS signed_in_at TIMESTAMP NULL`),
+			execSQL(`ALTER TABLE tokens ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP NULL`),
+			execSQL(`ALTER TABLE tokens ADD COLUMN IF NOT EXISTS ip_address VARCHAR(64) DEFAULT ''`),
+			execSQL(`ALTER TABLE tokens ADD COLUMN IF NOT EXISTS user_agent VARCHAR(255) DEFAULT ''`),
+			execSQL(`UPDATE tokens SET signed_in_at = created_at WHERE signed_in_at IS NULL`),
+		},
+		Down: []Step{
+			execSQL(`ALTER TABLE tokens DROP COLUMN IF EXISTS user_agent`),
+			execSQL(`ALTER TABLE tokens DROP COLUMN IF EXISTS ip_address`),
+			execSQL(`ALTER TABLE tokens DROP COLUMN IF EXISTS last_used_at`),
+			execSQL(`ALTER TABLE tokens DROP COLUMN IF EXISTS signed_in_at`),
+		},
+	},
+	{
+		Version: 14,
+		Name:    "account_recovery",
+		Up: []Step{
+			execSQL(postgresCreateUserDevicesTable),
+			execSQL(`CREATE INDEX IF NOT EXISTS idx_user_devices_user_id ON user_devices (user_id)`),
+			execSQL(`
+				INSERT INTO user_devices (user_id, device_id, created_at)
+				SELECT id, device_id, created_at FROM users u
+				WHERE NOT EXISTS (SELECT 1 FROM user_devices d WHERE d.device_id = u.device_id)
+			`),
+			execSQL(`ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP NULL`),
+			execSQL(postgresCreateAuthCodesTable),
+			execSQL(`CREATE INDEX IF NOT EXISTS idx_auth_codes_user_purpose ON auth_codes (user_id, purpose)`),
+			execSQL(`CREATE INDEX IF NOT EXISTS idx_auth_codes_expires_at ON auth_codes (expires_at)`),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS auth_codes`),
+			execSQL(`ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at`),
+			execSQL(`DROP TABLE IF EXISTS user_devices`),
+		},
+	},
+	{
+		Version: 15,
+		Name:    "apple_sign_in",
+		Up: []Step{
+			execSQL(`ALTER TABLE users ADD COLUMN IF NOT EXISTS apple_sub VARCHAR(255) NULL`),
+			execSQL(`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_apple_sub ON users (apple_sub)`),
+		},
+		Down: []Step{
+			execSQL(`DROP INDEX IF EXISTS idx_users_apple_sub`),
+			execSQL(`ALTER TABLE users DROP COLUMN IF EXISTS apple_sub`),
+		},
+	},
+	{
+		Version: 16,
+		Name:    "account_deletion",
+		Up: []Step{
+			execSQL(`ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_at TIMESTAMP NULL`),
+		},
+		Down: []Step{
+			execSQL(`ALTER TABLE users DROP COLUMN IF EXISTS deletion_scheduled_at`),
+		},
+	},
+	{
+		Version: 17,
+		Name:    "rate_limit_buckets",
+		Up: []Step{
+			execSQL(postgresCreateRateLimitBucketsTable),
+			execSQL(`CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_full_at ON rate_limit_buckets (full_at_ms)`),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS rate_limit_buckets`),
+		},
+	},
+	{
+		Version: 18,
+		Name:    "user_pauses",
+		Up: []Step{
+			execSQL(postgresCreateUserPausesTable),
+			execSQL(`CREATE INDEX IF NOT EXISTS idx_user_pauses_user_ends_at ON user_pauses (user_id, ends_at)`),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS user_pauses`),
+		},
+	},
+	{
+		Version: 19,
+		Name:    "checkin_cadence",
+		Up: []Step{
+			execSQL(`ALTER TABLE users ADD COLUMN IF NOT EXISTS checkin_interval_minutes INTEGER NOT NULL DEFAULT 0`),
+			execSQL(`ALTER TABLE checkins ADD COLUMN IF NOT EXISTS daily_date DATE NULL`),
+			execSQL(`UPDATE checkins SET daily_date = checkin_date WHERE daily_date IS NULL`),
+			execSQL(`CREATE UNIQUE INDEX IF NOT EXISTS idx_checkins_user_daily_date ON checkins (user_id, daily_date)`),
+			execSQL(`CREATE INDEX IF NOT EXISTS idx_checkins_user_date ON checkins (user_id, checkin_date)`),
+			execSQL(`ALTER TABLE checkins DROP CONSTRAINT IF EXISTS user_date`),
+		},
+		Down: []Step{
+			// 同一本地日期只保留最早的一条
+			execSQL(`
+				DELETE FROM checkins c1 USING checkins c2
+				WHERE c1.user_id = c2.user_id AND c1.checkin_date = c2.checkin_date
+				  AND (c1.checkin_datetime > c2.checkin_datetime OR (c1.checkin_datetime = c2.checkin_datetime AND c1.id > c2.id))
+			`),
+			execSQL(`ALTER TABLE checkins ADD CONSTRAINT user_date UNIQUE (user_id, checkin_date)`),
+			execSQL(`DROP INDEX IF EXISTS idx_checkins_user_date`),
+			execSQL(`DROP INDEX IF EXISTS idx_checkins_user_daily_date`),
+			execSQL(`ALTER TABLE checkins DROP COLUMN IF EXISTS daily_date`),
+			execSQL(`ALTER TABLE users DROP COLUMN IF EXISTS checkin_interval_minutes`),
+		},
+	},
+	{
+		Version: 20,
+		Name:    "checkin_deadline",
+		Up: []Step{
+			execSQL(`ALTER TABLE users ADD COLUMN IF NOT EXISTS checkin_deadline VARCHAR(5) NULL`),
+			execSQL(`ALTER TABLE users ADD COLUMN IF NOT EXISTS checkin_grace_minutes INTEGER NOT NULL DEFAULT 0`),
+		},
+		Down: []Step{
+			execSQL(`ALTER TABLE users DROP COLUMN IF EXISTS checkin_grace_minutes`),
+			execSQL(`ALTER TABLE users DROP COLUMN IF EXISTS checkin_deadline`),
+		},
+	},
+	{
+		Version: 21,
+		Name:    "checkin_details",
+		Up: []Step{
+			execSQL(`ALTER TABLE checkins ADD COLUMN IF NOT EXISTS mood SMALLINT NULL`),
+			execSQL(`ALTER TABLE checkins ADD COLUMN IF NOT EXISTS note VARCHAR(280) NULL`),
+			execSQL(`ALTER TABLE checkins ADD COLUMN IF NOT EXISTS battery_level SMALLINT NULL`),
+			execSQL(`ALTER TABLE checkins ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION NULL`),
+			execSQL(`ALTER TABLE checkins ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION NULL`),
+			execSQL(`ALTER TABLE users ADD COLUMN IF NOT EXISTS share_mood BOOLEAN NOT NULL DEFAULT FALSE`),
+			execSQL(`ALTER TABLE users ADD COLUMN IF NOT EXISTS share_note BOOLEAN NOT NULL DEFAULT FALSE`),
+			execSQL(`ALTER TABLE users ADD COLUMN IF NOT EXISTS share_battery BOOLEAN NOT NULL DEFAULT FALSE`),
+			execSQL(`ALTER TABLE users ADD COLUMN IF NOT EXISTS share_location BOOLEAN NOT NULL DEFAULT FALSE`),
+		},
+		Down: []Step{
+			execSQL(`ALTER TABLE users DROP COLUMN IF EXISTS share_location`),
+			execSQL(`ALTER TABLE users DROP COLUMN IF EXISTS share_battery`),
+			execSQL(`ALTER TABLE users DROP COLUMN IF EXISTS share_note`),
+			execSQL(`ALTER TABLE users DROP COLUMN IF EXISTS share_mood`),
+			execSQL(`ALTER TABLE checkins DROP COLUMN IF EXISTS longitude`),
+			execSQL(`ALTER TABLE checkins DROP COLUMN IF EXISTS latitude`),
+			execSQL(`ALTER TABLE checkins DROP COLUMN IF EXISTS battery_level`),
+			execSQL(`ALTER TABLE checkins DROP COLUMN IF EXISTS note`),
+			execSQL(`ALTER TABLE checkins DROP COLUMN IF EXISTS mood`),
+		},
+	},
+	{
+		Version: 22,
+		Name:    "checkin_time_audit",
+		Up: []Step{
+			execSQL(`ALTER TABLE checkins ADD COLUMN IF NOT EXISTS source VARCHAR(16) NULL`),
+			execSQL(`ALTER TABLE checkins ADD COLUMN IF NOT EXISTS received_at TIMESTAMP NULL`),
+			execSQL(`ALTER TABLE checkins ADD COLUMN IF NOT EXISTS client_datetime TIMESTAMP NULL`),
+		},
+		Down: []Step{
+			execSQL(`ALTER TABLE checkins DROP COLUMN IF EXISTS client_datetime`),
+			execSQL(`ALTER TABLE checkins DROP COLUMN IF EXISTS received_at`),
+			execSQL(`ALTER TABLE checkins DROP COLUMN IF EXISTS source`),
+		},
+	},
+	{
+		Version: 23,
+		Name:    "notification_claims",
+		Up: []Step{
+			execSQL(`ALTER TABLE notifications ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMP NULL`),
+		},
+		Down: []Step{
+			execSQL(`ALTER TABLE notifications DROP COLUMN IF EXISTS claimed_at`),
+		},
+	},
+	{
+		Version: 24,
+		Name:    "auth_code_discard_previous",
+		Up: []Step{
+			execSQL(`ALTER TABLE auth_codes ADD COLUMN IF NOT EXISTS discard_previous BOOLEAN NOT NULL DEFAULT FALSE`),
+		},
+		Down: []Step{
+			execSQL(`ALTER TABLE auth_codes DROP COLUMN IF EXISTS discard_previous`),
+		},
+	},
+	{
+		Version: 25,
+		Name:    "checkin_stats",
+		Up: []Step{
+			execSQL(postgresCreateCheckInStatsTable),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS checkin_stats`),
+		},
+	},
+	{
+		Version: 26,
+		Name:    "contact_opt_outs",
+		Up: []Step{
+			execSQL(`ALTER TABLE emergency_contacts ADD COLUMN IF NOT EXISTS confirmation_sent_at TIMESTAMP NULL`),
+			execSQL(`ALTER TABLE emergency_contacts ADD COLUMN IF NOT EXISTS confirmation_count INTEGER NOT NULL DEFAULT 0`),
+			execSQL(postgresCreateContactOptOutsTable),
+			execSQL(`
+				INSERT INTO contact_opt_outs (user_id, email, opted_out_at)
+				SELECT user_id, LOWER(email), opted_out_at FROM emergency_contacts WHERE opted_out_at IS NOT NULL
+				ON CONFLICT DO NOTHING
+			`),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS contact_opt_outs`),
+			execSQL(`ALTER TABLE emergency_contacts DROP COLUMN IF EXISTS confirmation_count`),
+			execSQL(`ALTER TABLE emergency_contacts DROP COLUMN IF EXISTS confirmation_sent_at`),
+		},
+	},
+}
+
+const postgresCreateUsersTable = `
+CREATE TABLE users (
+    id BIGSERIAL PRIMARY KEY,
+    device_id VARCHAR(255) UNIQUE NOT NULL,
+    name VARCHAR(100) DEFAULT '',
+    email VARCHAR(255) DEFAULT '',
+    phone VARCHAR(32) DEFAULT '',
+    apns_token TEXT,
+    push_enabled BOOLEAN DEFAULT TRUE,
+    email_enabled BOOLEAN DEFAULT TRUE,
+    timezone VARCHAR(50) DEFAULT 'UTC',
+    reminder_times JSONB,
+    reminder_days JSONB,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const postgresCreateCheckInsTable = `
+CREATE TABLE checkins (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    checkin_datetime TIMESTAMP NOT NULL,
+    checkin_date DATE NOT NULL,
+    timezone VARCHAR(50),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT user_date UNIQUE (user_id, checkin_date)
+)
+`
+
+const postgresCreateNotificationsTable = `
+CREATE TABLE notifications (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    notification_type VARCHAR(32) NOT NULL,
+    recipient VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    retry_count INT DEFAULT 0,
+    max_retries INT DEFAULT 3,
+    scheduled_at TIMESTAMP NOT NULL,
+    sent_at TIMESTAMP NULL,
+    failed_at TIMESTAMP NULL,
+    error_message TEXT,
+    response_status INT NULL,
+    content JSONB,
+    timezone VARCHAR(50),
+    unique_key VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const postgresCreateTokensTable = `
+CREATE TABLE tokens (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id VARCHAR(255) NOT NULL,
+    access_token VARCHAR(255) UNIQUE NOT NULL,
+    refresh_token VARCHAR(255) UNIQUE NOT NULL,
+    token_type VARCHAR(20) DEFAULT 'Bearer',
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const postgresCreateEscalationPoliciesTable = `
+CREATE TABLE escalation_policies (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT UNIQUE NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    steps JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const postgresCreateEmergencyContactsTable = `
+CREATE TABLE emergency_contacts (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) DEFAULT '',
+    email VARCHAR(255) NOT NULL,
+    phone VARCHAR(32) DEFAULT '',
+    relationship VARCHAR(50) DEFAULT '',
+    language VARCHAR(10) DEFAULT 'zh',
+    verified_at TIMESTAMP NULL,
+    opted_out_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT user_email UNIQUE (user_id, email)
+)
+`
+
+const postgresCreateCheckInLinksTable = `
+CREATE TABLE checkin_links (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const postgresCreateIncidentsTable = `
+CREATE TABLE incidents (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'open',
+    last_checkin_at TIMESTAMP NULL,
+    opened_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    acknowledged_by BIGINT NULL REFERENCES emergency_contacts(id) ON DELETE SET NULL,
+    acknowledged_at TIMESTAMP NULL,
+    paused_until TIMESTAMP NULL,
+    resolved_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const postgresCreateIncidentContactsTable = `
+CREATE TABLE incident_contacts (
+    id BIGSERIAL PRIMARY KEY,
+    incident_id BIGINT NOT NULL REFERENCES incidents(id) ON DELETE CASCADE,
+    contact_id BIGINT NOT NULL REFERENCES emergency_contacts(id) ON DELETE CASCADE,
+    first_alerted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_alerted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    acknowledged_at TIMESTAMP NULL,
+    CONSTRAINT incident_contact UNIQUE (incident_id, contact_id)
+)
+`
+
+const postgresCreateSecurityEventsTable = `
+CREATE TABLE IF NOT EXISTS security_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event_type VARCHAR(50) NOT NULL,
+    device_id VARCHAR(255) DEFAULT '',
+    ip_address VARCHAR(64) DEFAULT '',
+    user_agent VARCHAR(255) DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const postgresCreateUserDevicesTable = `
+CREATE TABLE IF NOT EXISTS user_devices (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id VARCHAR(255) UNIQUE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const postgresCreateAuthCodesTable = `
+CREATE TABLE IF NOT EXISTS auth_codes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(32) NOT NULL,
+    code_hash VARCHAR(64) NULL UNIQUE,
+    email VARCHAR(255) NULL,
+    device_id VARCHAR(255) NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const postgresCreateRateLimitBucketsTable = `
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    bucket_key VARCHAR(128) NOT NULL PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    version BIGINT NOT NULL DEFAULT 0,
+    updated_ms BIGINT NOT NULL,
+    full_at_ms BIGINT NOT NULL
+)
+`
+
+const postgresCreateUserPausesTable = `
+CREATE TABLE IF NOT EXISTS user_pauses (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    reason VARCHAR(255) DEFAULT '',
+    notify_contacts BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const postgresCreateWebhooksTable = `
+CREATE TABLE webhooks (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    contact_id BIGINT NULL REFERENCES emergency_contacts(id) ON DELETE CASCADE,
+    url VARCHAR(255) NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    events JSONB,
+    enabled BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const postgresCreateCheckInStatsTable = `
+CREATE TABLE IF NOT EXISTS checkin_stats (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    last_checkin_id BIGINT NOT NULL,
+    last_checkin_at TIMESTAMP NOT NULL,
+    last_checkin_date VARCHAR(10) NOT NULL,
+    streak_length INTEGER NOT NULL DEFAULT 0,
+    longest_streak INTEGER NOT NULL DEFAULT 0,
+    time_sin DOUBLE PRECISION NOT NULL DEFAULT 0,
+    time_cos DOUBLE PRECISION NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const postgresCreateContactOptOutsTable = `
+CREATE TABLE IF NOT EXISTS contact_opt_outs (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    opted_out_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, email)
+)
+`
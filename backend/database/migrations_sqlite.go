@@ -0,0 +1,528 @@
+package database
+
+// sqliteMigrations SQLite 数据库迁移
+// 支持 SQLite 时 MySQL 的结构已迁移到版本 10，新数据库直接从该版本的完整结构开始
+// 时间按 UTC 以文本存储，JSON 字段使用 TEXT
+var sqliteMigrations = []Migration{
+	{
+		Version: 10,
+		Name:    "initial_schema",
+		Up: []Step{
+			execSQL(sqliteCreateUsersTable),
+			execSQL(sqliteCreateCheckInsTable),
+			execSQL(sqliteCreateNotificationsTable),
+			execSQL(`CREATE INDEX idx_notifications_user_status ON notifications (user_id, status)`),
+			execSQL(`CREATE INDEX idx_notifications_scheduled_status ON notifications (scheduled_at, status)`),
+			execSQL(`CREATE INDEX idx_notifications_unique_key ON notifications (unique_key)`),
+			execSQL(sqliteCreateTokensTable),
+			execSQL(`CREATE INDEX idx_tokens_user_device ON tokens (user_id, device_id)`),
+			execSQL(sqliteCreateEscalationPoliciesTable),
+			execSQL(sqliteCreateEmergencyContactsTable),
+			execSQL(sqliteCreateCheckInLinksTable),
+			execSQL(`CREATE INDEX idx_checkin_links_expires_at ON checkin_links (expires_at)`),
+			execSQL(sqliteCreateIncidentsTable),
+			execSQL(`CREATE INDEX idx_incidents_user_status ON incidents (user_id, status)`),
+			execSQL(sqliteCreateIncidentContactsTable),
+			execSQL(sqliteCreateWebhooksTable),
+			execSQL(`CREATE INDEX idx_webhooks_user_contact ON webhooks (user_id, contact_id)`),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS webhooks`),
+			execSQL(`DROP TABLE IF EXISTS incident_contacts`),
+			execSQL(`DROP TABLE IF EXISTS incidents`),
+			execSQL(`DROP TABLE IF EXISTS checkin_links`),
+			execSQL(`DROP TABLE IF EXISTS emergency_contacts`),
+			execSQL(`DROP TABLE IF EXISTS escalation_policies`),
+			execSQL(`DROP TABLE IF EXISTS tokens`),
+			execSQL(`DROP TABLE IF EXISTS notifications`),
+			execSQL(`DROP TABLE IF EXISTS checkins`),
+			execSQL(`DROP TABLE IF EXISTS users`),
+		},
+	},
+	{
+		Version: 11,
+		Name:    "hash_tokens",
+		Up: []Step{
+			execSQL(`ALTER TABLE tokens ADD COLUMN refresh_expires_at TIMESTAMP NULL`),
+			dataMigration("hash_existing_tokens", hashExistingTokens(sqliteDialect{})),
+		},
+		Down: []Step{
+			execSQL(`DELETE FROM tokens`),
+			execSQL(`ALTER TABLE tokens DROP COLUMN refresh_expires_at`),
+		},
+	},
+	{
+		Version: 12,
+		Name:    "token_families",
+		Up: []Step{
+			execSQL(`ALTER TABLE tokens ADD COLUMN family_id TEXT NULL`),
+			execSQL(`ALTER TABLE tokens ADD COLUMN rotated_at TIMESTAMP NULL`),
+			execSQL(`UPDATE tokens SET family_id = 'legacy-' || id WHERE family_id IS NULL`),
+			execSQL(`CREATE INDEX idx_tokens_family_id ON tokens (family_id)`),
+			execSQL(sqliteCreateSecurityEventsTable),
+			execSQL(`CREATE INDEX idx_security_events_user_created ON security_events (user_id, created_at)`),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS security_events`),
+			execSQL(`DELETE FROM tokens WHERE rotated_at IS NOT NULL`),
+			execSQL(`DROP INDEX IF EXISTS idx_tokens_family_id`),
+			execSQL(`ALTER TABLE tokens DROP COLUMN rotated_at`),
+			execSQL(`ALTER TABLE tokens DROP COLUMN family_id`),
+		},
+	},
+	{
+		Version: 13,
+		Name:    "token_sessions",
+		Up: []Step{
+			execSQL(`ALTER TABLE tokens ADD COLUMN signed_in_at TIMESTAMP NULL`),
+			execSQL(`ALTER TABLE tokens ADD COLUMN last_used_at TIMESTAMP NULL`),
+			execSQL(`ALTER TABLE tokens ADD COLUMN ip_address TEXT DEFAULT ''`),
+			execSQL(`ALTER TABLE tokens ADD COLUMN user_agent TEXT DEFAULT ''`),
+			execSQL(`UPDATE tokens SET signed_in_at = created_at WHERE signed_in_at IS NULL`),
+		},
+		Down: []Step{
+			execSQL(`ALTER TABLE tokens DROP COLUMN user_agent`),
+			execSQL(`ALTER TABLE tokens DROP COLUMN ip_address`),
+			execSQL(`ALTER TABLE tokens DROP COLUMN last_used_at`),
+			execSQL(`ALTER TABLE tokens DROP COLUMN signed_in_at`),
+		},
+	},
+	{
+		Version: 14,
+		Name:    "account_recovery",
+		Up: []Step{
+			execSQL(sqliteCreateUserDevicesTable),
+			execSQL(`CREATE INDEX idx_user_devices_user_id ON user_devices (user_id)`),
+			execSQL(`
+				INSERT INTO user_devices (user_id, device_id, created_at)
+				SELECT id, device_id, created_at FROM users u
+				WHERE NOT EXISTS (SELECT 1 FROM user_devices d WHERE d.device_id = u.device_id)
+			`),
+			execSQL(`ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP NULL`),
+			execSQL(sqliteCreateAuthCodesTable),
+			execSQL(`CREATE INDEX idx_auth_codes_user_purpose ON auth_codes (user_id, purpose)`),
+			execSQL(`CREATE INDEX idx_auth_codes_expires_at ON auth_codes (expires_at)`),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS auth_codes`),
+			execSQL(`ALTER TABLE users DROP COLUMN email_verified_at`),
+			execSQL(`DROP TABLE IF EXISTS user_devices`),
+		},
+	},
+	{
+		Version: 15,
+		Name:    "apple_sign_in",
+		Up: []Step{
+			execSQL(`ALTER TABLE users ADD COLUMN apple_sub TEXT NULL`),
+			execSQL(`CREATE UNIQUE INDEX idx_users_apple_sub ON users (apple_sub)`),
+		},
+		Down: []Step{
+			execSQL(`DROP INDEX IF EXISTS idx_users_apple_sub`),
+			execSQL(`ALTER TABLE users DROP COLUMN apple_sub`),
+		},
+	},
+	{
+		Version: 16,
+		Name:    "account_deletion",
+		Up: []Step{
+			execSQL(`ALTER TABLE users ADD COLUMN deletion_scheduled_at TIMESTAMP NULL`),
+		},
+		Down: []Step{
+			execSQL(`ALTER TABLE users DROP COLUMN deletion_scheduled_at`),
+		},
+	},
+	{
+		Version: 17,
+		Name:    "rate_limit_buckets",
+		Up: []Step{
+			execSQL(sqliteCreateRateLimitBucketsTable),
+			execSQL(`CREATE INDEX idx_rate_limit_buckets_full_at ON rate_limit_buckets (full_at_ms)`),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS rate_limit_buckets`),
+		},
+	},
+	{
+		Version: 18,
+		Name:    "user_pauses",
+		Up: []Step{
+			execSQL(sqliteCreateUserPausesTable),
+			execSQL(`CREATE INDEX idx_user_pauses_user_ends_at ON user_pauses (user_id, ends_at)`),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS user_pauses`),
+		},
+	},
+	{
+		// SQLite 不能删除表上的唯一约束，重建 checkins 表
+		Version: 19,
+		Name:    "checkin_cadence",
+		Up: []Step{
+			execSQL(`ALTER TABLE users ADD COLUMN checkin_interval_minutes INTEGER NOT NULL DEFAULT 0`),
+			execSQL(`ALTER TABLE checkins RENAME TO checkins_daily`),
+			execSQL(sqliteCreateCheckInsCadenceTable),
+			execSQL(`
+				INSERT INTO checkins (id, user_id, checkin_datetime, checkin_date, daily_date, timezone, created_at)
+				SELECT id, user_id, checkin_datetime, checkin_date, checkin_date, timezone, created_at FROM checkins_daily
+			`),
+			execSQL(`DROP TABLE checkins_daily`),
+			execSQL(`CREATE UNIQUE INDEX idx_checkins_user_daily_date ON checkins (user_id, daily_date)`),
+			execSQL(`CREATE INDEX idx_checkins_user_date ON checkins (user_id, checkin_date)`),
+		},
+		Down: []Step{
+			execSQL(`DROP INDEX IF EXISTS idx_checkins_user_date`),
+			execSQL(`DROP INDEX IF EXISTS idx_checkins_user_daily_date`),
+			execSQL(`ALTER TABLE checkins RENAME TO checkins_cadence`),
+			execSQL(sqliteCreateCheckInsTable),
+			execSQL(`
+				INSERT INTO checkins (id, user_id, checkin_datetime, checkin_date, timezone, created_at)
+				SELECT id, user_id, checkin_datetime, checkin_date, timezone, created_at FROM checkins_cadence c1
+				WHERE NOT EXISTS (
+				    SELECT 1 FROM checkins_cadence c2
+				    WHERE c2.user_id = c1.user_id AND c2.checkin_date = c1.checkin_date
+				      AND (c2.checkin_datetime < c1.checkin_datetime OR (c2.checkin_datetime = c1.checkin_datetime AND c2.id < c1.id))
+				)
+			`),
+			execSQL(`DROP TABLE checkins_cadence`),
+			execSQL(`ALTER TABLE users DROP COLUMN checkin_interval_minutes`),
+		},
+	},
+	{
+		Version: 20,
+		Name:    "checkin_deadline",
+		Up: []Step{
+			execSQL(`ALTER TABLE users ADD COLUMN checkin_deadline TEXT NULL`),
+			execSQL(`ALTER TABLE users ADD COLUMN checkin_grace_minutes INTEGER NOT NULL DEFAULT 0`),
+		},
+		Down: []Step{
+			execSQL(`ALTER TABLE users DROP COLUMN checkin_grace_minutes`),
+			execSQL(`ALTER TABLE users DROP COLUMN checkin_deadline`),
+		},
+	},
+	{
+		Version: 21,
+		Name:    "checkin_details",
+		Up: []Step{
+			execSQL(`ALTER TABLE checkins ADD COLUMN mood INTEGER NULL`),
+			execSQL(`ALTER TABLE checkins ADD COLUMN note TEXT NULL`),
+			execSQL(`ALTER TABLE checkins ADD COLUMN battery_level INTEGER NULL`),
+			execSQL(`ALTER TABLE checkins ADD COLUMN latitude REAL NULL`),
+			execSQL(`ALTER TABLE checkins ADD COLUMN longitude REAL NULL`),
+			execSQL(`ALTER TABLE users ADD COLUMN share_mood BOOLEAN NOT NULL DEFAULT 0`),
+			execSQL(`ALTER TABLE users ADD COLUMN share_note BOOLEAN NOT NULL DEFAULT 0`),
+			execSQL(`ALTER TABLE users ADD COLUMN share_battery BOOLEAN NOT NULL DEFAULT 0`),
+			execSQL(`ALTER TABLE users ADD COLUMN share_location BOOLEAN NOT NULL DEFAULT 0`),
+		},
+		Down: []Step{
+			execSQL(`ALTER TABLE users DROP COLUMN share_location`),
+			execSQL(`ALTER TABLE users DROP COLUMN share_battery`),
+			execSQL(`ALTER TABLE users DROP COLUMN share_note`),
+			execSQL(`ALTER TABLE users DROP COLUMN share_mood`),
+			execSQL(`ALTER TABLE checkins DROP COLUMN longitude`),
+			execSQL(`ALTER TABLE checkins DROP COLUMN latitude`),
+			execSQL(`ALTER TABLE checkins DROP COLUMN battery_level`),
+			execSQL(`ALTER TABLE checkins DROP COLUMN note`),
+			execSQL(`ALTER TABLE checkins DROP COLUMN mood`),
+		},
+	},
+	{
+		Version: 22,
+		Name:    "checkin_time_audit",
+		Up: []Step{
+			execSQL(`ALTER TABLE checkins ADD COLUMN source TEXT NULL`),
+			execSQL(`ALTER TABLE checkins ADD COLUMN received_at DATETIME NULL`),
+			execSQL(`ALTER TABLE checkins ADD COLUMN client_datetime DATETIME NULL`),
+		},
+		Down: []Step{
+			execSQL(`ALTER TABLE checkins DROP COLUMN client_datetime`),
+			execSQL(`ALTER TABLE checkins DROP COLUMN received_at`),
+			execSQL(`ALTER TABLE checkins DROP COLUMN source`),
+		},
+	},
+	{
+		Version: 23,
+		Name:    "notification_claims",
+		Up: []Step{
+			execSQL(`ALTER TABLE notifications ADD COLUMN claimed_at TIMESTAMP NULL`),
+		},
+		Down: []Step{
+			execSQL(`ALTER TABLE notifications DROP COLUMN claimed_at`),
+		},
+	},
+	{
+		Version: 24,
+		Name:    "auth_code_discard_previous",
+		Up: []Step{
+			execSQL(`ALTER TABLE auth_codes ADD COLUMN discard_previous BOOLEAN NOT NULL DEFAULT 0`),
+		},
+		Down: []Step{
+			execSQL(`ALTER TABLE auth_codes DROP COLUMN discard_previous`),
+		},
+	},
+	{
+		Version: 25,
+		Name:    "checkin_stats",
+		Up: []Step{
+			execSQL(sqliteCreateCheckInStatsTable),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS checkin_stats`),
+		},
+	},
+	{
+		Version: 26,
+		Name:    "contact_opt_outs",
+		Up: []Step{
+			execSQL(`ALTER TABLE emergency_contacts ADD COLUMN confirmation_sent_at TIMESTAMP NULL`),
+			execSQL(`ALTER TABLE emergency_contacts ADD COLUMN confirmation_count INTEGER NOT NULL DEFAULT 0`),
+			execSQL(sqliteCreateContactOptOutsTable),
+			execSQL(`
+				INSERT OR IGNORE INTO contact_opt_outs (user_id, email, opted_out_at)
+				SELECT user_id, LOWER(email), opted_out_at FROM emergency_contacts WHERE opted_out_at IS NOT NULL
+			`),
+		},
+		Down: []Step{
+			execSQL(`DROP TABLE IF EXISTS contact_opt_outs`),
+			execSQL(`ALTER TABLE emergency_contacts DROP COLUMN confirmation_count`),
+			execSQL(`ALTER TABLE emergency_contacts DROP COLUMN confirmation_sent_at`),
+		},
+	},
+}
+
+const sqliteCreateUsersTable = `
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id TEXT UNIQUE NOT NULL,
+    name TEXT DEFAULT '',
+    email TEXT DEFAULT '',
+    phone TEXT DEFAULT '',
+    apns_token TEXT,
+    push_enabled BOOLEAN DEFAULT 1,
+    email_enabled BOOLEAN DEFAULT 1,
+    timezone TEXT DEFAULT 'UTC',
+    reminder_times TEXT,
+    reminder_days TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const sqliteCreateCheckInsTable = `
+CREATE TABLE checkins (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    checkin_datetime DATETIME NOT NULL,
+    checkin_date DATE NOT NULL,
+    timezone TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, checkin_date)
+)
+`
+
+const sqliteCreateCheckInsCadenceTable = `
+CREATE TABLE checkins (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    checkin_datetime DATETIME NOT NULL,
+    checkin_date DATE NOT NULL,
+    daily_date DATE NULL,
+    timezone TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const sqliteCreateNotificationsTable = `
+CREATE TABLE notifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    notification_type TEXT NOT NULL,
+    recipient TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    retry_count INTEGER DEFAULT 0,
+    max_retries INTEGER DEFAULT 3,
+    scheduled_at TIMESTAMP NOT NULL,
+    sent_at TIMESTAMP NULL,
+    failed_at TIMESTAMP NULL,
+    error_message TEXT,
+    response_status INTEGER NULL,
+    content TEXT,
+    timezone TEXT,
+    unique_key TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const sqliteCreateTokensTable = `
+CREATE TABLE tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id TEXT NOT NULL,
+    access_token TEXT UNIQUE NOT NULL,
+    refresh_token TEXT UNIQUE NOT NULL,
+    token_type TEXT DEFAULT 'Bearer',
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const sqliteCreateEscalationPoliciesTable = `
+CREATE TABLE escalation_policies (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER UNIQUE NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    steps TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const sqliteCreateEmergencyContactsTable = `
+CREATE TABLE emergency_contacts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT DEFAULT '',
+    email TEXT NOT NULL,
+    phone TEXT DEFAULT '',
+    relationship TEXT DEFAULT '',
+    language TEXT DEFAULT 'zh',
+    verified_at TIMESTAMP NULL,
+    opted_out_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, email)
+)
+`
+
+const sqliteCreateCheckInLinksTable = `
+CREATE TABLE checkin_links (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const sqliteCreateIncidentsTable = `
+CREATE TABLE incidents (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'open',
+    last_checkin_at DATETIME NULL,
+    opened_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    acknowledged_by INTEGER NULL REFERENCES emergency_contacts(id) ON DELETE SET NULL,
+    acknowledged_at TIMESTAMP NULL,
+    paused_until TIMESTAMP NULL,
+    resolved_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const sqliteCreateIncidentContactsTable = `
+CREATE TABLE incident_contacts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    incident_id INTEGER NOT NULL REFERENCES incidents(id) ON DELETE CASCADE,
+    contact_id INTEGER NOT NULL REFERENCES emergency_contacts(id) ON DELETE CASCADE,
+    first_alerted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_alerted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    acknowledged_at TIMESTAMP NULL,
+    UNIQUE (incident_id, contact_id)
+)
+`
+
+const sqliteCreateSecurityEventsTable = `
+CREATE TABLE security_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event_type TEXT NOT NULL,
+    device_id TEXT DEFAULT '',
+    ip_address TEXT DEFAULT '',
+    user_agent TEXT DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const sqliteCreateUserDevicesTable = `
+CREATE TABLE user_devices (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id TEXT UNIQUE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const sqliteCreateAuthCodesTable = `
+CREATE TABLE auth_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL,
+    code_hash TEXT NULL UNIQUE,
+    email TEXT NULL,
+    device_id TEXT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const sqliteCreateRateLimitBucketsTable = `
+CREATE TABLE rate_limit_buckets (
+    bucket_key TEXT NOT NULL PRIMARY KEY,
+    tokens REAL NOT NULL,
+    version INTEGER NOT NULL DEFAULT 0,
+    updated_ms INTEGER NOT NULL,
+    full_at_ms INTEGER NOT NULL
+)
+`
+
+const sqliteCreateUserPausesTable = `
+CREATE TABLE user_pauses (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    reason TEXT DEFAULT '',
+    notify_contacts BOOLEAN DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const sqliteCreateWebhooksTable = `
+CREATE TABLE webhooks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    contact_id INTEGER NULL REFERENCES emergency_contacts(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT,
+    enabled BOOLEAN DEFAULT 1,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const sqliteCreateCheckInStatsTable = `
+CREATE TABLE checkin_stats (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    last_checkin_id INTEGER NOT NULL,
+    last_checkin_at TIMESTAMP NOT NULL,
+    last_checkin_date TEXT NOT NULL,
+    streak_length INTEGER NOT NULL DEFAULT 0,
+    longest_streak INTEGER NOT NULL DEFAULT 0,
+    time_sin REAL NOT NULL DEFAULT 0,
+    time_cos REAL NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+const sqliteCreateContactOptOutsTable = `
+CREATE TABLE contact_opt_outs (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    opted_out_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, email)
+)
+`
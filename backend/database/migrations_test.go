@@ -0,0 +1,52 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckInLocalDatesKeepDuplicates(t *testing.T) {
+	// 两次打卡的 UTC 日期不同，按 UTC+8 计算都是 1 月 2 日
+	checkIns := []*checkInLocalDate{
+		{id: 2, userID: 1, datetime: time.Date(2024, 1, 2, 2, 0, 0, 0, time.UTC), date: "2024-01-02", userTimezone: "Asia/Shanghai"},
+		{id: 1, userID: 1, datetime: time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC), date: "2024-01-01", userTimezone: "Asia/Shanghai"},
+		{id: 3, userID: 2, datetime: time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC), date: "2024-01-01", userTimezone: "Asia/Shanghai"},
+	}
+	for _, c := range checkIns {
+		toLocalCheckInDate(c)
+	}
+
+	if duplicates := assignDailyDates(checkIns); duplicates != 1 {
+		t.Errorf("duplicates = %d, want 1", duplicates)
+	}
+	want := map[int64]struct{ date, dailyDate string }{
+		1: {"2024-01-02", "2024-01-02"}, // 最早的一条占用 daily_date
+		2: {"2024-01-02", ""},           // 同一本地日期的其他记录保留，daily_date 为 NULL
+		3: {"2024-01-02", "2024-01-02"}, // 其他用户不受影响
+	}
+	for _, c := range checkIns {
+		if c.date != want[c.id].date || c.dailyDate != want[c.id].dailyDate || c.timezone != "Asia/Shanghai" {
+			t.Errorf("checkin %d = %q/%q/%q, want %q/%q/Asia/Shanghai", c.id, c.date, c.dailyDate, c.timezone, want[c.id].date, want[c.id].dailyDate)
+		}
+	}
+
+	// 已迁移的记录不重新计算
+	migrated := &checkInLocalDate{datetime: time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC), date: "2024-01-01", timezone: "UTC", userTimezone: "Asia/Shanghai"}
+	toLocalCheckInDate(migrated)
+	if migrated.date != "2024-01-01" {
+		t.Errorf("migrated checkin date = %q, want unchanged", migrated.date)
+	}
+
+	// 回滚为 UTC 日期后两条记录的日期不同，都占用 daily_date，没有记录被删除
+	for _, c := range checkIns {
+		toUTCCheckInDate(c)
+	}
+	if duplicates := assignDailyDates(checkIns); duplicates != 0 {
+		t.Errorf("duplicates after restore = %d, want 0", duplicates)
+	}
+	for _, c := range checkIns {
+		if c.dailyDate != c.date || c.timezone != "" {
+			t.Errorf("restored checkin %d = %q/%q/%q", c.id, c.date, c.dailyDate, c.timezone)
+		}
+	}
+}
@@ -0,0 +1,493 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// migrationLockName 迁移使用的 MySQL 命名锁，保证多个实例不会同时迁移
+const migrationLockName = "deadornot_schema_migrations"
+
+// migrationLockKey 迁移使用的 PostgreSQL advisory lock
+const migrationLockKey = 0x6465_6164_6f72_6e6f
+
+// migrationLockTimeout 等待其他实例完成迁移的最长秒数
+const migrationLockTimeout = 300
+
+const createSchemaMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    checksum CHAR(64) NOT NULL,
+    applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)
+`
+
+// Migration 一个版本的数据库迁移
+// MySQL 的 DDL 会隐式提交，迁移无法包在事务里；每个操作都需要可以重复执行
+type Migration struct {
+	Version int
+	Name    string
+	Up      []Step
+	Down    []Step
+}
+
+// Checksum 迁移内容的校验和，已执行的迁移被修改时用于发现差异
+func (m Migration) Checksum() string {
+	h := sha256.New()
+	h.Write([]byte(m.Name))
+	for _, step := range m.Up {
+		h.Write([]byte("\n-- up\n" + step.Statement()))
+	}
+	for _, step := range m.Down {
+		h.Write([]byte("\n-- down\n" + step.Statement()))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Step 迁移中的一个操作
+type Step interface {
+	// Statement 操作的描述（SQL），参与校验和计算
+	Statement() string
+	// Apply 执行操作
+	Apply(ctx context.Context, conn *sql.Conn) error
+}
+
+// execStep 直接执行的 SQL
+type execStep string
+
+// execSQL 创建执行 SQL 的操作
+func execSQL(query string) Step {
+	return execStep(query)
+}
+
+func (s execStep) Statement() string {
+	return strings.TrimSpace(string(s))
+}
+
+func (s execStep) Apply(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, string(s))
+	return err
+}
+
+// addColumn、dropColumn、addIndex、modifyColumnIfType 通过 information_schema 判断是否需要执行，只用于 MySQL 的迁移
+
+// addColumnStep 字段不存在时添加字段
+type addColumnStep struct {
+	table      string
+	column     string
+	definition string
+}
+
+// addColumn 创建添加字段的操作，字段已存在时跳过
+func addColumn(table, column, definition string) Step {
+	return addColumnStep{table, column, definition}
+}
+
+func (s addColumnStep) Statement() string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", s.table, s.column, s.definition)
+}
+
+func (s addColumnStep) Apply(ctx context.Context, conn *sql.Conn) error {
+	exists, err := columnExists(ctx, conn, s.table, s.column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, s.Statement())
+	return err
+}
+
+// dropColumnStep 字段存在时删除字段
+type dropColumnStep struct {
+	table  string
+	column string
+}
+
+// dropColumn 创建删除字段的操作，字段不存在时跳过
+func dropColumn(table, column string) Step {
+	return dropColumnStep{table, column}
+}
+
+func (s dropColumnStep) Statement() string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", s.table, s.column)
+}
+
+func (s dropColumnStep) Apply(ctx context.Context, conn *sql.Conn) error {
+	exists, err := columnExists(ctx, conn, s.table, s.column)
+	if err != nil || !exists {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, s.Statement())
+	return err
+}
+
+// addIndexStep 索引不存在时添加索引
+type addIndexStep struct {
+	table   string
+	index   string
+	columns string
+}
+
+// addIndex 创建添加索引的操作，索引已存在时跳过
+func addIndex(table, index, columns string) Step {
+	return addIndexStep{table, index, columns}
+}
+
+func (s addIndexStep) Statement() string {
+	return fmt.Sprintf("ALTER TABLE %s ADD INDEX %s (%s)", s.table, s.index, s.columns)
+}
+
+func (s addIndexStep) Apply(ctx context.Context, conn *sql.Conn) error {
+	exists, err := indexExists(ctx, conn, s.table, s.index)
+	if err != nil || exists {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, s.Statement())
+	return err
+}
+
+// modifyColumnStep 字段为指定类型时修改字段定义
+type modifyColumnStep struct {
+	table      string
+	column     string
+	fromType   string // 仅当字段当前为该类型时才修改
+	definition string
+}
+
+// modifyColumnIfType 创建修改字段类型的操作，字段当前类型不是 fromType 时跳过
+func modifyColumnIfType(table, column, fromType, definition string) Step {
+	return modifyColumnStep{table, column, fromType, definition}
+}
+
+func (s modifyColumnStep) Statement() string {
+	return fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s -- from %s", s.table, s.column, s.definition, s.fromType)
+}
+
+func (s modifyColumnStep) Apply(ctx context.Context, conn *sql.Conn) error {
+	var dataType string
+	err := conn.QueryRowContext(ctx, `
+		SELECT DATA_TYPE FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?
+	`, s.table, s.column).Scan(&dataType)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if dataType != s.fromType {
+		return nil
+	}
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", s.table, s.column, s.definition))
+	return err
+}
+
+// funcStep 用 Go 代码实现的数据迁移
+type funcStep struct {
+	name string
+	fn   func(ctx context.Context, conn *sql.Conn) error
+}
+
+// dataMigration 创建用 Go 代码实现的数据迁移操作，name 参与校验和计算，修改逻辑时应同时修改 name
+func dataMigration(name string, fn func(ctx context.Context, conn *sql.Conn) error) Step {
+	return funcStep{name, fn}
+}
+
+func (s funcStep) Statement() string {
+	return "-- func " + s.name
+}
+
+func (s funcStep) Apply(ctx context.Context, conn *sql.Conn) error {
+	return s.fn(ctx, conn)
+}
+
+// columnExists 判断字段是否存在
+func columnExists(ctx context.Context, conn *sql.Conn, table, column string) (bool, error) {
+	var exists bool
+	err := conn.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM information_schema.COLUMNS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?
+		)
+	`, table, column).Scan(&exists)
+	return exists, err
+}
+
+// indexExists 判断索引是否存在
+func indexExists(ctx context.Context, conn *sql.Conn, table, index string) (bool, error) {
+	var exists bool
+	err := conn.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM information_schema.STATISTICS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?
+		)
+	`, table, index).Scan(&exists)
+	return exists, err
+}
+
+// MigrationStatus 迁移状态
+type MigrationStatus struct {
+	Version          int
+	Name             string
+	Applied          bool
+	AppliedAt        *time.Time
+	ChecksumMismatch bool // 已执行的迁移内容被修改过
+	Unknown          bool // 数据库中记录了当前程序不认识的版本
+}
+
+// appliedMigration schema_migrations 中的一条记录
+type appliedMigration struct {
+	version   int
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// Migrator 数据库迁移执行器
+type Migrator struct {
+	db         *DB
+	migrations []Migration
+}
+
+// NewMigrator 创建迁移执行器，按数据库类型选择迁移列表
+func NewMigrator(db *DB) *Migrator {
+	sorted := append([]Migration(nil), migrationsFor(db.dialect)...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	return &Migrator{
+		db:         db,
+		migrations: sorted,
+	}
+}
+
+// Up 执行所有未执行的迁移，返回执行的数量
+func (m *Migrator) Up() (int, error) {
+	count := 0
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := m.loadApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verifyChecksums(applied); err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			log.Printf("Applying migration %d_%s", migration.Version, migration.Name)
+			if err := runSteps(ctx, conn, migration.Up); err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			_, err := conn.ExecContext(ctx, m.db.dialect.Rebind(`
+				INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)
+			`), migration.Version, migration.Name, migration.Checksum())
+			if err != nil {
+				return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down 回滚最近执行的 steps 个迁移，返回回滚的数量
+func (m *Migrator) Down(steps int) (int, error) {
+	count := 0
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := m.loadApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verifyChecksums(applied); err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			log.Printf("Reverting migration %d_%s", migration.Version, migration.Name)
+			if err := runSteps(ctx, conn, migration.Down); err != nil {
+				return fmt.Errorf("revert of migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx, m.db.dialect.Rebind(`DELETE FROM schema_migrations WHERE version = ?`), migration.Version); err != nil {
+				return fmt.Errorf("failed to remove migration record %d: %w", migration.Version, err)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Status 获取所有迁移的执行状态
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := m.loadApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		known := make(map[int]bool, len(m.migrations))
+		for _, migration := range m.migrations {
+			known[migration.Version] = true
+			status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+			if record, ok := applied[migration.Version]; ok {
+				appliedAt := record.appliedAt
+				status.Applied = true
+				status.AppliedAt = &appliedAt
+				status.ChecksumMismatch = record.checksum != migration.Checksum()
+			}
+			statuses = append(statuses, status)
+		}
+
+		for version, record := range applied {
+			if known[version] {
+				continue
+			}
+			appliedAt := record.appliedAt
+			statuses = append(statuses, MigrationStatus{
+				Version:   version,
+				Name:      record.name,
+				Applied:   true,
+				AppliedAt: &appliedAt,
+				Unknown:   true,
+			})
+		}
+		sort.Slice(statuses, func(i, j int) bool {
+			return statuses[i].Version < statuses[j].Version
+		})
+		return nil
+	})
+	return statuses, err
+}
+
+// withLock 获取迁移锁后在同一连接上执行，命名锁与连接绑定
+func (m *Migrator) withLock(fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	unlock, err := lockMigrations(ctx, conn, m.db.dialect)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := conn.ExecContext(ctx, createSchemaMigrationsTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	return fn(ctx, conn)
+}
+
+// lockMigrations 获取迁移锁，返回释放锁的函数
+// SQLite 只支持单实例部署，不需要加锁
+func lockMigrations(ctx context.Context, conn *sql.Conn, dialect Dialect) (func(), error) {
+	switch dialect.Name() {
+	case DriverMySQL:
+		var locked sql.NullInt64
+		err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`, migrationLockName, migrationLockTimeout).Scan(&locked)
+		if err != nil {
+			return nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		if !locked.Valid || locked.Int64 != 1 {
+			return nil, fmt.Errorf("timed out waiting for migration lock held by another instance")
+		}
+		return func() {
+			conn.ExecContext(ctx, `SELECT RELEASE_LOCK(?)`, migrationLockName)
+		}, nil
+
+	case DriverPostgres:
+		deadline := time.Now().Add(migrationLockTimeout * time.Second)
+		for {
+			var locked bool
+			if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, int64(migrationLockKey)).Scan(&locked); err != nil {
+				return nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+			}
+			if locked {
+				break
+			}
+			if time.Now().After(deadline) {
+				return nil, fmt.Errorf("timed out waiting for migration lock held by another instance")
+			}
+			time.Sleep(time.Second)
+		}
+		return func() {
+			conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, int64(migrationLockKey))
+		}, nil
+
+	default:
+		return func() {}, nil
+	}
+}
+
+// loadApplied 读取已执行的迁移
+func (m *Migrator) loadApplied(ctx context.Context, conn *sql.Conn) (map[int]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var record appliedMigration
+		if err := rows.Scan(&record.version, &record.name, &record.checksum, &record.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		applied[record.version] = record
+	}
+	return applied, rows.Err()
+}
+
+// verifyChecksums 已执行的迁移被修改时拒绝继续，避免数据库与代码不一致
+func (m *Migrator) verifyChecksums(applied map[int]appliedMigration) error {
+	for _, migration := range m.migrations {
+		record, ok := applied[migration.Version]
+		if !ok {
+			continue
+		}
+		if record.checksum != migration.Checksum() {
+			return fmt.Errorf("checksum mismatch for applied migration %d_%s: it has been modified after it was applied", migration.Version, migration.Name)
+		}
+	}
+	return nil
+}
+
+// runSteps 依次执行迁移操作
+func runSteps(ctx context.Context, conn *sql.Conn, steps []Step) error {
+	for i, step := range steps {
+		if err := step.Apply(ctx, conn); err != nil {
+			return fmt.Errorf("step %d (%s): %w", i+1, firstLine(step.Statement()), err)
+		}
+	}
+	return nil
+}
+
+// firstLine 取语句的第一行，用于错误信息
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
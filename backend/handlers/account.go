@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/deadornot/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// deletionConfirmation 注销账号时需要在请求中填写的确认文字
+const deletionConfirmation = "DELETE"
+
+// DeleteAccount 申请注销账号，宽限期结束前可以撤销
+func DeleteAccount(accountService *services.AccountService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		var req struct {
+			Confirmation string `json:"confirmation"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || req.Confirmation != deletionConfirmation {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf(`confirmation must be "%s"`, deletionConfirmation)})
+			return
+		}
+
+		scheduledAt, err := accountService.RequestDeletion(userID, clientInfo(c))
+		if err != nil {
+			log.Printf("Failed to schedule deletion for user %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule account deletion"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":               "Account deletion scheduled",
+			"deletion_scheduled_at": scheduledAt,
+		})
+	}
+}
+
+// CancelAccountDeletion 撤销注销申请
+func CancelAccountDeletion(accountService *services.AccountService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		cancelled, err := accountService.CancelDeletion(userID, clientInfo(c))
+		if err != nil {
+			log.Printf("Failed to cancel deletion for user %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel account deletion"})
+			return
+		}
+		if !cancelled {
+			c.JSON(http.StatusConflict, gin.H{"error": "Account deletion is not scheduled"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Account deletion cancelled"})
+	}
+}
+
+// ExportAccount 导出用户数据，默认返回 JSON，format=zip 时返回 ZIP 附件
+func ExportAccount(accountService *services.AccountService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		format := c.DefaultQuery("format", "json")
+		if format != "json" && format != "zip" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or zip"})
+			return
+		}
+
+		export, err := accountService.Export(userID, c.GetInt64("token_id"))
+		if err != nil {
+			log.Printf("Failed to export account for user %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account"})
+			return
+		}
+
+		if format == "json" {
+			c.JSON(http.StatusOK, export)
+			return
+		}
+
+		filename := fmt.Sprintf("deadornot-export-%s.zip", export.ExportedAt.Format("20060102-150405"))
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		c.Status(http.StatusOK)
+		if err := export.WriteZip(c.Writer); err != nil {
+			c.Error(err)
+		}
+	}
+}
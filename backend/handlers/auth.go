@@ -1,8 +1,9 @@
 package handlers
 
 import (
-	"database/sql"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/deadornot/backend/services"
 	"github.com/gin-gonic/gin"
@@ -20,8 +21,16 @@ func NewAuthHandler(authService *services.AuthService) *AuthHandler {
 	}
 }
 
+// clientInfo 获取请求的客户端信息
+func clientInfo(c *gin.Context) services.ClientInfo {
+	return services.ClientInfo{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
 // Login 登录
-func (h *AuthHandler) Login(db *sql.DB) gin.HandlerFunc {
+func (h *AuthHandler) Login() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
 			DeviceID string `json:"device_id"`
@@ -43,7 +52,7 @@ func (h *AuthHandler) Login(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		tokenResponse, err := h.authService.Login(deviceID)
+		tokenResponse, err := h.authService.Login(deviceID, clientInfo(c))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -53,6 +62,46 @@ func (h *AuthHandler) Login(db *sql.DB) gin.HandlerFunc {
 	}
 }
 
+// Apple 使用 Sign in with Apple 登录
+func (h *AuthHandler) Apple() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			IdentityToken         string `json:"identity_token"`
+			DeviceID              string `json:"device_id"`
+			DiscardCurrentAccount bool   `json:"discard_current_account"` // 确认放弃设备当前账号的数据
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		deviceID := req.DeviceID
+		if deviceID == "" {
+			deviceID = c.GetHeader("X-Device-ID")
+		}
+
+		if req.IdentityToken == "" || deviceID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "identity_token and device_id are required"})
+			return
+		}
+
+		tokenResponse, err := h.authService.LoginWithApple(req.IdentityToken, deviceID, req.DiscardCurrentAccount, clientInfo(c))
+		switch {
+		case errors.Is(err, services.ErrAppleSignInDisabled):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrInvalidIdentityToken):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrAppleAccountMismatch), errors.Is(err, services.ErrPreviousAccountHasData):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusOK, tokenResponse)
+		}
+	}
+}
+
 // Refresh 刷新 Token
 func (h *AuthHandler) Refresh() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -65,7 +114,7 @@ func (h *AuthHandler) Refresh() gin.HandlerFunc {
 			return
 		}
 
-		tokenResponse, err := h.authService.Refresh(req.RefreshToken)
+		tokenResponse, err := h.authService.Refresh(req.RefreshToken, clientInfo(c))
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			return
@@ -94,3 +143,73 @@ func (h *AuthHandler) Logout() gin.HandlerFunc {
 		c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 	}
 }
+
+// ListSecurityEvents 获取当前用户的安全事件
+func (h *AuthHandler) ListSecurityEvents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		events, err := h.authService.ListSecurityEvents(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"security_events": events})
+	}
+}
+
+// ListSessions 获取当前用户的登录会话
+func (h *AuthHandler) ListSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		tokenID := c.GetInt64("token_id")
+
+		sessions, err := h.authService.ListSessions(userID, tokenID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+	}
+}
+
+// RevokeSession 撤销一个登录会话
+func (h *AuthHandler) RevokeSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		sessionID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session id"})
+			return
+		}
+
+		err = h.authService.RevokeSession(userID, sessionID)
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+	}
+}
+
+// RevokeOtherSessions 撤销除当前会话外的所有会话
+func (h *AuthHandler) RevokeOtherSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		tokenID := c.GetInt64("token_id")
+
+		if err := h.authService.RevokeOtherSessions(userID, tokenID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Other sessions revoked successfully"})
+	}
+}
@@ -1,21 +1,25 @@
 package handlers
 
 import (
-	"database/sql"
+	"errors"
 	"net/http"
 	"time"
 
-	"github.com/deadornot/backend/utils"
+	"github.com/deadornot/backend/models"
+	"github.com/deadornot/backend/repository"
+	"github.com/deadornot/backend/services"
 	"github.com/gin-gonic/gin"
 )
 
-// CheckIn 打卡
-func CheckIn(db *sql.DB) gin.HandlerFunc {
+// CheckIn 打卡，可附带心情、留言、电量和大致位置
+func CheckIn(checkInService *services.CheckInService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.GetInt64("user_id")
 
 		var req struct {
 			DateTime string `json:"datetime"` // RFC 3339 格式，可选
+			Backfill bool   `json:"backfill"` // 补打卡，需要提供 datetime
+			models.CheckInDetails
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -23,175 +27,249 @@ func CheckIn(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		var checkInDateTime time.Time
-		var err error
-
+		input := services.CheckInInput{Backfill: req.Backfill, CheckInDetails: req.CheckInDetails}
 		if req.DateTime != "" {
-			// 解析 RFC 3339 格式时间
-			checkInDateTime, err = time.Parse(time.RFC3339, req.DateTime)
+			// 解析 RFC 3339 格式时间，没有提供时间时使用服务器时间
+			clientDateTime, err := time.Parse(time.RFC3339, req.DateTime)
 			if err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid datetime format, expected RFC 3339"})
 				return
 			}
-		} else {
-			// 如果没有提供时间，使用当前 UTC 时间
-			checkInDateTime = time.Now().UTC()
+			input.ClientDateTime = &clientDateTime
 		}
 
-		// 转换为 UTC（确保是 UTC）
-		checkInDateTime = checkInDateTime.UTC()
-
-		// 检查同一天是否已打卡
-		var exists bool
-		err = db.QueryRow(`
-			SELECT EXISTS(
-				SELECT 1 FROM checkins 
-				WHERE user_id = ? AND DATE(checkin_datetime) = DATE(?)
-			)
-		`, userID, checkInDateTime).Scan(&exists)
-
+		checkInDateTime, nextDeadline, err := checkInService.CheckIn(userID, input)
+		if err == services.ErrAlreadyCheckedIn || errors.Is(err, services.ErrInvalidCheckInDetails) || errors.Is(err, services.ErrInvalidCheckInTime) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check in"})
 			return
 		}
 
-		if exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Already checked in today"})
+		// 返回 RFC 3339 格式的时间
+		c.JSON(http.StatusOK, gin.H{
+			"message":       "Check-in successful",
+			"datetime":      checkInDateTime.Format(time.RFC3339),
+			"next_deadline": nextDeadline.Format(time.RFC3339),
+		})
+	}
+}
+
+// CheckInLinkPage 一键打卡链接落地页（无需认证）
+// GET 只校验链接并显示确认页，不打卡也不消耗链接：邮件客户端、安全网关和聊天软件的链接预览会自动打开链接，
+// 只有用户点击按钮提交的 POST（CheckInByLink）才会打卡
+func CheckInLinkPage(checkInLinkService *services.CheckInLinkService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Param("token")
+		if _, err := checkInLinkService.Peek(token); err != nil {
+			renderLinkResult(c, checkInLinkErrorStatus(err), "打卡失败", checkInLinkErrorMessage(err))
 			return
 		}
 
-		// 插入打卡记录
-		_, err = db.Exec(`
-			INSERT INTO checkins (user_id, checkin_datetime) 
-			VALUES (?, ?)
-		`, userID, checkInDateTime)
+		renderActionPage(c, "📢 打卡提醒", "点击下方按钮告诉大家您一切安好。", "我很好，立即打卡")
+	}
+}
 
+// CheckInByLink 通过一键打卡链接打卡（无需认证）
+// 表单提交返回页面，App 直接调用返回 JSON
+func CheckInByLink(checkInService *services.CheckInService, checkInLinkService *services.CheckInLinkService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fromBrowser := isFormSubmit(c)
+
+		linkID, userID, err := checkInLinkService.Redeem(c.Param("token"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check in"})
+			if fromBrowser {
+				renderLinkResult(c, checkInLinkErrorStatus(err), "打卡失败", checkInLinkErrorMessage(err))
+			} else {
+				c.JSON(checkInLinkErrorStatus(err), gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		// 没有记录打卡时释放链接，之后仍可使用
+		checkInDateTime, nextDeadline, err := checkInService.CheckIn(userID, services.CheckInInput{})
+		if err == services.ErrAlreadyCheckedIn {
+			checkInLinkService.Release(linkID)
+			if fromBrowser {
+				renderLinkResult(c, http.StatusOK, "今天已打卡", "您今天已经打过卡了，无需重复打卡。")
+			} else {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		if err != nil {
+			checkInLinkService.Release(linkID)
+			if fromBrowser {
+				renderLinkResult(c, http.StatusInternalServerError, "打卡失败", "服务暂时不可用，请稍后重试。")
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check in"})
+			}
+			return
+		}
+
+		if fromBrowser {
+			renderLinkResult(c, http.StatusOK, "打卡成功", "已记录您今天的打卡，祝您一切安好！")
 			return
 		}
 
-		// 返回 RFC 3339 格式的时间
 		c.JSON(http.StatusOK, gin.H{
-			"message":  "Check-in successful",
-			"datetime": checkInDateTime.Format(time.RFC3339),
+			"message":       "Check-in successful",
+			"datetime":      checkInDateTime.Format(time.RFC3339),
+			"next_deadline": nextDeadline.Format(time.RFC3339),
 		})
 	}
 }
 
+// checkInLinkErrorStatus 一键打卡链接错误对应的状态码
+func checkInLinkErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCheckInLinkUsed):
+		return http.StatusGone
+	case errors.Is(err, services.ErrInvalidLinkToken), errors.Is(err, services.ErrExpiredLinkToken):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// checkInLinkErrorMessage 一键打卡链接错误对应的提示
+func checkInLinkErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, services.ErrCheckInLinkUsed):
+		return "该链接已使用过，请打开\"死了么\"应用打卡。"
+	case errors.Is(err, services.ErrExpiredLinkToken):
+		return "链接已过期，请打开\"死了么\"应用打卡。"
+	case errors.Is(err, services.ErrInvalidLinkToken):
+		return "链接无效。"
+	default:
+		return "服务暂时不可用，请稍后重试。"
+	}
+}
+
+// checkInHistoryItem 打卡记录中的一条
+type checkInHistoryItem struct {
+	DateTime string `json:"datetime"`
+	Date     string `json:"date"`
+	Source   string `json:"source,omitempty"` // server、client 或 backfill，旧记录为空
+	models.CheckInDetails
+}
+
 // GetCheckInHistory 获取打卡记录
-func GetCheckInHistory(db *sql.DB) gin.HandlerFunc {
+func GetCheckInHistory(checkIns repository.CheckInRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.GetInt64("user_id")
-		timezone := c.GetString("timezone")
-		if timezone == "" {
-			timezone = "UTC"
-		}
 
 		startDate := c.Query("start_date")
 		endDate := c.Query("end_date")
 
-		query := "SELECT checkin_datetime FROM checkins WHERE user_id = ?"
-		args := []interface{}{userID}
-
+		// 按打卡时的本地日期过滤（yyyy-MM-dd）
 		if startDate != "" {
-			query += " AND DATE(checkin_datetime) >= DATE(?)"
-			startTime, _ := utils.ParseDateInTimezone(startDate, timezone)
-			args = append(args, startTime)
+			if _, err := time.Parse("2006-01-02", startDate); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date, expected yyyy-MM-dd"})
+				return
+			}
 		}
 
 		if endDate != "" {
-			query += " AND DATE(checkin_datetime) <= DATE(?)"
-			endTime, _ := utils.ParseDateInTimezone(endDate, timezone)
-			args = append(args, endTime)
+			if _, err := time.Parse("2006-01-02", endDate); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date, expected yyyy-MM-dd"})
+				return
+			}
 		}
 
-		query += " ORDER BY checkin_datetime DESC"
-
-		rows, err := db.Query(query, args...)
+		records, err := checkIns.List(userID, startDate, endDate)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 			return
 		}
-		defer rows.Close()
 
 		var datetimes []string = []string{}
-		for rows.Next() {
-			var datetime time.Time
-			if err := rows.Scan(&datetime); err != nil {
-				continue
-			}
-			// 返回 RFC 3339 格式
-			datetimes = append(datetimes, datetime.Format(time.RFC3339))
+		var dates []string = []string{}
+		items := []checkInHistoryItem{}
+		for _, record := range records {
+			// 返回 RFC 3339 格式，以及打卡时的本地日期
+			datetime := record.CheckInDateTime.UTC().Format(time.RFC3339)
+			date := record.CheckInDate.Format("2006-01-02")
+			datetimes = append(datetimes, datetime)
+			dates = append(dates, date)
+			items = append(items, checkInHistoryItem{
+				DateTime:       datetime,
+				Date:           date,
+				Source:         record.Source,
+				CheckInDetails: record.CheckInDetails,
+			})
 		}
 
-		c.JSON(http.StatusOK, gin.H{"datetimes": datetimes})
+		// datetimes 和 dates 兼容旧客户端，checkins 包含打卡附带的状态信息
+		c.JSON(http.StatusOK, gin.H{"datetimes": datetimes, "dates": dates, "checkins": items})
 	}
 }
 
-// GetCheckInStats 获取打卡统计
-func GetCheckInStats(db *sql.DB) gin.HandlerFunc {
+// GetCheckInStats 获取打卡统计，暂停期间未打卡的日期不中断连续打卡
+// 按间隔打卡的用户连续打卡按次数计算，并返回下一次打卡的截止时间和宽限时间的结束时间
+func GetCheckInStats(users repository.UserRepository, pauses repository.PauseRepository, statsService *services.CheckInStatsService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.GetInt64("user_id")
-		timezone := c.GetString("timezone")
-		if timezone == "" {
-			timezone = "UTC"
-		}
 
-		// 获取最后打卡时间
-		var lastCheckIn sql.NullTime
-		err := db.QueryRow(`
-			SELECT MAX(checkin_datetime) FROM checkins WHERE user_id = ?
-		`, userID).Scan(&lastCheckIn)
+		user, err := users.Get(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
 
-		if err != nil && err != sql.ErrNoRows {
+		now := time.Now().UTC()
+		stats, err := statsService.Compute(user, now)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 			return
 		}
 
 		var lastCheckInDateTime *string
-		var currentStreak int
-		var totalDays int
+		var nextDeadline *string
+		var graceEndsAt *string
+		var averageCheckInTime *string
+		var overdue bool
 
-		if lastCheckIn.Valid {
+		if stats.LastCheckInAt != nil {
 			// 返回 RFC 3339 格式
-			datetimeStr := lastCheckIn.Time.Format(time.RFC3339)
+			last := *stats.LastCheckInAt
+			datetimeStr := last.UTC().Format(time.RFC3339)
 			lastCheckInDateTime = &datetimeStr
 
-			// 计算连续打卡天数
-			daysSince, _ := utils.DaysSinceInTimezone(lastCheckIn.Time, timezone)
-
-			if daysSince == 0 {
-				// 今天已打卡，计算连续天数
-				currentStreak = 1
-				checkDateTime := lastCheckIn.Time
-				for {
-					checkDateTime = checkDateTime.AddDate(0, 0, -1)
-					var exists bool
-					err := db.QueryRow(`
-						SELECT EXISTS(SELECT 1 FROM checkins WHERE user_id = ? AND DATE(checkin_datetime) = DATE(?))
-					`, userID, checkDateTime).Scan(&exists)
-					if err != nil || !exists {
-						break
-					}
-					currentStreak++
-				}
+			// 截止时间从最近一次打卡或之后的暂停结束时开始计算，只需要最近一次打卡之后结束的暂停
+			userPauses, err := pauses.ListEndingAfter(userID, last)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
 			}
-		}
-
-		// 获取总打卡天数（使用生成列 checkin_date 或 DATE 函数）
-		err = db.QueryRow(`
-			SELECT COUNT(DISTINCT DATE(checkin_datetime)) FROM checkins WHERE user_id = ?
-		`, userID).Scan(&totalDays)
-
-		if err != nil {
-			totalDays = 0
+			cadence := services.UserCheckInCadence(user)
+			deadline := cadence.NextDeadline(services.CheckInDeadlineSince(last, userPauses, now))
+			deadlineStr := deadline.Format(time.RFC3339)
+			nextDeadline = &deadlineStr
+			graceEndsStr := deadline.Add(cadence.Grace).Format(time.RFC3339)
+			graceEndsAt = &graceEndsStr
+			overdue = !now.Before(deadline)
+
+			averageCheckInTime = &stats.AverageCheckInTime
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"current_streak":        currentStreak,
-			"last_checkin_datetime": lastCheckInDateTime,
-			"total_days":            totalDays,
+			"current_streak":             stats.CurrentStreak,
+			"streak_including_yesterday": stats.StreakIncludingYesterday,
+			"longest_streak":             stats.LongestStreak,
+			"last_checkin_datetime":      lastCheckInDateTime,
+			"total_days":                 stats.TotalDays,
+			"month":                      stats.Month,
+			"average_checkin_time":       averageCheckInTime,
+			"weekday_counts":             stats.WeekdayCounts, // 下标 0 为星期日
+			"checkin_interval_minutes":   user.CheckInIntervalMinutes,
+			"checkin_deadline":           user.CheckInDeadline,
+			"checkin_grace_minutes":      user.CheckInGraceMinutes,
+			"next_deadline":              nextDeadline,
+			"grace_ends_at":              graceEndsAt,
+			"overdue":                    overdue,
 		})
 	}
 }
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/deadornot/backend/config"
+	"github.com/deadornot/backend/database"
+	"github.com/deadornot/backend/repository"
+	"github.com/deadornot/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// newTestDB 在临时目录中创建执行过迁移的 SQLite 数据库
+func newTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	cfg := &config.Config{Database: config.DatabaseConfig{
+		Driver: database.DriverSQLite,
+		Path:   filepath.Join(t.TempDir(), "test.db"),
+	}}
+	db, err := database.InitDB(cfg)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	return db
+}
+
+// checkInLinkTest 一键打卡链接接口的测试环境
+type checkInLinkTest struct {
+	router         *gin.Engine
+	repos          *repository.Repositories
+	checkInService *services.CheckInService
+	userID         int64
+	path           string
+}
+
+func newCheckInLinkTest(t *testing.T) *checkInLinkTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	repos := repository.New(db)
+	cfg := &config.Config{Server: config.ServerConfig{BaseURL: "https://example.com", SecretKey: "test-secret"}}
+
+	signer := services.NewLinkSigner(cfg)
+	notificationService := services.NewNotificationService(repos.Notifications)
+	webhookService := services.NewWebhookService(db, repos, notificationService, cfg)
+	incidentService := services.NewIncidentService(db, notificationService, signer, webhookService, cfg)
+	checkInService := services.NewCheckInService(repos, incidentService, webhookService, cfg)
+	checkInLinkService := services.NewCheckInLinkService(db, signer, cfg)
+
+	router := gin.New()
+	router.GET("/api/checkin/link/:token", CheckInLinkPage(checkInLinkService))
+	router.POST("/api/checkin/link/:token", CheckInByLink(checkInService, checkInLinkService))
+
+	userID, err := db.Insert(`INSERT INTO users (device_id, timezone) VALUES ('device-1', 'UTC')`)
+	if err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	link, err := checkInLinkService.Create(userID)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	return &checkInLinkTest{
+		router:         router,
+		repos:          repos,
+		checkInService: checkInService,
+		userID:         userID,
+		path:           "/api/checkin/link/" + link.Token,
+	}
+}
+
+func (lt *checkInLinkTest) request(method string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, lt.path, nil)
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	w := httptest.NewRecorder()
+	lt.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCheckInLinkGetDoesNotConsumeToken(t *testing.T) {
+	lt := newCheckInLinkTest(t)
+	request, repos, userID := lt.request, lt.repos, lt.userID
+
+	countCheckIns := func() int {
+		days, err := repos.CheckIns.CountDays(userID)
+		if err != nil {
+			t.Fatalf("CountDays: %v", err)
+		}
+		return days
+	}
+
+	// 邮件客户端和聊天软件会预先打开链接，GET 只显示确认页，不打卡也不消耗链接
+	for i := 0; i < 2; i++ {
+		if w := request(http.MethodGet); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<form") {
+			t.Fatalf("GET #%d = %d, want confirmation page", i+1, w.Code)
+		}
+	}
+	if n := countCheckIns(); n != 0 {
+		t.Fatalf("check-ins after GET = %d, want 0", n)
+	}
+
+	if w := request(http.MethodPost); w.Code != http.StatusOK {
+		t.Fatalf("POST = %d: %s", w.Code, w.Body.String())
+	}
+	if n := countCheckIns(); n != 1 {
+		t.Fatalf("check-ins after POST = %d, want 1", n)
+	}
+
+	// 链接只能使用一次
+	if w := request(http.MethodPost); w.Code != http.StatusGone {
+		t.Errorf("second POST = %d, want %d", w.Code, http.StatusGone)
+	}
+	if w := request(http.MethodGet); w.Code != http.StatusGone {
+		t.Errorf("GET after POST = %d, want %d", w.Code, http.StatusGone)
+	}
+	if n := countCheckIns(); n != 1 {
+		t.Errorf("check-ins after second POST = %d, want 1", n)
+	}
+}
+
+func TestCheckInLinkReleasedWhenAlreadyCheckedIn(t *testing.T) {
+	lt := newCheckInLinkTest(t)
+
+	if _, _, err := lt.checkInService.CheckIn(lt.userID, services.CheckInInput{}); err != nil {
+		t.Fatalf("CheckIn: %v", err)
+	}
+
+	// 今天已经在应用内打卡，链接没有记录打卡，之后仍可使用
+	if w := lt.request(http.MethodPost); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "今天已打卡") {
+		t.Fatalf("POST = %d: %s", w.Code, w.Body.String())
+	}
+	if w := lt.request(http.MethodGet); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<form") {
+		t.Errorf("GET after already checked in = %d, want confirmation page", w.Code)
+	}
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/deadornot/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ListContacts 获取紧急联系人列表
+func ListContacts(contactService *services.ContactService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		contacts, err := contactService.List(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"contacts": contacts})
+	}
+}
+
+// CreateContact 添加紧急联系人
+func CreateContact(contactService *services.ContactService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		var req services.ContactInput
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		contact, err := contactService.Create(userID, req)
+		if err != nil {
+			respondContactError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, contact)
+	}
+}
+
+// UpdateContact 更新紧急联系人
+func UpdateContact(contactService *services.ContactService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		contactID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contact id"})
+			return
+		}
+
+		var req services.ContactInput
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		contact, err := contactService.Update(userID, contactID, req)
+		if err != nil {
+			respondContactError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, contact)
+	}
+}
+
+// DeleteContact 删除紧急联系人
+func DeleteContact(contactService *services.ContactService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		contactID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contact id"})
+			return
+		}
+
+		if err := contactService.Delete(userID, contactID); err != nil {
+			respondContactError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Contact deleted successfully"})
+	}
+}
+
+// ResendContactConfirmation 重新发送确认邮件
+func ResendContactConfirmation(contactService *services.ContactService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		contactID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid contact id"})
+			return
+		}
+
+		contact, err := contactService.Get(userID, contactID)
+		if err != nil {
+			respondContactError(c, err)
+			return
+		}
+
+		// 确认链接不会撤销退订，不再打扰已退订的联系人
+		if contact.OptedOutAt != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Contact has opted out"})
+			return
+		}
+		if contact.VerifiedAt != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Contact is already verified"})
+			return
+		}
+
+		if err := contactService.SendConfirmation(contact); err != nil {
+			if errors.Is(err, services.ErrConfirmationLimit) {
+				c.JSON(http.StatusTooManyRequests, gin.H{"error": "Confirmation was sent recently, please try again later"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send confirmation"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Confirmation sent"})
+	}
+}
+
+// ConfirmContactPage 紧急联系人确认链接落地页（无需认证）
+func ConfirmContactPage(contactService *services.ContactService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := contactService.PeekConfirm(c.Param("token")); err != nil {
+			renderLinkResult(c, linkErrorStatus(err), "确认失败", linkErrorMessage(err))
+			return
+		}
+
+		renderActionPage(c, "🤝 紧急联系人确认", "确认后，当对方连续多天未打卡时，我们会通过邮件通知您。", "确认成为紧急联系人")
+	}
+}
+
+// ConfirmContact 紧急联系人通过邮件链接确认（无需认证）
+func ConfirmContact(contactService *services.ContactService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := contactService.Confirm(c.Param("token")); err != nil {
+			renderLinkResult(c, linkErrorStatus(err), "确认失败", linkErrorMessage(err))
+			return
+		}
+
+		renderLinkResult(c, http.StatusOK, "确认成功", "您已成为紧急联系人。当对方连续多天未打卡时，我们会通过邮件通知您。")
+	}
+}
+
+// OptOutContactPage 紧急联系人退订链接落地页（无需认证）
+func OptOutContactPage(contactService *services.ContactService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := contactService.PeekOptOut(c.Param("token")); err != nil {
+			renderLinkResult(c, linkErrorStatus(err), "退订失败", linkErrorMessage(err))
+			return
+		}
+
+		renderActionPage(c, "退订提醒", "退订后，您将不会再收到相关的提醒邮件。", "确认退订")
+	}
+}
+
+// OptOutContact 紧急联系人通过邮件链接退订（无需认证）
+func OptOutContact(contactService *services.ContactService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := contactService.OptOut(c.Param("token")); err != nil {
+			renderLinkResult(c, linkErrorStatus(err), "退订失败", linkErrorMessage(err))
+			return
+		}
+
+		renderLinkResult(c, http.StatusOK, "退订成功", "您将不会再收到相关的提醒邮件。")
+	}
+}
+
+// respondContactError 将联系人服务的错误转换为响应
+func respondContactError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrContactNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Contact not found"})
+	case errors.Is(err, services.ErrContactExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTooManyContacts), errors.Is(err, services.ErrInvalidContactReq):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	}
+}
+
+// linkErrorStatus 签名链接错误对应的状态码
+func linkErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidLinkToken), errors.Is(err, services.ErrExpiredLinkToken):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrContactNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// linkErrorMessage 签名链接错误对应的提示
+func linkErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, services.ErrExpiredLinkToken):
+		return "链接已过期，请联系对方重新发送。"
+	case errors.Is(err, services.ErrInvalidLinkToken):
+		return "链接无效。"
+	case errors.Is(err, services.ErrContactNotFound):
+		return "该紧急联系人已被删除。"
+	default:
+		return "服务暂时不可用，请稍后重试。"
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/deadornot/backend/models"
+	"github.com/deadornot/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// GetEscalationPolicy 获取升级策略
+func GetEscalationPolicy(escalationService *services.EscalationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		policy, err := escalationService.GetPolicy(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, policy)
+	}
+}
+
+// UpdateEscalationPolicy 更新升级策略
+func UpdateEscalationPolicy(escalationService *services.EscalationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		var req struct {
+			Steps models.EscalationSteps `json:"steps"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		if req.Steps == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "steps is required"})
+			return
+		}
+
+		if err := services.ValidateEscalationSteps(req.Steps); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		policy, err := escalationService.UpdatePolicy(userID, req.Steps)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update escalation policy"})
+			return
+		}
+
+		c.JSON(http.StatusOK, policy)
+	}
+}
+
+// ResetEscalationPolicy 恢复默认升级策略
+func ResetEscalationPolicy(escalationService *services.EscalationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		if err := escalationService.ResetPolicy(userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset escalation policy"})
+			return
+		}
+
+		policy, err := escalationService.GetPolicy(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, policy)
+	}
+}
@@ -4,11 +4,12 @@ import (
 	"database/sql"
 	"net/http"
 
+	"github.com/deadornot/backend/services"
 	"github.com/gin-gonic/gin"
 )
 
 // HealthCheck 健康检查接口
-func HealthCheck(db *sql.DB) gin.HandlerFunc {
+func HealthCheck(db *sql.DB, notificationService *services.NotificationService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 检查数据库连接
 		if err := db.Ping(); err != nil {
@@ -20,9 +21,20 @@ func HealthCheck(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
+		// 检查通知渠道，渠道不可用不影响服务整体状态
+		channels := gin.H{}
+		for channel, err := range notificationService.HealthCheck() {
+			if err != nil {
+				channels[channel] = gin.H{"status": "unavailable", "error": err.Error()}
+			} else {
+				channels[channel] = gin.H{"status": "ok"}
+			}
+		}
+
 		c.JSON(http.StatusOK, gin.H{
-			"status":  "healthy",
-			"message": "Service is running",
+			"status":   "healthy",
+			"message":  "Service is running",
+			"channels": channels,
 		})
 	}
 }
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/deadornot/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ListIncidents 获取紧急事件列表
+func ListIncidents(incidentService *services.IncidentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		incidents, err := incidentService.List(userID, 20)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		// 第一条未解除的事件即为当前事件
+		var current interface{}
+		if len(incidents) > 0 && incidents[0].ResolvedAt == nil {
+			current = incidents[0]
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"current":   current,
+			"incidents": incidents,
+		})
+	}
+}
+
+// AcknowledgeIncidentPage 紧急联系人确认链接落地页（无需认证）
+func AcknowledgeIncidentPage(incidentService *services.IncidentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := incidentService.PeekAcknowledge(c.Param("token")); err != nil {
+			renderLinkResult(c, incidentErrorStatus(err), "无法确认", incidentErrorMessage(err))
+			return
+		}
+
+		renderActionPage(c, "🙋 我会去确认", "点击下方按钮后，我们会告知其他紧急联系人由您跟进，并暂停发送提醒。", "我会去确认 TA 的情况")
+	}
+}
+
+// AcknowledgeIncident 紧急联系人确认会去查看情况（无需认证）
+func AcknowledgeIncident(incidentService *services.IncidentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		incident, err := incidentService.Acknowledge(c.Param("token"))
+		if err != nil {
+			if isFormSubmit(c) {
+				renderLinkResult(c, incidentErrorStatus(err), "无法确认", incidentErrorMessage(err))
+			} else {
+				c.JSON(incidentErrorStatus(err), gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		if isFormSubmit(c) {
+			renderLinkResult(c, http.StatusOK, "感谢您的跟进", "我们已告知其他紧急联系人，并暂停发送提醒。如确认情况紧急，请立即拨打急救电话。")
+			return
+		}
+
+		c.JSON(http.StatusOK, incident)
+	}
+}
+
+// incidentErrorStatus 紧急事件错误对应的状态码
+func incidentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidLinkToken), errors.Is(err, services.ErrExpiredLinkToken):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrIncidentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrIncidentResolved):
+		return http.StatusGone
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// incidentErrorMessage 紧急事件错误对应的提示
+func incidentErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, services.ErrIncidentResolved):
+		return "对方已经重新打卡，无需再确认。"
+	case errors.Is(err, services.ErrExpiredLinkToken):
+		return "链接已过期。"
+	case errors.Is(err, services.ErrInvalidLinkToken), errors.Is(err, services.ErrIncidentNotFound):
+		return "链接无效。"
+	default:
+		return "服务暂时不可用，请稍后重试。"
+	}
+}
@@ -1,11 +1,11 @@
 package handlers
 
 import (
-	"database/sql"
 	"log"
 	"net/http"
 	"strings"
 
+	"github.com/deadornot/backend/repository"
 	"github.com/deadornot/backend/services"
 	"github.com/gin-gonic/gin"
 )
@@ -42,24 +42,21 @@ func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
 		// 将用户ID和设备ID存储到上下文
 		c.Set("user_id", token.UserID)
 		c.Set("device_id", token.DeviceID)
+		c.Set("token_id", token.ID)
 		c.Set("access_token", accessToken)
 
+		// 记录会话的最近使用时间
+		authService.TouchSession(token, clientInfo(c))
+
 		// 查询用户时区
-		var timezone string
-		err = authService.DB.QueryRow(`
-			SELECT timezone FROM users WHERE id = ?
-		`, token.UserID).Scan(&timezone)
-		if err != nil || timezone == "" {
-			timezone = "UTC"
-		}
-		c.Set("timezone", timezone)
+		c.Set("timezone", authService.GetUserTimezone(token.UserID))
 
 		c.Next()
 	}
 }
 
 // DeviceIDMiddleware 设备ID中间件（保留作为备选，用于首次登录）
-func DeviceIDMiddleware(db *sql.DB) gin.HandlerFunc {
+func DeviceIDMiddleware(users repository.UserRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		deviceID := c.GetHeader("X-Device-ID")
 		if deviceID == "" {
@@ -71,28 +68,26 @@ func DeviceIDMiddleware(db *sql.DB) gin.HandlerFunc {
 		// 查询或创建用户
 		var userID int64
 		var timezone string
-		err := db.QueryRow(`
-			SELECT id, timezone FROM users WHERE device_id = ?
-		`, deviceID).Scan(&userID, &timezone)
+		user, err := users.GetByDeviceID(deviceID)
 
-		if err == sql.ErrNoRows {
+		if err == repository.ErrNotFound {
 			// 创建新用户
-			result, err := db.Exec(`
-				INSERT INTO users (device_id, timezone) VALUES (?, 'UTC')
-			`, deviceID)
+			userID, err = users.Create(deviceID, "UTC")
 			if err != nil {
 				log.Printf("Failed to create user: %v", err)
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 				c.Abort()
 				return
 			}
-			userID, _ = result.LastInsertId()
 			timezone = "UTC"
 		} else if err != nil {
 			log.Printf("Failed to query user: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 			c.Abort()
 			return
+		} else {
+			userID = user.ID
+			timezone = user.Timezone
 		}
 
 		// 将用户ID和时区存储到上下文
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// renderLinkResult 渲染邮件链接点击后的结果页面
+func renderLinkResult(c *gin.Context, status int, title, message string) {
+	page := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>%s</title>
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 40px 20px; text-align: center; }
+        h1 { font-size: 24px; }
+        .footer { margin-top: 40px; color: #999; font-size: 12px; }
+    </style>
+</head>
+<body>
+    <h1>%s</h1>
+    <p>%s</p>
+    <div class="footer">死了么</div>
+</body>
+</html>`, html.EscapeString(title), html.EscapeString(title), html.EscapeString(message))
+
+	c.Data(status, "text/html; charset=utf-8", []byte(page))
+}
+
+// renderActionPage 渲染带确认按钮的页面，按钮以 POST 提交到当前地址
+// 邮件中的链接只展示页面，避免邮件客户端预取链接时触发操作
+func renderActionPage(c *gin.Context, title, message, button string) {
+	page := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>%s</title>
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 40px 20px; text-align: center; }
+        h1 { font-size: 24px; }
+        button { background: #48c6ef; color: white; border: none; padding: 14px 32px; border-radius: 8px; font-size: 18px; font-weight: 500; }
+        .footer { margin-top: 40px; color: #999; font-size: 12px; }
+    </style>
+</head>
+<body>
+    <h1>%s</h1>
+    <p>%s</p>
+    <form method="POST" action="%s">
+        <button type="submit">%s</button>
+    </form>
+    <div class="footer">死了么</div>
+</body>
+</html>`, html.EscapeString(title), html.EscapeString(title), html.EscapeString(message),
+		html.EscapeString(c.Request.URL.Path), html.EscapeString(button))
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+}
+
+// isFormSubmit 判断请求是否来自页面表单提交
+func isFormSubmit(c *gin.Context) bool {
+	return c.ContentType() == "application/x-www-form-urlencoded"
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/deadornot/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// GetPause 获取生效中或未开始的暂停
+func GetPause(pauseService *services.PauseService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		pause, err := pauseService.Get(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"pause": pause})
+	}
+}
+
+// SetPause 设置暂停时段，期间不发送提醒、不触发升级
+func SetPause(pauseService *services.PauseService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		var req struct {
+			StartsAt       string `json:"starts_at"` // RFC 3339 格式，可选，默认立即开始
+			EndsAt         string `json:"ends_at"`   // RFC 3339 格式
+			Reason         string `json:"reason"`
+			NotifyContacts bool   `json:"notify_contacts"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		input := services.PauseInput{
+			Reason:         req.Reason,
+			NotifyContacts: req.NotifyContacts,
+		}
+
+		endsAt, err := time.Parse(time.RFC3339, req.EndsAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ends_at, expected RFC 3339"})
+			return
+		}
+		input.EndsAt = endsAt
+
+		if req.StartsAt != "" {
+			startsAt, err := time.Parse(time.RFC3339, req.StartsAt)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid starts_at, expected RFC 3339"})
+				return
+			}
+			input.StartsAt = &startsAt
+		}
+
+		pause, err := pauseService.Set(userID, input)
+		switch {
+		case errors.Is(err, services.ErrPauseEndInPast), errors.Is(err, services.ErrPauseEndBeforeStart),
+			errors.Is(err, services.ErrPauseTooLong), errors.Is(err, services.ErrPauseReasonTooLong):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusOK, gin.H{"pause": pause})
+		}
+	}
+}
+
+// EndPause 提前结束暂停
+func EndPause(pauseService *services.PauseService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		ended, err := pauseService.End(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !ended {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No active pause"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Pause ended"})
+	}
+}
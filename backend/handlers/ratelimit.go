@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/deadornot/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// maxPeekBodySize 限流时读取请求体中 device_id 的最大长度
+const maxPeekBodySize = 64 << 10
+
+// RateLimitMiddleware 按 group 的配置限流：先按 IP，再按已登录的用户或请求中的设备ID
+// 用于需要认证的接口时应放在 AuthMiddleware 之后
+// IP 取自 c.ClientIP()，只在请求来自 TRUSTED_PROXIES 时才使用 X-Forwarded-For；
+// 设备ID 由客户端提供、可以随意更换，只用于区分同一 IP 后的设备，不能代替按 IP 限流
+func RateLimitMiddleware(rateLimiter *services.RateLimiter, group string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wait := rateLimiter.Allow(group, services.RateLimitByIP, c.ClientIP())
+
+		if wait == 0 {
+			if userID := c.GetInt64("user_id"); userID != 0 {
+				wait = rateLimiter.Allow(group, services.RateLimitByUser, strconv.FormatInt(userID, 10))
+			} else {
+				wait = rateLimiter.Allow(group, services.RateLimitByDevice, requestDeviceID(c))
+			}
+		}
+
+		if wait > 0 {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       "Too many requests",
+				"retry_after": retryAfter,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// requestDeviceID 获取未登录请求的设备ID：优先使用 JSON 请求体中的 device_id，否则使用 X-Device-ID header
+// 读取请求体后会还原，不影响后续的处理器
+func requestDeviceID(c *gin.Context) string {
+	if c.Request.Body != nil && c.ContentType() == "application/json" {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPeekBodySize))
+		c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+		if err == nil {
+			var req struct {
+				DeviceID string `json:"device_id"`
+			}
+			if json.Unmarshal(body, &req) == nil && req.DeviceID != "" {
+				return req.DeviceID
+			}
+		}
+	}
+	return c.GetHeader("X-Device-ID")
+}
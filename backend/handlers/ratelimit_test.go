@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deadornot/backend/config"
+	"github.com/deadornot/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// newRateLimitedRouter 只有一个限流接口的路由，接口原样返回请求体
+func newRateLimitedRouter(t *testing.T, trustedProxies []string, rule config.RateLimitRule) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	rateLimiter := services.NewRateLimiter(nil, &config.Config{RateLimit: config.RateLimitConfig{
+		Enabled: true,
+		Store:   "memory",
+		Auth:    rule,
+	}})
+
+	router := gin.New()
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		t.Fatalf("SetTrustedProxies: %v", err)
+	}
+	router.POST("/login", RateLimitMiddleware(rateLimiter, services.RateLimitAuth), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+	return router
+}
+
+func postLogin(router *gin.Engine, remoteAddr, forwardedFor, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("Content-Type", "application/json")
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitMiddlewareIgnoresSpoofedForwardedFor(t *testing.T) {
+	router := newRateLimitedRouter(t, nil, config.RateLimitRule{
+		PerIP: config.RateLimit{Requests: 2, Per: time.Hour},
+	})
+
+	// 不信任代理时，每次更换 X-Forwarded-For 仍然计入同一个 IP
+	for i, forwardedFor := range []string{"198.51.100.1", "198.51.100.2"} {
+		if w := postLogin(router, "203.0.113.7:1234", forwardedFor, "{}"); w.Code != http.StatusOK {
+			t.Fatalf("request #%d = %d, want 200", i+1, w.Code)
+		}
+	}
+	w := postLogin(router, "203.0.113.7:1234", "198.51.100.3", "{}")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over limit = %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After header is missing")
+	}
+
+	// 其他 IP 不受影响
+	if w := postLogin(router, "203.0.113.8:1234", "", "{}"); w.Code != http.StatusOK {
+		t.Errorf("request from another IP = %d, want 200", w.Code)
+	}
+}
+
+func TestRateLimitMiddlewareTrustedProxy(t *testing.T) {
+	router := newRateLimitedRouter(t, []string{"127.0.0.1"}, config.RateLimitRule{
+		PerIP: config.RateLimit{Requests: 1, Per: time.Hour},
+	})
+
+	// 来自可信代理的请求按 X-Forwarded-For 中的客户端 IP 限流
+	if w := postLogin(router, "127.0.0.1:1234", "198.51.100.1", "{}"); w.Code != http.StatusOK {
+		t.Fatalf("first client = %d, want 200", w.Code)
+	}
+	if w := postLogin(router, "127.0.0.1:1234", "198.51.100.2", "{}"); w.Code != http.StatusOK {
+		t.Fatalf("second client = %d, want 200", w.Code)
+	}
+	if w := postLogin(router, "127.0.0.1:1234", "198.51.100.1", "{}"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("first client again = %d, want 429", w.Code)
+	}
+}
+
+func TestRateLimitMiddlewareByDevice(t *testing.T) {
+	router := newRateLimitedRouter(t, nil, config.RateLimitRule{
+		PerClient: config.RateLimit{Requests: 1, Per: time.Hour},
+	})
+
+	body := `{"device_id":"device-1"}`
+	w := postLogin(router, "203.0.113.7:1234", "", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("first request = %d, want 200", w.Code)
+	}
+	// 读取 device_id 后请求体对后续处理器保持不变
+	if w.Body.String() != body {
+		t.Errorf("handler body = %q, want %q", w.Body.String(), body)
+	}
+
+	if w := postLogin(router, "203.0.113.7:1234", "", body); w.Code != http.StatusTooManyRequests {
+		t.Errorf("same device = %d, want 429", w.Code)
+	}
+	if w := postLogin(router, "203.0.113.7:1234", "", `{"device_id":"device-2"}`); w.Code != http.StatusOK {
+		t.Errorf("other device = %d, want 200", w.Code)
+	}
+}
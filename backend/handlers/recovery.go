@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/deadornot/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// CreatePairingCode 在已登录的设备上生成配对码
+func CreatePairingCode(recoveryService *services.RecoveryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		code, err := recoveryService.CreatePairingCode(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, code)
+	}
+}
+
+// PairDevice 新设备使用配对码关联到已有账号并登录（无需认证）
+func PairDevice(recoveryService *services.RecoveryService, authService *services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Code                  string `json:"code"`
+			DeviceID              string `json:"device_id"`
+			DiscardCurrentAccount bool   `json:"discard_current_account"` // 确认放弃设备当前账号的数据
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		deviceID := req.DeviceID
+		if deviceID == "" {
+			deviceID = c.GetHeader("X-Device-ID")
+		}
+		if req.Code == "" || deviceID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "code and device_id are required"})
+			return
+		}
+
+		_, err := recoveryService.RedeemPairingCode(req.Code, deviceID, req.DiscardCurrentAccount, clientInfo(c))
+		if errors.Is(err, services.ErrInvalidPairingCode) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrPreviousAccountHasData) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 设备已关联到账号，直接登录
+		tokenResponse, err := authService.Login(deviceID, clientInfo(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, tokenResponse)
+	}
+}
+
+// SendEmailVerification 向用户当前的邮箱重新发送验证邮件
+func SendEmailVerification(recoveryService *services.RecoveryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		err := recoveryService.SendEmailVerification(userID)
+		switch {
+		case errors.Is(err, services.ErrEmailNotSet):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrEmailVerified):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+		}
+	}
+}
+
+// VerifyEmailPage 邮箱验证链接落地页（无需认证）
+func VerifyEmailPage(recoveryService *services.RecoveryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := recoveryService.PeekEmailVerification(c.Param("token")); err != nil {
+			renderLinkResult(c, authLinkErrorStatus(err), "验证失败", authLinkErrorMessage(err))
+			return
+		}
+
+		renderActionPage(c, "✉️ 验证邮箱", "验证后，更换手机时可以通过这个邮箱找回账号。", "验证邮箱")
+	}
+}
+
+// VerifyEmail 通过邮件链接验证邮箱（无需认证）
+func VerifyEmail(recoveryService *services.RecoveryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := recoveryService.VerifyEmail(c.Param("token")); err != nil {
+			renderLinkResult(c, authLinkErrorStatus(err), "验证失败", authLinkErrorMessage(err))
+			return
+		}
+
+		renderLinkResult(c, http.StatusOK, "验证成功", "您的邮箱已验证，更换手机时可以通过这个邮箱找回账号。")
+	}
+}
+
+// RequestRecovery 新设备请求通过邮箱找回账号（无需认证）
+// 无论邮箱是否存在都返回相同的结果
+func RequestRecovery(recoveryService *services.RecoveryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Email                 string `json:"email"`
+			DeviceID              string `json:"device_id"`
+			DiscardCurrentAccount bool   `json:"discard_current_account"` // 确认放弃设备当前账号的数据
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		deviceID := req.DeviceID
+		if deviceID == "" {
+			deviceID = c.GetHeader("X-Device-ID")
+		}
+		if req.Email == "" || deviceID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "email and device_id are required"})
+			return
+		}
+
+		if err := recoveryService.RequestRecovery(req.Email, deviceID, req.DiscardCurrentAccount); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"message": "If the email is verified, a recovery link has been sent"})
+	}
+}
+
+// RecoveryPage 找回账号链接落地页（无需认证）
+func RecoveryPage(recoveryService *services.RecoveryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := recoveryService.PeekRecovery(c.Param("token")); err != nil {
+			renderLinkResult(c, authLinkErrorStatus(err), "找回失败", authLinkErrorMessage(err))
+			return
+		}
+
+		renderActionPage(c, "📱 找回账号", "确认后，发起请求的新设备将登录您原来的账号。如果这不是您的操作，请直接关闭此页面。", "确认在新设备上登录")
+	}
+}
+
+// Recover 通过邮件链接将新设备关联到账号（无需认证）
+func Recover(recoveryService *services.RecoveryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := recoveryService.Recover(c.Param("token"), clientInfo(c)); err != nil {
+			renderLinkResult(c, authLinkErrorStatus(err), "找回失败", authLinkErrorMessage(err))
+			return
+		}
+
+		renderLinkResult(c, http.StatusOK, "找回成功", "新设备已关联到您的账号，请回到 App 重新登录。")
+	}
+}
+
+// authLinkErrorStatus 账号邮件链接错误对应的状态码
+func authLinkErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidLinkToken), errors.Is(err, services.ErrExpiredLinkToken):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrAuthLinkUsed), errors.Is(err, services.ErrPreviousAccountHasData):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// authLinkErrorMessage 账号邮件链接错误对应的提示
+func authLinkErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, services.ErrExpiredLinkToken):
+		return "链接已过期，请在 App 中重新发送。"
+	case errors.Is(err, services.ErrAuthLinkUsed):
+		return "链接已使用过。"
+	case errors.Is(err, services.ErrPreviousAccountHasData):
+		return "新设备上当前登录的账号还有打卡记录等数据。请在 App 中确认放弃该账号后重新发起找回。"
+	case errors.Is(err, services.ErrInvalidLinkToken):
+		return "链接无效。"
+	default:
+		return "服务暂时不可用，请稍后重试。"
+	}
+}
@@ -1,33 +1,25 @@
 package handlers
 
 import (
-	"database/sql"
-	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"net/mail"
+	"time"
 
 	"github.com/deadornot/backend/models"
+	"github.com/deadornot/backend/repository"
+	"github.com/deadornot/backend/services"
 	"github.com/gin-gonic/gin"
 )
 
 // GetUser 获取用户信息
-func GetUser(db *sql.DB) gin.HandlerFunc {
+func GetUser(users repository.UserRepository, contactService *services.ContactService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.GetInt64("user_id")
 
-		var user models.User
-		var emailsJSON string
-		var apnsToken sql.NullString
-		err := db.QueryRow(`
-			SELECT id, device_id, name, emergency_contact_emails, apns_token, 
-			       push_enabled, email_enabled, timezone, created_at, updated_at
-			FROM users WHERE id = ?
-		`, userID).Scan(
-			&user.ID, &user.DeviceID, &user.Name, &emailsJSON,
-			&apnsToken, &user.PushEnabled, &user.EmailEnabled,
-			&user.Timezone, &user.CreatedAt, &user.UpdatedAt,
-		)
-
-		if err == sql.ErrNoRows {
+		user, err := users.Get(userID)
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
 		}
@@ -36,34 +28,60 @@ func GetUser(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		// 处理可能为 NULL 的 apns_token
-		if apnsToken.Valid {
-			user.APNSToken = apnsToken.String
-		} else {
-			user.APNSToken = ""
+		// 未设置提醒时间的用户使用默认值
+		if len(user.ReminderTimes) == 0 {
+			user.ReminderTimes = models.DefaultReminderTimes()
+		}
+		if len(user.ReminderDays) == 0 {
+			user.ReminderDays = models.DefaultReminderDays()
 		}
 
-		// 解析JSON字段
-		if err := json.Unmarshal([]byte(emailsJSON), &user.EmergencyContactEmails); err != nil {
-			user.EmergencyContactEmails = []string{}
+		// 兼容旧客户端：紧急联系人邮箱来自 emergency_contacts 表
+		contacts, err := contactService.List(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		resp := userResponse{User: user, EmergencyContactEmails: []string{}}
+		for _, contact := range contacts {
+			if contact.OptedOutAt == nil {
+				resp.EmergencyContactEmails = append(resp.EmergencyContactEmails, contact.Email)
+			}
 		}
 
-		c.JSON(http.StatusOK, user)
+		c.JSON(http.StatusOK, resp)
 	}
 }
 
+// userResponse 用户信息，附带旧客户端使用的紧急联系人邮箱列表
+type userResponse struct {
+	*models.User
+	EmergencyContactEmails []string `json:"emergency_contact_emails"`
+}
+
 // UpdateUser 更新用户设置
-func UpdateUser(db *sql.DB) gin.HandlerFunc {
+func UpdateUser(users repository.UserRepository, contactService *services.ContactService, recoveryService *services.RecoveryService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.GetInt64("user_id")
 
 		var req struct {
 			Name                   string   `json:"name"`
+			Email                  *string  `json:"email"`
+			Phone                  *string  `json:"phone"`
 			EmergencyContactEmails []string `json:"emergency_contact_emails"`
 			APNSToken              string   `json:"apns_token"`
 			PushEnabled            *bool    `json:"push_enabled"`
 			EmailEnabled           *bool    `json:"email_enabled"`
 			Timezone               string   `json:"timezone"`
+			ReminderTimes          []string `json:"reminder_times"`
+			ReminderDays           []string `json:"reminder_days"`
+			CheckInIntervalMinutes *int     `json:"checkin_interval_minutes"` // 0 表示每天打卡一次
+			CheckInDeadline        *string  `json:"checkin_deadline"`         // HH:MM，空字符串表示取消截止时间
+			CheckInGraceMinutes    *int     `json:"checkin_grace_minutes"`
+			ShareMood              *bool    `json:"share_mood"`
+			ShareNote              *bool    `json:"share_note"`
+			ShareBattery           *bool    `json:"share_battery"`
+			ShareLocation          *bool    `json:"share_location"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -71,71 +89,133 @@ func UpdateUser(db *sql.DB) gin.HandlerFunc {
 		}
 
 		// 限制紧急联系人数量
-		if len(req.EmergencyContactEmails) > 3 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Maximum 3 emergency contact emails allowed"})
+		if len(req.EmergencyContactEmails) > services.MaxEmergencyContacts {
+			c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrTooManyContacts.Error()})
 			return
 		}
 
-		// 构建更新SQL
-		updates := []string{}
-		args := []interface{}{}
+		// 收集需要更新的字段
+		var update repository.UserUpdate
 
 		if req.Name != "" {
-			updates = append(updates, "name = ?")
-			args = append(args, req.Name)
+			update.Name = &req.Name
 		}
 
-		if req.EmergencyContactEmails != nil {
-			emailsJSON, _ := json.Marshal(req.EmergencyContactEmails)
-			updates = append(updates, "emergency_contact_emails = ?")
-			args = append(args, string(emailsJSON))
+		if req.Email != nil {
+			if *req.Email != "" {
+				if _, err := mail.ParseAddress(*req.Email); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+					return
+				}
+			}
+			update.Email = req.Email
+		}
+
+		if req.Phone != nil {
+			phone, err := contactService.NormalizePhone(*req.Phone)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			update.Phone = &phone
 		}
 
 		if req.APNSToken != "" {
-			updates = append(updates, "apns_token = ?")
-			args = append(args, req.APNSToken)
+			update.APNSToken = &req.APNSToken
+		}
+
+		update.PushEnabled = req.PushEnabled
+		update.EmailEnabled = req.EmailEnabled
+
+		// 紧急提醒中分享哪些打卡信息由用户逐项授权
+		update.ShareMood = req.ShareMood
+		update.ShareNote = req.ShareNote
+		update.ShareBattery = req.ShareBattery
+		update.ShareLocation = req.ShareLocation
+
+		if req.Timezone != "" {
+			// 只接受 IANA 时区名称；Local 取决于服务器所在时区，也不接受
+			if _, err := time.LoadLocation(req.Timezone); err != nil || req.Timezone == "Local" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+				return
+			}
+			update.Timezone = &req.Timezone
 		}
 
-		if req.PushEnabled != nil {
-			updates = append(updates, "push_enabled = ?")
-			args = append(args, *req.PushEnabled)
+		if req.ReminderTimes != nil {
+			times, err := services.NormalizeReminderTimes(req.ReminderTimes)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			update.ReminderTimes = times
 		}
 
-		if req.EmailEnabled != nil {
-			updates = append(updates, "email_enabled = ?")
-			args = append(args, *req.EmailEnabled)
+		if req.ReminderDays != nil {
+			days, err := services.NormalizeReminderDays(req.ReminderDays)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			update.ReminderDays = days
 		}
 
-		if req.Timezone != "" {
-			updates = append(updates, "timezone = ?")
-			args = append(args, req.Timezone)
+		if req.CheckInIntervalMinutes != nil {
+			if err := services.ValidateCheckInInterval(*req.CheckInIntervalMinutes); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			update.CheckInIntervalMinutes = req.CheckInIntervalMinutes
 		}
 
-		if len(updates) == 0 {
+		if req.CheckInDeadline != nil {
+			deadline, err := services.NormalizeCheckInDeadline(*req.CheckInDeadline)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			update.CheckInDeadline = &deadline
+		}
+
+		if req.CheckInGraceMinutes != nil {
+			if err := services.ValidateCheckInGrace(*req.CheckInGraceMinutes); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			update.CheckInGraceMinutes = req.CheckInGraceMinutes
+		}
+
+		// 兼容旧客户端：按邮箱列表同步 emergency_contacts 表，新邮箱需要确认
+		// 放在所有字段校验之后，避免请求返回 400 时联系人已被修改
+		if req.EmergencyContactEmails != nil {
+			if err := contactService.SyncEmails(userID, req.EmergencyContactEmails); err != nil {
+				respondContactError(c, err)
+				return
+			}
+		}
+
+		if update.IsEmpty() {
+			if req.EmergencyContactEmails != nil {
+				c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
+				return
+			}
 			c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
 			return
 		}
 
-		args = append(args, userID)
-
-		query := "UPDATE users SET " + joinStrings(updates, ", ") + " WHERE id = ?"
-		_, err := db.Exec(query, args...)
-		if err != nil {
+		if err := users.Update(userID, update); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
-	}
-}
+		// 新邮箱需要验证后才能用于找回账号
+		if update.Email != nil && *update.Email != "" {
+			err := recoveryService.SendEmailVerification(userID)
+			if err != nil && !errors.Is(err, services.ErrEmailVerified) {
+				log.Printf("Failed to send email verification for user %d: %v", userID, err)
+			}
+		}
 
-func joinStrings(strs []string, sep string) string {
-	if len(strs) == 0 {
-		return ""
-	}
-	result := strs[0]
-	for i := 1; i < len(strs); i++ {
-		result += sep + strs[i]
+		c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
 	}
-	return result
 }
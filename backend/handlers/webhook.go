@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/deadornot/backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ListWebhooks 获取 webhook 列表
+func ListWebhooks(webhookService *services.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		webhooks, err := webhookService.List(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"webhooks": webhooks})
+	}
+}
+
+// CreateWebhook 登记 webhook，响应中的 secret 只返回这一次
+func CreateWebhook(webhookService *services.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		var req services.WebhookInput
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		webhook, err := webhookService.Create(userID, req)
+		if err != nil {
+			respondWebhookError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, webhook)
+	}
+}
+
+// UpdateWebhook 更新 webhook
+func UpdateWebhook(webhookService *services.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		webhookID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook id"})
+			return
+		}
+
+		var req services.WebhookInput
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		webhook, err := webhookService.Update(userID, webhookID, req)
+		if err != nil {
+			respondWebhookError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, webhook)
+	}
+}
+
+// DeleteWebhook 删除 webhook
+func DeleteWebhook(webhookService *services.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		webhookID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook id"})
+			return
+		}
+
+		if err := webhookService.Delete(userID, webhookID); err != nil {
+			respondWebhookError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+	}
+}
+
+// ListWebhookDeliveries 获取 webhook 最近的投递记录（含响应状态码）
+func ListWebhookDeliveries(webhookService *services.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+
+		webhookID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook id"})
+			return
+		}
+
+		deliveries, err := webhookService.ListDeliveries(userID, webhookID, 50)
+		if err != nil {
+			respondWebhookError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+	}
+}
+
+// respondWebhookError 将 webhook 服务的错误转换为响应
+func respondWebhookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrWebhookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+	case errors.Is(err, services.ErrContactNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Contact not found"})
+	case errors.Is(err, services.ErrTooManyWebhooks), errors.Is(err, services.ErrInvalidWebhookReq):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	}
+}
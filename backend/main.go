@@ -1,11 +1,15 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"text/tabwriter"
 
 	"github.com/deadornot/backend/config"
 	"github.com/deadornot/backend/database"
+	"github.com/deadornot/backend/repository"
 	"github.com/deadornot/backend/routes"
 	"github.com/deadornot/backend/services"
 	"github.com/gin-gonic/gin"
@@ -28,26 +32,66 @@ func main() {
 	}
 	defer db.Close()
 
+	// migrate 子命令：执行迁移后退出
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(db, os.Args[2:]); err != nil {
+			log.Fatalf("Migrate failed: %v", err)
+		}
+		return
+	}
+
 	// Run database migrations
 	if err := database.RunMigrations(db); err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	// Initialize repositories
+	repos := repository.New(db)
+
 	// Initialize services
 	pushService := services.NewPushService(cfg)
 	emailService := services.NewEmailService(cfg)
-	notificationService := services.NewNotificationService(db, emailService, pushService)
-	schedulerService := services.NewSchedulerService(db, notificationService, cfg)
-	authService := services.NewAuthService(db, cfg)
+	notificationService := services.NewNotificationService(repos.Notifications)
+
+	// Register notification channels
+	notificationService.Register(services.NewEmailNotifier(emailService, cfg))
+	notificationService.Register(services.NewPushNotifier(repos.Users, pushService, cfg))
+	if cfg.SMS.Provider != "" {
+		smsProvider, err := services.NewSMSProvider(cfg)
+		if err != nil {
+			log.Fatalf("Failed to initialize SMS provider: %v", err)
+		}
+		notificationService.Register(services.NewSMSNotifier(smsProvider, cfg))
+	}
+	notificationService.Register(services.NewWebhookNotifier(db, cfg))
+
+	authService := services.NewAuthService(repos, services.NewAppleVerifier(cfg), cfg)
+	escalationService := services.NewEscalationService(db)
+	linkSigner := services.NewLinkSigner(cfg)
+	webhookService := services.NewWebhookService(db, repos, notificationService, cfg)
+	contactService := services.NewContactService(db, notificationService, linkSigner, cfg)
+	incidentService := services.NewIncidentService(db, notificationService, linkSigner, webhookService, cfg)
+	checkInService := services.NewCheckInService(repos, incidentService, webhookService, cfg)
+	checkInLinkService := services.NewCheckInLinkService(db, linkSigner, cfg)
+	recoveryService := services.NewRecoveryService(db, repos, notificationService, linkSigner, cfg)
+	accountService := services.NewAccountService(repos, contactService, authService, cfg)
+	rateLimiter := services.NewRateLimiter(db, cfg)
+	pauseService := services.NewPauseService(repos, contactService, notificationService)
+	checkInStatsService := services.NewCheckInStatsService(repos)
+	schedulerService := services.NewSchedulerService(db, repos, notificationService, contactService, checkInLinkService, incidentService, webhookService, accountService, cfg)
 
 	// Start scheduler
 	go schedulerService.Start()
 
 	// Setup router
 	router := gin.Default()
+	// 限流、会话和安全事件记录的客户端 IP 只在请求来自可信代理时取自 X-Forwarded-For
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	// Setup routes
-	routes.SetupRoutes(router, db, notificationService, authService)
+	routes.SetupRoutes(router, db, repos, notificationService, authService, escalationService, contactService, checkInService, checkInLinkService, incidentService, webhookService, recoveryService, accountService, rateLimiter, pauseService, checkInStatsService)
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -60,3 +104,66 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// runMigrateCommand 执行 migrate up|down [N]|status
+func runMigrateCommand(db *database.DB, args []string) error {
+	migrator := database.NewMigrator(db)
+
+	command := "status"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up()
+		if err != nil {
+			return err
+		}
+		log.Printf("Applied %d migrations", applied)
+		return nil
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of migrations to revert: %q", args[1])
+			}
+			steps = n
+		}
+		reverted, err := migrator.Down(steps)
+		if err != nil {
+			return err
+		}
+		log.Printf("Reverted %d migrations", reverted)
+		return nil
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, status := range statuses {
+			state := "pending"
+			appliedAt := "-"
+			if status.Applied {
+				state = "applied"
+				appliedAt = status.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+			}
+			if status.ChecksumMismatch {
+				state = "modified"
+			}
+			if status.Unknown {
+				state = "unknown"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+		}
+		return w.Flush()
+
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down [N] or status", command)
+	}
+}
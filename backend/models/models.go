@@ -12,21 +12,212 @@ type User struct {
 	ID                     int64       `json:"id" db:"id"`
 	DeviceID               string      `json:"device_id" db:"device_id"`
 	Name                   string      `json:"name" db:"name"`
-	EmergencyContactEmails StringArray `json:"emergency_contact_emails" db:"emergency_contact_emails"`
+	Email                  string      `json:"email" db:"email"`
+	EmailVerifiedAt        *time.Time  `json:"email_verified_at" db:"email_verified_at"` // 邮箱验证时间，只有验证过的邮箱可以找回账号
+	AppleSub               string      `json:"-" db:"apple_sub"`                         // Sign in with Apple 的用户ID
+	AppleLinked            bool        `json:"apple_linked" db:"-"`                      // 是否已关联 Apple 账号
+	Phone                  string      `json:"phone" db:"phone"`
 	APNSToken              string      `json:"apns_token" db:"apns_token"`
 	PushEnabled            bool        `json:"push_enabled" db:"push_enabled"`
 	EmailEnabled           bool        `json:"email_enabled" db:"email_enabled"`
 	Timezone               string      `json:"timezone" db:"timezone"`
+	ReminderTimes          StringArray `json:"reminder_times" db:"reminder_times"`                     // 每日提醒时间（HH:MM，用户时区）
+	ReminderDays           StringArray `json:"reminder_days" db:"reminder_days"`                       // 提醒的星期（mon..sun）
+	CheckInIntervalMinutes int         `json:"checkin_interval_minutes" db:"checkin_interval_minutes"` // 打卡间隔（分钟），0 表示每天打卡一次
+	CheckInDeadline        string      `json:"checkin_deadline" db:"checkin_deadline"`                 // 每天打卡的截止时间（HH:MM，用户时区），为空表示不设截止时间
+	CheckInGraceMinutes    int         `json:"checkin_grace_minutes" db:"checkin_grace_minutes"`       // 超过截止时间后开始升级前的宽限时间（分钟）
+	ShareMood              bool        `json:"share_mood" db:"share_mood"`                             // 紧急提醒邮件中是否附带最近的心情
+	ShareNote              bool        `json:"share_note" db:"share_note"`                             // 紧急提醒邮件中是否附带最近的留言
+	ShareBattery           bool        `json:"share_battery" db:"share_battery"`                       // 紧急提醒邮件中是否附带最近的电量
+	ShareLocation          bool        `json:"share_location" db:"share_location"`                     // 紧急提醒邮件中是否附带最近的大致位置
+	DeletionScheduledAt    *time.Time  `json:"deletion_scheduled_at" db:"deletion_scheduled_at"`       // 申请注销后计划删除的时间
 	CreatedAt              time.Time   `json:"created_at" db:"created_at"`
 	UpdatedAt              time.Time   `json:"updated_at" db:"updated_at"`
 }
 
+// CheckInInterval 按间隔打卡的间隔，每天打卡一次的用户返回 0
+func (u *User) CheckInInterval() time.Duration {
+	return time.Duration(u.CheckInIntervalMinutes) * time.Minute
+}
+
+// CheckInSharing 用户同意在紧急提醒中分享给紧急联系人的打卡信息
+func (u *User) CheckInSharing() CheckInSharing {
+	return CheckInSharing{Mood: u.ShareMood, Note: u.ShareNote, Battery: u.ShareBattery, Location: u.ShareLocation}
+}
+
+// CheckInSharing 打卡信息的分享授权，每一项单独授权
+type CheckInSharing struct {
+	Mood     bool
+	Note     bool
+	Battery  bool
+	Location bool
+}
+
+// Any 是否授权分享任意一项
+func (s CheckInSharing) Any() bool {
+	return s.Mood || s.Note || s.Battery || s.Location
+}
+
+// UserDevice 用户关联的设备
+type UserDevice struct {
+	DeviceID  string    `json:"device_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Pause 暂停时段：出行、住院等期间不发送提醒、不触发升级，也不中断连续打卡
+type Pause struct {
+	ID             int64     `json:"id" db:"id"`
+	UserID         int64     `json:"user_id" db:"user_id"`
+	StartsAt       time.Time `json:"starts_at" db:"starts_at"`
+	EndsAt         time.Time `json:"ends_at" db:"ends_at"`
+	Reason         string    `json:"reason" db:"reason"`
+	NotifyContacts bool      `json:"notify_contacts" db:"notify_contacts"` // 是否通知紧急联系人
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// IsActive 判断暂停在 t 时刻是否生效
+func (p *Pause) IsActive(t time.Time) bool {
+	return !t.Before(p.StartsAt) && t.Before(p.EndsAt)
+}
+
+// CoversDate 判断暂停是否覆盖了某个本地日期（yyyy-MM-dd）的任意时间
+func (p *Pause) CoversDate(date string, loc *time.Location) bool {
+	day, err := time.ParseInLocation("2006-01-02", date, loc)
+	if err != nil {
+		return false
+	}
+	return p.StartsAt.Before(day.AddDate(0, 0, 1)) && p.EndsAt.After(day)
+}
+
 // CheckIn 打卡记录模型
 type CheckIn struct {
-	ID          int64     `json:"id" db:"id"`
-	UserID      int64     `json:"user_id" db:"user_id"`
-	CheckInDate time.Time `json:"checkin_date" db:"checkin_date"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	ID              int64      `json:"id" db:"id"`
+	UserID          int64      `json:"user_id" db:"user_id"`
+	CheckInDateTime time.Time  `json:"checkin_datetime" db:"checkin_datetime"`         // UTC
+	CheckInDate     time.Time  `json:"checkin_date" db:"checkin_date"`                 // 打卡时用户时区的本地日期
+	Timezone        string     `json:"timezone" db:"timezone"`                         // 计算本地日期时使用的时区
+	Source          string     `json:"source,omitempty" db:"source"`                   // 打卡时间的来源：server、client 或 backfill，旧记录为空
+	ReceivedAt      *time.Time `json:"received_at,omitempty" db:"received_at"`         // 服务器收到打卡的时间
+	ClientDateTime  *time.Time `json:"client_datetime,omitempty" db:"client_datetime"` // 客户端提交的原始打卡时间
+	CheckInDetails
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// CheckInStatsCache 打卡统计的增量缓存，记录已统计到的最后一条打卡，之后只需读取新的打卡记录
+type CheckInStatsCache struct {
+	UserID          int64     `db:"user_id"`
+	LastCheckInID   int64     `db:"last_checkin_id"`
+	LastCheckInAt   time.Time `db:"last_checkin_at"`   // 已统计的最晚一次打卡的时间（UTC）
+	LastCheckInDate string    `db:"last_checkin_date"` // 该次打卡的本地日期 yyyy-MM-dd
+	StreakLength    int       `db:"streak_length"`     // 截至该次打卡的连续打卡
+	LongestStreak   int       `db:"longest_streak"`
+	TimeSin         float64   `db:"time_sin"` // 打卡本地时间换算为角度后的正弦之和，用于计算平均打卡时间
+	TimeCos         float64   `db:"time_cos"`
+}
+
+// 打卡时间的来源
+const (
+	CheckInSourceServer   = "server"   // 使用服务器时间：客户端未提交时间，或提交的时间超出容差
+	CheckInSourceClient   = "client"   // 使用客户端提交的时间，在容差范围内
+	CheckInSourceBackfill = "backfill" // 补打卡，客户端明确提交的较早时间
+)
+
+// CheckInDetails 打卡时可选附带的状态信息
+type CheckInDetails struct {
+	Mood         *int     `json:"mood,omitempty" db:"mood"`                   // 心情 1-5
+	Note         string   `json:"note,omitempty" db:"note"`                   // 简短留言
+	BatteryLevel *int     `json:"battery_level,omitempty" db:"battery_level"` // 手机电量百分比
+	Latitude     *float64 `json:"latitude,omitempty" db:"latitude"`           // 大致位置，保留两位小数（约 1 公里）
+	Longitude    *float64 `json:"longitude,omitempty" db:"longitude"`
+}
+
+// IsEmpty 是否没有附带任何状态信息
+func (d CheckInDetails) IsEmpty() bool {
+	return d.Mood == nil && d.Note == "" && d.BatteryLevel == nil && d.Latitude == nil
+}
+
+// 打卡状态信息的取值范围
+const (
+	MinCheckInMood       = 1
+	MaxCheckInMood       = 5
+	MaxCheckInNoteLength = 280
+)
+
+// EmergencyContact 紧急联系人模型
+type EmergencyContact struct {
+	ID           int64      `json:"id" db:"id"`
+	UserID       int64      `json:"user_id" db:"user_id"`
+	Name         string     `json:"name" db:"name"`
+	Email        string     `json:"email" db:"email"`
+	Phone        string     `json:"phone" db:"phone"`
+	Relationship string     `json:"relationship" db:"relationship"`
+	Language     string     `json:"language" db:"language"`
+	VerifiedAt   *time.Time `json:"verified_at" db:"verified_at"`
+	OptedOutAt   *time.Time `json:"opted_out_at" db:"opted_out_at"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// 紧急事件状态
+const (
+	IncidentStatusOpen         = "open"
+	IncidentStatusAcknowledged = "acknowledged"
+	IncidentStatusResolved     = "resolved"
+)
+
+// Incident 紧急事件：一次未打卡升级从开启到用户重新打卡的全过程
+type Incident struct {
+	ID                 int64              `json:"id" db:"id"`
+	UserID             int64              `json:"user_id" db:"user_id"`
+	Status             string             `json:"status" db:"status"`
+	LastCheckinAt      *time.Time         `json:"last_checkin_at" db:"last_checkin_at"`
+	OpenedAt           time.Time          `json:"opened_at" db:"opened_at"`
+	AcknowledgedBy     *int64             `json:"acknowledged_by" db:"acknowledged_by"`
+	AcknowledgedByName string             `json:"acknowledged_by_name,omitempty"`
+	AcknowledgedAt     *time.Time         `json:"acknowledged_at" db:"acknowledged_at"`
+	PausedUntil        *time.Time         `json:"paused_until" db:"paused_until"`
+	ResolvedAt         *time.Time         `json:"resolved_at" db:"resolved_at"`
+	Contacts           []*IncidentContact `json:"contacts"`
+}
+
+// IsPaused 紧急联系人确认后，在暂停期内不再向联系人升级
+func (i *Incident) IsPaused(now time.Time) bool {
+	return i.PausedUntil != nil && now.Before(*i.PausedUntil)
+}
+
+// IncidentContact 紧急事件中被通知的联系人
+type IncidentContact struct {
+	ID             int64      `json:"-" db:"id"`
+	IncidentID     int64      `json:"-" db:"incident_id"`
+	ContactID      int64      `json:"contact_id" db:"contact_id"`
+	Name           string     `json:"name"`
+	Email          string     `json:"email"`
+	FirstAlertedAt time.Time  `json:"first_alerted_at" db:"first_alerted_at"`
+	LastAlertedAt  time.Time  `json:"last_alerted_at" db:"last_alerted_at"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at" db:"acknowledged_at"`
+	OptedOut       bool       `json:"-"`
+}
+
+// Webhook 事件类型
+const (
+	WebhookEventReminder   = "reminder"
+	WebhookEventEscalation = "escalation"
+	WebhookEventAllClear   = "all_clear"
+	WebhookEventCheckIn    = "checkin"
+)
+
+// Webhook 用户或紧急联系人登记的事件回调地址
+type Webhook struct {
+	ID        int64       `json:"id" db:"id"`
+	UserID    int64       `json:"-" db:"user_id"`
+	ContactID *int64      `json:"contact_id" db:"contact_id"` // 为空时属于用户本人
+	URL       string      `json:"url" db:"url"`
+	Secret    string      `json:"secret,omitempty" db:"secret"` // 仅在创建时返回
+	Events    StringArray `json:"events" db:"events"`
+	Enabled   bool        `json:"enabled" db:"enabled"`
+	CreatedAt time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at" db:"updated_at"`
 }
 
 // Notification 通知记录模型
@@ -45,6 +236,7 @@ type Notification struct {
 	Content          NotificationContent `json:"content" db:"content"`
 	Timezone         string              `json:"timezone" db:"timezone"`
 	UniqueKey        string              `json:"unique_key" db:"unique_key"`
+	ResponseStatus   *int                `json:"response_status" db:"response_status"`
 	CreatedAt        time.Time           `json:"created_at" db:"created_at"`
 	UpdatedAt        time.Time           `json:"updated_at" db:"updated_at"`
 }
@@ -56,15 +248,90 @@ type NotificationContent struct {
 	Data    map[string]interface{} `json:"data,omitempty"`
 }
 
+// 升级渠道
+const (
+	EscalationChannelPush  = "push"
+	EscalationChannelEmail = "email"
+	EscalationChannelSMS   = "sms"
+)
+
+// 升级对象
+const (
+	EscalationTargetUser     = "user"
+	EscalationTargetContacts = "contacts"
+)
+
+// EscalationStep 升级步骤：未打卡第 Day 天通过 Channel 通知 Target
+type EscalationStep struct {
+	Day         int    `json:"day"`
+	Channel     string `json:"channel"`
+	Target      string `json:"target"`
+	RepeatDaily bool   `json:"repeat_daily"` // 为 true 时第 Day 天之后每天重复
+}
+
+// EscalationSteps 升级步骤列表，用于JSON字段
+type EscalationSteps []EscalationStep
+
+// EscalationPolicy 用户的升级策略
+type EscalationPolicy struct {
+	UserID    int64           `json:"user_id" db:"user_id"`
+	Steps     EscalationSteps `json:"steps" db:"steps"`
+	IsDefault bool            `json:"is_default"`
+	UpdatedAt *time.Time      `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+// MaxReminderTimes 每天最多的提醒次数
+const MaxReminderTimes = 6
+
+// 打卡间隔和宽限时间的取值范围（分钟）
+const (
+	MinCheckInIntervalMinutes = 60
+	MaxCheckInIntervalMinutes = 7 * 24 * 60
+	MaxCheckInGraceMinutes    = 24 * 60
+)
+
+// ReminderWeekdays 提醒星期的取值，下标与 time.Weekday 一致
+var ReminderWeekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// DefaultReminderTimes 默认每日提醒时间
+func DefaultReminderTimes() StringArray {
+	return StringArray{"09:00"}
+}
+
+// DefaultReminderDays 默认每天都提醒
+func DefaultReminderDays() StringArray {
+	return append(StringArray{}, ReminderWeekdays...)
+}
+
+// DefaultEscalationSteps 默认升级策略
+func DefaultEscalationSteps() EscalationSteps {
+	return EscalationSteps{
+		{Day: 1, Channel: EscalationChannelPush, Target: EscalationTargetUser},
+		{Day: 2, Channel: EscalationChannelEmail, Target: EscalationTargetUser},
+		{Day: 3, Channel: EscalationChannelEmail, Target: EscalationTargetContacts},
+		{Day: 5, Channel: EscalationChannelSMS, Target: EscalationTargetContacts},
+		{Day: 7, Channel: EscalationChannelEmail, Target: EscalationTargetContacts, RepeatDaily: true},
+	}
+}
+
+// Matches 判断该步骤在未打卡第 daysSince 天是否需要触发
+func (s EscalationStep) Matches(daysSince int) bool {
+	if s.RepeatDaily {
+		return daysSince >= s.Day
+	}
+	return daysSince == s.Day
+}
+
 // StringArray 字符串数组类型，用于JSON字段
 type StringArray []string
 
 // Value 实现 driver.Valuer 接口
+// 返回字符串而不是 []byte，PostgreSQL 驱动会把 []byte 当作 bytea
 func (a StringArray) Value() (driver.Value, error) {
 	if len(a) == 0 {
 		return "[]", nil
 	}
-	return json.Marshal(a)
+	return jsonValue(a)
 }
 
 // Scan 实现 sql.Scanner 接口
@@ -89,7 +356,7 @@ func (a *StringArray) Scan(value interface{}) error {
 
 // Value 实现 driver.Valuer 接口
 func (nc NotificationContent) Value() (driver.Value, error) {
-	return json.Marshal(nc)
+	return jsonValue(nc)
 }
 
 // Scan 实现 sql.Scanner 接口
@@ -112,25 +379,101 @@ func (nc *NotificationContent) Scan(value interface{}) error {
 	return json.Unmarshal(bytes, nc)
 }
 
-// Token 模型
+// Value 实现 driver.Valuer 接口
+func (s EscalationSteps) Value() (driver.Value, error) {
+	if len(s) == 0 {
+		return "[]", nil
+	}
+	return jsonValue(s)
+}
+
+// jsonValue 序列化为 JSON 字符串，用于 JSON 字段
+func jsonValue(v interface{}) (driver.Value, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan 实现 sql.Scanner 接口
+func (s *EscalationSteps) Scan(value interface{}) error {
+	if value == nil {
+		*s = EscalationSteps{}
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New("cannot scan non-string value into EscalationSteps")
+	}
+
+	return json.Unmarshal(bytes, s)
+}
+
+// Token 模型，数据库只保存 Token 的 SHA-256 哈希
 type Token struct {
-	ID           int64     `json:"id" db:"id"`
-	UserID       int64     `json:"user_id" db:"user_id"`
-	DeviceID     string    `json:"device_id" db:"device_id"`
-	AccessToken  string    `json:"access_token" db:"access_token"`
-	RefreshToken string    `json:"refresh_token" db:"refresh_token"`
-	TokenType    string    `json:"token_type" db:"token_type"`
-	ExpiresAt    time.Time `json:"expires_at" db:"expires_at"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	ID               int64      `json:"id" db:"id"`
+	UserID           int64      `json:"user_id" db:"user_id"`
+	DeviceID         string     `json:"device_id" db:"device_id"`
+	FamilyID         string     `json:"-" db:"family_id"` // 同一次登录后刷新得到的 Token 属于同一家族
+	AccessTokenHash  string     `json:"-" db:"access_token"`
+	RefreshTokenHash string     `json:"-" db:"refresh_token"`
+	TokenType        string     `json:"token_type" db:"token_type"`
+	ExpiresAt        time.Time  `json:"expires_at" db:"expires_at"`                 // Access Token 过期时间
+	RefreshExpiresAt time.Time  `json:"refresh_expires_at" db:"refresh_expires_at"` // Refresh Token 过期时间
+	RotatedAt        *time.Time `json:"rotated_at,omitempty" db:"rotated_at"`       // 已刷新为新 Token 的时间，之后不再有效
+	SignedInAt       time.Time  `json:"signed_in_at" db:"signed_in_at"`             // 登录时间，刷新后保持不变
+	LastUsedAt       *time.Time `json:"last_used_at" db:"last_used_at"`
+	IPAddress        string     `json:"ip_address" db:"ip_address"`
+	UserAgent        string     `json:"user_agent" db:"user_agent"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Session 登录会话，即某次登录当前有效的 Token
+type Session struct {
+	ID         int64      `json:"id"`
+	DeviceID   string     `json:"device_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	IPAddress  string     `json:"ip_address"`
+	UserAgent  string     `json:"user_agent"`
+	Current    bool       `json:"current"` // 是否为当前请求使用的会话
+}
+
+// 安全事件类型
+const (
+	SecurityEventRefreshTokenReuse = "refresh_token_reuse" // 已刷新过的 Refresh Token 被再次使用
+	SecurityEventDevicePaired      = "device_paired"       // 通过配对码关联了新设备
+	SecurityEventDeviceRecovered   = "device_recovered"    // 通过邮箱找回账号关联了新设备
+	SecurityEventDeletionRequested = "deletion_requested"  // 申请注销账号
+	SecurityEventDeletionCancelled = "deletion_cancelled"  // 撤销注销申请
+)
+
+// SecurityEvent 安全事件，用户可以查看
+type SecurityEvent struct {
+	ID        int64     `json:"id" db:"id"`
+	UserID    int64     `json:"-" db:"user_id"`
+	EventType string    `json:"event_type" db:"event_type"`
+	DeviceID  string    `json:"device_id" db:"device_id"`
+	IPAddress string    `json:"ip_address" db:"ip_address"`
+	UserAgent string    `json:"user_agent" db:"user_agent"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
 // TokenResponse 登录响应
 type TokenResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
-	TokenType    string `json:"token_type"`
-	ExpiresIn    int64  `json:"expires_in"`
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in"`
 }
 
 // LoginRequest 登录请求
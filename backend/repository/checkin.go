@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/deadornot/backend/database"
+	"github.com/deadornot/backend/models"
+)
+
+const checkInColumns = `
+	id, user_id, checkin_datetime, checkin_date, timezone, source, received_at, client_datetime,
+	mood, note, battery_level, latitude, longitude, created_at
+`
+
+// checkInRepository CheckInRepository 的 SQL 实现
+// checkin_date 始终以 yyyy-MM-dd 字符串读写，SQLite 按文本比较日期
+type checkInRepository struct {
+	db *database.DB
+}
+
+// scanCheckIn 按 checkInColumns 的顺序读取打卡记录
+func scanCheckIn(row interface{ Scan(...interface{}) error }) (*models.CheckIn, error) {
+	var checkIn models.CheckIn
+	var timezone, source, note sql.NullString
+	var receivedAt, clientDateTime sql.NullTime
+	var mood, batteryLevel sql.NullInt64
+	var latitude, longitude sql.NullFloat64
+	err := row.Scan(
+		&checkIn.ID, &checkIn.UserID, &checkIn.CheckInDateTime, &checkIn.CheckInDate, &timezone,
+		&source, &receivedAt, &clientDateTime,
+		&mood, &note, &batteryLevel, &latitude, &longitude, &checkIn.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	checkIn.Timezone = timezone.String
+	checkIn.Source = source.String
+	if receivedAt.Valid {
+		checkIn.ReceivedAt = &receivedAt.Time
+	}
+	if clientDateTime.Valid {
+		checkIn.ClientDateTime = &clientDateTime.Time
+	}
+	checkIn.Note = note.String
+	if mood.Valid {
+		value := int(mood.Int64)
+		checkIn.Mood = &value
+	}
+	if batteryLevel.Valid {
+		value := int(batteryLevel.Int64)
+		checkIn.BatteryLevel = &value
+	}
+	if latitude.Valid && longitude.Valid {
+		checkIn.Latitude = &latitude.Float64
+		checkIn.Longitude = &longitude.Float64
+	}
+	return &checkIn, nil
+}
+
+// nullableString 空字符串保存为 NULL
+func nullableString(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+func (r *checkInRepository) Create(checkIn *models.CheckIn, oncePerDay bool) error {
+	// daily_date 上有唯一键，按间隔打卡时为 NULL，同一天可以有多条记录
+	date := checkIn.CheckInDate.Format("2006-01-02")
+	var dailyDate interface{}
+	if oncePerDay {
+		dailyDate = date
+	}
+
+	id, err := r.db.Insert(`
+		INSERT INTO checkins (
+			user_id, checkin_datetime, checkin_date, daily_date, timezone, source, received_at, client_datetime,
+			mood, note, battery_level, latitude, longitude
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, checkIn.UserID, checkIn.CheckInDateTime, date, dailyDate, checkIn.Timezone,
+		nullableString(checkIn.Source), checkIn.ReceivedAt, checkIn.ClientDateTime,
+		checkIn.Mood, nullableString(checkIn.Note), checkIn.BatteryLevel, checkIn.Latitude, checkIn.Longitude)
+	if r.db.Dialect().IsDuplicateKey(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	checkIn.ID = id
+	return nil
+}
+
+func (r *checkInRepository) ExistsOnDate(userID int64, date string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM checkins WHERE user_id = ? AND checkin_date = ?)
+	`, userID, date).Scan(&exists)
+	return exists, err
+}
+
+func (r *checkInRepository) Latest(userID int64) (*models.CheckIn, error) {
+	checkIn, err := scanCheckIn(r.db.QueryRow(`
+		SELECT `+checkInColumns+` FROM checkins
+		WHERE user_id = ?
+		ORDER BY checkin_date DESC, checkin_datetime DESC
+		LIMIT 1
+	`, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return checkIn, err
+}
+
+func (r *checkInRepository) List(userID int64, startDate, endDate string) ([]*models.CheckIn, error) {
+	query := "SELECT " + checkInColumns + " FROM checkins WHERE user_id = ?"
+	args := []interface{}{userID}
+
+	if startDate != "" {
+		query += " AND checkin_date >= ?"
+		args = append(args, startDate)
+	}
+	if endDate != "" {
+		query += " AND checkin_date <= ?"
+		args = append(args, endDate)
+	}
+	query += " ORDER BY checkin_datetime DESC"
+
+	return r.queryCheckIns(query, args...)
+}
+
+func (r *checkInRepository) CountDays(userID int64) (int, error) {
+	var count int
+	err := r.db.QueryRow(`
+		SELECT COUNT(DISTINCT checkin_date) FROM checkins WHERE user_id = ?
+	`, userID).Scan(&count)
+	return count, err
+}
+
+func (r *checkInRepository) ListAfterID(userID, afterID int64) ([]*models.CheckIn, error) {
+	return r.queryCheckIns(`
+		SELECT `+checkInColumns+` FROM checkins
+		WHERE user_id = ? AND id > ?
+		ORDER BY checkin_datetime ASC, id ASC
+	`, userID, afterID)
+}
+
+func (r *checkInRepository) Aggregate(userID int64) (*CheckInAggregate, error) {
+	rows, err := r.db.Query(`
+		SELECT `+r.db.Dialect().Weekday("checkin_date")+` AS weekday, COUNT(*), COUNT(DISTINCT checkin_date)
+		FROM checkins
+		WHERE user_id = ?
+		GROUP BY weekday
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// 每个日期只属于一个星期，按星期分组后的日期数之和即累计打卡天数
+	var aggregate CheckInAggregate
+	for rows.Next() {
+		var weekday, count, days int
+		if err := rows.Scan(&weekday, &count, &days); err != nil {
+			return nil, err
+		}
+		if weekday >= 0 && weekday < len(aggregate.WeekdayCounts) {
+			aggregate.WeekdayCounts[weekday] = count
+		}
+		aggregate.TotalDays += days
+	}
+	return &aggregate, rows.Err()
+}
+
+func (r *checkInRepository) ListWithDetails(userID int64, limit int) ([]*models.CheckIn, error) {
+	return r.queryCheckIns(`
+		SELECT `+checkInColumns+` FROM checkins
+		WHERE user_id = ?
+		  AND (mood IS NOT NULL OR note IS NOT NULL OR battery_level IS NOT NULL OR latitude IS NOT NULL)
+		ORDER BY checkin_datetime DESC
+		LIMIT ?
+	`, userID, limit)
+}
+
+// queryCheckIns 执行查询并按 checkInColumns 读取打卡记录
+func (r *checkInRepository) queryCheckIns(query string, args ...interface{}) ([]*models.CheckIn, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checkIns := []*models.CheckIn{}
+	for rows.Next() {
+		checkIn, err := scanCheckIn(rows)
+		if err != nil {
+			return nil, err
+		}
+		checkIns = append(checkIns, checkIn)
+	}
+	return checkIns, rows.Err()
+}
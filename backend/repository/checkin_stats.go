@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/deadornot/backend/database"
+	"github.com/deadornot/backend/models"
+)
+
+// checkInStatsRepository CheckInStatsRepository 的 SQL 实现
+type checkInStatsRepository struct {
+	db *database.DB
+}
+
+func (r *checkInStatsRepository) Get(userID int64) (*models.CheckInStatsCache, error) {
+	var cache models.CheckInStatsCache
+	err := r.db.QueryRow(`
+		SELECT user_id, last_checkin_id, last_checkin_at, last_checkin_date,
+		       streak_length, longest_streak, time_sin, time_cos
+		FROM checkin_stats
+		WHERE user_id = ?
+	`, userID).Scan(
+		&cache.UserID, &cache.LastCheckInID, &cache.LastCheckInAt, &cache.LastCheckInDate,
+		&cache.StreakLength, &cache.LongestStreak, &cache.TimeSin, &cache.TimeCos,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cache, nil
+}
+
+func (r *checkInStatsRepository) Save(cache *models.CheckInStatsCache) error {
+	_, err := r.db.Exec(`
+		INSERT INTO checkin_stats (
+			user_id, last_checkin_id, last_checkin_at, last_checkin_date,
+			streak_length, longest_streak, time_sin, time_cos, updated_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		`+r.db.Dialect().Upsert([]string{"user_id"},
+		"last_checkin_id", "last_checkin_at", "last_checkin_date",
+		"streak_length", "longest_streak", "time_sin", "time_cos", "updated_at"),
+		cache.UserID, cache.LastCheckInID, cache.LastCheckInAt, cache.LastCheckInDate,
+		cache.StreakLength, cache.LongestStreak, cache.TimeSin, cache.TimeCos)
+	return err
+}
@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/deadornot/backend/database"
+	"github.com/deadornot/backend/models"
+)
+
+const notificationColumns = `
+	id, user_id, notification_type, recipient, status, retry_count, max_retries,
+	scheduled_at, sent_at, error_message, response_status, content, timezone, created_at
+`
+
+// notificationRepository NotificationRepository 的 SQL 实现
+type notificationRepository struct {
+	db *database.DB
+}
+
+// scanNotification 按 notificationColumns 的顺序读取通知
+func scanNotification(row interface{ Scan(...interface{}) error }) (*models.Notification, error) {
+	var notif models.Notification
+	var sentAt sql.NullTime
+	var errorMessage, timezone sql.NullString
+	var responseStatus sql.NullInt64
+	err := row.Scan(
+		&notif.ID, &notif.UserID, &notif.NotificationType, &notif.Recipient, &notif.Status,
+		&notif.RetryCount, &notif.MaxRetries, &notif.ScheduledAt, &sentAt, &errorMessage,
+		&responseStatus, &notif.Content, &timezone, &notif.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if sentAt.Valid {
+		notif.SentAt = &sentAt.Time
+	}
+	notif.ErrorMessage = errorMessage.String
+	if responseStatus.Valid {
+		status := int(responseStatus.Int64)
+		notif.ResponseStatus = &status
+	}
+	notif.Timezone = timezone.String
+	return &notif, nil
+}
+
+// listNotifications 执行查询并读取通知列表
+func (r *notificationRepository) listNotifications(query string, args ...interface{}) ([]*models.Notification, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []*models.Notification{}
+	for rows.Next() {
+		notif, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notif)
+	}
+	return notifications, rows.Err()
+}
+
+func (r *notificationRepository) Create(notification *models.Notification) error {
+	id, err := r.db.Insert(`
+		INSERT INTO notifications
+		(user_id, notification_type, recipient, status, scheduled_at, content, timezone, unique_key, max_retries)
+		VALUES (?, ?, ?, 'pending', ?, ?, ?, ?, ?)
+	`, notification.UserID, notification.NotificationType, notification.Recipient, notification.ScheduledAt,
+		notification.Content, notification.Timezone, notification.UniqueKey, notification.MaxRetries)
+	if err != nil {
+		return err
+	}
+	notification.ID = id
+	notification.Status = "pending"
+	return nil
+}
+
+func (r *notificationRepository) CountActiveByUniqueKey(uniqueKey string) (int, error) {
+	var count int
+	err := r.db.QueryRow(`
+		SELECT COUNT(*) FROM notifications
+		WHERE unique_key = ? AND status != 'failed'
+	`, uniqueKey).Scan(&count)
+	return count, err
+}
+
+func (r *notificationRepository) ListDue(status string, limit int) ([]*models.Notification, error) {
+	return r.listNotifications(`
+		SELECT `+notificationColumns+`
+		FROM notifications
+		WHERE status = ? AND scheduled_at <= ?
+		ORDER BY scheduled_at ASC
+		LIMIT ?
+	`, status, time.Now(), limit)
+}
+
+func (r *notificationRepository) Claim(id int64, status string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE notifications
+		SET status = 'sending', claimed_at = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status = ?
+	`, time.Now(), id, status)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *notificationRepository) ReleaseStaleClaims(claimedBefore time.Time) (int64, error) {
+	now := time.Now()
+	const errorMessage = "claim expired before the send completed"
+
+	// 已用完重试次数的直接标记为失败，避免导致进程崩溃的通知被反复认领
+	failed, err := r.db.Exec(`
+		UPDATE notifications
+		SET status = 'failed', failed_at = ?, error_message = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE status = 'sending' AND (claimed_at IS NULL OR claimed_at < ?) AND retry_count >= max_retries
+	`, now, errorMessage, claimedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	retrying, err := r.db.Exec(`
+		UPDATE notifications
+		SET status = 'retrying', retry_count = retry_count + 1, scheduled_at = ?,
+		    error_message = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE status = 'sending' AND (claimed_at IS NULL OR claimed_at < ?)
+	`, now, errorMessage, claimedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	failedCount, err := failed.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	retryingCount, err := retrying.RowsAffected()
+	return failedCount + retryingCount, err
+}
+
+func (r *notificationRepository) MarkSent(id int64, sentAt time.Time, responseStatus *int) error {
+	_, err := r.db.Exec(`
+		UPDATE notifications
+		SET status = 'sent', sent_at = ?, response_status = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, sentAt, responseStatus, id)
+	return err
+}
+
+func (r *notificationRepository) MarkRetrying(id int64, scheduledAt time.Time, errorMessage string, responseStatus *int) error {
+	_, err := r.db.Exec(`
+		UPDATE notifications
+		SET status = 'retrying', retry_count = retry_count + 1,
+		    scheduled_at = ?, error_message = ?, response_status = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, scheduledAt, errorMessage, responseStatus, id)
+	return err
+}
+
+func (r *notificationRepository) MarkFailed(id int64, failedAt time.Time, errorMessage string, responseStatus *int) error {
+	_, err := r.db.Exec(`
+		UPDATE notifications
+		SET status = 'failed', failed_at = ?, error_message = ?, response_status = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, failedAt, errorMessage, responseStatus, id)
+	return err
+}
+
+func (r *notificationRepository) ListByWebhook(userID, webhookID int64, limit int) ([]*models.Notification, error) {
+	return r.listNotifications(`
+		SELECT `+notificationColumns+`
+		FROM notifications
+		WHERE user_id = ? AND notification_type = 'webhook'
+		  AND `+r.db.Dialect().JSONValue("content", "data", "webhook_id")+` = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, userID, webhookID, limit)
+}
+
+func (r *notificationRepository) ListByUser(userID int64) ([]*models.Notification, error) {
+	return r.listNotifications(`
+		SELECT `+notificationColumns+`
+		FROM notifications
+		WHERE user_id = ?
+		ORDER BY id DESC
+	`, userID)
+}
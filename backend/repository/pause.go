@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/deadornot/backend/database"
+	"github.com/deadornot/backend/models"
+)
+
+const pauseColumns = `id, user_id, starts_at, ends_at, reason, notify_contacts, created_at, updated_at`
+
+// pauseRepository PauseRepository 的 SQL 实现
+type pauseRepository struct {
+	db *database.DB
+}
+
+// scanPause 按 pauseColumns 的顺序读取暂停时段
+func scanPause(row interface{ Scan(...interface{}) error }) (*models.Pause, error) {
+	var pause models.Pause
+	var reason sql.NullString
+	err := row.Scan(
+		&pause.ID, &pause.UserID, &pause.StartsAt, &pause.EndsAt, &reason,
+		&pause.NotifyContacts, &pause.CreatedAt, &pause.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	pause.Reason = reason.String
+	return &pause, nil
+}
+
+// getPause 执行查询并读取一个暂停时段，没有时返回 ErrNotFound
+func (r *pauseRepository) getPause(query string, args ...interface{}) (*models.Pause, error) {
+	pause, err := scanPause(r.db.QueryRow(query, args...))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return pause, err
+}
+
+func (r *pauseRepository) Create(pause *models.Pause) error {
+	id, err := r.db.Insert(`
+		INSERT INTO user_pauses (user_id, starts_at, ends_at, reason, notify_contacts)
+		VALUES (?, ?, ?, ?, ?)
+	`, pause.UserID, pause.StartsAt, pause.EndsAt, pause.Reason, pause.NotifyContacts)
+	if err != nil {
+		return err
+	}
+	pause.ID = id
+	return nil
+}
+
+func (r *pauseRepository) Update(pause *models.Pause) error {
+	_, err := r.db.Exec(`
+		UPDATE user_pauses
+		SET starts_at = ?, ends_at = ?, reason = ?, notify_contacts = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, pause.StartsAt, pause.EndsAt, pause.Reason, pause.NotifyContacts, pause.ID)
+	return err
+}
+
+func (r *pauseRepository) Delete(id int64) error {
+	_, err := r.db.Exec(`DELETE FROM user_pauses WHERE id = ?`, id)
+	return err
+}
+
+func (r *pauseRepository) GetCurrent(userID int64, now time.Time) (*models.Pause, error) {
+	return r.getPause(`
+		SELECT `+pauseColumns+`
+		FROM user_pauses
+		WHERE user_id = ? AND ends_at > ?
+		ORDER BY starts_at
+		LIMIT 1
+	`, userID, now)
+}
+
+func (r *pauseRepository) LatestEnded(userID int64, now time.Time) (*models.Pause, error) {
+	return r.getPause(`
+		SELECT `+pauseColumns+`
+		FROM user_pauses
+		WHERE user_id = ? AND ends_at <= ?
+		ORDER BY ends_at DESC
+		LIMIT 1
+	`, userID, now)
+}
+
+func (r *pauseRepository) ListByUser(userID int64) ([]*models.Pause, error) {
+	return r.listPauses(`
+		SELECT `+pauseColumns+`
+		FROM user_pauses
+		WHERE user_id = ?
+		ORDER BY starts_at DESC
+	`, userID)
+}
+
+func (r *pauseRepository) ListEndingAfter(userID int64, after time.Time) ([]*models.Pause, error) {
+	return r.listPauses(`
+		SELECT `+pauseColumns+`
+		FROM user_pauses
+		WHERE user_id = ? AND ends_at > ?
+		ORDER BY starts_at DESC
+	`, userID, after)
+}
+
+// listPauses 执行查询并读取暂停时段列表
+func (r *pauseRepository) listPauses(query string, args ...interface{}) ([]*models.Pause, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pauses := []*models.Pause{}
+	for rows.Next() {
+		pause, err := scanPause(rows)
+		if err != nil {
+			return nil, err
+		}
+		pauses = append(pauses, pause)
+	}
+	return pauses, rows.Err()
+}
+
+func (r *pauseRepository) ListActiveUserIDs(now time.Time) ([]int64, error) {
+	rows, err := r.db.Query(`
+		SELECT DISTINCT user_id FROM user_pauses WHERE starts_at <= ? AND ends_at > ?
+	`, now, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/deadornot/backend/database"
+	"github.com/deadornot/backend/models"
+)
+
+var (
+	ErrNotFound  = errors.New("record not found")
+	ErrDuplicate = errors.New("duplicate record")
+	// ErrAccountHasData 设备关联到其他用户后原账号将无法登录，且原账号还有数据，需要用户确认放弃
+	ErrAccountHasData = errors.New("previous account has data")
+)
+
+// UserRepository 用户数据
+type UserRepository interface {
+	// Get 按ID获取用户，不存在时返回 ErrNotFound
+	Get(id int64) (*models.User, error)
+	// GetByDeviceID 按关联的设备ID获取用户，不存在时返回 ErrNotFound
+	GetByDeviceID(deviceID string) (*models.User, error)
+	// GetByAppleSub 按 Apple 用户ID获取用户，不存在时返回 ErrNotFound
+	GetByAppleSub(appleSub string) (*models.User, error)
+	// SetAppleSub 关联 Apple 账号，已关联到其他用户时返回 ErrDuplicate
+	SetAppleSub(id int64, appleSub string) error
+	// GetByVerifiedEmail 按已验证的邮箱获取用户，不存在时返回 ErrNotFound
+	GetByVerifiedEmail(email string) (*models.User, error)
+	// Create 创建用户并关联设备，返回用户ID
+	Create(deviceID, timezone string) (int64, error)
+	// LinkDevice 将设备关联到用户；设备已属于其他用户时移到该用户
+	// 原用户因此无法再登录（没有其他设备且未关联 Apple 账号）时：没有数据则删除原用户；
+	// 有数据时只有 discardPrevious 为 true 才删除，否则返回 ErrAccountHasData 且不做任何修改
+	LinkDevice(userID int64, deviceID string, discardPrevious bool) error
+	// MarkEmailVerified 标记用户邮箱已验证，邮箱已被修改时返回 false
+	MarkEmailVerified(id int64, email string) (bool, error)
+	// ListDevices 获取用户关联的设备
+	ListDevices(id int64) ([]*models.UserDevice, error)
+	// ScheduleDeletion 设置计划删除的时间，nil 表示撤销注销
+	ScheduleDeletion(id int64, at *time.Time) error
+	// ListDueForDeletion 获取计划删除时间已到的用户ID
+	ListDueForDeletion(before time.Time) ([]int64, error)
+	// Delete 删除用户，关联数据由外键级联删除
+	Delete(id int64) error
+	// Update 更新用户设置，只更新 update 中不为空的字段
+	Update(id int64, update UserUpdate) error
+	// List 获取所有用户
+	List() ([]*models.User, error)
+}
+
+// UserUpdate 用户设置的修改，nil 表示不修改
+type UserUpdate struct {
+	Name          *string
+	Email         *string
+	Phone         *string
+	APNSToken     *string
+	PushEnabled   *bool
+	EmailEnabled  *bool
+	Timezone      *string
+	ReminderTimes models.StringArray
+	ReminderDays  models.StringArray
+
+	CheckInIntervalMinutes *int
+	CheckInDeadline        *string // 空字符串表示取消截止时间
+	CheckInGraceMinutes    *int
+
+	ShareMood     *bool
+	ShareNote     *bool
+	ShareBattery  *bool
+	ShareLocation *bool
+}
+
+// IsEmpty 是否没有需要修改的字段
+func (u UserUpdate) IsEmpty() bool {
+	return u.Name == nil && u.Email == nil && u.Phone == nil && u.APNSToken == nil &&
+		u.PushEnabled == nil && u.EmailEnabled == nil && u.Timezone == nil &&
+		u.ReminderTimes == nil && u.ReminderDays == nil &&
+		u.CheckInIntervalMinutes == nil && u.CheckInDeadline == nil && u.CheckInGraceMinutes == nil &&
+		u.ShareMood == nil && u.ShareNote == nil && u.ShareBattery == nil && u.ShareLocation == nil
+}
+
+// CheckInRepository 打卡记录
+type CheckInRepository interface {
+	// Create 保存打卡记录并设置 checkIn.ID
+	// oncePerDay 为 true 时同一本地日期已有每日打卡记录返回 ErrDuplicate，按间隔打卡的记录不受限制
+	Create(checkIn *models.CheckIn, oncePerDay bool) error
+	// ExistsOnDate 用户在某个本地日期（yyyy-MM-dd）是否已打卡
+	ExistsOnDate(userID int64, date string) (bool, error)
+	// Latest 获取用户最近一次打卡，从未打卡时返回 ErrNotFound
+	Latest(userID int64) (*models.CheckIn, error)
+	// List 按本地日期范围（yyyy-MM-dd，为空表示不限）获取打卡记录，按时间倒序
+	List(userID int64, startDate, endDate string) ([]*models.CheckIn, error)
+	// CountDays 累计打卡天数
+	CountDays(userID int64) (int, error)
+	// ListAfterID 获取ID大于 afterID 的打卡记录，按打卡时间正序，用于增量更新统计
+	ListAfterID(userID, afterID int64) ([]*models.CheckIn, error)
+	// Aggregate 一次查询统计累计打卡天数和按星期的打卡次数
+	Aggregate(userID int64) (*CheckInAggregate, error)
+	// ListWithDetails 获取最近 limit 条附带状态信息的打卡记录，按时间倒序
+	ListWithDetails(userID int64, limit int) ([]*models.CheckIn, error)
+}
+
+// CheckInAggregate 打卡记录的聚合统计
+type CheckInAggregate struct {
+	TotalDays     int    // 累计打卡天数
+	WeekdayCounts [7]int // 按本地日期的星期统计的打卡次数，下标 0 为星期日
+}
+
+// CheckInStatsRepository 打卡统计的增量缓存
+type CheckInStatsRepository interface {
+	// Get 获取用户的统计缓存，没有时返回 ErrNotFound
+	Get(userID int64) (*models.CheckInStatsCache, error)
+	// Save 保存统计缓存
+	Save(cache *models.CheckInStatsCache) error
+}
+
+// NotificationRepository 通知记录
+type NotificationRepository interface {
+	// Create 创建待发送的通知
+	Create(notification *models.Notification) error
+	// CountActiveByUniqueKey 唯一键相同且未失败的通知数量，用于去重
+	CountActiveByUniqueKey(uniqueKey string) (int, error)
+	// ListDue 获取状态为 status 且已到发送时间的通知
+	ListDue(status string, limit int) ([]*models.Notification, error)
+	// Claim 将通知从 status 改为 sending，返回 false 表示已被其他进程处理
+	Claim(id int64, status string) (bool, error)
+	// ReleaseStaleClaims 将认领时间早于 claimedBefore 仍处于 sending 的通知放回重试队列，返回处理的数量
+	// 发送期间进程崩溃或重启时，这些通知不会再被其他步骤处理
+	ReleaseStaleClaims(claimedBefore time.Time) (int64, error)
+	// MarkSent 标记为发送成功
+	MarkSent(id int64, sentAt time.Time, responseStatus *int) error
+	// MarkRetrying 标记为等待重试
+	MarkRetrying(id int64, scheduledAt time.Time, errorMessage string, responseStatus *int) error
+	// MarkFailed 标记为发送失败
+	MarkFailed(id int64, failedAt time.Time, errorMessage string, responseStatus *int) error
+	// ListByWebhook 获取 webhook 最近的投递记录
+	ListByWebhook(userID, webhookID int64, limit int) ([]*models.Notification, error)
+	// ListByUser 获取用户的全部通知记录，按时间倒序
+	ListByUser(userID int64) ([]*models.Notification, error)
+}
+
+// TokenRepository 登录 Token，只保存和查询 Token 的哈希
+type TokenRepository interface {
+	// Create 保存 Token
+	Create(token *models.Token) error
+	// Get 按ID获取，不存在时返回 ErrNotFound
+	Get(id int64) (*models.Token, error)
+	// GetByAccessTokenHash 按 Access Token 哈希获取，不存在时返回 ErrNotFound
+	GetByAccessTokenHash(accessTokenHash string) (*models.Token, error)
+	// GetByRefreshTokenHash 按 Refresh Token 哈希获取，不存在时返回 ErrNotFound
+	GetByRefreshTokenHash(refreshTokenHash string) (*models.Token, error)
+	// ListActiveByUser 获取用户未被刷新的 Token，即每次登录当前有效的 Token
+	ListActiveByUser(userID int64) ([]*models.Token, error)
+	// Touch 记录 Token 的最近使用时间和客户端信息
+	Touch(id int64, usedAt time.Time, ipAddress, userAgent string) error
+	// MarkRotated 标记 Token 已刷新，返回 false 表示已被刷新过
+	MarkRotated(id int64, rotatedAt time.Time) (bool, error)
+	// Delete 删除 Token
+	Delete(id int64) error
+	// DeleteFamily 删除同一家族的所有 Token
+	DeleteFamily(familyID string) error
+	// DeleteOtherFamilies 删除用户其他家族的 Token
+	DeleteOtherFamilies(userID int64, keepFamilyID string) error
+	// DeleteExpired 删除 Refresh Token 在 before 之前过期的 Token
+	DeleteExpired(before time.Time) error
+	// DeleteByDevice 删除用户某台设备的 Token
+	DeleteByDevice(userID int64, deviceID string) error
+}
+
+// SecurityEventRepository 安全事件
+type SecurityEventRepository interface {
+	// Create 记录安全事件
+	Create(event *models.SecurityEvent) error
+	// ListByUser 获取用户最近的安全事件，按时间倒序
+	ListByUser(userID int64, limit int) ([]*models.SecurityEvent, error)
+}
+
+// PauseRepository 暂停时段
+type PauseRepository interface {
+	// Create 创建暂停时段并设置 pause.ID
+	Create(pause *models.Pause) error
+	// Update 更新暂停的时间、原因和是否通知联系人
+	Update(pause *models.Pause) error
+	// Delete 删除暂停时段
+	Delete(id int64) error
+	// GetCurrent 获取 now 时尚未结束（生效中或未开始）的暂停，没有时返回 ErrNotFound
+	GetCurrent(userID int64, now time.Time) (*models.Pause, error)
+	// LatestEnded 获取 now 之前最近结束的暂停，没有时返回 ErrNotFound
+	LatestEnded(userID int64, now time.Time) (*models.Pause, error)
+	// ListByUser 获取用户的全部暂停时段，按开始时间倒序
+	ListByUser(userID int64) ([]*models.Pause, error)
+	// ListEndingAfter 获取在 after 之后结束的暂停时段，按开始时间倒序
+	ListEndingAfter(userID int64, after time.Time) ([]*models.Pause, error)
+	// ListActiveUserIDs 获取 now 时处于暂停中的用户ID
+	ListActiveUserIDs(now time.Time) ([]int64, error)
+}
+
+// Repositories 所有数据仓库
+type Repositories struct {
+	Users          UserRepository
+	CheckIns       CheckInRepository
+	CheckInStats   CheckInStatsRepository
+	Notifications  NotificationRepository
+	Tokens         TokenRepository
+	SecurityEvents SecurityEventRepository
+	Pauses         PauseRepository
+}
+
+// New 创建数据仓库，SQL 差异由 db 的 Dialect 处理（MySQL、PostgreSQL、SQLite）
+func New(db *database.DB) *Repositories {
+	return &Repositories{
+		Users:          &userRepository{db: db},
+		CheckIns:       &checkInRepository{db: db},
+		CheckInStats:   &checkInStatsRepository{db: db},
+		Notifications:  &notificationRepository{db: db},
+		Tokens:         &tokenRepository{db: db},
+		SecurityEvents: &securityEventRepository{db: db},
+		Pauses:         &pauseRepository{db: db},
+	}
+}
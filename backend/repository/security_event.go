@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"github.com/deadornot/backend/database"
+	"github.com/deadornot/backend/models"
+)
+
+// securityEventRepository SecurityEventRepository 的 SQL 实现
+type securityEventRepository struct {
+	db *database.DB
+}
+
+func (r *securityEventRepository) Create(event *models.SecurityEvent) error {
+	id, err := r.db.Insert(`
+		INSERT INTO security_events (user_id, event_type, device_id, ip_address, user_agent)
+		VALUES (?, ?, ?, ?, ?)
+	`, event.UserID, event.EventType, event.DeviceID, event.IPAddress, event.UserAgent)
+	if err != nil {
+		return err
+	}
+	event.ID = id
+	return nil
+}
+
+func (r *securityEventRepository) ListByUser(userID int64, limit int) ([]*models.SecurityEvent, error) {
+	rows, err := r.db.Query(`
+		SELECT id, user_id, event_type, device_id, ip_address, user_agent, created_at
+		FROM security_events
+		WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*models.SecurityEvent{}
+	for rows.Next() {
+		var event models.SecurityEvent
+		if err := rows.Scan(&event.ID, &event.UserID, &event.EventType, &event.DeviceID,
+			&event.IPAddress, &event.UserAgent, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	return events, rows.Err()
+}
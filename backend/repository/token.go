@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/deadornot/backend/database"
+	"github.com/deadornot/backend/models"
+)
+
+const tokenColumns = `
+	id, user_id, device_id, family_id, access_token, refresh_token, token_type, expires_at, refresh_expires_at,
+	rotated_at, signed_in_at, last_used_at, ip_address, user_agent, created_at, updated_at
+`
+
+// tokenRepository TokenRepository 的 SQL 实现
+// access_token 和 refresh_token 字段保存的是 Token 的哈希
+type tokenRepository struct {
+	db *database.DB
+}
+
+// scanToken 按 tokenColumns 的顺序读取 Token
+func scanToken(row interface{ Scan(...interface{}) error }) (*models.Token, error) {
+	var token models.Token
+	var familyID, ipAddress, userAgent sql.NullString
+	var refreshExpiresAt, rotatedAt, signedInAt, lastUsedAt sql.NullTime
+	err := row.Scan(
+		&token.ID, &token.UserID, &token.DeviceID, &familyID, &token.AccessTokenHash, &token.RefreshTokenHash,
+		&token.TokenType, &token.ExpiresAt, &refreshExpiresAt, &rotatedAt, &signedInAt, &lastUsedAt,
+		&ipAddress, &userAgent, &token.CreatedAt, &token.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// 旧数据的 Refresh Token 与 Access Token 同时过期
+	token.RefreshExpiresAt = token.ExpiresAt
+	if refreshExpiresAt.Valid {
+		token.RefreshExpiresAt = refreshExpiresAt.Time
+	}
+	token.SignedInAt = token.CreatedAt
+	if signedInAt.Valid {
+		token.SignedInAt = signedInAt.Time
+	}
+	token.FamilyID = familyID.String
+	if rotatedAt.Valid {
+		token.RotatedAt = &rotatedAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	token.IPAddress = ipAddress.String
+	token.UserAgent = userAgent.String
+	return &token, nil
+}
+
+// getToken 按条件获取一个 Token
+func (r *tokenRepository) getToken(where string, args ...interface{}) (*models.Token, error) {
+	token, err := scanToken(r.db.QueryRow(`SELECT `+tokenColumns+` FROM tokens WHERE `+where, args...))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return token, err
+}
+
+func (r *tokenRepository) Create(token *models.Token) error {
+	if token.TokenType == "" {
+		token.TokenType = "Bearer"
+	}
+	id, err := r.db.Insert(`
+		INSERT INTO tokens (
+			user_id, device_id, family_id, access_token, refresh_token, token_type, expires_at, refresh_expires_at,
+			signed_in_at, last_used_at, ip_address, user_agent
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, token.UserID, token.DeviceID, token.FamilyID, token.AccessTokenHash, token.RefreshTokenHash, token.TokenType,
+		token.ExpiresAt, token.RefreshExpiresAt, token.SignedInAt, token.LastUsedAt, token.IPAddress, token.UserAgent)
+	if err != nil {
+		return err
+	}
+	token.ID = id
+	return nil
+}
+
+func (r *tokenRepository) Get(id int64) (*models.Token, error) {
+	return r.getToken("id = ?", id)
+}
+
+func (r *tokenRepository) GetByAccessTokenHash(accessTokenHash string) (*models.Token, error) {
+	return r.getToken("access_token = ?", accessTokenHash)
+}
+
+func (r *tokenRepository) GetByRefreshTokenHash(refreshTokenHash string) (*models.Token, error) {
+	return r.getToken("refresh_token = ?", refreshTokenHash)
+}
+
+func (r *tokenRepository) ListActiveByUser(userID int64) ([]*models.Token, error) {
+	rows, err := r.db.Query(`
+		SELECT `+tokenColumns+`
+		FROM tokens
+		WHERE user_id = ? AND rotated_at IS NULL
+		ORDER BY signed_in_at DESC, id DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*models.Token{}
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (r *tokenRepository) Touch(id int64, usedAt time.Time, ipAddress, userAgent string) error {
+	_, err := r.db.Exec(`
+		UPDATE tokens SET last_used_at = ?, ip_address = ?, user_agent = ? WHERE id = ?
+	`, usedAt, ipAddress, userAgent, id)
+	return err
+}
+
+func (r *tokenRepository) MarkRotated(id int64, rotatedAt time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE tokens
+		SET rotated_at = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND rotated_at IS NULL
+	`, rotatedAt, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *tokenRepository) Delete(id int64) error {
+	_, err := r.db.Exec(`DELETE FROM tokens WHERE id = ?`, id)
+	return err
+}
+
+func (r *tokenRepository) DeleteFamily(familyID string) error {
+	_, err := r.db.Exec(`DELETE FROM tokens WHERE family_id = ?`, familyID)
+	return err
+}
+
+func (r *tokenRepository) DeleteOtherFamilies(userID int64, keepFamilyID string) error {
+	_, err := r.db.Exec(`DELETE FROM tokens WHERE user_id = ? AND family_id <> ?`, userID, keepFamilyID)
+	return err
+}
+
+func (r *tokenRepository) DeleteExpired(before time.Time) error {
+	_, err := r.db.Exec(`DELETE FROM tokens WHERE refresh_expires_at < ?`, before)
+	return err
+}
+
+func (r *tokenRepository) DeleteByDevice(userID int64, deviceID string) error {
+	_, err := r.db.Exec(`DELETE FROM tokens WHERE user_id = ? AND device_id = ?`, userID, deviceID)
+	return err
+}
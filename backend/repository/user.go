@@ -0,0 +1,372 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/deadornot/backend/database"
+	"github.com/deadornot/backend/models"
+)
+
+const userColumns = `
+	id, device_id, name, email, email_verified_at, apple_sub, phone, apns_token,
+	push_enabled, email_enabled, timezone, reminder_times, reminder_days,
+	checkin_interval_minutes, checkin_deadline, checkin_grace_minutes,
+	share_mood, share_note, share_battery, share_location, deletion_scheduled_at, created_at, updated_at
+`
+
+// userRepository UserRepository 的 SQL 实现
+type userRepository struct {
+	db *database.DB
+}
+
+// scanUser 按 userColumns 的顺序读取用户
+func scanUser(row interface{ Scan(...interface{}) error }) (*models.User, error) {
+	var user models.User
+	var name, email, appleSub, phone, apnsToken, timezone, checkInDeadline sql.NullString
+	var emailVerifiedAt, deletionScheduledAt sql.NullTime
+	err := row.Scan(
+		&user.ID, &user.DeviceID, &name, &email, &emailVerifiedAt, &appleSub, &phone, &apnsToken,
+		&user.PushEnabled, &user.EmailEnabled, &timezone, &user.ReminderTimes, &user.ReminderDays,
+		&user.CheckInIntervalMinutes, &checkInDeadline, &user.CheckInGraceMinutes,
+		&user.ShareMood, &user.ShareNote, &user.ShareBattery, &user.ShareLocation, &deletionScheduledAt, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Name = name.String
+	user.Email = email.String
+	if emailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &emailVerifiedAt.Time
+	}
+	if deletionScheduledAt.Valid {
+		user.DeletionScheduledAt = &deletionScheduledAt.Time
+	}
+	user.AppleSub = appleSub.String
+	user.AppleLinked = user.AppleSub != ""
+	user.Phone = phone.String
+	user.APNSToken = apnsToken.String
+	user.CheckInDeadline = checkInDeadline.String
+	user.Timezone = timezone.String
+	if user.Timezone == "" {
+		user.Timezone = "UTC"
+	}
+	return &user, nil
+}
+
+func (r *userRepository) Get(id int64) (*models.User, error) {
+	user, err := scanUser(r.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return user, err
+}
+
+func (r *userRepository) GetByDeviceID(deviceID string) (*models.User, error) {
+	user, err := scanUser(r.db.QueryRow(`
+		SELECT `+userColumns+` FROM users
+		WHERE id = (SELECT user_id FROM user_devices WHERE device_id = ?)
+	`, deviceID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return user, err
+}
+
+func (r *userRepository) GetByAppleSub(appleSub string) (*models.User, error) {
+	user, err := scanUser(r.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE apple_sub = ?`, appleSub))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return user, err
+}
+
+func (r *userRepository) SetAppleSub(id int64, appleSub string) error {
+	_, err := r.db.Exec(`
+		UPDATE users SET apple_sub = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+	`, appleSub, id)
+	if r.db.Dialect().IsDuplicateKey(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *userRepository) GetByVerifiedEmail(email string) (*models.User, error) {
+	user, err := scanUser(r.db.QueryRow(`
+		SELECT `+userColumns+` FROM users
+		WHERE LOWER(email) = LOWER(?) AND email_verified_at IS NOT NULL
+		ORDER BY email_verified_at DESC, id DESC
+		LIMIT 1
+	`, email))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return user, err
+}
+
+func (r *userRepository) Create(deviceID, timezone string) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := tx.Insert(`
+		INSERT INTO users (device_id, timezone) VALUES (?, ?)
+	`, deviceID, timezone)
+	if r.db.Dialect().IsDuplicateKey(err) {
+		return 0, ErrDuplicate
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO user_devices (user_id, device_id) VALUES (?, ?)`, id, deviceID)
+	if r.db.Dialect().IsDuplicateKey(err) {
+		return 0, ErrDuplicate
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func (r *userRepository) LinkDevice(userID int64, deviceID string, discardPrevious bool) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var ownerID int64
+	err = tx.QueryRow(`SELECT user_id FROM user_devices WHERE device_id = ?`, deviceID).Scan(&ownerID)
+	switch {
+	case err == sql.ErrNoRows:
+		if _, err := tx.Exec(`INSERT INTO user_devices (user_id, device_id) VALUES (?, ?)`, userID, deviceID); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case ownerID == userID:
+		return nil
+	default:
+		// 设备从原账号移出，原账号在该设备上的登录全部失效
+		if _, err := tx.Exec(`UPDATE user_devices SET user_id = ? WHERE device_id = ?`, userID, deviceID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM tokens WHERE user_id = ? AND device_id = ?`, ownerID, deviceID); err != nil {
+			return err
+		}
+
+		// 原账号没有其他设备且未关联 Apple 账号时已无法登录，删除它，避免继续发送提醒和紧急通知
+		// 删除会级联删除打卡记录和紧急联系人等数据，原账号有数据时必须由用户确认
+		var orphaned bool
+		err := tx.QueryRow(`
+			SELECT NOT EXISTS(SELECT 1 FROM user_devices WHERE user_id = ?)
+			   AND EXISTS(SELECT 1 FROM users WHERE id = ? AND COALESCE(apple_sub, '') = '')
+		`, ownerID, ownerID).Scan(&orphaned)
+		if err != nil {
+			return err
+		}
+		if orphaned {
+			if !discardPrevious {
+				hasData, err := userHasData(tx, ownerID)
+				if err != nil {
+					return err
+				}
+				if hasData {
+					return ErrAccountHasData
+				}
+			}
+			if _, err := tx.Exec(`DELETE FROM users WHERE id = ?`, ownerID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// userHasData 用户是否有删除后无法恢复的数据：打卡记录、紧急联系人、紧急事件、webhook 或邮箱
+func userHasData(tx *database.Tx, userID int64) (bool, error) {
+	var hasData bool
+	err := tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM checkins WHERE user_id = ?)
+		    OR EXISTS(SELECT 1 FROM emergency_contacts WHERE user_id = ?)
+		    OR EXISTS(SELECT 1 FROM incidents WHERE user_id = ?)
+		    OR EXISTS(SELECT 1 FROM webhooks WHERE user_id = ?)
+		    OR EXISTS(SELECT 1 FROM users WHERE id = ? AND COALESCE(email, '') <> '')
+	`, userID, userID, userID, userID, userID).Scan(&hasData)
+	return hasData, err
+}
+
+func (r *userRepository) MarkEmailVerified(id int64, email string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE users SET email_verified_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND email = ?
+	`, id, email)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *userRepository) Update(id int64, update UserUpdate) error {
+	updates := []string{}
+	args := []interface{}{}
+
+	set := func(column string, value interface{}) {
+		updates = append(updates, column+" = ?")
+		args = append(args, value)
+	}
+	if update.Name != nil {
+		set("name", *update.Name)
+	}
+	if update.Email != nil {
+		// 邮箱变化后需要重新验证；MySQL 按顺序赋值，必须在修改 email 之前比较
+		updates = append(updates, "email_verified_at = CASE WHEN email = ? THEN email_verified_at ELSE NULL END")
+		args = append(args, *update.Email)
+		set("email", *update.Email)
+	}
+	if update.Phone != nil {
+		set("phone", *update.Phone)
+	}
+	if update.APNSToken != nil {
+		set("apns_token", *update.APNSToken)
+	}
+	if update.PushEnabled != nil {
+		set("push_enabled", *update.PushEnabled)
+	}
+	if update.EmailEnabled != nil {
+		set("email_enabled", *update.EmailEnabled)
+	}
+	if update.Timezone != nil {
+		set("timezone", *update.Timezone)
+	}
+	if update.ReminderTimes != nil {
+		set("reminder_times", update.ReminderTimes)
+	}
+	if update.ReminderDays != nil {
+		set("reminder_days", update.ReminderDays)
+	}
+	if update.CheckInIntervalMinutes != nil {
+		set("checkin_interval_minutes", *update.CheckInIntervalMinutes)
+	}
+	if update.CheckInDeadline != nil {
+		// 空字符串表示取消截止时间
+		var deadline interface{}
+		if *update.CheckInDeadline != "" {
+			deadline = *update.CheckInDeadline
+		}
+		set("checkin_deadline", deadline)
+	}
+	if update.CheckInGraceMinutes != nil {
+		set("checkin_grace_minutes", *update.CheckInGraceMinutes)
+	}
+	if update.ShareMood != nil {
+		set("share_mood", *update.ShareMood)
+	}
+	if update.ShareNote != nil {
+		set("share_note", *update.ShareNote)
+	}
+	if update.ShareBattery != nil {
+		set("share_battery", *update.ShareBattery)
+	}
+	if update.ShareLocation != nil {
+		set("share_location", *update.ShareLocation)
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+
+	updates = append(updates, "updated_at = CURRENT_TIMESTAMP")
+	args = append(args, id)
+
+	_, err := r.db.Exec("UPDATE users SET "+strings.Join(updates, ", ")+" WHERE id = ?", args...)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	// 连续打卡按打卡频率计算，频率修改后缓存的统计需要重新计算
+	if update.CheckInIntervalMinutes != nil || update.CheckInDeadline != nil || update.CheckInGraceMinutes != nil {
+		if _, err := r.db.Exec(`DELETE FROM checkin_stats WHERE user_id = ?`, id); err != nil {
+			return fmt.Errorf("failed to reset check-in stats: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *userRepository) List() ([]*models.User, error) {
+	rows, err := r.db.Query(`SELECT ` + userColumns + ` FROM users ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (r *userRepository) ScheduleDeletion(id int64, at *time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE users SET deletion_scheduled_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+	`, at, id)
+	return err
+}
+
+func (r *userRepository) ListDueForDeletion(before time.Time) ([]int64, error) {
+	rows, err := r.db.Query(`
+		SELECT id FROM users WHERE deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?
+	`, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *userRepository) Delete(id int64) error {
+	_, err := r.db.Exec(`DELETE FROM users WHERE id = ?`, id)
+	return err
+}
+
+func (r *userRepository) ListDevices(id int64) ([]*models.UserDevice, error) {
+	rows, err := r.db.Query(`
+		SELECT device_id, created_at FROM user_devices WHERE user_id = ? ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []*models.UserDevice{}
+	for rows.Next() {
+		var device models.UserDevice
+		if err := rows.Scan(&device.DeviceID, &device.CreatedAt); err != nil {
+			return nil, err
+		}
+		devices = append(devices, &device)
+	}
+	return devices, rows.Err()
+}
@@ -1,46 +1,133 @@
 package routes
 
 import (
-	"database/sql"
-
+	"github.com/deadornot/backend/database"
 	"github.com/deadornot/backend/handlers"
+	"github.com/deadornot/backend/repository"
 	"github.com/deadornot/backend/services"
 	"github.com/gin-gonic/gin"
 )
 
 // SetupRoutes 设置路由
-func SetupRoutes(router *gin.Engine, db *sql.DB, notificationService *services.NotificationService, authService *services.AuthService) {
+func SetupRoutes(router *gin.Engine, db *database.DB, repos *repository.Repositories, notificationService *services.NotificationService, authService *services.AuthService, escalationService *services.EscalationService, contactService *services.ContactService, checkInService *services.CheckInService, checkInLinkService *services.CheckInLinkService, incidentService *services.IncidentService, webhookService *services.WebhookService, recoveryService *services.RecoveryService, accountService *services.AccountService, rateLimiter *services.RateLimiter, pauseService *services.PauseService, checkInStatsService *services.CheckInStatsService) {
 	api := router.Group("/api")
 	{
 		// 健康检查
-		api.GET("/health", handlers.HealthCheck(db))
+		api.GET("/health", handlers.HealthCheck(db.DB, notificationService))
 
 		// 认证相关
 		authGroup := api.Group("/auth")
 		{
+			// 登录、配对和找回会创建或关联账号，按 IP 和设备限流
+			authLimit := handlers.RateLimitMiddleware(rateLimiter, services.RateLimitAuth)
+
 			// 登录（不需要认证）
-			authGroup.POST("/login", handlers.NewAuthHandler(authService).Login(db))
+			authGroup.POST("/login", authLimit, handlers.NewAuthHandler(authService).Login())
+			// Sign in with Apple（不需要认证，使用 Apple 的 identity token）
+			authGroup.POST("/apple", authLimit, handlers.NewAuthHandler(authService).Apple())
 			// 刷新 Token（不需要认证，使用 refresh_token）
-			authGroup.POST("/refresh", handlers.NewAuthHandler(authService).Refresh())
+			authGroup.POST("/refresh", handlers.RateLimitMiddleware(rateLimiter, services.RateLimitRefresh), handlers.NewAuthHandler(authService).Refresh())
 			// 注销（需要认证）
 			authGroup.POST("/logout", handlers.AuthMiddleware(authService), handlers.NewAuthHandler(authService).Logout())
+			// 安全事件（需要认证）
+			authGroup.GET("/security-events", handlers.AuthMiddleware(authService), handlers.NewAuthHandler(authService).ListSecurityEvents())
+
+			// 登录会话管理（需要认证）
+			sessionsGroup := authGroup.Group("/sessions", handlers.AuthMiddleware(authService))
+			sessionsGroup.GET("", handlers.NewAuthHandler(authService).ListSessions())
+			sessionsGroup.POST("/revoke-others", handlers.NewAuthHandler(authService).RevokeOtherSessions())
+			sessionsGroup.DELETE("/:id", handlers.NewAuthHandler(authService).RevokeSession())
+
+			// 新设备关联已有账号：旧设备生成配对码（需要认证），新设备使用配对码登录
+			authGroup.POST("/pairing-code", handlers.AuthMiddleware(authService), handlers.CreatePairingCode(recoveryService))
+			authGroup.POST("/pair", authLimit, handlers.PairDevice(recoveryService, authService))
+
+			// 通过已验证的邮箱找回账号，邮件中的链接不需要认证
+			authGroup.POST("/recovery", authLimit, handlers.RequestRecovery(recoveryService))
+			authGroup.GET("/recovery/:token", handlers.RecoveryPage(recoveryService))
+			authGroup.POST("/recovery/:token", handlers.Recover(recoveryService))
+
+			// 邮箱验证链接（不需要认证，使用签名令牌）
+			authGroup.GET("/verify-email/:token", handlers.VerifyEmailPage(recoveryService))
+			authGroup.POST("/verify-email/:token", handlers.VerifyEmail(recoveryService))
 		}
 
 		// 用户相关（需要Token认证）
 		userGroup := api.Group("/user")
 		userGroup.Use(handlers.AuthMiddleware(authService))
 		{
-			userGroup.GET("", handlers.GetUser(db))
-			userGroup.PUT("", handlers.UpdateUser(db))
+			userGroup.GET("", handlers.GetUser(repos.Users, contactService))
+			userGroup.PUT("", handlers.UpdateUser(repos.Users, contactService, recoveryService))
+			// 注销账号：宽限期内可以撤销，期满后删除全部数据
+			userGroup.DELETE("", handlers.DeleteAccount(accountService))
+			userGroup.POST("/cancel-deletion", handlers.CancelAccountDeletion(accountService))
+			userGroup.GET("/export", handlers.ExportAccount(accountService))
+
+			// 暂停模式：出行、住院等期间暂停提醒和升级
+			userGroup.GET("/pause", handlers.GetPause(pauseService))
+			userGroup.PUT("/pause", handlers.SetPause(pauseService))
+			userGroup.DELETE("/pause", handlers.EndPause(pauseService))
+			userGroup.POST("/email/verify", handlers.SendEmailVerification(recoveryService))
+
+			// 升级策略
+			userGroup.GET("/escalation", handlers.GetEscalationPolicy(escalationService))
+			userGroup.PUT("/escalation", handlers.UpdateEscalationPolicy(escalationService))
+			userGroup.DELETE("/escalation", handlers.ResetEscalationPolicy(escalationService))
+		}
+
+		// 紧急联系人
+		contactsGroup := api.Group("/contacts")
+		{
+			// 邮件中的确认/退订链接（不需要认证，使用签名令牌）
+			contactsGroup.GET("/confirm/:token", handlers.ConfirmContactPage(contactService))
+			contactsGroup.POST("/confirm/:token", handlers.ConfirmContact(contactService))
+			contactsGroup.GET("/opt-out/:token", handlers.OptOutContactPage(contactService))
+			contactsGroup.POST("/opt-out/:token", handlers.OptOutContact(contactService))
+
+			// 管理紧急联系人（需要Token认证）
+			authContacts := contactsGroup.Group("", handlers.AuthMiddleware(authService))
+			authContacts.GET("", handlers.ListContacts(contactService))
+			authContacts.POST("", handlers.CreateContact(contactService))
+			authContacts.PUT("/:id", handlers.UpdateContact(contactService))
+			authContacts.DELETE("/:id", handlers.DeleteContact(contactService))
+			authContacts.POST("/:id/resend", handlers.ResendContactConfirmation(contactService))
+		}
+
+		// 紧急事件
+		incidentGroup := api.Group("/incidents")
+		{
+			// 紧急联系人邮件中的"我会去确认"链接（不需要认证，使用签名令牌）
+			incidentGroup.GET("/ack/:token", handlers.AcknowledgeIncidentPage(incidentService))
+			incidentGroup.POST("/ack/:token", handlers.AcknowledgeIncident(incidentService))
+
+			incidentGroup.GET("", handlers.AuthMiddleware(authService), handlers.ListIncidents(incidentService))
+		}
+
+		// 事件回调（需要Token认证）
+		webhookGroup := api.Group("/webhooks")
+		webhookGroup.Use(handlers.AuthMiddleware(authService))
+		{
+			webhookGroup.GET("", handlers.ListWebhooks(webhookService))
+			webhookGroup.POST("", handlers.CreateWebhook(webhookService))
+			webhookGroup.PUT("/:id", handlers.UpdateWebhook(webhookService))
+			webhookGroup.DELETE("/:id", handlers.DeleteWebhook(webhookService))
+			webhookGroup.GET("/:id/deliveries", handlers.ListWebhookDeliveries(webhookService))
 		}
 
 		// 打卡相关（需要Token认证）
 		checkinGroup := api.Group("/checkin")
-		checkinGroup.Use(handlers.AuthMiddleware(authService))
 		{
-			checkinGroup.POST("", handlers.CheckIn(db))
-			checkinGroup.GET("/history", handlers.GetCheckInHistory(db))
-			checkinGroup.GET("/stats", handlers.GetCheckInStats(db))
+			// 打卡按 IP 和用户限流，限流放在认证之后以便按用户计数
+			checkinLimit := handlers.RateLimitMiddleware(rateLimiter, services.RateLimitCheckIn)
+
+			// 提醒中的一键打卡链接（不需要认证，使用一次性签名令牌）
+			checkinGroup.GET("/link/:token", handlers.CheckInLinkPage(checkInLinkService))
+			checkinGroup.POST("/link/:token", checkinLimit, handlers.CheckInByLink(checkInService, checkInLinkService))
+
+			authCheckin := checkinGroup.Group("", handlers.AuthMiddleware(authService))
+			authCheckin.POST("", checkinLimit, handlers.CheckIn(checkInService))
+			authCheckin.GET("/history", handlers.GetCheckInHistory(repos.CheckIns))
+			authCheckin.GET("/stats", handlers.GetCheckInStats(repos.Users, repos.Pauses, checkInStatsService))
 		}
 	}
 }
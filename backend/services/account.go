@@ -0,0 +1,194 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/deadornot/backend/config"
+	"github.com/deadornot/backend/models"
+	"github.com/deadornot/backend/repository"
+)
+
+// AccountExport 用户数据导出
+type AccountExport struct {
+	ExportedAt    time.Time                  `json:"exported_at"`
+	Profile       *models.User               `json:"profile"`
+	Devices       []*models.UserDevice       `json:"devices"`
+	Contacts      []*models.EmergencyContact `json:"contacts"`
+	CheckIns      []*models.CheckIn          `json:"checkins"`
+	Notifications []*models.Notification     `json:"notifications"`
+	Sessions      []*models.Session          `json:"sessions"`
+}
+
+// WriteZip 将导出数据按类别写成 ZIP，每个类别一个 JSON 文件
+func (e *AccountExport) WriteZip(w io.Writer) error {
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", e.Profile},
+		{"devices.json", e.Devices},
+		{"contacts.json", e.Contacts},
+		{"checkins.json", e.CheckIns},
+		{"notifications.json", e.Notifications},
+		{"sessions.json", e.Sessions},
+	}
+
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		f, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: e.ExportedAt,
+		})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// AccountService 账号注销和数据导出
+type AccountService struct {
+	users          repository.UserRepository
+	checkIns       repository.CheckInRepository
+	notifications  repository.NotificationRepository
+	securityEvents repository.SecurityEventRepository
+	contactService *ContactService
+	authService    *AuthService
+	config         *config.Config
+}
+
+// NewAccountService 创建账号服务
+func NewAccountService(repos *repository.Repositories, contactService *ContactService, authService *AuthService, cfg *config.Config) *AccountService {
+	return &AccountService{
+		users:          repos.Users,
+		checkIns:       repos.CheckIns,
+		notifications:  repos.Notifications,
+		securityEvents: repos.SecurityEvents,
+		contactService: contactService,
+		authService:    authService,
+		config:         cfg,
+	}
+}
+
+// RequestDeletion 申请注销账号，宽限期结束后由定时任务删除全部数据
+// 已申请过时返回原来的计划删除时间
+func (as *AccountService) RequestDeletion(userID int64, client ClientInfo) (time.Time, error) {
+	user, err := as.users.Get(userID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.DeletionScheduledAt != nil {
+		return *user.DeletionScheduledAt, nil
+	}
+
+	scheduledAt := time.Now().Add(as.config.Account.DeletionGracePeriod)
+	if err := as.users.ScheduleDeletion(userID, &scheduledAt); err != nil {
+		return time.Time{}, fmt.Errorf("failed to schedule deletion: %w", err)
+	}
+
+	as.recordSecurityEvent(userID, models.SecurityEventDeletionRequested, client)
+	return scheduledAt, nil
+}
+
+// CancelDeletion 在宽限期内撤销注销申请，未申请时返回 false
+func (as *AccountService) CancelDeletion(userID int64, client ClientInfo) (bool, error) {
+	user, err := as.users.Get(userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.DeletionScheduledAt == nil {
+		return false, nil
+	}
+
+	if err := as.users.ScheduleDeletion(userID, nil); err != nil {
+		return false, fmt.Errorf("failed to cancel deletion: %w", err)
+	}
+
+	as.recordSecurityEvent(userID, models.SecurityEventDeletionCancelled, client)
+	return true, nil
+}
+
+// PurgeDueDeletions 删除宽限期已结束的账号，关联数据由外键级联删除
+func (as *AccountService) PurgeDueDeletions() error {
+	userIDs, err := as.users.ListDueForDeletion(time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to query accounts due for deletion: %w", err)
+	}
+
+	for _, userID := range userIDs {
+		if err := as.users.Delete(userID); err != nil {
+			log.Printf("Failed to delete account %d: %v", userID, err)
+			continue
+		}
+		log.Printf("Deleted account %d after deletion grace period", userID)
+	}
+	return nil
+}
+
+// Export 导出用户的资料、设备、紧急联系人、打卡记录、通知记录和登录会话
+func (as *AccountService) Export(userID, currentTokenID int64) (*AccountExport, error) {
+	user, err := as.users.Get(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	devices, err := as.users.ListDevices(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query devices: %w", err)
+	}
+
+	contacts, err := as.contactService.List(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	checkIns, err := as.checkIns.List(userID, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query check-ins: %w", err)
+	}
+
+	notifications, err := as.notifications.ListByUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notifications: %w", err)
+	}
+
+	sessions, err := as.authService.ListSessions(userID, currentTokenID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccountExport{
+		ExportedAt:    time.Now().UTC(),
+		Profile:       user,
+		Devices:       devices,
+		Contacts:      contacts,
+		CheckIns:      checkIns,
+		Notifications: notifications,
+		Sessions:      sessions,
+	}, nil
+}
+
+// recordSecurityEvent 记录账号注销相关的安全事件，失败时只记录日志
+func (as *AccountService) recordSecurityEvent(userID int64, eventType string, client ClientInfo) {
+	client = client.normalized()
+	err := as.securityEvents.Create(&models.SecurityEvent{
+		UserID:    userID,
+		EventType: eventType,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+	})
+	if err != nil {
+		log.Printf("Failed to record security event for user %d: %v", userID, err)
+	}
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deadornot/backend/config"
+)
+
+// Apple 公钥的缓存时间和 identity token 允许的时钟误差
+const (
+	jwksCacheTTL        = 24 * time.Hour
+	jwksMinRefreshDelay = time.Minute
+	appleClockSkew      = time.Minute
+)
+
+var (
+	ErrAppleSignInDisabled  = errors.New("Sign in with Apple is not configured")
+	ErrInvalidIdentityToken = errors.New("invalid identity token")
+)
+
+// AppleIdentity identity token 中的用户信息
+type AppleIdentity struct {
+	Subject       string // 用户在该开发者账号下稳定的ID
+	Email         string
+	EmailVerified bool
+}
+
+// AppleVerifier 校验 Sign in with Apple 的 identity token（RS256 签名的 JWT）
+type AppleVerifier struct {
+	config *config.Config
+	client *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+// NewAppleVerifier 创建 identity token 校验器
+func NewAppleVerifier(cfg *config.Config) *AppleVerifier {
+	return &AppleVerifier{
+		config: cfg,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Enabled 是否配置了允许的 Client ID
+func (av *AppleVerifier) Enabled() bool {
+	return len(av.config.Apple.ClientIDs) > 0
+}
+
+// appleClaims identity token 中需要校验的字段
+type appleClaims struct {
+	Issuer        string          `json:"iss"`
+	Subject       string          `json:"sub"`
+	Audience      json.RawMessage `json:"aud"`
+	ExpiresAt     int64           `json:"exp"`
+	IssuedAt      int64           `json:"iat"`
+	Email         string          `json:"email"`
+	EmailVerified interface{}     `json:"email_verified"` // Apple 可能返回字符串 "true" 或布尔值
+}
+
+// Verify 校验 identity token 的签名、签发者、受众和有效期
+func (av *AppleVerifier) Verify(identityToken string) (*AppleIdentity, error) {
+	if !av.Enabled() {
+		return nil, ErrAppleSignInDisabled
+	}
+
+	parts := strings.Split(identityToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIdentityToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil || header.Alg != "RS256" {
+		return nil, ErrInvalidIdentityToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidIdentityToken
+	}
+
+	key, err := av.publicKey(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, ErrInvalidIdentityToken
+	}
+
+	var claims appleClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, ErrInvalidIdentityToken
+	}
+
+	now := time.Now()
+	switch {
+	case claims.Issuer != av.config.Apple.Issuer:
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidIdentityToken)
+	case !av.validAudience(claims.Audience):
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidIdentityToken)
+	case now.After(time.Unix(claims.ExpiresAt, 0).Add(appleClockSkew)):
+		return nil, fmt.Errorf("%w: token has expired", ErrInvalidIdentityToken)
+	case time.Unix(claims.IssuedAt, 0).After(now.Add(appleClockSkew)):
+		return nil, fmt.Errorf("%w: token issued in the future", ErrInvalidIdentityToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIdentityToken)
+	}
+
+	return &AppleIdentity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified == true || claims.EmailVerified == "true",
+	}, nil
+}
+
+// validAudience aud 可能是字符串或字符串数组，其中之一为允许的 Client ID 即可
+func (av *AppleVerifier) validAudience(raw json.RawMessage) bool {
+	var audiences []string
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		audiences = []string{single}
+	} else if err := json.Unmarshal(raw, &audiences); err != nil {
+		return false
+	}
+
+	for _, aud := range audiences {
+		for _, clientID := range av.config.Apple.ClientIDs {
+			if aud == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// publicKey 按 kid 获取公钥，缓存过期或 kid 未知时重新拉取 JWKS
+func (av *AppleVerifier) publicKey(kid string) (*rsa.PublicKey, error) {
+	av.mu.Lock()
+	defer av.mu.Unlock()
+
+	key, ok := av.keys[kid]
+	expired := time.Since(av.fetchedAt) > jwksCacheTTL
+	if ok && !expired {
+		return key, nil
+	}
+
+	// Apple 轮换密钥后才会出现未知 kid，限制拉取频率，避免伪造的 kid 或 Apple 不可用时频繁请求
+	if time.Since(av.lastAttempt) > jwksMinRefreshDelay {
+		av.lastAttempt = time.Now()
+		keys, err := av.fetchKeys()
+		if err != nil {
+			if ok {
+				return key, nil
+			}
+			return nil, fmt.Errorf("failed to fetch Apple public keys: %w", err)
+		}
+		av.keys = keys
+		av.fetchedAt = time.Now()
+	}
+
+	key, ok = av.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key id", ErrInvalidIdentityToken)
+	}
+	return key, nil
+}
+
+// fetchKeys 拉取并解析 JWKS 中的 RSA 公钥
+func (av *AppleVerifier) fetchKeys() (map[string]*rsa.PublicKey, error) {
+	resp, err := av.client.Get(av.config.Apple.JWKSURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no RSA keys found")
+	}
+	return keys, nil
+}
+
+// decodeJWTPart 解码 JWT 的 header 或 payload
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/deadornot/backend/config"
+)
+
+const (
+	testAppleIssuer   = "https://appleid.apple.com"
+	testAppleClientID = "com.example.deadornot"
+)
+
+// testJWKS 本地 JWKS 服务，可以随时替换公布的密钥以模拟 Apple 轮换密钥
+type testJWKS struct {
+	mu      sync.Mutex
+	keys    map[string]*rsa.PrivateKey
+	fetches int32
+	server  *httptest.Server
+}
+
+func newTestJWKS(t *testing.T, kids ...string) *testJWKS {
+	t.Helper()
+	jwks := &testJWKS{keys: map[string]*rsa.PrivateKey{}}
+	for _, kid := range kids {
+		jwks.keys[kid] = generateTestRSAKey(t)
+	}
+	jwks.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&jwks.fetches, 1)
+
+		jwks.mu.Lock()
+		defer jwks.mu.Unlock()
+		type jwk struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		}
+		body := struct {
+			Keys []jwk `json:"keys"`
+		}{}
+		for kid, key := range jwks.keys {
+			body.Keys = append(body.Keys, jwk{
+				Kty: "RSA",
+				Kid: kid,
+				Alg: "RS256",
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(jwks.server.Close)
+	return jwks
+}
+
+// rotate 替换公布的全部密钥
+func (j *testJWKS) rotate(t *testing.T, kids ...string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.keys = map[string]*rsa.PrivateKey{}
+	for _, kid := range kids {
+		j.keys[kid] = generateTestRSAKey(t)
+	}
+}
+
+func (j *testJWKS) key(kid string) *rsa.PrivateKey {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.keys[kid]
+}
+
+func generateTestRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return key
+}
+
+func newTestAppleVerifier(jwks *testJWKS) *AppleVerifier {
+	return NewAppleVerifier(&config.Config{Apple: config.AppleConfig{
+		ClientIDs: []string{testAppleClientID},
+		Issuer:    testAppleIssuer,
+		JWKSURL:   jwks.server.URL,
+	}})
+}
+
+// validClaims 一组可以通过校验的 claims
+func validClaims() map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":            testAppleIssuer,
+		"aud":            testAppleClientID,
+		"sub":            "001234.abcdef",
+		"iat":            now.Unix(),
+		"exp":            now.Add(10 * time.Minute).Unix(),
+		"email":          "user@privaterelay.appleid.com",
+		"email_verified": "true",
+	}
+}
+
+// signTestToken 用 RS256 签名生成 identity token，alg 只写入 header
+func signTestToken(t *testing.T, key *rsa.PrivateKey, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	signingInput := encode(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestAppleVerifierValidToken(t *testing.T) {
+	jwks := newTestJWKS(t, "key-1")
+	verifier := newTestAppleVerifier(jwks)
+
+	identity, err := verifier.Verify(signTestToken(t, jwks.key("key-1"), "RS256", "key-1", validClaims()))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if identity.Subject != "001234.abcdef" || identity.Email != "user@privaterelay.appleid.com" || !identity.EmailVerified {
+		t.Errorf("identity = %+v", identity)
+	}
+
+	// aud 为数组时其中之一匹配即可
+	claims := validClaims()
+	claims["aud"] = []string{"com.example.other", testAppleClientID}
+	if _, err := verifier.Verify(signTestToken(t, jwks.key("key-1"), "RS256", "key-1", claims)); err != nil {
+		t.Errorf("Verify with audience list: %v", err)
+	}
+}
+
+func TestAppleVerifierRejectsInvalidTokens(t *testing.T) {
+	jwks := newTestJWKS(t, "key-1")
+	verifier := newTestAppleVerifier(jwks)
+	key := jwks.key("key-1")
+	otherKey := generateTestRSAKey(t)
+
+	withClaim := func(name string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		claims[name] = value
+		return claims
+	}
+
+	cases := map[string]string{
+		"bad signature":  signTestToken(t, otherKey, "RS256", "key-1", validClaims()),
+		"alg HS256":      signTestToken(t, key, "HS256", "key-1", validClaims()),
+		"alg none":       signTestToken(t, key, "none", "key-1", validClaims()),
+		"wrong audience": signTestToken(t, key, "RS256", "key-1", withClaim("aud", "com.example.other")),
+		"wrong issuer":   signTestToken(t, key, "RS256", "key-1", withClaim("iss", "https://evil.example.com")),
+		"expired":        signTestToken(t, key, "RS256", "key-1", withClaim("exp", time.Now().Add(-time.Hour).Unix())),
+		"issued later":   signTestToken(t, key, "RS256", "key-1", withClaim("iat", time.Now().Add(time.Hour).Unix())),
+		"missing sub":    signTestToken(t, key, "RS256", "key-1", withClaim("sub", "")),
+		"malformed":      "not-a-jwt",
+	}
+	for name, token := range cases {
+		if _, err := verifier.Verify(token); !errors.Is(err, ErrInvalidIdentityToken) {
+			t.Errorf("%s: Verify = %v, want ErrInvalidIdentityToken", name, err)
+		}
+	}
+}
+
+func TestAppleVerifierKeyRotation(t *testing.T) {
+	jwks := newTestJWKS(t, "key-1")
+	verifier := newTestAppleVerifier(jwks)
+
+	if _, err := verifier.Verify(signTestToken(t, jwks.key("key-1"), "RS256", "key-1", validClaims())); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	// 缓存中的密钥直接使用，不重复拉取
+	if _, err := verifier.Verify(signTestToken(t, jwks.key("key-1"), "RS256", "key-1", validClaims())); err != nil {
+		t.Fatalf("Verify cached: %v", err)
+	}
+	if got := atomic.LoadInt32(&jwks.fetches); got != 1 {
+		t.Fatalf("fetches = %d, want 1", got)
+	}
+
+	jwks.rotate(t, "key-2")
+	token := signTestToken(t, jwks.key("key-2"), "RS256", "key-2", validClaims())
+
+	// 距上次拉取不足最小间隔时，未知 kid 不会触发拉取
+	if _, err := verifier.Verify(token); !errors.Is(err, ErrInvalidIdentityToken) {
+		t.Fatalf("Verify within refresh delay = %v, want ErrInvalidIdentityToken", err)
+	}
+	if got := atomic.LoadInt32(&jwks.fetches); got != 1 {
+		t.Fatalf("fetches = %d, want 1", got)
+	}
+
+	// 超过最小间隔后，未知 kid 触发重新拉取并使用新密钥
+	verifier.lastAttempt = time.Now().Add(-2 * jwksMinRefreshDelay)
+	if _, err := verifier.Verify(token); err != nil {
+		t.Fatalf("Verify after rotation: %v", err)
+	}
+	if got := atomic.LoadInt32(&jwks.fetches); got != 2 {
+		t.Errorf("fetches = %d, want 2", got)
+	}
+}
+
+func TestAppleVerifierDisabled(t *testing.T) {
+	verifier := NewAppleVerifier(&config.Config{})
+	if _, err := verifier.Verify("a.b.c"); !errors.Is(err, ErrAppleSignInDisabled) {
+		t.Errorf("Verify = %v, want ErrAppleSignInDisabled", err)
+	}
+}
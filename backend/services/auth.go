@@ -2,14 +2,16 @@ package services
 
 import (
 	"crypto/rand"
-	"database/sql"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/deadornot/backend/config"
 	"github.com/deadornot/backend/models"
+	"github.com/deadornot/backend/repository"
 )
 
 // TokenConfig Token配置
@@ -18,16 +20,62 @@ type TokenConfig struct {
 	RefreshTokenExpiry time.Duration // Refresh Token 过期时间，默认 30 天
 }
 
+// ErrRefreshTokenReuse 已刷新过的 Refresh Token 被再次使用，该设备的登录已被撤销
+var ErrRefreshTokenReuse = errors.New("refresh token reuse detected, please log in again")
+
+// ErrSessionNotFound 会话不存在或不属于当前用户
+var ErrSessionNotFound = errors.New("Session not found")
+
+// ErrAppleAccountMismatch 设备已属于关联了其他 Apple 账号的用户
+var ErrAppleAccountMismatch = errors.New("this device is linked to a different Apple ID")
+
+// sessionTouchInterval 会话最近使用时间的最小更新间隔，避免每个请求都写数据库
+const sessionTouchInterval = time.Minute
+
+// ClientInfo 发起请求的客户端信息，用于会话列表和安全事件
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+}
+
+// normalized 截断过长的客户端信息，与数据库字段长度一致
+func (ci ClientInfo) normalized() ClientInfo {
+	return ClientInfo{
+		IPAddress: truncateRunes(ci.IPAddress, 64),
+		UserAgent: truncateRunes(ci.UserAgent, 255),
+	}
+}
+
+// truncateRunes 按字符截断字符串
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
+
 // AuthService 认证服务
 type AuthService struct {
-	DB     *sql.DB
-	config *config.Config
+	users          repository.UserRepository
+	tokens         repository.TokenRepository
+	securityEvents repository.SecurityEventRepository
+	apple          *AppleVerifier
+	tokenConfig    TokenConfig
+	config         *config.Config
 }
 
 // NewAuthService 创建认证服务
-func NewAuthService(db *sql.DB, cfg *config.Config) *AuthService {
+func NewAuthService(repos *repository.Repositories, apple *AppleVerifier, cfg *config.Config) *AuthService {
 	return &AuthService{
-		DB:     db,
+		users:          repos.Users,
+		tokens:         repos.Tokens,
+		securityEvents: repos.SecurityEvents,
+		apple:          apple,
+		tokenConfig: TokenConfig{
+			AccessTokenExpiry:  cfg.Auth.AccessTokenExpiry,
+			RefreshTokenExpiry: cfg.Auth.RefreshTokenExpiry,
+		},
 		config: cfg,
 	}
 }
@@ -41,133 +89,266 @@ func generateRandomString(length int) (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
+// hashToken 计算 Token 的 SHA-256 哈希，数据库中只保存哈希
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// tokenPair 新生成的一组 Token
+type tokenPair struct {
+	accessToken      string
+	refreshToken     string
+	issuedAt         time.Time
+	expiresAt        time.Time
+	refreshExpiresAt time.Time
+}
+
+// newTokenPair 生成新的 Access Token 和 Refresh Token
+func (as *AuthService) newTokenPair() (*tokenPair, error) {
+	accessToken, err := generateRandomString(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	refreshToken, err := generateRandomString(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	now := time.Now()
+	return &tokenPair{
+		accessToken:      accessToken,
+		refreshToken:     refreshToken,
+		issuedAt:         now,
+		expiresAt:        now.Add(as.tokenConfig.AccessTokenExpiry),
+		refreshExpiresAt: now.Add(as.tokenConfig.RefreshTokenExpiry),
+	}, nil
+}
+
+// response 登录和刷新的响应
+func (p *tokenPair) response() *models.TokenResponse {
+	return &models.TokenResponse{
+		AccessToken:      p.accessToken,
+		RefreshToken:     p.refreshToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(p.expiresAt.Sub(p.issuedAt).Seconds()),
+		RefreshExpiresIn: int64(p.refreshExpiresAt.Sub(p.issuedAt).Seconds()),
+	}
+}
+
 // Login 登录/注册
-func (as *AuthService) Login(deviceID string) (*models.TokenResponse, error) {
+func (as *AuthService) Login(deviceID string, client ClientInfo) (*models.TokenResponse, error) {
 	if deviceID == "" {
 		return nil, errors.New("device_id is required")
 	}
 
 	// 查找或创建用户
 	var userID int64
-	err := as.DB.QueryRow(`
-		SELECT id FROM users WHERE device_id = ?
-	`, deviceID).Scan(&userID)
-
-	if err == sql.ErrNoRows {
+	user, err := as.users.GetByDeviceID(deviceID)
+	if err == repository.ErrNotFound {
 		// 创建新用户
-		result, err := as.DB.Exec(`
-			INSERT INTO users (device_id, timezone) VALUES (?, ?)
-		`, deviceID, "UTC")
+		userID, err = as.users.Create(deviceID, "UTC")
 		if err != nil {
 			return nil, fmt.Errorf("failed to create user: %w", err)
 		}
-		userID, err = result.LastInsertId()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get user id: %w", err)
-		}
 	} else if err != nil {
 		return nil, fmt.Errorf("failed to query user: %w", err)
+	} else {
+		userID = user.ID
 	}
 
 	// 生成 tokens
-	accessToken, err := generateRandomString(32)
+	pair, err := as.newTokenPair()
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
+		return nil, err
 	}
 
-	refreshToken, err := generateRandomString(32)
+	// 每次登录开始一个新的 Token 家族
+	familyID, err := generateRandomString(16)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		return nil, fmt.Errorf("failed to generate token family: %w", err)
 	}
 
-	// 设置过期时间
-	accessTokenExpiry := 7 * 24 * time.Hour  // 7 天
-	expiresAt := time.Now().Add(accessTokenExpiry)
-
 	// 删除该设备的旧 tokens
-	_, err = as.DB.Exec(`
-		DELETE FROM tokens WHERE user_id = ? AND device_id = ?
-	`, userID, deviceID)
-	if err != nil {
+	if err := as.tokens.DeleteByDevice(userID, deviceID); err != nil {
 		return nil, fmt.Errorf("failed to delete old tokens: %w", err)
 	}
 
 	// 插入新 token
-	_, err = as.DB.Exec(`
-		INSERT INTO tokens (user_id, device_id, access_token, refresh_token, token_type, expires_at)
-		VALUES (?, ?, ?, ?, 'Bearer', ?)
-	`, userID, deviceID, accessToken, refreshToken, expiresAt)
+	client = client.normalized()
+	err = as.tokens.Create(&models.Token{
+		UserID:           userID,
+		DeviceID:         deviceID,
+		FamilyID:         familyID,
+		AccessTokenHash:  hashToken(pair.accessToken),
+		RefreshTokenHash: hashToken(pair.refreshToken),
+		TokenType:        "Bearer",
+		ExpiresAt:        pair.expiresAt,
+		RefreshExpiresAt: pair.refreshExpiresAt,
+		SignedInAt:       pair.issuedAt,
+		LastUsedAt:       &pair.issuedAt,
+		IPAddress:        client.IPAddress,
+		UserAgent:        client.UserAgent,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create token: %w", err)
 	}
 
-	return &models.TokenResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		TokenType:    "Bearer",
-		ExpiresIn:    int64(accessTokenExpiry.Seconds()),
-	}, nil
+	return pair.response(), nil
+}
+
+// LoginWithApple 使用 Sign in with Apple 的 identity token 登录
+// Apple 用户ID已关联账号时将设备关联到该账号；否则把 Apple 账号关联到设备当前的账号（没有时新建）
+// 设备当前的账号因此无法登录且还有数据时，需要 discardPrevious 确认放弃，否则返回 ErrPreviousAccountHasData
+func (as *AuthService) LoginWithApple(identityToken, deviceID string, discardPrevious bool, client ClientInfo) (*models.TokenResponse, error) {
+	if identityToken == "" {
+		return nil, errors.New("identity_token is required")
+	}
+	if deviceID == "" {
+		return nil, errors.New("device_id is required")
+	}
+
+	identity, err := as.apple.Verify(identityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := as.users.GetByAppleSub(identity.Subject)
+	switch {
+	case err == nil:
+		// 重装或换设备后，设备关联回原来的账号
+		err := as.users.LinkDevice(user.ID, deviceID, discardPrevious)
+		if errors.Is(err, repository.ErrAccountHasData) {
+			return nil, ErrPreviousAccountHasData
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to link device: %w", err)
+		}
+	case err == repository.ErrNotFound:
+		if err := as.linkAppleToDeviceUser(identity.Subject, deviceID); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+
+	return as.Login(deviceID, client)
+}
+
+// linkAppleToDeviceUser 将 Apple 账号关联到设备当前的用户，仅使用设备ID的用户由此升级
+func (as *AuthService) linkAppleToDeviceUser(appleSub, deviceID string) error {
+	var userID int64
+	user, err := as.users.GetByDeviceID(deviceID)
+	switch {
+	case err == repository.ErrNotFound:
+		userID, err = as.users.Create(deviceID, "UTC")
+		if err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to query user: %w", err)
+	case user.AppleSub != "":
+		return ErrAppleAccountMismatch
+	default:
+		userID = user.ID
+	}
+
+	err = as.users.SetAppleSub(userID, appleSub)
+	if err == repository.ErrDuplicate {
+		return ErrAppleAccountMismatch
+	}
+	if err != nil {
+		return fmt.Errorf("failed to link Apple ID: %w", err)
+	}
+	return nil
 }
 
 // Refresh 刷新 Token
-func (as *AuthService) Refresh(refreshToken string) (*models.TokenResponse, error) {
+// 刷新后旧 Token 标记为已刷新，新 Token 属于同一家族；已刷新的 Refresh Token 再次使用时撤销整个家族
+func (as *AuthService) Refresh(refreshToken string, client ClientInfo) (*models.TokenResponse, error) {
 	if refreshToken == "" {
 		return nil, errors.New("refresh_token is required")
 	}
 
 	// 查找 refresh token
-	var token models.Token
-	err := as.DB.QueryRow(`
-		SELECT id, user_id, device_id, refresh_token, expires_at
-		FROM tokens
-		WHERE refresh_token = ?
-	`, refreshToken).Scan(&token.ID, &token.UserID, &token.DeviceID, &token.RefreshToken, &token.ExpiresAt)
-
-	if err == sql.ErrNoRows {
+	token, err := as.tokens.GetByRefreshTokenHash(hashToken(refreshToken))
+	if err == repository.ErrNotFound {
 		return nil, errors.New("invalid refresh token")
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to query token: %w", err)
 	}
 
+	// 已刷新过的 Refresh Token 再次出现，说明可能已泄露
+	if token.RotatedAt != nil {
+		return nil, as.revokeFamily(token, client)
+	}
+
 	// 检查是否过期
-	if time.Now().After(token.ExpiresAt) {
+	if time.Now().After(token.RefreshExpiresAt) {
 		// 删除过期 token
-		as.DB.Exec("DELETE FROM tokens WHERE id = ?", token.ID)
+		as.tokens.Delete(token.ID)
 		return nil, errors.New("refresh token has expired")
 	}
 
 	// 生成新的 tokens
-	accessToken, err := generateRandomString(32)
+	pair, err := as.newTokenPair()
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
+		return nil, err
 	}
 
-	newRefreshToken, err := generateRandomString(32)
+	// 标记旧 token 已刷新，并发请求中只有一个能成功
+	rotated, err := as.tokens.MarkRotated(token.ID, pair.issuedAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		return nil, fmt.Errorf("failed to update token: %w", err)
+	}
+	if !rotated {
+		return nil, as.revokeFamily(token, client)
 	}
 
-	// 设置过期时间
-	accessTokenExpiry := 7 * 24 * time.Hour
-	expiresAt := time.Now().Add(accessTokenExpiry)
+	// 插入同一家族的新 token，沿用原来的登录时间
+	client = client.normalized()
+	err = as.tokens.Create(&models.Token{
+		UserID:           token.UserID,
+		DeviceID:         token.DeviceID,
+		FamilyID:         token.FamilyID,
+		AccessTokenHash:  hashToken(pair.accessToken),
+		RefreshTokenHash: hashToken(pair.refreshToken),
+		TokenType:        "Bearer",
+		ExpiresAt:        pair.expiresAt,
+		RefreshExpiresAt: pair.refreshExpiresAt,
+		SignedInAt:       token.SignedInAt,
+		LastUsedAt:       &pair.issuedAt,
+		IPAddress:        client.IPAddress,
+		UserAgent:        client.UserAgent,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token: %w", err)
+	}
 
-	// 更新 token
-	_, err = as.DB.Exec(`
-		UPDATE tokens
-		SET access_token = ?, refresh_token = ?, expires_at = ?, updated_at = NOW()
-		WHERE id = ?
-	`, accessToken, newRefreshToken, expiresAt, token.ID)
+	return pair.response(), nil
+}
+
+// revokeFamily 撤销 Token 所在家族的所有 Token，并记录安全事件
+func (as *AuthService) revokeFamily(token *models.Token, client ClientInfo) error {
+	if err := as.tokens.DeleteFamily(token.FamilyID); err != nil {
+		return fmt.Errorf("failed to revoke tokens: %w", err)
+	}
+
+	client = client.normalized()
+	err := as.securityEvents.Create(&models.SecurityEvent{
+		UserID:    token.UserID,
+		EventType: models.SecurityEventRefreshTokenReuse,
+		DeviceID:  token.DeviceID,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to update token: %w", err)
+		log.Printf("Failed to record security event for user %d: %v", token.UserID, err)
 	}
 
-	return &models.TokenResponse{
-		AccessToken:  accessToken,
-		RefreshToken: newRefreshToken,
-		TokenType:    "Bearer",
-		ExpiresIn:    int64(accessTokenExpiry.Seconds()),
-	}, nil
+	return ErrRefreshTokenReuse
 }
 
 // ValidateAccessToken 验证 Access Token
@@ -176,34 +357,25 @@ func (as *AuthService) ValidateAccessToken(accessToken string) (*models.Token, e
 		return nil, errors.New("access_token is required")
 	}
 
-	var token models.Token
-	err := as.DB.QueryRow(`
-		SELECT id, user_id, device_id, access_token, refresh_token, token_type, expires_at
-		FROM tokens
-		WHERE access_token = ?
-	`, accessToken).Scan(
-		&token.ID,
-		&token.UserID,
-		&token.DeviceID,
-		&token.AccessToken,
-		&token.RefreshToken,
-		&token.TokenType,
-		&token.ExpiresAt,
-	)
-
-	if err == sql.ErrNoRows {
+	token, err := as.tokens.GetByAccessTokenHash(hashToken(accessToken))
+	if err == repository.ErrNotFound {
 		return nil, errors.New("invalid access token")
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to query token: %w", err)
 	}
 
+	// 已刷新的 token 不再有效
+	if token.RotatedAt != nil {
+		return nil, errors.New("invalid access token")
+	}
+
 	// 检查是否过期
 	if time.Now().After(token.ExpiresAt) {
 		return nil, errors.New("access token has expired")
 	}
 
-	return &token, nil
+	return token, nil
 }
 
 // Logout 注销
@@ -212,13 +384,19 @@ func (as *AuthService) Logout(accessToken string) error {
 		return errors.New("access_token is required")
 	}
 
-	_, err := as.DB.Exec(`
-		DELETE FROM tokens WHERE access_token = ?
-	`, accessToken)
+	// 同时删除该次登录刷新前的旧 token
+	token, err := as.tokens.GetByAccessTokenHash(hashToken(accessToken))
+	if err == repository.ErrNotFound {
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("failed to logout: %w", err)
 	}
 
+	if err := as.tokens.DeleteFamily(token.FamilyID); err != nil {
+		return fmt.Errorf("failed to logout: %w", err)
+	}
+
 	return nil
 }
 
@@ -230,3 +408,90 @@ func (as *AuthService) GetUserIDByToken(accessToken string) (int64, error) {
 	}
 	return token.UserID, nil
 }
+
+// GetUserTimezone 获取用户时区，查询失败或未设置时返回 UTC
+func (as *AuthService) GetUserTimezone(userID int64) string {
+	user, err := as.users.Get(userID)
+	if err != nil || user.Timezone == "" {
+		return "UTC"
+	}
+	return user.Timezone
+}
+
+// ListSecurityEvents 获取用户最近的安全事件
+func (as *AuthService) ListSecurityEvents(userID int64) ([]*models.SecurityEvent, error) {
+	events, err := as.securityEvents.ListByUser(userID, 50)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query security events: %w", err)
+	}
+	return events, nil
+}
+
+// TouchSession 记录会话的最近使用时间和客户端信息
+// 距离上次记录不足 sessionTouchInterval 且客户端信息未变化时跳过
+func (as *AuthService) TouchSession(token *models.Token, client ClientInfo) {
+	client = client.normalized()
+	now := time.Now()
+	if token.LastUsedAt != nil && now.Sub(*token.LastUsedAt) < sessionTouchInterval &&
+		token.IPAddress == client.IPAddress && token.UserAgent == client.UserAgent {
+		return
+	}
+
+	if err := as.tokens.Touch(token.ID, now, client.IPAddress, client.UserAgent); err != nil {
+		log.Printf("Failed to update session %d: %v", token.ID, err)
+	}
+}
+
+// ListSessions 获取用户的登录会话，currentTokenID 为当前请求使用的 Token
+func (as *AuthService) ListSessions(userID, currentTokenID int64) ([]*models.Session, error) {
+	tokens, err := as.tokens.ListActiveByUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+
+	sessions := make([]*models.Session, 0, len(tokens))
+	for _, token := range tokens {
+		sessions = append(sessions, &models.Session{
+			ID:         token.ID,
+			DeviceID:   token.DeviceID,
+			CreatedAt:  token.SignedInAt,
+			LastUsedAt: token.LastUsedAt,
+			IPAddress:  token.IPAddress,
+			UserAgent:  token.UserAgent,
+			Current:    token.ID == currentTokenID,
+		})
+	}
+	return sessions, nil
+}
+
+// RevokeSession 撤销用户的一个会话，包括该次登录刷新前的旧 Token
+func (as *AuthService) RevokeSession(userID, sessionID int64) error {
+	token, err := as.tokens.Get(sessionID)
+	if err == repository.ErrNotFound {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query session: %w", err)
+	}
+	if token.UserID != userID || token.RotatedAt != nil {
+		return ErrSessionNotFound
+	}
+
+	if err := as.tokens.DeleteFamily(token.FamilyID); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// RevokeOtherSessions 撤销除当前会话外的所有会话
+func (as *AuthService) RevokeOtherSessions(userID, currentTokenID int64) error {
+	token, err := as.tokens.Get(currentTokenID)
+	if err != nil {
+		return fmt.Errorf("failed to query session: %w", err)
+	}
+
+	if err := as.tokens.DeleteOtherFamilies(userID, token.FamilyID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/deadornot/backend/models"
+)
+
+var (
+	ErrInvalidCheckInInterval = fmt.Errorf(
+		"checkin_interval_minutes must be 0 (daily) or between %d and %d",
+		models.MinCheckInIntervalMinutes, models.MaxCheckInIntervalMinutes,
+	)
+	ErrInvalidCheckInDeadline = errors.New("checkin_deadline must be HH:MM or empty")
+	ErrInvalidCheckInGrace    = fmt.Errorf("checkin_grace_minutes must be between 0 and %d", models.MaxCheckInGraceMinutes)
+)
+
+// ValidateCheckInInterval 校验打卡间隔（分钟），0 表示每天打卡一次
+func ValidateCheckInInterval(minutes int) error {
+	if minutes == 0 {
+		return nil
+	}
+	if minutes < models.MinCheckInIntervalMinutes || minutes > models.MaxCheckInIntervalMinutes {
+		return ErrInvalidCheckInInterval
+	}
+	return nil
+}
+
+// NormalizeCheckInDeadline 校验每天打卡的截止时间（HH:MM），为空表示取消截止时间
+func NormalizeCheckInDeadline(deadline string) (string, error) {
+	deadline = strings.TrimSpace(deadline)
+	if deadline == "" {
+		return "", nil
+	}
+	clock, err := time.Parse("15:04", deadline)
+	if err != nil {
+		return "", ErrInvalidCheckInDeadline
+	}
+	return clock.Format("15:04"), nil
+}
+
+// ValidateCheckInGrace 校验宽限时间（分钟）
+func ValidateCheckInGrace(minutes int) error {
+	if minutes < 0 || minutes > models.MaxCheckInGraceMinutes {
+		return ErrInvalidCheckInGrace
+	}
+	return nil
+}
+
+// CheckInCadence 用户的打卡周期：每天打卡（可设截止时间）或按间隔打卡，超过截止时间后有宽限时间
+type CheckInCadence struct {
+	Interval time.Duration  // 按间隔打卡的间隔，0 表示每天打卡一次
+	Deadline string         // 每天打卡的截止时间（HH:MM），为空表示不设截止时间
+	Grace    time.Duration  // 超过截止时间后开始升级前的宽限时间
+	Location *time.Location // 用户时区
+}
+
+// NewCheckInCadence 按用户设置创建打卡周期，时区无效时使用 UTC
+func NewCheckInCadence(intervalMinutes int, deadline string, graceMinutes int, timezone string) CheckInCadence {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return CheckInCadence{
+		Interval: time.Duration(intervalMinutes) * time.Minute,
+		Deadline: deadline,
+		Grace:    time.Duration(graceMinutes) * time.Minute,
+		Location: loc,
+	}
+}
+
+// UserCheckInCadence 用户的打卡周期
+func UserCheckInCadence(user *models.User) CheckInCadence {
+	return NewCheckInCadence(user.CheckInIntervalMinutes, user.CheckInDeadline, user.CheckInGraceMinutes, user.Timezone)
+}
+
+// HasDeadline 是否有明确的截止时间：按间隔打卡，或每天打卡且设置了截止时间
+// 没有截止时间的每天打卡用户按未打卡的天数升级
+func (c CheckInCadence) HasDeadline() bool {
+	return c.Interval > 0 || c.Deadline != ""
+}
+
+// NextDeadline 从 since 起下一次打卡的截止时间
+// 按间隔打卡为 since 加上间隔；每天打卡为 since 所在本地日期后一天的截止时间，未设置时为后一天结束
+func (c CheckInCadence) NextDeadline(since time.Time) time.Time {
+	return c.deadlineAfter(since, 1)
+}
+
+// deadlineAfter since 之后的第 n 个截止时间
+func (c CheckInCadence) deadlineAfter(since time.Time, n int) time.Time {
+	if c.Interval > 0 {
+		return since.Add(time.Duration(n) * c.Interval).UTC()
+	}
+
+	local := since.In(c.Location)
+	clock, err := time.Parse("15:04", c.Deadline)
+	if err != nil {
+		return time.Date(local.Year(), local.Month(), local.Day()+n+1, 0, 0, 0, 0, c.Location).UTC()
+	}
+	return time.Date(local.Year(), local.Month(), local.Day()+n, clock.Hour(), clock.Minute(), 0, 0, c.Location).UTC()
+}
+
+// MissedDeadlines since 之后到 now 已过宽限时间的截止时间个数，用于有截止时间的用户的升级策略
+func (c CheckInCadence) MissedDeadlines(since, now time.Time) int {
+	if c.Interval > 0 {
+		if !now.After(since.Add(c.Grace)) {
+			return 0
+		}
+		return int(now.Sub(since.Add(c.Grace)) / c.Interval)
+	}
+
+	// 截止时间之间可能因夏令时相差不是 24 小时，先按天数估算再逐个校正
+	expired := now.Add(-c.Grace)
+	missed := int(expired.Sub(since)/(24*time.Hour)) - 1
+	if missed < 0 {
+		missed = 0
+	}
+	for missed > 0 && c.deadlineAfter(since, missed).After(expired) {
+		missed--
+	}
+	for !c.deadlineAfter(since, missed+1).After(expired) {
+		missed++
+	}
+	return missed
+}
+
+// CheckInDeadline 从 since 起用户下一次打卡的截止时间
+func CheckInDeadline(user *models.User, since time.Time) time.Time {
+	return UserCheckInCadence(user).NextDeadline(since)
+}
+
+// CheckInDeadlineSince 截止时间的计算起点：最近一次打卡，之后有暂停时为暂停结束的时间
+// 暂停期间不计时，与升级策略的计算方式一致
+func CheckInDeadlineSince(lastCheckIn time.Time, pauses []*models.Pause, now time.Time) time.Time {
+	since := lastCheckIn
+	for _, pause := range pauses {
+		if !pause.StartsAt.After(now) && pause.EndsAt.After(since) {
+			since = pause.EndsAt
+		}
+	}
+	return since
+}
+
+// FormatOverdue 未打卡时长的描述，如 "2 天 3 小时"、"5 小时"、"40 分钟"
+func FormatOverdue(d time.Duration) string {
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+
+	switch {
+	case days > 0 && hours > 0:
+		return fmt.Sprintf("%d 天 %d 小时", days, hours)
+	case days > 0:
+		return fmt.Sprintf("%d 天", days)
+	case hours > 0:
+		return fmt.Sprintf("%d 小时", hours)
+	default:
+		return fmt.Sprintf("%d 分钟", int(d/time.Minute))
+	}
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/deadornot/backend/config"
+	"github.com/deadornot/backend/models"
+	"github.com/deadornot/backend/repository"
+	"github.com/deadornot/backend/utils"
+)
+
+var (
+	ErrAlreadyCheckedIn      = errors.New("Already checked in today")
+	ErrInvalidCheckInDetails = errors.New("invalid check-in details")
+	ErrInvalidCheckInTime    = errors.New("invalid check-in time")
+)
+
+// lastKnownDetailsLimit 查找最近一次上报的状态信息时最多查看的打卡记录数
+const lastKnownDetailsLimit = 20
+
+// CheckInDetailItem 紧急提醒中展示的一项最近上报的状态信息
+type CheckInDetailItem struct {
+	Label string
+	Value string
+	URL   string    // 位置的地图链接（如果有）
+	At    time.Time // 上报时间（用户时区）
+}
+
+// CheckInInput 打卡的参数，ClientDateTime 为空表示使用服务器时间
+// Backfill 为 true 时按补打卡处理，允许在补打卡窗口内提交较早的时间
+type CheckInInput struct {
+	ClientDateTime *time.Time
+	Backfill       bool
+	models.CheckInDetails
+}
+
+// NormalizeCheckInDetails 校验打卡附带的状态信息；位置只保留两位小数（约 1 公里），不保存精确位置
+func NormalizeCheckInDetails(details models.CheckInDetails) (models.CheckInDetails, error) {
+	if details.Mood != nil && (*details.Mood < models.MinCheckInMood || *details.Mood > models.MaxCheckInMood) {
+		return details, fmt.Errorf("%w: mood must be between %d and %d", ErrInvalidCheckInDetails, models.MinCheckInMood, models.MaxCheckInMood)
+	}
+
+	details.Note = strings.TrimSpace(details.Note)
+	if utf8.RuneCountInString(details.Note) > models.MaxCheckInNoteLength {
+		return details, fmt.Errorf("%w: note must be at most %d characters", ErrInvalidCheckInDetails, models.MaxCheckInNoteLength)
+	}
+
+	if details.BatteryLevel != nil && (*details.BatteryLevel < 0 || *details.BatteryLevel > 100) {
+		return details, fmt.Errorf("%w: battery_level must be between 0 and 100", ErrInvalidCheckInDetails)
+	}
+
+	if (details.Latitude == nil) != (details.Longitude == nil) {
+		return details, fmt.Errorf("%w: latitude and longitude must be provided together", ErrInvalidCheckInDetails)
+	}
+	if details.Latitude != nil {
+		if *details.Latitude < -90 || *details.Latitude > 90 || *details.Longitude < -180 || *details.Longitude > 180 {
+			return details, fmt.Errorf("%w: invalid coordinates", ErrInvalidCheckInDetails)
+		}
+		latitude := math.Round(*details.Latitude*100) / 100
+		longitude := math.Round(*details.Longitude*100) / 100
+		details.Latitude, details.Longitude = &latitude, &longitude
+	}
+
+	return details, nil
+}
+
+// LastKnownCheckInDetails 每项状态信息最近一次上报的值，只包含用户授权分享的项
+// records 按打卡时间倒序
+func LastKnownCheckInDetails(records []*models.CheckIn, sharing models.CheckInSharing, loc *time.Location) []CheckInDetailItem {
+	var mood, note, battery, location *CheckInDetailItem
+	for _, record := range records {
+		at := record.CheckInDateTime.In(loc)
+		if sharing.Mood && mood == nil && record.Mood != nil {
+			mood = &CheckInDetailItem{Label: "心情", Value: fmt.Sprintf("%d / %d", *record.Mood, models.MaxCheckInMood), At: at}
+		}
+		if sharing.Note && note == nil && record.Note != "" {
+			note = &CheckInDetailItem{Label: "留言", Value: record.Note, At: at}
+		}
+		if sharing.Battery && battery == nil && record.BatteryLevel != nil {
+			battery = &CheckInDetailItem{Label: "手机电量", Value: fmt.Sprintf("%d%%", *record.BatteryLevel), At: at}
+		}
+		if sharing.Location && location == nil && record.Latitude != nil && record.Longitude != nil {
+			location = &CheckInDetailItem{
+				Label: "大致位置",
+				Value: fmt.Sprintf("%.2f, %.2f", *record.Latitude, *record.Longitude),
+				URL:   fmt.Sprintf("https://www.openstreetmap.org/?mlat=%.2f&mlon=%.2f#map=13/%.2f/%.2f", *record.Latitude, *record.Longitude, *record.Latitude, *record.Longitude),
+				At:    at,
+			}
+		}
+	}
+
+	items := []CheckInDetailItem{}
+	for _, item := range []*CheckInDetailItem{mood, note, battery, location} {
+		if item != nil {
+			items = append(items, *item)
+		}
+	}
+	return items
+}
+
+// CheckInService 打卡服务
+type CheckInService struct {
+	users           repository.UserRepository
+	checkIns        repository.CheckInRepository
+	pauses          repository.PauseRepository
+	incidentService *IncidentService
+	webhookService  *WebhookService
+	config          *config.Config
+}
+
+// NewCheckInService 创建打卡服务
+func NewCheckInService(repos *repository.Repositories, incidentService *IncidentService, webhookService *WebhookService, cfg *config.Config) *CheckInService {
+	return &CheckInService{
+		users:           repos.Users,
+		checkIns:        repos.CheckIns,
+		pauses:          repos.Pauses,
+		incidentService: incidentService,
+		webhookService:  webhookService,
+		config:          cfg,
+	}
+}
+
+// checkInTime 按容差确定记录的打卡时间和来源
+// 未提交时间时使用服务器时间；客户端时间在容差内时使用客户端时间，稍晚于服务器时间（时钟偏差）时按服务器时间记录，打卡时间不会在未来
+// 超出容差时（设备时钟不准）按服务器时间记录，不拒绝打卡；客户端提交的原始时间另外保存用于审计
+// 只有补打卡会因时间超出补打卡窗口而被拒绝
+func (cs *CheckInService) checkInTime(input CheckInInput, now time.Time) (time.Time, string, error) {
+	if input.Backfill {
+		return cs.backfillTime(input, now)
+	}
+	if input.ClientDateTime == nil {
+		return now, models.CheckInSourceServer, nil
+	}
+
+	clientDateTime := input.ClientDateTime.UTC()
+	if clientDateTime.After(now.Add(cs.config.CheckIn.MaxFutureSkew)) || clientDateTime.Before(now.Add(-cs.config.CheckIn.MaxPastSkew)) {
+		return now, models.CheckInSourceServer, nil
+	}
+	if clientDateTime.After(now) {
+		clientDateTime = now
+	}
+	return clientDateTime, models.CheckInSourceClient, nil
+}
+
+// backfillTime 校验补打卡的时间，必须在补打卡窗口内且不晚于服务器时间（允许时钟偏差）
+func (cs *CheckInService) backfillTime(input CheckInInput, now time.Time) (time.Time, string, error) {
+	if input.ClientDateTime == nil {
+		return time.Time{}, "", fmt.Errorf("%w: datetime is required for backfill", ErrInvalidCheckInTime)
+	}
+	if cs.config.CheckIn.BackfillWindow <= 0 {
+		return time.Time{}, "", fmt.Errorf("%w: backfill is disabled", ErrInvalidCheckInTime)
+	}
+
+	clientDateTime := input.ClientDateTime.UTC()
+	if clientDateTime.After(now.Add(cs.config.CheckIn.MaxFutureSkew)) {
+		return time.Time{}, "", fmt.Errorf("%w: datetime is in the future", ErrInvalidCheckInTime)
+	}
+	if clientDateTime.Before(now.Add(-cs.config.CheckIn.BackfillWindow)) {
+		return time.Time{}, "", fmt.Errorf("%w: datetime is too far in the past", ErrInvalidCheckInTime)
+	}
+	if clientDateTime.After(now) {
+		clientDateTime = now
+	}
+	return clientDateTime, models.CheckInSourceBackfill, nil
+}
+
+// CheckIn 记录一次打卡，可附带心情、留言、电量和大致位置，返回打卡时间和下一次打卡的截止时间
+// 每天打卡的用户同一天（用户时区的本地日期）只能打卡一次，按间隔打卡的用户不限次数
+// 记录服务器收到打卡的时间和客户端提交的原始时间，用于区分服务器时间、客户端时间和补打卡
+func (cs *CheckInService) CheckIn(userID int64, input CheckInInput) (time.Time, time.Time, error) {
+	details, err := NormalizeCheckInDetails(input.CheckInDetails)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	receivedAt := time.Now().UTC()
+	checkInDateTime, source, err := cs.checkInTime(input, receivedAt)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	var clientDateTime *time.Time
+	if input.ClientDateTime != nil {
+		utc := input.ClientDateTime.UTC()
+		clientDateTime = &utc
+	}
+
+	// 按用户当前时区计算打卡日期，并记录使用的时区
+	user, err := cs.users.Get(userID)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to query user: %w", err)
+	}
+	timezone := user.Timezone
+	checkInDate, err := utils.GetDateStringInTimezone(checkInDateTime, timezone)
+	if err != nil {
+		timezone = "UTC"
+		checkInDate = checkInDateTime.Format("2006-01-02")
+	}
+
+	// 每天打卡的用户检查同一天是否已打卡
+	oncePerDay := user.CheckInIntervalMinutes == 0
+	if oncePerDay {
+		exists, err := cs.checkIns.ExistsOnDate(userID, checkInDate)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("failed to check existing checkin: %w", err)
+		}
+
+		if exists {
+			return time.Time{}, time.Time{}, ErrAlreadyCheckedIn
+		}
+	}
+
+	// 插入打卡记录，并发请求由唯一键兜底
+	localDate, _ := time.Parse("2006-01-02", checkInDate)
+	checkIn := &models.CheckIn{
+		UserID:          userID,
+		CheckInDateTime: checkInDateTime,
+		CheckInDate:     localDate,
+		Timezone:        timezone,
+		Source:          source,
+		ReceivedAt:      &receivedAt,
+		ClientDateTime:  clientDateTime,
+		CheckInDetails:  details,
+	}
+	err = cs.checkIns.Create(checkIn, oncePerDay)
+	if err == repository.ErrDuplicate {
+		return time.Time{}, time.Time{}, ErrAlreadyCheckedIn
+	}
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to check in: %w", err)
+	}
+
+	// 补打的较早时间不会推迟截止时间
+	lastCheckIn := checkInDateTime
+	if last, err := cs.checkIns.Latest(userID); err == nil && last.CheckInDateTime.After(lastCheckIn) {
+		lastCheckIn = last.CheckInDateTime.UTC()
+	}
+	nextDeadline := CheckInDeadline(user, lastCheckIn)
+	if pauses, err := cs.pauses.ListByUser(userID); err == nil {
+		nextDeadline = CheckInDeadline(user, CheckInDeadlineSince(lastCheckIn, pauses, time.Now()))
+	} else {
+		log.Printf("Failed to query pauses for user %d: %v", userID, err)
+	}
+
+	// 重新打卡后解除紧急事件，并通知收到过提醒的联系人
+	if _, err := cs.incidentService.Resolve(userID, checkInDateTime); err != nil {
+		log.Printf("Failed to resolve incident for user %d: %v", userID, err)
+	}
+
+	err = cs.webhookService.Dispatch(WebhookEvent{
+		Type:   models.WebhookEventCheckIn,
+		Key:    fmt.Sprintf("checkin_%d", checkIn.ID),
+		UserID: userID,
+		Data: map[string]interface{}{
+			"checkin_at":    checkInDateTime.Format(time.RFC3339),
+			"next_deadline": nextDeadline.Format(time.RFC3339),
+			"source":        source,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to dispatch checkin webhook for user %d: %v", userID, err)
+	}
+
+	return checkInDateTime, nextDeadline, nil
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/deadornot/backend/config"
+	"github.com/deadornot/backend/database"
+)
+
+// 一键打卡链接用途和有效期
+const (
+	linkPurposeCheckIn = "checkin_link"
+
+	CheckInLinkTTL = 36 * time.Hour
+)
+
+var ErrCheckInLinkUsed = errors.New("check-in link has already been used")
+
+// CheckInLink 一键打卡链接
+type CheckInLink struct {
+	Token     string
+	URL       string
+	ExpiresAt time.Time
+}
+
+// CheckInLinkService 一键打卡链接服务，链接签名且只能使用一次
+type CheckInLinkService struct {
+	db     *database.DB
+	signer *LinkSigner
+	config *config.Config
+}
+
+// NewCheckInLinkService 创建一键打卡链接服务
+func NewCheckInLinkService(db *database.DB, signer *LinkSigner, cfg *config.Config) *CheckInLinkService {
+	return &CheckInLinkService{
+		db:     db,
+		signer: signer,
+		config: cfg,
+	}
+}
+
+// Create 为用户生成一键打卡链接
+func (ls *CheckInLinkService) Create(userID int64) (*CheckInLink, error) {
+	expiresAt := time.Now().Add(CheckInLinkTTL)
+
+	linkID, err := ls.db.Insert(`
+		INSERT INTO checkin_links (user_id, expires_at) VALUES (?, ?)
+	`, userID, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checkin link: %w", err)
+	}
+
+	token := ls.signer.Sign(linkPurposeCheckIn, linkID, CheckInLinkTTL)
+	return &CheckInLink{
+		Token:     token,
+		URL:       strings.TrimRight(ls.config.Server.BaseURL, "/") + "/api/checkin/link/" + token,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Peek 校验链接但不消耗，返回用户ID
+func (ls *CheckInLinkService) Peek(token string) (int64, error) {
+	linkID, err := ls.signer.Verify(linkPurposeCheckIn, token)
+	if err != nil {
+		return 0, err
+	}
+
+	var userID int64
+	var usedAt sql.NullTime
+	err = ls.db.QueryRow(`
+		SELECT user_id, used_at FROM checkin_links WHERE id = ?
+	`, linkID).Scan(&userID, &usedAt)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidLinkToken
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to query checkin link: %w", err)
+	}
+	if usedAt.Valid {
+		return 0, ErrCheckInLinkUsed
+	}
+
+	return userID, nil
+}
+
+// Redeem 消耗链接，返回链接ID和用户ID
+func (ls *CheckInLinkService) Redeem(token string) (linkID, userID int64, err error) {
+	linkID, err = ls.signer.Verify(linkPurposeCheckIn, token)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	result, err := ls.db.Exec(`
+		UPDATE checkin_links SET used_at = CURRENT_TIMESTAMP WHERE id = ? AND used_at IS NULL
+	`, linkID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to redeem checkin link: %w", err)
+	}
+
+	affected, _ := result.RowsAffected()
+	if affected == 0 {
+		var exists bool
+		ls.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM checkin_links WHERE id = ?)`, linkID).Scan(&exists)
+		if !exists {
+			return 0, 0, ErrInvalidLinkToken
+		}
+		return 0, 0, ErrCheckInLinkUsed
+	}
+
+	err = ls.db.QueryRow(`
+		SELECT user_id FROM checkin_links WHERE id = ?
+	`, linkID).Scan(&userID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to query checkin link: %w", err)
+	}
+
+	return linkID, userID, nil
+}
+
+// Release 打卡失败时恢复链接，允许重试
+func (ls *CheckInLinkService) Release(linkID int64) {
+	ls.db.Exec(`UPDATE checkin_links SET used_at = NULL WHERE id = ?`, linkID)
+}
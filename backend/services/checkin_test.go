@@ -0,0 +1,122 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/deadornot/backend/config"
+	"github.com/deadornot/backend/models"
+	"github.com/deadornot/backend/repository"
+)
+
+func TestCheckInTime(t *testing.T) {
+	cs := &CheckInService{config: &config.Config{CheckIn: config.CheckInConfig{
+		MaxPastSkew:    10 * time.Minute,
+		MaxFutureSkew:  2 * time.Minute,
+		BackfillWindow: 48 * time.Hour,
+	}}}
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(offset time.Duration) *time.Time {
+		t := now.Add(offset)
+		return &t
+	}
+
+	cases := []struct {
+		name       string
+		input      CheckInInput
+		wantTime   time.Time
+		wantSource string
+	}{
+		{"no client time", CheckInInput{}, now, models.CheckInSourceServer},
+		{"within past skew", CheckInInput{ClientDateTime: at(-5 * time.Minute)}, now.Add(-5 * time.Minute), models.CheckInSourceClient},
+		{"at past skew", CheckInInput{ClientDateTime: at(-10 * time.Minute)}, now.Add(-10 * time.Minute), models.CheckInSourceClient},
+		{"slightly ahead is clamped", CheckInInput{ClientDateTime: at(time.Minute)}, now, models.CheckInSourceClient},
+		{"at future skew is clamped", CheckInInput{ClientDateTime: at(2 * time.Minute)}, now, models.CheckInSourceClient},
+		// 设备时钟不准时按服务器时间记录，不拒绝
+		{"clock behind", CheckInInput{ClientDateTime: at(-3 * time.Hour)}, now, models.CheckInSourceServer},
+		{"clock ahead", CheckInInput{ClientDateTime: at(time.Hour)}, now, models.CheckInSourceServer},
+		{"backfill within window", CheckInInput{ClientDateTime: at(-24 * time.Hour), Backfill: true}, now.Add(-24 * time.Hour), models.CheckInSourceBackfill},
+		{"backfill at window", CheckInInput{ClientDateTime: at(-48 * time.Hour), Backfill: true}, now.Add(-48 * time.Hour), models.CheckInSourceBackfill},
+		{"backfill slightly ahead is clamped", CheckInInput{ClientDateTime: at(time.Minute), Backfill: true}, now, models.CheckInSourceBackfill},
+	}
+	for _, tc := range cases {
+		got, source, err := cs.checkInTime(tc.input, now)
+		if err != nil {
+			t.Errorf("%s: checkInTime error = %v", tc.name, err)
+			continue
+		}
+		if !got.Equal(tc.wantTime) || source != tc.wantSource {
+			t.Errorf("%s: checkInTime = %v, %s; want %v, %s", tc.name, got, source, tc.wantTime, tc.wantSource)
+		}
+	}
+}
+
+func TestCheckInTimeRejectsInvalidBackfill(t *testing.T) {
+	cfg := &config.Config{CheckIn: config.CheckInConfig{
+		MaxPastSkew:    10 * time.Minute,
+		MaxFutureSkew:  2 * time.Minute,
+		BackfillWindow: 48 * time.Hour,
+	}}
+	cs := &CheckInService{config: cfg}
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(offset time.Duration) *time.Time {
+		t := now.Add(offset)
+		return &t
+	}
+
+	cases := map[string]CheckInInput{
+		"without datetime":   {Backfill: true},
+		"before window":      {ClientDateTime: at(-49 * time.Hour), Backfill: true},
+		"beyond future skew": {ClientDateTime: at(time.Hour), Backfill: true},
+	}
+	for name, input := range cases {
+		if _, _, err := cs.checkInTime(input, now); !errors.Is(err, ErrInvalidCheckInTime) {
+			t.Errorf("%s: checkInTime error = %v, want ErrInvalidCheckInTime", name, err)
+		}
+	}
+
+	cfg.CheckIn.BackfillWindow = 0
+	if _, _, err := cs.checkInTime(CheckInInput{ClientDateTime: at(-time.Hour), Backfill: true}, now); !errors.Is(err, ErrInvalidCheckInTime) {
+		t.Errorf("disabled backfill: checkInTime error = %v, want ErrInvalidCheckInTime", err)
+	}
+}
+
+func TestCheckInWithDriftedClockKeepsClientTime(t *testing.T) {
+	db := newTestDB(t)
+	repos := repository.New(db)
+	cfg := &config.Config{CheckIn: config.CheckInConfig{
+		MaxPastSkew:   10 * time.Minute,
+		MaxFutureSkew: 2 * time.Minute,
+	}}
+	notificationService := NewNotificationService(repos.Notifications)
+	webhookService := NewWebhookService(db, repos, notificationService, cfg)
+	incidentService := NewIncidentService(db, notificationService, NewLinkSigner(cfg), webhookService, cfg)
+	cs := NewCheckInService(repos, incidentService, webhookService, cfg)
+
+	userID, err := db.Insert(`INSERT INTO users (device_id, timezone) VALUES ('device-1', 'UTC')`)
+	if err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+
+	// 设备时钟慢了一天，打卡按服务器时间记录，客户端时间保留
+	drifted := time.Now().UTC().Add(-24 * time.Hour).Truncate(time.Second)
+	checkInDateTime, _, err := cs.CheckIn(userID, CheckInInput{ClientDateTime: &drifted})
+	if err != nil {
+		t.Fatalf("CheckIn: %v", err)
+	}
+	if time.Since(checkInDateTime) > time.Minute {
+		t.Errorf("check-in time = %v, want server time", checkInDateTime)
+	}
+
+	record, err := repos.CheckIns.Latest(userID)
+	if err != nil {
+		t.Fatalf("Latest: %v", err)
+	}
+	if record.Source != models.CheckInSourceServer {
+		t.Errorf("source = %q, want %q", record.Source, models.CheckInSourceServer)
+	}
+	if record.ClientDateTime == nil || !record.ClientDateTime.Equal(drifted) {
+		t.Errorf("client datetime = %v, want %v", record.ClientDateTime, drifted)
+	}
+}
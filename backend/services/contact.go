@@ -0,0 +1,531 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/deadornot/backend/config"
+	"github.com/deadornot/backend/database"
+	"github.com/deadornot/backend/models"
+	"github.com/deadornot/backend/utils"
+)
+
+// MaxEmergencyContacts 每个用户最多的紧急联系人数量
+const MaxEmergencyContacts = 10
+
+// 签名链接用途和有效期
+const (
+	linkPurposeContactConfirm = "contact_confirm"
+	linkPurposeContactOptOut  = "contact_opt_out"
+
+	contactConfirmLinkTTL = 7 * 24 * time.Hour
+	contactOptOutLinkTTL  = 365 * 24 * time.Hour
+)
+
+// 确认邮件的发送限制：两次发送的最小间隔和每个邮箱最多发送的次数（修改邮箱后重新计数）
+const (
+	ContactConfirmResendInterval = 10 * time.Minute
+	MaxContactConfirmations      = 5
+)
+
+var (
+	ErrContactNotFound   = errors.New("contact not found")
+	ErrContactExists     = errors.New("contact with this email already exists")
+	ErrTooManyContacts   = fmt.Errorf("maximum %d emergency contacts allowed", MaxEmergencyContacts)
+	ErrInvalidContactReq = errors.New("invalid contact")
+	ErrConfirmationLimit = errors.New("confirmation email was sent recently or too many times")
+)
+
+// ContactInput 创建或更新紧急联系人的参数
+type ContactInput struct {
+	Name         string `json:"name"`
+	Email        string `json:"email"`
+	Phone        string `json:"phone"`
+	Relationship string `json:"relationship"`
+	Language     string `json:"language"`
+}
+
+// ContactService 紧急联系人服务
+type ContactService struct {
+	db                  *database.DB
+	notificationService *NotificationService
+	signer              *LinkSigner
+	emailTemplate       *EmailTemplate
+	config              *config.Config
+}
+
+// NewContactService 创建紧急联系人服务
+func NewContactService(db *database.DB, notificationService *NotificationService, signer *LinkSigner, cfg *config.Config) *ContactService {
+	return &ContactService{
+		db:                  db,
+		notificationService: notificationService,
+		signer:              signer,
+		emailTemplate:       NewEmailTemplate(),
+		config:              cfg,
+	}
+}
+
+const contactColumns = `id, user_id, name, email, phone, relationship, language, verified_at, opted_out_at, created_at, updated_at`
+
+// scanContact 扫描一行紧急联系人
+func scanContact(scanner interface{ Scan(...interface{}) error }) (*models.EmergencyContact, error) {
+	var contact models.EmergencyContact
+	var verifiedAt, optedOutAt sql.NullTime
+	err := scanner.Scan(
+		&contact.ID, &contact.UserID, &contact.Name, &contact.Email, &contact.Phone,
+		&contact.Relationship, &contact.Language, &verifiedAt, &optedOutAt,
+		&contact.CreatedAt, &contact.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if verifiedAt.Valid {
+		contact.VerifiedAt = &verifiedAt.Time
+	}
+	if optedOutAt.Valid {
+		contact.OptedOutAt = &optedOutAt.Time
+	}
+	return &contact, nil
+}
+
+// List 获取用户的全部紧急联系人
+func (cs *ContactService) List(userID int64) ([]*models.EmergencyContact, error) {
+	return cs.query(`SELECT `+contactColumns+` FROM emergency_contacts WHERE user_id = ? ORDER BY id`, userID)
+}
+
+// ListAlertable 获取可以接收提醒的紧急联系人（已确认且未退订）
+func (cs *ContactService) ListAlertable(userID int64) ([]*models.EmergencyContact, error) {
+	return cs.query(`
+		SELECT `+contactColumns+` FROM emergency_contacts
+		WHERE user_id = ? AND verified_at IS NOT NULL AND opted_out_at IS NULL
+		ORDER BY id
+	`, userID)
+}
+
+// query 查询紧急联系人列表
+func (cs *ContactService) query(query string, args ...interface{}) ([]*models.EmergencyContact, error) {
+	rows, err := cs.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query contacts: %w", err)
+	}
+	defer rows.Close()
+
+	contacts := []*models.EmergencyContact{}
+	for rows.Next() {
+		contact, err := scanContact(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan contact: %w", err)
+		}
+		contacts = append(contacts, contact)
+	}
+	return contacts, rows.Err()
+}
+
+// Get 获取单个紧急联系人
+func (cs *ContactService) Get(userID, contactID int64) (*models.EmergencyContact, error) {
+	contact, err := scanContact(cs.db.QueryRow(`
+		SELECT `+contactColumns+` FROM emergency_contacts WHERE id = ? AND user_id = ?
+	`, contactID, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrContactNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query contact: %w", err)
+	}
+	return contact, nil
+}
+
+// Create 添加紧急联系人并发送确认邮件
+func (cs *ContactService) Create(userID int64, input ContactInput) (*models.EmergencyContact, error) {
+	if err := cs.normalizeContactInput(&input); err != nil {
+		return nil, err
+	}
+
+	var count int
+	if err := cs.db.QueryRow(`SELECT COUNT(*) FROM emergency_contacts WHERE user_id = ?`, userID).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to count contacts: %w", err)
+	}
+	if count >= MaxEmergencyContacts {
+		return nil, ErrTooManyContacts
+	}
+
+	if err := cs.ensureEmailAvailable(userID, input.Email, 0); err != nil {
+		return nil, err
+	}
+
+	// 之前退订过的邮箱重新添加后仍为退订状态，不再发送确认邮件
+	optedOutAt, err := cs.optedOutAt(userID, input.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	contactID, err := cs.db.Insert(`
+		INSERT INTO emergency_contacts (user_id, name, email, phone, relationship, language, opted_out_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, userID, input.Name, input.Email, input.Phone, input.Relationship, input.Language, optedOutAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create contact: %w", err)
+	}
+
+	contact, err := cs.Get(userID, contactID)
+	if err != nil {
+		return nil, err
+	}
+
+	if contact.OptedOutAt == nil {
+		if err := cs.SendConfirmation(contact); err != nil {
+			log.Printf("Failed to send confirmation to contact %d: %v", contact.ID, err)
+		}
+	}
+
+	return contact, nil
+}
+
+// Update 更新紧急联系人，修改邮箱后需要重新确认
+func (cs *ContactService) Update(userID, contactID int64, input ContactInput) (*models.EmergencyContact, error) {
+	if err := cs.normalizeContactInput(&input); err != nil {
+		return nil, err
+	}
+
+	existing, err := cs.Get(userID, contactID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 修改邮箱后退订状态和确认邮件的发送次数跟随新邮箱
+	emailChanged := NormalizeEmail(existing.Email) != input.Email
+	optedOutAt := existing.OptedOutAt
+	if emailChanged {
+		if err := cs.ensureEmailAvailable(userID, input.Email, contactID); err != nil {
+			return nil, err
+		}
+		if optedOutAt, err = cs.optedOutAt(userID, input.Email); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = cs.db.Exec(`
+		UPDATE emergency_contacts
+		SET name = ?, email = ?, phone = ?, relationship = ?, language = ?, opted_out_at = ?,
+		    verified_at = CASE WHEN ? THEN NULL ELSE verified_at END,
+		    confirmation_sent_at = CASE WHEN ? THEN NULL ELSE confirmation_sent_at END,
+		    confirmation_count = CASE WHEN ? THEN 0 ELSE confirmation_count END
+		WHERE id = ? AND user_id = ?
+	`, input.Name, input.Email, input.Phone, input.Relationship, input.Language, optedOutAt,
+		emailChanged, emailChanged, emailChanged, contactID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update contact: %w", err)
+	}
+
+	contact, err := cs.Get(userID, contactID)
+	if err != nil {
+		return nil, err
+	}
+
+	if emailChanged && contact.OptedOutAt == nil {
+		if err := cs.SendConfirmation(contact); err != nil {
+			log.Printf("Failed to send confirmation to contact %d: %v", contact.ID, err)
+		}
+	}
+
+	return contact, nil
+}
+
+// Delete 删除紧急联系人
+func (cs *ContactService) Delete(userID, contactID int64) error {
+	result, err := cs.db.Exec(`
+		DELETE FROM emergency_contacts WHERE id = ? AND user_id = ?
+	`, contactID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete contact: %w", err)
+	}
+
+	affected, _ := result.RowsAffected()
+	if affected == 0 {
+		return ErrContactNotFound
+	}
+	return nil
+}
+
+// SyncEmails 兼容旧接口：按邮箱列表增删紧急联系人
+// 旧接口返回的列表不含已退订的联系人，因此保留已退订的记录，避免退订状态丢失后再次打扰对方
+func (cs *ContactService) SyncEmails(userID int64, emails []string) error {
+	if len(emails) > MaxEmergencyContacts {
+		return ErrTooManyContacts
+	}
+
+	// 先校验全部邮箱，避免删除部分联系人后才发现参数错误
+	for _, email := range emails {
+		if email = NormalizeEmail(email); email == "" {
+			continue
+		}
+		if _, err := mail.ParseAddress(email); err != nil {
+			return fmt.Errorf("%w: invalid email address", ErrInvalidContactReq)
+		}
+	}
+
+	contacts, err := cs.List(userID)
+	if err != nil {
+		return err
+	}
+
+	wanted := map[string]bool{}
+	for _, email := range emails {
+		if email = NormalizeEmail(email); email != "" {
+			wanted[email] = true
+		}
+	}
+
+	existing := map[string]bool{}
+	for _, contact := range contacts {
+		key := NormalizeEmail(contact.Email)
+		existing[key] = true
+		if !wanted[key] && contact.OptedOutAt == nil {
+			if err := cs.Delete(userID, contact.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, email := range emails {
+		email = NormalizeEmail(email)
+		if email == "" || existing[email] {
+			continue
+		}
+		existing[email] = true
+		if _, err := cs.Create(userID, ContactInput{Email: email}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SendConfirmation 发送紧急联系人确认邮件
+// 距上次发送不足 ContactConfirmResendInterval 或已发送 MaxContactConfirmations 次时返回 ErrConfirmationLimit
+func (cs *ContactService) SendConfirmation(contact *models.EmergencyContact) error {
+	now := time.Now()
+	result, err := cs.db.Exec(`
+		UPDATE emergency_contacts
+		SET confirmation_sent_at = ?, confirmation_count = confirmation_count + 1
+		WHERE id = ? AND confirmation_count < ? AND (confirmation_sent_at IS NULL OR confirmation_sent_at <= ?)
+	`, now.UTC(), contact.ID, MaxContactConfirmations, now.Add(-ContactConfirmResendInterval).UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record confirmation: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrConfirmationLimit
+	}
+
+	var userName, timezone string
+	err = cs.db.QueryRow(`
+		SELECT name, timezone FROM users WHERE id = ?
+	`, contact.UserID).Scan(&userName, &timezone)
+	if err != nil {
+		return fmt.Errorf("failed to query user: %w", err)
+	}
+	if userName == "" {
+		userName = "您的朋友"
+	}
+
+	subject, body := cs.emailTemplate.BuildContactConfirmationEmail(ContactConfirmationData{
+		UserName:    userName,
+		ContactName: contact.Name,
+		ConfirmURL:  cs.ConfirmURL(contact),
+		OptOutURL:   cs.OptOutURL(contact.ID),
+	})
+
+	uniqueKey := fmt.Sprintf("%d_contact_confirm_%d_%d", contact.UserID, contact.ID, now.Unix())
+	return cs.notificationService.CreateNotification(
+		contact.UserID, "email", contact.Email, timezone, time.Now(),
+		models.NotificationContent{Subject: subject, Body: body}, uniqueKey,
+	)
+}
+
+// ConfirmURL 生成确认链接，令牌绑定当前邮箱，修改邮箱后旧链接失效
+func (cs *ContactService) ConfirmURL(contact *models.EmergencyContact) string {
+	token := cs.signer.SignBound(linkPurposeContactConfirm, contact.ID, NormalizeEmail(contact.Email), contactConfirmLinkTTL)
+	return strings.TrimRight(cs.config.Server.BaseURL, "/") + "/api/contacts/confirm/" + token
+}
+
+// OptOutURL 生成退订链接
+func (cs *ContactService) OptOutURL(contactID int64) string {
+	token := cs.signer.Sign(linkPurposeContactOptOut, contactID, contactOptOutLinkTTL)
+	return strings.TrimRight(cs.config.Server.BaseURL, "/") + "/api/contacts/opt-out/" + token
+}
+
+// PeekConfirm 校验确认链接但不执行确认
+func (cs *ContactService) PeekConfirm(token string) (*models.EmergencyContact, error) {
+	return cs.verifyConfirm(token)
+}
+
+// PeekOptOut 校验退订链接但不执行退订
+func (cs *ContactService) PeekOptOut(token string) (*models.EmergencyContact, error) {
+	contactID, err := cs.signer.Verify(linkPurposeContactOptOut, token)
+	if err != nil {
+		return nil, err
+	}
+	return cs.getByID(contactID)
+}
+
+// Confirm 通过签名链接确认紧急联系人，不会撤销已有的退订
+func (cs *ContactService) Confirm(token string) (*models.EmergencyContact, error) {
+	contact, err := cs.verifyConfirm(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按邮箱条件更新，避免校验后邮箱被并发修改
+	result, err := cs.db.Exec(`
+		UPDATE emergency_contacts SET verified_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND email = ? AND verified_at IS NULL
+	`, contact.ID, contact.Email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm contact: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 && contact.VerifiedAt == nil {
+		return nil, ErrInvalidLinkToken
+	}
+
+	return cs.getByID(contact.ID)
+}
+
+// verifyConfirm 校验确认链接，链接签发后邮箱被修改时视为无效
+func (cs *ContactService) verifyConfirm(token string) (*models.EmergencyContact, error) {
+	var contact *models.EmergencyContact
+	_, err := cs.signer.VerifyBound(linkPurposeContactConfirm, token, func(contactID int64) (string, error) {
+		var err error
+		contact, err = cs.getByID(contactID)
+		if err != nil {
+			return "", err
+		}
+		return NormalizeEmail(contact.Email), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return contact, nil
+}
+
+// OptOut 通过签名链接退订
+// 退订同时按用户和邮箱记录，删除联系人后重新添加同一邮箱时仍然有效
+func (cs *ContactService) OptOut(token string) (*models.EmergencyContact, error) {
+	contactID, err := cs.signer.Verify(linkPurposeContactOptOut, token)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = cs.db.Exec(`
+		UPDATE emergency_contacts SET opted_out_at = CURRENT_TIMESTAMP WHERE id = ? AND opted_out_at IS NULL
+	`, contactID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to opt out contact: %w", err)
+	}
+
+	contact, err := cs.getByID(contactID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = cs.db.Exec(`
+		INSERT INTO contact_opt_outs (user_id, email) VALUES (?, ?)
+	`, contact.UserID, NormalizeEmail(contact.Email))
+	if err != nil && !cs.db.Dialect().IsDuplicateKey(err) {
+		return nil, fmt.Errorf("failed to record opt-out: %w", err)
+	}
+
+	return contact, nil
+}
+
+// optedOutAt 邮箱对该用户的退订时间，没有退订时为 nil
+func (cs *ContactService) optedOutAt(userID int64, email string) (*time.Time, error) {
+	var optedOutAt time.Time
+	err := cs.db.QueryRow(`
+		SELECT opted_out_at FROM contact_opt_outs WHERE user_id = ? AND email = ?
+	`, userID, NormalizeEmail(email)).Scan(&optedOutAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query contact opt-out: %w", err)
+	}
+	return &optedOutAt, nil
+}
+
+// getByID 按ID获取紧急联系人（不校验所属用户）
+func (cs *ContactService) getByID(contactID int64) (*models.EmergencyContact, error) {
+	contact, err := scanContact(cs.db.QueryRow(`
+		SELECT `+contactColumns+` FROM emergency_contacts WHERE id = ?
+	`, contactID))
+	if err == sql.ErrNoRows {
+		return nil, ErrContactNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query contact: %w", err)
+	}
+	return contact, nil
+}
+
+// ensureEmailAvailable 检查同一用户下邮箱是否重复，忽略大小写以兼容规范化之前写入的数据
+func (cs *ContactService) ensureEmailAvailable(userID int64, email string, excludeID int64) error {
+	var exists bool
+	err := cs.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM emergency_contacts WHERE user_id = ? AND LOWER(email) = ? AND id != ?)
+	`, userID, NormalizeEmail(email), excludeID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check contact email: %w", err)
+	}
+	if exists {
+		return ErrContactExists
+	}
+	return nil
+}
+
+// NormalizeEmail 规范化邮箱：去除首尾空白并转为小写
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizePhone 将手机号规范化为 E.164 格式，未带国际区号时使用默认区号
+func (cs *ContactService) NormalizePhone(phone string) (string, error) {
+	return utils.NormalizePhoneE164(phone, cs.config.SMS.DefaultCountryCode)
+}
+
+// normalizeContactInput 校验并规范化联系人参数，手机号统一为 E.164 格式
+func (cs *ContactService) normalizeContactInput(input *ContactInput) error {
+	input.Name = strings.TrimSpace(input.Name)
+	input.Email = NormalizeEmail(input.Email)
+	input.Phone = strings.TrimSpace(input.Phone)
+	input.Relationship = strings.TrimSpace(input.Relationship)
+	input.Language = strings.TrimSpace(input.Language)
+
+	if input.Email == "" {
+		return fmt.Errorf("%w: email is required", ErrInvalidContactReq)
+	}
+	if _, err := mail.ParseAddress(input.Email); err != nil {
+		return fmt.Errorf("%w: invalid email address", ErrInvalidContactReq)
+	}
+	if len(input.Name) > 100 {
+		return fmt.Errorf("%w: name is too long", ErrInvalidContactReq)
+	}
+	phone, err := cs.NormalizePhone(input.Phone)
+	if err != nil {
+		return fmt.Errorf("%w: invalid phone number", ErrInvalidContactReq)
+	}
+	input.Phone = phone
+	if len(input.Relationship) > 50 {
+		return fmt.Errorf("%w: relationship is too long", ErrInvalidContactReq)
+	}
+	if input.Language == "" {
+		input.Language = "zh"
+	}
+	if len(input.Language) > 10 {
+		return fmt.Errorf("%w: invalid language", ErrInvalidContactReq)
+	}
+	return nil
+}
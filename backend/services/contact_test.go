@@ -0,0 +1,143 @@
+package services
+
+import (
+	"errors"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/deadornot/backend/config"
+	"github.com/deadornot/backend/database"
+	"github.com/deadornot/backend/repository"
+)
+
+func newTestContactService(t *testing.T) (*ContactService, *database.DB, int64) {
+	t.Helper()
+	db := newTestDB(t)
+	cfg := &config.Config{Server: config.ServerConfig{BaseURL: "https://example.com", SecretKey: "test-secret"}}
+	notificationService := NewNotificationService(repository.New(db).Notifications)
+	notificationService.Register(NewEmailNotifier(NewEmailService(cfg), cfg))
+	contactService := NewContactService(db, notificationService, NewLinkSigner(cfg), cfg)
+
+	userID, err := db.Insert(`INSERT INTO users (device_id, timezone) VALUES ('device-1', 'UTC')`)
+	if err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	return contactService, db, userID
+}
+
+// countConfirmations 发给 email 的确认邮件数量
+func countConfirmations(t *testing.T, db *database.DB, email string) int {
+	t.Helper()
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM notifications WHERE recipient = ?`, email).Scan(&count); err != nil {
+		t.Fatalf("count notifications: %v", err)
+	}
+	return count
+}
+
+func TestSendConfirmationLimit(t *testing.T) {
+	contactService, db, userID := newTestContactService(t)
+
+	contact, err := contactService.Create(userID, ContactInput{Name: "Alice", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if n := countConfirmations(t, db, "alice@example.com"); n != 1 {
+		t.Fatalf("confirmations after Create = %d, want 1", n)
+	}
+
+	// 刚发送过时不能立即重发
+	if err := contactService.SendConfirmation(contact); !errors.Is(err, ErrConfirmationLimit) {
+		t.Fatalf("immediate resend = %v, want ErrConfirmationLimit", err)
+	}
+
+	// 间隔足够后可以重发，但总次数有上限
+	for i := 1; i < MaxContactConfirmations; i++ {
+		if _, err := db.Exec(`UPDATE emergency_contacts SET confirmation_sent_at = ? WHERE id = ?`,
+			time.Now().Add(-ContactConfirmResendInterval).UTC(), contact.ID); err != nil {
+			t.Fatalf("rewind confirmation_sent_at: %v", err)
+		}
+		if err := contactService.SendConfirmation(contact); err != nil {
+			t.Fatalf("resend #%d: %v", i, err)
+		}
+	}
+	if _, err := db.Exec(`UPDATE emergency_contacts SET confirmation_sent_at = NULL WHERE id = ?`, contact.ID); err != nil {
+		t.Fatalf("clear confirmation_sent_at: %v", err)
+	}
+	if err := contactService.SendConfirmation(contact); !errors.Is(err, ErrConfirmationLimit) {
+		t.Fatalf("resend over limit = %v, want ErrConfirmationLimit", err)
+	}
+	if n := countConfirmations(t, db, "alice@example.com"); n != MaxContactConfirmations {
+		t.Errorf("confirmations = %d, want %d", n, MaxContactConfirmations)
+	}
+
+	// 修改邮箱后重新计数
+	if _, err := contactService.Update(userID, contact.ID, ContactInput{Name: "Alice", Email: "alice@example.org"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if n := countConfirmations(t, db, "alice@example.org"); n != 1 {
+		t.Errorf("confirmations to new email = %d, want 1", n)
+	}
+}
+
+func TestOptOutSurvivesDelete(t *testing.T) {
+	contactService, db, userID := newTestContactService(t)
+
+	contact, err := contactService.Create(userID, ContactInput{Name: "Alice", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := contactService.OptOut(path.Base(contactService.OptOutURL(contact.ID))); err != nil {
+		t.Fatalf("OptOut: %v", err)
+	}
+	if err := contactService.Delete(userID, contact.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	// 删除后重新添加同一邮箱（大小写不同）仍为退订状态，不再发送确认邮件
+	recreated, err := contactService.Create(userID, ContactInput{Name: "Alice", Email: "Alice@Example.com"})
+	if err != nil {
+		t.Fatalf("Create again: %v", err)
+	}
+	if recreated.OptedOutAt == nil {
+		t.Error("re-created contact is not opted out")
+	}
+	if n := countConfirmations(t, db, "alice@example.com"); n != 1 {
+		t.Errorf("confirmations after re-create = %d, want 1", n)
+	}
+
+	// 修改为已退订的邮箱同样保持退订
+	other, err := contactService.Create(userID, ContactInput{Name: "Bob", Email: "bob@example.com"})
+	if err != nil {
+		t.Fatalf("Create other: %v", err)
+	}
+	if err := contactService.Delete(userID, recreated.ID); err != nil {
+		t.Fatalf("Delete re-created: %v", err)
+	}
+	updated, err := contactService.Update(userID, other.ID, ContactInput{Name: "Bob", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if updated.OptedOutAt == nil {
+		t.Error("contact updated to an opted-out email is not opted out")
+	}
+
+	// 旧接口同步邮箱列表时同样不能绕过退订
+	if err := contactService.Delete(userID, updated.ID); err != nil {
+		t.Fatalf("Delete updated: %v", err)
+	}
+	if err := contactService.SyncEmails(userID, []string{"alice@example.com"}); err != nil {
+		t.Fatalf("SyncEmails: %v", err)
+	}
+	contacts, err := contactService.List(userID)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(contacts) != 1 || contacts[0].OptedOutAt == nil {
+		t.Errorf("synced contacts = %+v, want one opted-out contact", contacts)
+	}
+	if n := countConfirmations(t, db, "alice@example.com"); n != 1 {
+		t.Errorf("confirmations after sync = %d, want 1", n)
+	}
+}
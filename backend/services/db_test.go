@@ -0,0 +1,27 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/deadornot/backend/config"
+	"github.com/deadornot/backend/database"
+)
+
+// newTestDB 在临时目录中创建执行过迁移的 SQLite 数据库
+func newTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	cfg := &config.Config{Database: config.DatabaseConfig{
+		Driver: database.DriverSQLite,
+		Path:   filepath.Join(t.TempDir(), "test.db"),
+	}}
+	db, err := database.InitDB(cfg)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	return db
+}
@@ -44,6 +44,26 @@ func (es *EmailService) SendEmail(to, subject, body string) error {
 	return fmt.Errorf("unsupported email provider: %s", es.config.Email.Provider)
 }
 
+// CheckConfig 检查当前邮件服务商的配置是否完整
+func (es *EmailService) CheckConfig() error {
+	switch es.config.Email.Provider {
+	case "aliyun":
+		if es.config.Email.AliyunKey == "" || es.config.Email.AliyunSecret == "" {
+			return fmt.Errorf("Aliyun access key or secret is not configured")
+		}
+	case "smtp":
+		if es.config.Email.SMTPHost == "" || es.config.Email.SMTPUser == "" || es.config.Email.SMTPPassword == "" {
+			return fmt.Errorf("SMTP configuration is incomplete")
+		}
+	default:
+		return fmt.Errorf("unsupported email provider: %s", es.config.Email.Provider)
+	}
+	if es.config.Email.FromEmail == "" {
+		return fmt.Errorf("FROM_EMAIL is not configured")
+	}
+	return nil
+}
+
 // sendViaAliyun 通过阿里云邮件推送发送
 func (es *EmailService) sendViaAliyun(to, subject, body string) error {
 	if es.config.Email.AliyunKey == "" || es.config.Email.AliyunSecret == "" {
@@ -107,6 +127,11 @@ func (es *EmailService) sendViaAliyun(to, subject, body string) error {
 
 // calculateAliyunSignature 计算阿里云 API 签名
 func (es *EmailService) calculateAliyunSignature(method string, params url.Values) string {
+	return calculateAliyunSignature(method, es.config.Email.AliyunSecret, params)
+}
+
+// calculateAliyunSignature 计算阿里云 RPC 风格 API 签名，邮件推送和短信服务共用
+func calculateAliyunSignature(method, secret string, params url.Values) string {
 	// 1. 参数排序
 	keys := make([]string, 0, len(params))
 	for k := range params {
@@ -120,22 +145,27 @@ func (es *EmailService) calculateAliyunSignature(method string, params url.Value
 		if i > 0 {
 			paramStr.WriteString("&")
 		}
-		paramStr.WriteString(url.QueryEscape(k))
+		paramStr.WriteString(aliyunPercentEncode(k))
 		paramStr.WriteString("=")
-		paramStr.WriteString(url.QueryEscape(params.Get(k)))
+		paramStr.WriteString(aliyunPercentEncode(params.Get(k)))
 	}
 
 	// 3. 构造待签名字符串
-	stringToSign := method + "&" + url.QueryEscape("/") + "&" + url.QueryEscape(paramStr.String())
+	stringToSign := method + "&" + aliyunPercentEncode("/") + "&" + aliyunPercentEncode(paramStr.String())
 
 	// 4. 计算 HMAC-SHA1
-	mac := hmac.New(sha1.New, []byte(es.config.Email.AliyunSecret+"&"))
+	mac := hmac.New(sha1.New, []byte(secret+"&"))
 	mac.Write([]byte(stringToSign))
 	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
 
 	return signature
 }
 
+// aliyunPercentEncode 阿里云签名使用的 URL 编码：空格编码为 %20 而不是 +
+func aliyunPercentEncode(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
 // sendViaSMTP 通过SMTP发送
 func (es *EmailService) sendViaSMTP(to, subject, body string) error {
 	if es.config.Email.SMTPHost == "" || es.config.Email.SMTPUser == "" || es.config.Email.SMTPPassword == "" {
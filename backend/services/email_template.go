@@ -2,6 +2,8 @@ package services
 
 import (
 	"fmt"
+	"html"
+	"strings"
 	"time"
 )
 
@@ -16,15 +18,18 @@ func NewEmailTemplate() *EmailTemplate {
 // EmergencyReminderData 紧急提醒数据
 type EmergencyReminderData struct {
 	Name           string
-	DaysSince      int
+	Overdue        string // 未打卡时长，如 "3 天"、"5 小时"
 	LastCheckinAt  *time.Time
 	TotalCheckins  int
-	EmergencyPhone string // 紧急联系人电话（如果有）
+	EmergencyPhone string              // 紧急联系人电话（如果有）
+	OptOutURL      string              // 退订链接（如果有）
+	AckURL         string              // "我会去确认"链接（如果有）
+	Details        []CheckInDetailItem // 用户授权分享的最近上报的状态信息
 }
 
 // BuildEmergencyReminderEmail 构建紧急提醒邮件
 func (et *EmailTemplate) BuildEmergencyReminderEmail(data EmergencyReminderData) (subject, body string) {
-	subject = fmt.Sprintf("紧急提醒：%s 已连续多天未打卡", data.Name)
+	subject = fmt.Sprintf("紧急提醒：%s 已连续 %s未打卡", data.Name, data.Overdue)
 
 	// 获取日期描述
 	dateDescription := ""
@@ -131,7 +136,7 @@ func (et *EmailTemplate) BuildEmergencyReminderEmail(data EmergencyReminderData)
 
             <div class="alert-box">
                 <strong>%s 的紧急联系人</strong><br>
-                %s 已连续 <strong>%d 天</strong> 未在"死了么"应用打卡，请您留意！
+                %s 已连续 <strong>%s</strong>未在"死了么"应用打卡，请您留意！
             </div>
 
             <table class="info-table">
@@ -140,8 +145,8 @@ func (et *EmailTemplate) BuildEmergencyReminderEmail(data EmergencyReminderData)
                     <td>%s</td>
                 </tr>
                 <tr>
-                    <th>未打卡天数</th>
-                    <td>%d 天</td>
+                    <th>未打卡时长</th>
+                    <td>%s</td>
                 </tr>
                 <tr>
                     <th>最后打卡时间</th>
@@ -151,10 +156,10 @@ func (et *EmailTemplate) BuildEmergencyReminderEmail(data EmergencyReminderData)
                     <th>累计打卡天数</th>
                     <td>%d 次</td>
                 </tr>
-            </table>
+%s            </table>
 
             <p>请尽快通过电话或其他方式联系 %s，确认其安全状况。</p>
-
+%s
             <p style="color: #666666; font-size: 14px;">
                 如已确认 %s 安全，请忽略此邮件。
             </p>
@@ -162,27 +167,220 @@ func (et *EmailTemplate) BuildEmergencyReminderEmail(data EmergencyReminderData)
             <div style="margin-top: 30px; padding-top: 20px; border-top: 1px solid #eeeeee;">
                 <p style="color: #999999; font-size: 12px; margin: 0;">
                     此邮件由 <span class="app-name">死了么</span> 自动发送<br>
-                    如果您不希望再收到此类通知，请联系 %s 修改紧急联系人设置
+                    如果您不希望再收到此类通知，请联系 %s 修改紧急联系人设置%s
                 </p>
             </div>
         </div>
     </div>
 </body>
-</html>`, data.Name, data.Name, data.DaysSince, data.Name, data.DaysSince, dateDescription, data.TotalCheckins, data.Name, data.Name, data.Name)
+</html>`, data.Name, data.Name, data.Overdue, data.Name, data.Overdue, dateDescription, data.TotalCheckins, checkInDetailRows(data.Details), data.Name, ackButton(data.AckURL, data.Name), data.Name, data.Name, optOutLink(data.OptOutURL))
 
 	return subject, htmlBody
 }
 
+// AllClearData 解除提醒数据
+type AllClearData struct {
+	Name          string
+	RecipientName string
+	LastCheckinAt *time.Time
+	CheckinAt     time.Time
+	Gap           time.Duration
+}
+
+// BuildAllClearEmail 构建"已恢复打卡"邮件，通知收到过紧急提醒的联系人
+func (et *EmailTemplate) BuildAllClearEmail(data AllClearData) (subject, body string) {
+	subject = fmt.Sprintf("好消息：%s 已重新打卡", data.Name)
+
+	greeting := "您好，"
+	if data.RecipientName != "" {
+		greeting = fmt.Sprintf("%s，您好：", data.RecipientName)
+	}
+
+	lastCheckinDescription := "未知"
+	if data.LastCheckinAt != nil {
+		lastCheckinDescription = data.LastCheckinAt.Format("2006年1月2日 15:04")
+	}
+
+	htmlBody := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>已恢复打卡</title>
+    <style>
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif;
+            line-height: 1.6;
+            color: #333333;
+            max-width: 600px;
+            margin: 0 auto;
+            padding: 20px;
+        }
+        .container {
+            background-color: #ffffff;
+            border-radius: 12px;
+            box-shadow: 0 2px 8px rgba(0, 0, 0, 0.1);
+            overflow: hidden;
+        }
+        .header {
+            background: linear-gradient(135deg, #43e97b 0%%, #38f9d7 100%%);
+            color: white;
+            padding: 30px 20px;
+            text-align: center;
+        }
+        .header h1 {
+            margin: 0;
+            font-size: 24px;
+            font-weight: 600;
+        }
+        .content {
+            padding: 30px 20px;
+        }
+        .success-box {
+            background-color: #d4edda;
+            border-left: 4px solid #28a745;
+            padding: 15px;
+            margin: 20px 0;
+            border-radius: 4px;
+        }
+        .info-table {
+            width: 100%%;
+            border-collapse: collapse;
+            margin: 20px 0;
+        }
+        .info-table th, .info-table td {
+            padding: 12px;
+            text-align: left;
+            border-bottom: 1px solid #eeeeee;
+        }
+        .info-table th {
+            color: #666666;
+            font-weight: 500;
+            width: 40%%;
+        }
+        .info-table td {
+            font-weight: 600;
+        }
+        .app-name {
+            color: #667eea;
+            font-weight: 600;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>✅ 警报解除</h1>
+        </div>
+        <div class="content">
+            <p>%s</p>
+
+            <div class="success-box">
+                <strong>%s 已在"死了么"应用重新打卡</strong>，之前的紧急提醒已解除。
+            </div>
+
+            <table class="info-table">
+                <tr>
+                    <th>上次打卡时间</th>
+                    <td>%s</td>
+                </tr>
+                <tr>
+                    <th>本次打卡时间</th>
+                    <td>%s</td>
+                </tr>
+                <tr>
+                    <th>中断时长</th>
+                    <td>%s</td>
+                </tr>
+            </table>
+
+            <p>感谢您的关心。</p>
+
+            <div style="margin-top: 30px; padding-top: 20px; border-top: 1px solid #eeeeee;">
+                <p style="color: #999999; font-size: 12px; margin: 0;">
+                    此邮件由 <span class="app-name">死了么</span> 自动发送
+                </p>
+            </div>
+        </div>
+    </div>
+</body>
+</html>`, greeting, data.Name, lastCheckinDescription, data.CheckinAt.Format("2006年1月2日 15:04"), formatGap(data.Gap))
+
+	return subject, htmlBody
+}
+
+// formatGap 将时长格式化为"X 天 Y 小时"
+func formatGap(gap time.Duration) string {
+	if gap < time.Hour {
+		return "不到 1 小时"
+	}
+	days := int(gap.Hours()) / 24
+	hours := int(gap.Hours()) % 24
+	if days == 0 {
+		return fmt.Sprintf("%d 小时", hours)
+	}
+	if hours == 0 {
+		return fmt.Sprintf("%d 天", days)
+	}
+	return fmt.Sprintf("%d 天 %d 小时", days, hours)
+}
+
+// ackButton 构建"我会去确认"按钮，点击后其他联系人会收到通知并暂停升级
+func ackButton(url, name string) string {
+	if url == "" {
+		return ""
+	}
+	return fmt.Sprintf(`
+            <p style="text-align: center;">
+                <a href="%s" class="cta-button">我会去确认 %s 的情况</a>
+            </p>
+            <p style="color: #666666; font-size: 14px; text-align: center;">
+                点击后我们会告知其他紧急联系人，并暂停发送提醒
+            </p>
+`, url, name)
+}
+
+// checkInDetailRows 构建紧急提醒邮件中最近上报的状态信息行，留言等内容由用户填写，需要转义
+func checkInDetailRows(items []CheckInDetailItem) string {
+	rows := ""
+	for _, item := range items {
+		value := html.EscapeString(item.Value)
+		if item.URL != "" {
+			value = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(item.URL), value)
+		}
+		rows += fmt.Sprintf(`                <tr>
+                    <th>最近%s</th>
+                    <td>%s <span style="color: #999999; font-weight: normal;">（%s）</span></td>
+                </tr>
+`, item.Label, value, item.At.Format("1月2日 15:04"))
+	}
+	return rows
+}
+
+// optOutLink 构建邮件底部的退订链接
+func optOutLink(url string) string {
+	if url == "" {
+		return ""
+	}
+	return fmt.Sprintf(`，或<a href="%s" style="color: #999999;">点击此处退订</a>`, url)
+}
+
 // DailyReminderData 每日提醒数据
 type DailyReminderData struct {
 	Name         string
 	ReminderTime string
+	CheckInURL   string // 一键打卡链接
 }
 
 // BuildDailyReminderEmail 构建每日打卡提醒邮件
 func (et *EmailTemplate) BuildDailyReminderEmail(data DailyReminderData) (subject, body string) {
 	subject = fmt.Sprintf("%s，该打卡了！", data.Name)
 
+	checkInURL := data.CheckInURL
+	if checkInURL == "" {
+		checkInURL = "#"
+	}
+
 	htmlBody := fmt.Sprintf(`<!DOCTYPE html>
 <html>
 <head>
@@ -206,7 +404,65 @@ func (et *EmailTemplate) BuildDailyReminderEmail(data DailyReminderData) (subjec
             <p>今天是%s，您还没有完成打卡哦！</p>
             <p>请打开"死了么"应用，点击打卡按钮完成每日打卡。</p>
             <p style="text-align: center;">
-                <a href="#" class="button">立即打卡</a>
+                <a href="%s" class="button">我很好，立即打卡</a>
+            </p>
+        </div>
+        <div class="footer">
+            此邮件由"死了么"自动发送
+        </div>
+    </div>
+</body>
+</html>`, data.Name, data.ReminderTime, checkInURL)
+
+	return subject, htmlBody
+}
+
+// ContactConfirmationData 紧急联系人确认数据
+type ContactConfirmationData struct {
+	UserName    string
+	ContactName string
+	ConfirmURL  string
+	OptOutURL   string
+}
+
+// BuildContactConfirmationEmail 构建紧急联系人确认邮件
+func (et *EmailTemplate) BuildContactConfirmationEmail(data ContactConfirmationData) (subject, body string) {
+	// 邮件发给尚未确认的第三方地址，用户填写的名字只作为文本出现
+	subject = fmt.Sprintf("%s 希望将您设为紧急联系人", headerText(data.UserName))
+
+	userName := html.EscapeString(data.UserName)
+	greeting := "您好："
+	if data.ContactName != "" {
+		greeting = fmt.Sprintf("%s，您好：", html.EscapeString(data.ContactName))
+	}
+
+	htmlBody := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px; }
+        .container { background: #ffffff; border-radius: 12px; box-shadow: 0 2px 8px rgba(0,0,0,0.1); }
+        .header { background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); color: white; padding: 30px; text-align: center; }
+        .content { padding: 30px; }
+        .button { display: inline-block; background: #667eea; color: white; padding: 12px 24px; border-radius: 8px; text-decoration: none; font-weight: 500; }
+        .footer { text-align: center; padding: 20px; color: #999; font-size: 12px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>🤝 紧急联系人确认</h1>
+        </div>
+        <div class="content">
+            <p>%s</p>
+            <p>%s 在"死了么"应用中将您设为紧急联系人。当 %s 连续多天未打卡时，我们会通过邮件通知您。</p>
+            <p>如果您同意接收此类通知，请点击下方按钮确认：</p>
+            <p style="text-align: center;">
+                <a href="%s" class="button">确认成为紧急联系人</a>
+            </p>
+            <p style="color: #666666; font-size: 14px;">
+                如果您不认识 %s 或不希望接收通知，请忽略此邮件，或<a href="%s">点击此处拒绝</a>。
             </p>
         </div>
         <div class="footer">
@@ -214,7 +470,233 @@ func (et *EmailTemplate) BuildDailyReminderEmail(data DailyReminderData) (subjec
         </div>
     </div>
 </body>
-</html>`, data.Name, data.ReminderTime)
+</html>`, greeting, userName, userName, html.EscapeString(data.ConfirmURL), userName, html.EscapeString(data.OptOutURL))
 
 	return subject, htmlBody
 }
+
+// IncidentAcknowledgedData 紧急联系人已确认的通知数据
+type IncidentAcknowledgedData struct {
+	Name           string
+	AcknowledgedBy string
+	RecipientName  string
+	PausedUntil    *time.Time
+}
+
+// BuildIncidentAcknowledgedEmail 构建"已有联系人在跟进"的通知邮件
+func (et *EmailTemplate) BuildIncidentAcknowledgedEmail(data IncidentAcknowledgedData) (subject, body string) {
+	subject = fmt.Sprintf("%s 正在确认 %s 的情况", headerText(data.AcknowledgedBy), headerText(data.Name))
+
+	name := html.EscapeString(data.Name)
+	acknowledgedBy := html.EscapeString(data.AcknowledgedBy)
+	greeting := "您好："
+	if data.RecipientName != "" {
+		greeting = fmt.Sprintf("%s，您好：", html.EscapeString(data.RecipientName))
+	}
+
+	pauseDescription := ""
+	if data.PausedUntil != nil {
+		pauseDescription = fmt.Sprintf("在 %s 之前，我们将暂停向您发送提醒。", data.PausedUntil.Format("2006年1月2日 15:04"))
+	}
+
+	htmlBody := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px; }
+        .container { background: #ffffff; border-radius: 12px; box-shadow: 0 2px 8px rgba(0,0,0,0.1); }
+        .header { background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); color: white; padding: 30px; text-align: center; }
+        .content { padding: 30px; }
+        .footer { text-align: center; padding: 20px; color: #999; font-size: 12px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>🙋 已有人在跟进</h1>
+        </div>
+        <div class="content">
+            <p>%s</p>
+            <p><strong>%s</strong> 已表示会去确认 %s 的情况。%s</p>
+            <p>如果您仍然担心，也可以直接联系 %s 或 %s。</p>
+        </div>
+        <div class="footer">
+            此邮件由"死了么"自动发送
+        </div>
+    </div>
+</body>
+</html>`, greeting, acknowledgedBy, name, pauseDescription, name, acknowledgedBy)
+
+	return subject, htmlBody
+}
+
+// EmailVerificationData 邮箱验证数据
+type EmailVerificationData struct {
+	Name      string
+	VerifyURL string
+}
+
+// BuildEmailVerificationEmail 构建用户邮箱验证邮件
+func (et *EmailTemplate) BuildEmailVerificationEmail(data EmailVerificationData) (subject, body string) {
+	subject = "请验证您的邮箱"
+
+	greeting := "您好："
+	if data.Name != "" {
+		greeting = fmt.Sprintf("%s，您好：", data.Name)
+	}
+
+	htmlBody := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px; }
+        .container { background: #ffffff; border-radius: 12px; box-shadow: 0 2px 8px rgba(0,0,0,0.1); }
+        .header { background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); color: white; padding: 30px; text-align: center; }
+        .content { padding: 30px; }
+        .button { display: inline-block; background: #667eea; color: white; padding: 12px 24px; border-radius: 8px; text-decoration: none; font-weight: 500; }
+        .footer { text-align: center; padding: 20px; color: #999; font-size: 12px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>✉️ 验证邮箱</h1>
+        </div>
+        <div class="content">
+            <p>%s</p>
+            <p>您在"死了么"应用中填写了这个邮箱。验证后，更换手机时可以通过这个邮箱找回账号。</p>
+            <p style="text-align: center;">
+                <a href="%s" class="button">验证邮箱</a>
+            </p>
+            <p style="color: #666666; font-size: 14px;">
+                如果这不是您的操作，请忽略此邮件。
+            </p>
+        </div>
+        <div class="footer">
+            此邮件由"死了么"自动发送
+        </div>
+    </div>
+</body>
+</html>`, greeting, data.VerifyURL)
+
+	return subject, htmlBody
+}
+
+// AccountRecoveryData 找回账号数据
+type AccountRecoveryData struct {
+	Name        string
+	RecoveryURL string
+	ExpiresIn   time.Duration
+}
+
+// BuildAccountRecoveryEmail 构建找回账号邮件
+func (et *EmailTemplate) BuildAccountRecoveryEmail(data AccountRecoveryData) (subject, body string) {
+	subject = "在新设备上找回您的账号"
+
+	greeting := "您好："
+	if data.Name != "" {
+		greeting = fmt.Sprintf("%s，您好：", data.Name)
+	}
+
+	htmlBody := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px; }
+        .container { background: #ffffff; border-radius: 12px; box-shadow: 0 2px 8px rgba(0,0,0,0.1); }
+        .header { background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); color: white; padding: 30px; text-align: center; }
+        .content { padding: 30px; }
+        .button { display: inline-block; background: #667eea; color: white; padding: 12px 24px; border-radius: 8px; text-decoration: none; font-weight: 500; }
+        .footer { text-align: center; padding: 20px; color: #999; font-size: 12px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>📱 找回账号</h1>
+        </div>
+        <div class="content">
+            <p>%s</p>
+            <p>有一台新设备请求登录您在"死了么"的账号。确认后，这台设备将使用您原来的打卡记录和紧急联系人。</p>
+            <p style="text-align: center;">
+                <a href="%s" class="button">在新设备上登录</a>
+            </p>
+            <p style="color: #666666; font-size: 14px;">
+                链接 %s 内有效，只能使用一次。如果这不是您的操作，请忽略此邮件，您的账号不会有任何变化。
+            </p>
+        </div>
+        <div class="footer">
+            此邮件由"死了么"自动发送
+        </div>
+    </div>
+</body>
+</html>`, greeting, data.RecoveryURL, formatGap(data.ExpiresIn))
+
+	return subject, htmlBody
+}
+
+// PauseNoticeData 暂停提醒通知数据，时间为用户时区的本地时间
+type PauseNoticeData struct {
+	Name          string
+	RecipientName string
+	StartsAt      time.Time
+	EndsAt        time.Time
+	Reason        string
+	OptOutURL     string
+}
+
+// BuildPauseNoticeEmail 构建通知紧急联系人"用户暂停了打卡"的邮件
+func (et *EmailTemplate) BuildPauseNoticeEmail(data PauseNoticeData) (subject, body string) {
+	subject = fmt.Sprintf("%s 暂停了\"死了么\"的打卡", data.Name)
+
+	greeting := "您好："
+	if data.RecipientName != "" {
+		greeting = fmt.Sprintf("%s，您好：", data.RecipientName)
+	}
+
+	reasonDescription := ""
+	if data.Reason != "" {
+		reasonDescription = fmt.Sprintf("<p>原因：%s</p>", html.EscapeString(data.Reason))
+	}
+
+	htmlBody := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px; }
+        .container { background: #ffffff; border-radius: 12px; box-shadow: 0 2px 8px rgba(0,0,0,0.1); }
+        .header { background: linear-gradient(135deg, #48c6ef 0%%, #6f86d6 100%%); color: white; padding: 30px; text-align: center; }
+        .content { padding: 30px; }
+        .footer { text-align: center; padding: 20px; color: #999; font-size: 12px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>⏸️ 暂停打卡</h1>
+        </div>
+        <div class="content">
+            <p>%s</p>
+            <p><strong>%s</strong> 将在 %s 至 %s 期间暂停打卡。</p>
+            %s
+            <p>暂停期间 %s 不需要打卡，我们也不会因为未打卡向您发送紧急提醒。暂停结束后将恢复正常。</p>
+        </div>
+        <div class="footer">
+            此邮件由"死了么"自动发送%s
+        </div>
+    </div>
+</body>
+</html>`, greeting, data.Name, data.StartsAt.Format("2006年1月2日 15:04"), data.EndsAt.Format("2006年1月2日 15:04"),
+		reasonDescription, data.Name, optOutLink(data.OptOutURL))
+
+	return subject, htmlBody
+}
+
+// headerText 用于邮件标题的文本，换行等空白字符替换为空格，避免注入邮件头
+func headerText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildContactConfirmationEmailEscapesNames(t *testing.T) {
+	subject, body := NewEmailTemplate().BuildContactConfirmationEmail(ContactConfirmationData{
+		UserName:    "Eve\r\nBcc: victim@example.com <a href=\"https://evil.example.com\">点击</a>",
+		ContactName: "<b>Bob</b>",
+		ConfirmURL:  "https://example.com/confirm?token=a&b",
+		OptOutURL:   "https://example.com/opt-out",
+	})
+
+	if strings.ContainsAny(subject, "\r\n") {
+		t.Errorf("subject contains a line break: %q", subject)
+	}
+	for _, raw := range []string{`<a href="https://evil.example.com">`, "<b>Bob</b>"} {
+		if strings.Contains(body, raw) {
+			t.Errorf("body contains unescaped %q", raw)
+		}
+	}
+	if !strings.Contains(body, "&lt;b&gt;Bob&lt;/b&gt;") {
+		t.Error("contact name is not escaped in the body")
+	}
+	if !strings.Contains(body, `href="https://example.com/confirm?token=a&amp;b"`) {
+		t.Error("confirm URL is missing from the body")
+	}
+}
+
+func TestBuildIncidentAcknowledgedEmailEscapesNames(t *testing.T) {
+	subject, body := NewEmailTemplate().BuildIncidentAcknowledgedEmail(IncidentAcknowledgedData{
+		Name:           "Alice\nBcc: victim@example.com",
+		AcknowledgedBy: "<script>alert(1)</script>",
+		RecipientName:  "<i>Carol</i>",
+	})
+
+	if strings.ContainsAny(subject, "\r\n") {
+		t.Errorf("subject contains a line break: %q", subject)
+	}
+	for _, raw := range []string{"<script>", "<i>Carol</i>"} {
+		if strings.Contains(body, raw) {
+			t.Errorf("body contains unescaped %q", raw)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/deadornot/backend/database"
+	"github.com/deadornot/backend/models"
+)
+
+// 升级策略限制
+const (
+	maxEscalationSteps = 20
+	maxEscalationDay   = 365
+)
+
+// EscalationService 升级策略服务
+type EscalationService struct {
+	db *database.DB
+}
+
+// NewEscalationService 创建升级策略服务
+func NewEscalationService(db *database.DB) *EscalationService {
+	return &EscalationService{
+		db: db,
+	}
+}
+
+// GetPolicy 获取用户的升级策略，未设置时返回默认策略
+func (es *EscalationService) GetPolicy(userID int64) (*models.EscalationPolicy, error) {
+	policy := &models.EscalationPolicy{UserID: userID}
+
+	var updatedAt sql.NullTime
+	err := es.db.QueryRow(`
+		SELECT steps, updated_at FROM escalation_policies WHERE user_id = ?
+	`, userID).Scan(&policy.Steps, &updatedAt)
+
+	if err == sql.ErrNoRows {
+		policy.Steps = models.DefaultEscalationSteps()
+		policy.IsDefault = true
+		return policy, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query escalation policy: %w", err)
+	}
+
+	if updatedAt.Valid {
+		policy.UpdatedAt = &updatedAt.Time
+	}
+	return policy, nil
+}
+
+// UpdatePolicy 保存用户的升级策略
+func (es *EscalationService) UpdatePolicy(userID int64, steps models.EscalationSteps) (*models.EscalationPolicy, error) {
+	if err := ValidateEscalationSteps(steps); err != nil {
+		return nil, err
+	}
+
+	stepsJSON, err := json.Marshal(steps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal steps: %w", err)
+	}
+
+	_, err = es.db.Exec(`
+		INSERT INTO escalation_policies (user_id, steps, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+	`+es.db.Dialect().Upsert([]string{"user_id"}, "steps", "updated_at"), userID, string(stepsJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save escalation policy: %w", err)
+	}
+
+	return es.GetPolicy(userID)
+}
+
+// ResetPolicy 删除自定义策略，恢复默认策略
+func (es *EscalationService) ResetPolicy(userID int64) error {
+	_, err := es.db.Exec(`
+		DELETE FROM escalation_policies WHERE user_id = ?
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to reset escalation policy: %w", err)
+	}
+	return nil
+}
+
+// ValidateEscalationSteps 校验升级步骤
+func ValidateEscalationSteps(steps models.EscalationSteps) error {
+	if len(steps) > maxEscalationSteps {
+		return fmt.Errorf("maximum %d escalation steps allowed", maxEscalationSteps)
+	}
+
+	for i, step := range steps {
+		if step.Day < 1 || step.Day > maxEscalationDay {
+			return fmt.Errorf("step %d: day must be between 1 and %d", i+1, maxEscalationDay)
+		}
+
+		switch step.Channel {
+		case models.EscalationChannelPush, models.EscalationChannelEmail, models.EscalationChannelSMS:
+		default:
+			return fmt.Errorf("step %d: unsupported channel: %s", i+1, step.Channel)
+		}
+
+		switch step.Target {
+		case models.EscalationTargetUser, models.EscalationTargetContacts:
+		default:
+			return fmt.Errorf("step %d: unsupported target: %s", i+1, step.Target)
+		}
+
+		// 紧急联系人没有安装 App，无法接收推送
+		if step.Channel == models.EscalationChannelPush && step.Target == models.EscalationTargetContacts {
+			return errors.New("push notifications can only be sent to the user")
+		}
+	}
+
+	return nil
+}
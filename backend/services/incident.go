@@ -0,0 +1,467 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/deadornot/backend/config"
+	"github.com/deadornot/backend/database"
+	"github.com/deadornot/backend/models"
+)
+
+// 紧急联系人确认链接用途和有效期
+const (
+	linkPurposeIncidentAck = "incident_ack"
+
+	incidentAckLinkTTL = 30 * 24 * time.Hour
+)
+
+var (
+	ErrIncidentNotFound = errors.New("incident not found")
+	ErrIncidentResolved = errors.New("incident has already been resolved")
+)
+
+// IncidentService 紧急事件服务
+type IncidentService struct {
+	db                  *database.DB
+	notificationService *NotificationService
+	signer              *LinkSigner
+	webhookService      *WebhookService
+	emailTemplate       *EmailTemplate
+	config              *config.Config
+}
+
+// NewIncidentService 创建紧急事件服务
+func NewIncidentService(db *database.DB, notificationService *NotificationService, signer *LinkSigner, webhookService *WebhookService, cfg *config.Config) *IncidentService {
+	return &IncidentService{
+		db:                  db,
+		notificationService: notificationService,
+		signer:              signer,
+		webhookService:      webhookService,
+		emailTemplate:       NewEmailTemplate(),
+		config:              cfg,
+	}
+}
+
+const incidentColumns = `id, user_id, status, last_checkin_at, opened_at, acknowledged_by, acknowledged_at, paused_until, resolved_at`
+
+// scanIncident 扫描一行紧急事件
+func scanIncident(scanner interface{ Scan(...interface{}) error }) (*models.Incident, error) {
+	var incident models.Incident
+	var lastCheckinAt, acknowledgedAt, pausedUntil, resolvedAt sql.NullTime
+	var acknowledgedBy sql.NullInt64
+	err := scanner.Scan(
+		&incident.ID, &incident.UserID, &incident.Status, &lastCheckinAt, &incident.OpenedAt,
+		&acknowledgedBy, &acknowledgedAt, &pausedUntil, &resolvedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if lastCheckinAt.Valid {
+		incident.LastCheckinAt = &lastCheckinAt.Time
+	}
+	if acknowledgedBy.Valid {
+		incident.AcknowledgedBy = &acknowledgedBy.Int64
+	}
+	if acknowledgedAt.Valid {
+		incident.AcknowledgedAt = &acknowledgedAt.Time
+	}
+	if pausedUntil.Valid {
+		incident.PausedUntil = &pausedUntil.Time
+	}
+	if resolvedAt.Valid {
+		incident.ResolvedAt = &resolvedAt.Time
+	}
+	incident.Contacts = []*models.IncidentContact{}
+	return &incident, nil
+}
+
+// GetActive 获取用户当前未解除的紧急事件，没有时返回 nil
+func (is *IncidentService) GetActive(userID int64) (*models.Incident, error) {
+	incident, err := scanIncident(is.db.QueryRow(`
+		SELECT `+incidentColumns+` FROM incidents
+		WHERE user_id = ? AND status != 'resolved'
+		ORDER BY id DESC LIMIT 1
+	`, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incident: %w", err)
+	}
+	return incident, nil
+}
+
+// Open 开启紧急事件，已有未解除的事件时直接返回
+func (is *IncidentService) Open(userID int64, lastCheckinAt *time.Time) (*models.Incident, error) {
+	incident, err := is.GetActive(userID)
+	if err != nil || incident != nil {
+		return incident, err
+	}
+
+	_, err = is.db.Exec(`
+		INSERT INTO incidents (user_id, status, last_checkin_at) VALUES (?, 'open', ?)
+	`, userID, lastCheckinAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open incident: %w", err)
+	}
+	log.Printf("Incident opened for user %d", userID)
+
+	return is.GetActive(userID)
+}
+
+// List 获取用户最近的紧急事件
+func (is *IncidentService) List(userID int64, limit int) ([]*models.Incident, error) {
+	rows, err := is.db.Query(`
+		SELECT `+incidentColumns+` FROM incidents
+		WHERE user_id = ?
+		ORDER BY id DESC LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incidents: %w", err)
+	}
+	defer rows.Close()
+
+	incidents := []*models.Incident{}
+	for rows.Next() {
+		incident, err := scanIncident(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan incident: %w", err)
+		}
+		incidents = append(incidents, incident)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, incident := range incidents {
+		if err := is.loadContacts(incident); err != nil {
+			return nil, err
+		}
+	}
+	return incidents, nil
+}
+
+// loadContacts 加载紧急事件中被通知的联系人
+func (is *IncidentService) loadContacts(incident *models.Incident) error {
+	rows, err := is.db.Query(`
+		SELECT ic.id, ic.incident_id, ic.contact_id, ec.name, ec.email,
+		       ic.first_alerted_at, ic.last_alerted_at, ic.acknowledged_at, ec.opted_out_at IS NOT NULL
+		FROM incident_contacts ic
+		JOIN emergency_contacts ec ON ec.id = ic.contact_id
+		WHERE ic.incident_id = ?
+		ORDER BY ic.id
+	`, incident.ID)
+	if err != nil {
+		return fmt.Errorf("failed to query incident contacts: %w", err)
+	}
+	defer rows.Close()
+
+	incident.Contacts = []*models.IncidentContact{}
+	for rows.Next() {
+		var contact models.IncidentContact
+		var acknowledgedAt sql.NullTime
+		if err := rows.Scan(
+			&contact.ID, &contact.IncidentID, &contact.ContactID, &contact.Name, &contact.Email,
+			&contact.FirstAlertedAt, &contact.LastAlertedAt, &acknowledgedAt, &contact.OptedOut,
+		); err != nil {
+			return fmt.Errorf("failed to scan incident contact: %w", err)
+		}
+		if acknowledgedAt.Valid {
+			contact.AcknowledgedAt = &acknowledgedAt.Time
+		}
+		if incident.AcknowledgedBy != nil && *incident.AcknowledgedBy == contact.ContactID {
+			incident.AcknowledgedByName = contactDisplayName(contact.Name, contact.Email)
+		}
+		incident.Contacts = append(incident.Contacts, &contact)
+	}
+	return rows.Err()
+}
+
+// RecordAlert 记录向联系人发出了提醒，返回确认链接
+func (is *IncidentService) RecordAlert(incidentID, contactID int64) (string, error) {
+	_, err := is.db.Exec(`
+		INSERT INTO incident_contacts (incident_id, contact_id, last_alerted_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+	`+is.db.Dialect().Upsert([]string{"incident_id", "contact_id"}, "last_alerted_at"), incidentID, contactID)
+	if err != nil {
+		return "", fmt.Errorf("failed to record incident alert: %w", err)
+	}
+
+	var incidentContactID int64
+	err = is.db.QueryRow(`
+		SELECT id FROM incident_contacts WHERE incident_id = ? AND contact_id = ?
+	`, incidentID, contactID).Scan(&incidentContactID)
+	if err != nil {
+		return "", fmt.Errorf("failed to query incident contact: %w", err)
+	}
+
+	token := is.signer.Sign(linkPurposeIncidentAck, incidentContactID, incidentAckLinkTTL)
+	return strings.TrimRight(is.config.Server.BaseURL, "/") + "/api/incidents/ack/" + token, nil
+}
+
+// PeekAcknowledge 校验确认链接但不记录，返回紧急事件
+func (is *IncidentService) PeekAcknowledge(token string) (*models.Incident, error) {
+	incidentContactID, err := is.signer.Verify(linkPurposeIncidentAck, token)
+	if err != nil {
+		return nil, err
+	}
+
+	incident, err := scanIncident(is.db.QueryRow(`
+		SELECT i.id, i.user_id, i.status, i.last_checkin_at, i.opened_at,
+		       i.acknowledged_by, i.acknowledged_at, i.paused_until, i.resolved_at
+		FROM incident_contacts ic
+		JOIN incidents i ON i.id = ic.incident_id
+		WHERE ic.id = ?
+	`, incidentContactID))
+	if err == sql.ErrNoRows {
+		return nil, ErrIncidentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incident: %w", err)
+	}
+	if incident.Status == models.IncidentStatusResolved {
+		return nil, ErrIncidentResolved
+	}
+	return incident, nil
+}
+
+// Acknowledge 紧急联系人确认会去查看情况：暂停升级并通知其他联系人
+func (is *IncidentService) Acknowledge(token string) (*models.Incident, error) {
+	incidentContactID, err := is.signer.Verify(linkPurposeIncidentAck, token)
+	if err != nil {
+		return nil, err
+	}
+
+	incident, err := is.PeekAcknowledge(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var contactID int64
+	var firstAck bool
+	err = is.db.QueryRow(`
+		SELECT contact_id, acknowledged_at IS NULL FROM incident_contacts WHERE id = ?
+	`, incidentContactID).Scan(&contactID, &firstAck)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incident contact: %w", err)
+	}
+
+	pausedUntil := time.Now().Add(is.config.Incident.AckPauseDuration)
+
+	tx, err := is.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE incident_contacts SET acknowledged_at = CURRENT_TIMESTAMP WHERE id = ? AND acknowledged_at IS NULL
+	`, incidentContactID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acknowledge incident: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE incidents
+		SET status = 'acknowledged', acknowledged_by = ?, acknowledged_at = CURRENT_TIMESTAMP, paused_until = ?
+		WHERE id = ? AND status != 'resolved'
+	`, contactID, pausedUntil, incident.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acknowledge incident: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	incident, err = is.get(incident.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 同一联系人重复点击时不重复广播
+	if firstAck {
+		if err := is.broadcastAcknowledgement(incident, contactID); err != nil {
+			log.Printf("Failed to broadcast acknowledgement for incident %d: %v", incident.ID, err)
+		}
+	}
+
+	return incident, nil
+}
+
+// broadcastAcknowledgement 通知其他被提醒过的联系人：已有人在跟进
+func (is *IncidentService) broadcastAcknowledgement(incident *models.Incident, ackContactID int64) error {
+	var userName, timezone string
+	err := is.db.QueryRow(`
+		SELECT name, timezone FROM users WHERE id = ?
+	`, incident.UserID).Scan(&userName, &timezone)
+	if err != nil {
+		return fmt.Errorf("failed to query user: %w", err)
+	}
+
+	for _, contact := range incident.Contacts {
+		if contact.ContactID == ackContactID || contact.OptedOut {
+			continue
+		}
+
+		subject, body := is.emailTemplate.BuildIncidentAcknowledgedEmail(IncidentAcknowledgedData{
+			Name:           userName,
+			AcknowledgedBy: incident.AcknowledgedByName,
+			RecipientName:  contact.Name,
+			PausedUntil:    incident.PausedUntil,
+		})
+
+		uniqueKey := fmt.Sprintf("%d_incident_%d_ack_%d_%d", incident.UserID, incident.ID, ackContactID, contact.ContactID)
+		err := is.notificationService.CreateNotification(
+			incident.UserID, "email", contact.Email, timezone, time.Now(),
+			models.NotificationContent{Subject: subject, Body: body}, uniqueKey,
+		)
+		if err != nil {
+			log.Printf("Failed to notify contact %d about acknowledgement: %v", contact.ContactID, err)
+		}
+	}
+
+	return nil
+}
+
+// Resolve 用户重新打卡后解除未解除的紧急事件，并向收到过提醒的联系人发送解除通知
+func (is *IncidentService) Resolve(userID int64, checkinAt time.Time) (*models.Incident, error) {
+	incident, err := is.GetActive(userID)
+	if err != nil || incident == nil {
+		return nil, err
+	}
+
+	_, err = is.db.Exec(`
+		UPDATE incidents SET status = 'resolved', resolved_at = CURRENT_TIMESTAMP, paused_until = NULL
+		WHERE id = ? AND status != 'resolved'
+	`, incident.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve incident: %w", err)
+	}
+	log.Printf("Incident %d resolved for user %d", incident.ID, userID)
+
+	incident, err = is.get(incident.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := is.sendAllClear(incident, checkinAt); err != nil {
+		log.Printf("Failed to send all-clear for incident %d: %v", incident.ID, err)
+	}
+
+	is.dispatchAllClear(incident, checkinAt)
+
+	return incident, nil
+}
+
+// sendAllClear 向紧急事件中收到过提醒的联系人发送解除通知
+func (is *IncidentService) sendAllClear(incident *models.Incident, checkinAt time.Time) error {
+	if len(incident.Contacts) == 0 {
+		return nil
+	}
+
+	var userName, timezone string
+	err := is.db.QueryRow(`
+		SELECT name, timezone FROM users WHERE id = ?
+	`, incident.UserID).Scan(&userName, &timezone)
+	if err != nil {
+		return fmt.Errorf("failed to query user: %w", err)
+	}
+
+	var gap time.Duration
+	if incident.LastCheckinAt != nil {
+		gap = checkinAt.Sub(*incident.LastCheckinAt)
+	}
+
+	for _, contact := range incident.Contacts {
+		if contact.OptedOut {
+			continue
+		}
+
+		subject, body := is.emailTemplate.BuildAllClearEmail(AllClearData{
+			Name:          userName,
+			RecipientName: contact.Name,
+			LastCheckinAt: incident.LastCheckinAt,
+			CheckinAt:     checkinAt,
+			Gap:           gap,
+		})
+
+		uniqueKey := fmt.Sprintf("%d_incident_%d_all_clear_%d", incident.UserID, incident.ID, contact.ContactID)
+		err := is.notificationService.CreateNotification(
+			incident.UserID, "email", contact.Email, timezone, time.Now(),
+			models.NotificationContent{Subject: subject, Body: body}, uniqueKey,
+		)
+		if err != nil {
+			log.Printf("Failed to send all-clear to contact %d: %v", contact.ContactID, err)
+		}
+	}
+
+	return nil
+}
+
+// dispatchAllClear 向用户和收到过提醒的联系人的 webhook 投递解除事件
+func (is *IncidentService) dispatchAllClear(incident *models.Incident, checkinAt time.Time) {
+	data := map[string]interface{}{
+		"incident_id":     incident.ID,
+		"opened_at":       incident.OpenedAt.UTC().Format(time.RFC3339),
+		"last_checkin_at": incident.LastCheckinAt,
+		"checkin_at":      checkinAt.UTC().Format(time.RFC3339),
+	}
+	key := fmt.Sprintf("incident_%d_all_clear", incident.ID)
+
+	err := is.webhookService.Dispatch(WebhookEvent{
+		Type:   models.WebhookEventAllClear,
+		Key:    key,
+		UserID: incident.UserID,
+		Data:   data,
+	})
+	if err != nil {
+		log.Printf("Failed to dispatch all-clear webhook for incident %d: %v", incident.ID, err)
+	}
+
+	for _, contact := range incident.Contacts {
+		if contact.OptedOut {
+			continue
+		}
+		err := is.webhookService.Dispatch(WebhookEvent{
+			Type:      models.WebhookEventAllClear,
+			Key:       key,
+			UserID:    incident.UserID,
+			ContactID: contact.ContactID,
+			Data:      data,
+		})
+		if err != nil {
+			log.Printf("Failed to dispatch all-clear webhook to contact %d: %v", contact.ContactID, err)
+		}
+	}
+}
+
+// get 按ID获取紧急事件（包含联系人）
+func (is *IncidentService) get(incidentID int64) (*models.Incident, error) {
+	incident, err := scanIncident(is.db.QueryRow(`
+		SELECT `+incidentColumns+` FROM incidents WHERE id = ?
+	`, incidentID))
+	if err == sql.ErrNoRows {
+		return nil, ErrIncidentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incident: %w", err)
+	}
+	if err := is.loadContacts(incident); err != nil {
+		return nil, err
+	}
+	return incident, nil
+}
+
+// contactDisplayName 联系人展示名称，没有姓名时使用邮箱
+func contactDisplayName(name, email string) string {
+	if name != "" {
+		return name
+	}
+	return email
+}
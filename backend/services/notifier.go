@@ -0,0 +1,203 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/deadornot/backend/config"
+	"github.com/deadornot/backend/models"
+	"github.com/deadornot/backend/repository"
+)
+
+// Notifier 通知渠道，新渠道实现该接口并在启动时注册
+type Notifier interface {
+	// Channel 渠道名称，对应 notifications.notification_type
+	Channel() string
+	// Send 发送一条通知
+	Send(notif *models.Notification) error
+	// RetryPolicy 发送失败时的重试策略
+	RetryPolicy() RetryPolicy
+	// HealthCheck 检查渠道是否可用
+	HealthCheck() error
+}
+
+// RetryPolicy 重试策略
+type RetryPolicy struct {
+	MaxRetries int
+	Delays     []time.Duration
+}
+
+// defaultRetryDelays 默认重试延迟（指数退避）
+var defaultRetryDelays = []time.Duration{
+	1 * time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+}
+
+// NewRetryPolicy 根据配置创建重试策略
+func NewRetryPolicy(cfg config.RetryConfig) RetryPolicy {
+	policy := RetryPolicy{
+		MaxRetries: cfg.MaxRetries,
+		Delays:     cfg.Delays,
+	}
+	if len(policy.Delays) == 0 {
+		policy.Delays = defaultRetryDelays
+	}
+	return policy
+}
+
+// Delay 获取第 retryCount 次重试的延迟，超出配置时使用最后一个延迟
+func (p RetryPolicy) Delay(retryCount int) time.Duration {
+	delays := p.Delays
+	if len(delays) == 0 {
+		delays = defaultRetryDelays
+	}
+	if retryCount < 1 {
+		retryCount = 1
+	}
+	if retryCount <= len(delays) {
+		return delays[retryCount-1]
+	}
+	return delays[len(delays)-1]
+}
+
+// NotifierRegistry 通知渠道注册表
+type NotifierRegistry struct {
+	mu        sync.RWMutex
+	notifiers map[string]Notifier
+}
+
+// NewNotifierRegistry 创建通知渠道注册表
+func NewNotifierRegistry() *NotifierRegistry {
+	return &NotifierRegistry{
+		notifiers: make(map[string]Notifier),
+	}
+}
+
+// Register 注册通知渠道，同名渠道会被覆盖
+func (r *NotifierRegistry) Register(notifier Notifier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifiers[notifier.Channel()] = notifier
+}
+
+// Get 获取通知渠道
+func (r *NotifierRegistry) Get(channel string) (Notifier, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	notifier, ok := r.notifiers[channel]
+	return notifier, ok
+}
+
+// Channels 获取已注册的渠道名称
+func (r *NotifierRegistry) Channels() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	channels := make([]string, 0, len(r.notifiers))
+	for channel := range r.notifiers {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// HealthCheck 检查所有渠道，返回每个渠道的错误（可用时为 nil）
+func (r *NotifierRegistry) HealthCheck() map[string]error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	results := make(map[string]error, len(r.notifiers))
+	for channel, notifier := range r.notifiers {
+		results[channel] = notifier.HealthCheck()
+	}
+	return results
+}
+
+// EmailNotifier 邮件渠道
+type EmailNotifier struct {
+	emailService *EmailService
+	retryPolicy  RetryPolicy
+}
+
+// NewEmailNotifier 创建邮件渠道
+func NewEmailNotifier(emailService *EmailService, cfg *config.Config) *EmailNotifier {
+	return &EmailNotifier{
+		emailService: emailService,
+		retryPolicy:  NewRetryPolicy(cfg.Email.Retry),
+	}
+}
+
+// Channel 渠道名称
+func (en *EmailNotifier) Channel() string {
+	return "email"
+}
+
+// Send 发送邮件
+func (en *EmailNotifier) Send(notif *models.Notification) error {
+	return en.emailService.SendEmail(
+		notif.Recipient,
+		notif.Content.Subject,
+		notif.Content.Body,
+	)
+}
+
+// RetryPolicy 重试策略
+func (en *EmailNotifier) RetryPolicy() RetryPolicy {
+	return en.retryPolicy
+}
+
+// HealthCheck 检查邮件配置是否完整
+func (en *EmailNotifier) HealthCheck() error {
+	return en.emailService.CheckConfig()
+}
+
+// PushNotifier APNs 推送渠道
+type PushNotifier struct {
+	users       repository.UserRepository
+	pushService *PushService
+	retryPolicy RetryPolicy
+}
+
+// NewPushNotifier 创建推送渠道
+func NewPushNotifier(users repository.UserRepository, pushService *PushService, cfg *config.Config) *PushNotifier {
+	return &PushNotifier{
+		users:       users,
+		pushService: pushService,
+		retryPolicy: NewRetryPolicy(cfg.APNs.Retry),
+	}
+}
+
+// Channel 渠道名称
+func (pn *PushNotifier) Channel() string {
+	return "push"
+}
+
+// Send 发送推送
+func (pn *PushNotifier) Send(notif *models.Notification) error {
+	if !pn.pushService.IsAvailable() {
+		return fmt.Errorf("push service not available")
+	}
+	// 需要从数据库获取用户的APNS token
+	user, err := pn.users.Get(notif.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get APNS token: %w", err)
+	}
+	if user.APNSToken == "" {
+		return fmt.Errorf("APNS token not available for user")
+	}
+	return pn.pushService.SendPush(user.APNSToken, notif.Content.Subject, notif.Content.Body, notif.Content.Data)
+}
+
+// RetryPolicy 重试策略
+func (pn *PushNotifier) RetryPolicy() RetryPolicy {
+	return pn.retryPolicy
+}
+
+// HealthCheck 检查推送服务是否初始化
+func (pn *PushNotifier) HealthCheck() error {
+	if !pn.pushService.IsAvailable() {
+		return fmt.Errorf("push service not initialized")
+	}
+	return nil
+}
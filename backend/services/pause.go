@@ -0,0 +1,186 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/deadornot/backend/models"
+	"github.com/deadornot/backend/repository"
+)
+
+// 暂停时段的限制
+const (
+	MaxPauseDuration  = 90 * 24 * time.Hour
+	maxPauseReasonLen = 200
+)
+
+var (
+	ErrPauseEndInPast      = errors.New("ends_at must be in the future")
+	ErrPauseEndBeforeStart = errors.New("ends_at must be after starts_at")
+	ErrPauseTooLong        = errors.New("pause cannot be longer than 90 days")
+	ErrPauseReasonTooLong  = errors.New("reason is too long")
+)
+
+// PauseInput 设置暂停的参数，StartsAt 为空表示立即开始
+type PauseInput struct {
+	StartsAt       *time.Time
+	EndsAt         time.Time
+	Reason         string
+	NotifyContacts bool
+}
+
+// PauseService 暂停模式：出行、住院等期间暂停提醒和升级
+type PauseService struct {
+	users               repository.UserRepository
+	pauses              repository.PauseRepository
+	contactService      *ContactService
+	notificationService *NotificationService
+	emailTemplate       *EmailTemplate
+}
+
+// NewPauseService 创建暂停服务
+func NewPauseService(repos *repository.Repositories, contactService *ContactService, notificationService *NotificationService) *PauseService {
+	return &PauseService{
+		users:               repos.Users,
+		pauses:              repos.Pauses,
+		contactService:      contactService,
+		notificationService: notificationService,
+		emailTemplate:       NewEmailTemplate(),
+	}
+}
+
+// Get 获取生效中或未开始的暂停，没有时返回 nil
+func (ps *PauseService) Get(userID int64) (*models.Pause, error) {
+	pause, err := ps.pauses.GetCurrent(userID, time.Now().UTC())
+	if err == repository.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pause: %w", err)
+	}
+	return pause, nil
+}
+
+// Set 设置暂停时段，已有生效中或未开始的暂停时修改它（已开始的暂停不改变开始时间）
+func (ps *PauseService) Set(userID int64, input PauseInput) (*models.Pause, error) {
+	now := time.Now().UTC()
+
+	input.Reason = strings.TrimSpace(input.Reason)
+	if utf8.RuneCountInString(input.Reason) > maxPauseReasonLen {
+		return nil, ErrPauseReasonTooLong
+	}
+
+	pause, err := ps.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	startsAt := now
+	if pause != nil && !pause.StartsAt.After(now) {
+		startsAt = pause.StartsAt
+	} else if input.StartsAt != nil && input.StartsAt.After(now) {
+		startsAt = input.StartsAt.UTC()
+	}
+	endsAt := input.EndsAt.UTC()
+
+	switch {
+	case !endsAt.After(now):
+		return nil, ErrPauseEndInPast
+	case !endsAt.After(startsAt):
+		return nil, ErrPauseEndBeforeStart
+	case endsAt.Sub(startsAt) > MaxPauseDuration:
+		return nil, ErrPauseTooLong
+	}
+
+	if pause == nil {
+		pause = &models.Pause{UserID: userID, CreatedAt: now}
+	}
+	pause.StartsAt = startsAt
+	pause.EndsAt = endsAt
+	pause.Reason = input.Reason
+	pause.NotifyContacts = input.NotifyContacts
+	pause.UpdatedAt = now
+
+	if pause.ID == 0 {
+		err = ps.pauses.Create(pause)
+	} else {
+		err = ps.pauses.Update(pause)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save pause: %w", err)
+	}
+
+	if pause.NotifyContacts {
+		if err := ps.notifyContacts(pause); err != nil {
+			log.Printf("Failed to notify contacts about pause %d: %v", pause.ID, err)
+		}
+	}
+
+	return pause, nil
+}
+
+// End 提前结束暂停：已开始的暂停在当前时间结束，未开始的直接删除；没有暂停时返回 false
+func (ps *PauseService) End(userID int64) (bool, error) {
+	pause, err := ps.Get(userID)
+	if err != nil || pause == nil {
+		return false, err
+	}
+
+	now := time.Now().UTC()
+	if pause.StartsAt.After(now) {
+		err = ps.pauses.Delete(pause.ID)
+	} else {
+		pause.EndsAt = now
+		err = ps.pauses.Update(pause)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to end pause: %w", err)
+	}
+	return true, nil
+}
+
+// notifyContacts 通知已确认的紧急联系人暂停的时间和原因
+// 修改暂停时间后会重新通知，时间不变时不重复发送
+func (ps *PauseService) notifyContacts(pause *models.Pause) error {
+	user, err := ps.users.Get(pause.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	contacts, err := ps.contactService.ListAlertable(pause.UserID)
+	if err != nil {
+		return err
+	}
+
+	timezone := user.Timezone
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		timezone = "UTC"
+		loc = time.UTC
+	}
+
+	for _, contact := range contacts {
+		subject, body := ps.emailTemplate.BuildPauseNoticeEmail(PauseNoticeData{
+			Name:          user.Name,
+			RecipientName: contact.Name,
+			StartsAt:      pause.StartsAt.In(loc),
+			EndsAt:        pause.EndsAt.In(loc),
+			Reason:        pause.Reason,
+			OptOutURL:     ps.contactService.OptOutURL(contact.ID),
+		})
+
+		uniqueKey := fmt.Sprintf("%d_pause_%d_%d_%d_%d", pause.UserID, pause.ID, pause.StartsAt.Unix(), pause.EndsAt.Unix(), contact.ID)
+		err := ps.notificationService.CreateNotification(
+			pause.UserID, "email", contact.Email, timezone, time.Now(),
+			models.NotificationContent{Subject: subject, Body: body}, uniqueKey,
+		)
+		if err != nil {
+			log.Printf("Failed to notify contact %d about pause: %v", contact.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/deadornot/backend/config"
+	"github.com/deadornot/backend/database"
+)
+
+// 限流的接口分组，每组的限制在 RATE_LIMIT_<GROUP>_* 中配置
+const (
+	RateLimitAuth    = "auth"
+	RateLimitRefresh = "refresh"
+	RateLimitCheckIn = "checkin"
+)
+
+// 限流的维度
+const (
+	RateLimitByIP     = "ip"
+	RateLimitByUser   = "user"
+	RateLimitByDevice = "device"
+)
+
+// rateLimitSweepInterval 内存限流清理已补满令牌桶的间隔
+const rateLimitSweepInterval = 10 * time.Minute
+
+// databaseRateLimitRetries 数据库限流并发更新冲突时的重试次数
+const databaseRateLimitRetries = 3
+
+var errRateLimitContention = errors.New("rate limit bucket is updated concurrently")
+
+// RateLimitStore 保存令牌桶状态
+type RateLimitStore interface {
+	// Take 从 key 对应的令牌桶中取一个令牌，令牌不足时返回需要等待的时间
+	Take(key string, limit config.RateLimit, now time.Time) (time.Duration, error)
+}
+
+// RateLimiter 按接口分组限流，同时限制单个 IP 和单个用户或设备的请求频率
+type RateLimiter struct {
+	store   RateLimitStore
+	enabled bool
+	rules   map[string]config.RateLimitRule
+}
+
+// NewRateLimiter 创建限流器，RATE_LIMIT_STORE=database 时多个实例共享限流状态
+func NewRateLimiter(db *database.DB, cfg *config.Config) *RateLimiter {
+	var store RateLimitStore
+	switch cfg.RateLimit.Store {
+	case "database":
+		store = &databaseRateLimitStore{db: db}
+	case "memory":
+		store = newMemoryRateLimitStore()
+	default:
+		log.Printf("Unknown rate limit store %q, using memory", cfg.RateLimit.Store)
+		store = newMemoryRateLimitStore()
+	}
+
+	return &RateLimiter{
+		store:   store,
+		enabled: cfg.RateLimit.Enabled,
+		rules: map[string]config.RateLimitRule{
+			RateLimitAuth:    cfg.RateLimit.Auth,
+			RateLimitRefresh: cfg.RateLimit.Refresh,
+			RateLimitCheckIn: cfg.RateLimit.CheckIn,
+		},
+	}
+}
+
+// Allow 检查 group 中 by 维度的 value 是否还能请求，返回 0 表示允许，否则为需要等待的时间
+// 限流状态读写失败时放行，避免存储故障导致所有请求失败
+func (rl *RateLimiter) Allow(group, by, value string) time.Duration {
+	if !rl.enabled || value == "" {
+		return 0
+	}
+
+	rule := rl.rules[group]
+	limit := rule.PerClient
+	if by == RateLimitByIP {
+		limit = rule.PerIP
+	}
+	if limit.Requests <= 0 || limit.Per <= 0 {
+		return 0
+	}
+
+	wait, err := rl.store.Take(rateLimitKey(group, by, value), limit, time.Now())
+	if err != nil {
+		log.Printf("Failed to check rate limit for %s/%s: %v", group, by, err)
+		return 0
+	}
+	return wait
+}
+
+// rateLimitKey 令牌桶的键，不直接保存 IP 和设备ID
+func rateLimitKey(group, by, value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return group + ":" + by + ":" + hex.EncodeToString(hash[:16])
+}
+
+// takeToken 按经过的时间补充令牌后取一个，返回剩余令牌数和需要等待的时间
+func takeToken(tokens float64, updatedAt time.Time, limit config.RateLimit, now time.Time) (float64, time.Duration) {
+	capacity := float64(limit.Requests)
+	rate := capacity / float64(limit.Per) // 每纳秒补充的令牌数
+
+	if elapsed := now.Sub(updatedAt); elapsed > 0 {
+		tokens += float64(elapsed) * rate
+	}
+	if tokens > capacity {
+		tokens = capacity
+	}
+
+	if tokens >= 1 {
+		return tokens - 1, 0
+	}
+	return tokens, time.Duration((1 - tokens) / rate)
+}
+
+// bucketFullAt 令牌桶补满的时间，之后可以删除该令牌桶
+func bucketFullAt(tokens float64, limit config.RateLimit, now time.Time) time.Time {
+	missing := float64(limit.Requests) - tokens
+	return now.Add(time.Duration(missing / float64(limit.Requests) * float64(limit.Per)))
+}
+
+// memoryRateLimitStore 保存在进程内存中的令牌桶，只对当前实例生效
+type memoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*rateLimitBucket
+	lastSweep time.Time
+}
+
+type rateLimitBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	fullAt    time.Time
+}
+
+func newMemoryRateLimitStore() *memoryRateLimitStore {
+	return &memoryRateLimitStore{
+		buckets:   make(map[string]*rateLimitBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *memoryRateLimitStore) Take(key string, limit config.RateLimit, now time.Time) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 已补满的令牌桶与新建的没有区别，定期删除以限制内存占用
+	if now.Sub(s.lastSweep) > rateLimitSweepInterval {
+		for k, b := range s.buckets {
+			if now.After(b.fullAt) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &rateLimitBucket{tokens: float64(limit.Requests), updatedAt: now}
+		s.buckets[key] = bucket
+	}
+
+	tokens, wait := takeToken(bucket.tokens, bucket.updatedAt, limit, now)
+	if wait > 0 {
+		return wait, nil
+	}
+	bucket.tokens = tokens
+	bucket.updatedAt = now
+	bucket.fullAt = bucketFullAt(tokens, limit, now)
+	return 0, nil
+}
+
+// databaseRateLimitStore 保存在 rate_limit_buckets 表中的令牌桶，多个实例共享
+// 使用 version 做乐观锁，兼容 MySQL、PostgreSQL 和 SQLite
+type databaseRateLimitStore struct {
+	db *database.DB
+}
+
+func (s *databaseRateLimitStore) Take(key string, limit config.RateLimit, now time.Time) (time.Duration, error) {
+	for attempt := 0; attempt < databaseRateLimitRetries; attempt++ {
+		var tokens float64
+		var version, updatedMS int64
+		err := s.db.QueryRow(`
+			SELECT tokens, version, updated_ms FROM rate_limit_buckets WHERE bucket_key = ?
+		`, key).Scan(&tokens, &version, &updatedMS)
+
+		if err == sql.ErrNoRows {
+			remaining, _ := takeToken(float64(limit.Requests), now, limit, now)
+			_, err := s.db.Exec(`
+				INSERT INTO rate_limit_buckets (bucket_key, tokens, version, updated_ms, full_at_ms)
+				VALUES (?, ?, 0, ?, ?)
+			`, key, remaining, now.UnixMilli(), bucketFullAt(remaining, limit, now).UnixMilli())
+			if s.db.Dialect().IsDuplicateKey(err) {
+				continue
+			}
+			return 0, err
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		remaining, wait := takeToken(tokens, time.UnixMilli(updatedMS), limit, now)
+		if wait > 0 {
+			return wait, nil
+		}
+
+		result, err := s.db.Exec(`
+			UPDATE rate_limit_buckets
+			SET tokens = ?, version = version + 1, updated_ms = ?, full_at_ms = ?
+			WHERE bucket_key = ? AND version = ?
+		`, remaining, now.UnixMilli(), bucketFullAt(remaining, limit, now).UnixMilli(), key, version)
+		if err != nil {
+			return 0, err
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected == 1 {
+			return 0, nil
+		}
+	}
+	return 0, errRateLimitContention
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/deadornot/backend/config"
+)
+
+func TestTakeToken(t *testing.T) {
+	limit := config.RateLimit{Requests: 4, Per: time.Hour}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// 令牌充足时取一个
+	if tokens, wait := takeToken(4, now, limit, now); tokens != 3 || wait != 0 {
+		t.Errorf("full bucket = %v, %v; want 3, 0", tokens, wait)
+	}
+
+	// 每 15 分钟补充一个令牌
+	if tokens, wait := takeToken(0, now, limit, now.Add(15*time.Minute)); tokens != 0 || wait != 0 {
+		t.Errorf("refilled bucket = %v, %v; want 0, 0", tokens, wait)
+	}
+
+	// 令牌不足时返回补足一个令牌需要等待的时间
+	if _, wait := takeToken(0.5, now, limit, now); wait != 7*time.Minute+30*time.Second {
+		t.Errorf("wait = %v, want 7m30s", wait)
+	}
+
+	// 补充的令牌不超过容量
+	if tokens, _ := takeToken(2, now, limit, now.Add(24*time.Hour)); tokens != 3 {
+		t.Errorf("tokens after long idle = %v, want 3", tokens)
+	}
+}
+
+// testRateLimitStore 对令牌桶存储执行相同的检查
+func testRateLimitStore(t *testing.T, store RateLimitStore) {
+	t.Helper()
+	limit := config.RateLimit{Requests: 2, Per: time.Minute}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if wait, err := store.Take("a", limit, now); err != nil || wait != 0 {
+			t.Fatalf("Take #%d = %v, %v; want allowed", i+1, wait, err)
+		}
+	}
+	wait, err := store.Take("a", limit, now)
+	if err != nil || wait != 30*time.Second {
+		t.Fatalf("Take over limit = %v, %v; want 30s", wait, err)
+	}
+
+	// 被拒绝的请求不消耗令牌，等待后可以继续请求
+	if wait, err := store.Take("a", limit, now.Add(30*time.Second)); err != nil || wait != 0 {
+		t.Errorf("Take after wait = %v, %v; want allowed", wait, err)
+	}
+
+	// 不同的键互不影响
+	if wait, err := store.Take("b", limit, now); err != nil || wait != 0 {
+		t.Errorf("Take other key = %v, %v; want allowed", wait, err)
+	}
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	testRateLimitStore(t, newMemoryRateLimitStore())
+}
+
+func TestDatabaseRateLimitStore(t *testing.T) {
+	testRateLimitStore(t, &databaseRateLimitStore{db: newTestDB(t)})
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	cfg := &config.Config{RateLimit: config.RateLimitConfig{
+		Enabled: true,
+		Store:   "memory",
+		Auth: config.RateLimitRule{
+			PerIP:     config.RateLimit{Requests: 2, Per: time.Hour},
+			PerClient: config.RateLimit{Requests: 1, Per: time.Hour},
+		},
+	}}
+	rl := NewRateLimiter(nil, cfg)
+
+	if rl.Allow(RateLimitAuth, RateLimitByIP, "192.0.2.1") != 0 || rl.Allow(RateLimitAuth, RateLimitByIP, "192.0.2.1") != 0 {
+		t.Fatal("requests within the IP limit should be allowed")
+	}
+	if rl.Allow(RateLimitAuth, RateLimitByIP, "192.0.2.1") == 0 {
+		t.Error("request over the IP limit should be rejected")
+	}
+
+	// 按设备和按 IP 使用各自的限制和令牌桶
+	if rl.Allow(RateLimitAuth, RateLimitByDevice, "192.0.2.1") != 0 {
+		t.Error("device bucket should not share the IP bucket")
+	}
+	if rl.Allow(RateLimitAuth, RateLimitByDevice, "192.0.2.1") == 0 {
+		t.Error("request over the device limit should be rejected")
+	}
+
+	// 没有配置限制的分组和空值不限流
+	for i := 0; i < 5; i++ {
+		if rl.Allow(RateLimitCheckIn, RateLimitByIP, "192.0.2.1") != 0 {
+			t.Fatal("group without limits should not be limited")
+		}
+		if rl.Allow(RateLimitAuth, RateLimitByDevice, "") != 0 {
+			t.Fatal("empty value should not be limited")
+		}
+	}
+
+	cfg.RateLimit.Enabled = false
+	disabled := NewRateLimiter(nil, cfg)
+	for i := 0; i < 5; i++ {
+		if disabled.Allow(RateLimitAuth, RateLimitByIP, "192.0.2.1") != 0 {
+			t.Fatal("disabled rate limiter should allow every request")
+		}
+	}
+}
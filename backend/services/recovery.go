@@ -0,0 +1,375 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/deadornot/backend/config"
+	"github.com/deadornot/backend/database"
+	"github.com/deadornot/backend/models"
+	"github.com/deadornot/backend/repository"
+)
+
+// auth_codes 的用途和有效期
+const (
+	authCodePairing       = "pairing"
+	authCodeEmailVerify   = "email_verify"
+	authCodeEmailRecovery = "email_recovery"
+
+	PairingCodeTTL      = 10 * time.Minute
+	emailVerifyLinkTTL  = 24 * time.Hour
+	AccountRecoveryTTL  = time.Hour
+	pairingCodeLength   = 8
+	pairingCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // 去掉容易混淆的 0/O、1/I
+)
+
+var (
+	ErrInvalidPairingCode = errors.New("invalid or expired pairing code")
+	ErrEmailNotSet        = errors.New("email is not set")
+	ErrEmailVerified      = errors.New("email is already verified")
+	ErrAuthLinkUsed       = errors.New("link has already been used")
+	// ErrPreviousAccountHasData 设备当前的账号关联新账号后将无法登录且还有数据，需要用户确认放弃
+	ErrPreviousAccountHasData = errors.New("the account currently on this device has data, confirm discarding it to continue")
+)
+
+// PairingCode 在旧设备上生成的配对码
+type PairingCode struct {
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// RecoveryService 账号找回服务：配对码关联新设备、验证用户邮箱、通过邮箱链接找回账号
+type RecoveryService struct {
+	db                  *database.DB
+	users               repository.UserRepository
+	securityEvents      repository.SecurityEventRepository
+	notificationService *NotificationService
+	signer              *LinkSigner
+	emailTemplate       *EmailTemplate
+	config              *config.Config
+}
+
+// NewRecoveryService 创建账号找回服务
+func NewRecoveryService(db *database.DB, repos *repository.Repositories, notificationService *NotificationService, signer *LinkSigner, cfg *config.Config) *RecoveryService {
+	return &RecoveryService{
+		db:                  db,
+		users:               repos.Users,
+		securityEvents:      repos.SecurityEvents,
+		notificationService: notificationService,
+		signer:              signer,
+		emailTemplate:       NewEmailTemplate(),
+		config:              cfg,
+	}
+}
+
+// generatePairingCode 生成随机配对码
+func generatePairingCode() (string, error) {
+	bytes := make([]byte, pairingCodeLength)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	code := make([]byte, pairingCodeLength)
+	for i, b := range bytes {
+		code[i] = pairingCodeAlphabet[int(b)%len(pairingCodeAlphabet)]
+	}
+	return string(code), nil
+}
+
+// normalizePairingCode 忽略大小写、空格和分隔符
+func normalizePairingCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// CreatePairingCode 为用户生成配对码，之前未使用的配对码失效
+func (rs *RecoveryService) CreatePairingCode(userID int64) (*PairingCode, error) {
+	_, err := rs.db.Exec(`
+		DELETE FROM auth_codes WHERE user_id = ? AND purpose = ? AND used_at IS NULL
+	`, userID, authCodePairing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete old pairing codes: %w", err)
+	}
+
+	expiresAt := time.Now().Add(PairingCodeTTL)
+	for attempt := 0; attempt < 3; attempt++ {
+		code, err := generatePairingCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate pairing code: %w", err)
+		}
+
+		_, err = rs.db.Exec(`
+			INSERT INTO auth_codes (user_id, purpose, code_hash, expires_at) VALUES (?, ?, ?, ?)
+		`, userID, authCodePairing, hashToken(code), expiresAt)
+		if rs.db.Dialect().IsDuplicateKey(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create pairing code: %w", err)
+		}
+
+		return &PairingCode{
+			Code:      code[:4] + "-" + code[4:],
+			ExpiresAt: expiresAt,
+		}, nil
+	}
+
+	return nil, errors.New("failed to generate a unique pairing code")
+}
+
+// RedeemPairingCode 使用配对码将设备关联到生成配对码的用户，返回用户ID
+// discardPrevious 表示用户已确认放弃设备当前账号的数据，未确认时返回 ErrPreviousAccountHasData 且配对码仍可使用
+func (rs *RecoveryService) RedeemPairingCode(code, deviceID string, discardPrevious bool, client ClientInfo) (int64, error) {
+	if deviceID == "" {
+		return 0, errors.New("device_id is required")
+	}
+
+	codeHash := hashToken(normalizePairingCode(code))
+	result, err := rs.db.Exec(`
+		UPDATE auth_codes SET used_at = CURRENT_TIMESTAMP, device_id = ?
+		WHERE code_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?
+	`, deviceID, codeHash, authCodePairing, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to redeem pairing code: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return 0, ErrInvalidPairingCode
+	}
+
+	var userID int64
+	err = rs.db.QueryRow(`SELECT user_id FROM auth_codes WHERE code_hash = ?`, codeHash).Scan(&userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query pairing code: %w", err)
+	}
+
+	if err := rs.linkDevice(userID, deviceID, discardPrevious, models.SecurityEventDevicePaired, client); err != nil {
+		if errors.Is(err, ErrPreviousAccountHasData) {
+			rs.releaseCode(`code_hash = ?`, codeHash)
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+// SendEmailVerification 向用户当前的邮箱发送验证邮件
+func (rs *RecoveryService) SendEmailVerification(userID int64) error {
+	user, err := rs.users.Get(userID)
+	if err != nil {
+		return fmt.Errorf("failed to query user: %w", err)
+	}
+	if user.Email == "" {
+		return ErrEmailNotSet
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailVerified
+	}
+
+	codeID, err := rs.db.Insert(`
+		INSERT INTO auth_codes (user_id, purpose, email, expires_at) VALUES (?, ?, ?, ?)
+	`, userID, authCodeEmailVerify, user.Email, time.Now().Add(emailVerifyLinkTTL))
+	if err != nil {
+		return fmt.Errorf("failed to create email verification: %w", err)
+	}
+
+	token := rs.signer.Sign(authCodeEmailVerify, codeID, emailVerifyLinkTTL)
+	subject, body := rs.emailTemplate.BuildEmailVerificationEmail(EmailVerificationData{
+		Name:      user.Name,
+		VerifyURL: rs.linkURL("/api/auth/verify-email/", token),
+	})
+
+	uniqueKey := fmt.Sprintf("%d_email_verify_%d", userID, codeID)
+	return rs.notificationService.CreateNotification(
+		userID, "email", user.Email, user.Timezone, time.Now(),
+		models.NotificationContent{Subject: subject, Body: body}, uniqueKey,
+	)
+}
+
+// PeekEmailVerification 校验邮箱验证链接但不执行验证
+func (rs *RecoveryService) PeekEmailVerification(token string) error {
+	_, err := rs.peekLink(authCodeEmailVerify, token)
+	return err
+}
+
+// VerifyEmail 通过邮件链接验证邮箱，邮箱在发送后被修改时链接失效
+func (rs *RecoveryService) VerifyEmail(token string) error {
+	code, err := rs.redeemLink(authCodeEmailVerify, token)
+	if err != nil {
+		return err
+	}
+
+	verified, err := rs.users.MarkEmailVerified(code.userID, code.email)
+	if err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+	if !verified {
+		return ErrInvalidLinkToken
+	}
+	return nil
+}
+
+// RequestRecovery 向已验证的邮箱发送找回账号链接，确认后将 deviceID 关联到该账号
+// 邮箱不存在或未验证时不返回错误，避免泄露邮箱是否注册；discardPrevious 见 RedeemPairingCode
+func (rs *RecoveryService) RequestRecovery(email, deviceID string, discardPrevious bool) error {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return errors.New("email is required")
+	}
+	if deviceID == "" {
+		return errors.New("device_id is required")
+	}
+
+	user, err := rs.users.GetByVerifiedEmail(email)
+	if err == repository.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query user: %w", err)
+	}
+
+	codeID, err := rs.db.Insert(`
+		INSERT INTO auth_codes (user_id, purpose, email, device_id, discard_previous, expires_at) VALUES (?, ?, ?, ?, ?, ?)
+	`, user.ID, authCodeEmailRecovery, user.Email, deviceID, discardPrevious, time.Now().Add(AccountRecoveryTTL))
+	if err != nil {
+		return fmt.Errorf("failed to create recovery link: %w", err)
+	}
+
+	token := rs.signer.Sign(authCodeEmailRecovery, codeID, AccountRecoveryTTL)
+	subject, body := rs.emailTemplate.BuildAccountRecoveryEmail(AccountRecoveryData{
+		Name:        user.Name,
+		RecoveryURL: rs.linkURL("/api/auth/recovery/", token),
+		ExpiresIn:   AccountRecoveryTTL,
+	})
+
+	uniqueKey := fmt.Sprintf("%d_account_recovery_%d", user.ID, codeID)
+	return rs.notificationService.CreateNotification(
+		user.ID, "email", user.Email, user.Timezone, time.Now(),
+		models.NotificationContent{Subject: subject, Body: body}, uniqueKey,
+	)
+}
+
+// PeekRecovery 校验找回账号链接但不执行
+func (rs *RecoveryService) PeekRecovery(token string) error {
+	_, err := rs.peekLink(authCodeEmailRecovery, token)
+	return err
+}
+
+// Recover 通过邮件链接将请求找回的设备关联到账号
+// 设备之后使用原来的 device_id 重新登录即可进入该账号
+func (rs *RecoveryService) Recover(token string, client ClientInfo) error {
+	code, err := rs.redeemLink(authCodeEmailRecovery, token)
+	if err != nil {
+		return err
+	}
+
+	// 发送后邮箱被修改或取消验证时链接失效
+	user, err := rs.users.Get(code.userID)
+	if err != nil {
+		return fmt.Errorf("failed to query user: %w", err)
+	}
+	if user.EmailVerifiedAt == nil || !strings.EqualFold(user.Email, code.email) {
+		return ErrInvalidLinkToken
+	}
+
+	err = rs.linkDevice(code.userID, code.deviceID, code.discardPrevious, models.SecurityEventDeviceRecovered, client)
+	if errors.Is(err, ErrPreviousAccountHasData) {
+		// 原账号的数据被清理后链接仍可使用
+		rs.releaseCode(`id = ?`, code.id)
+	}
+	return err
+}
+
+// linkDevice 关联设备并记录安全事件
+func (rs *RecoveryService) linkDevice(userID int64, deviceID string, discardPrevious bool, eventType string, client ClientInfo) error {
+	err := rs.users.LinkDevice(userID, deviceID, discardPrevious)
+	if errors.Is(err, repository.ErrAccountHasData) {
+		return ErrPreviousAccountHasData
+	}
+	if err != nil {
+		return fmt.Errorf("failed to link device: %w", err)
+	}
+
+	client = client.normalized()
+	err = rs.securityEvents.Create(&models.SecurityEvent{
+		UserID:    userID,
+		EventType: eventType,
+		DeviceID:  deviceID,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+	})
+	if err != nil {
+		log.Printf("Failed to record security event for user %d: %v", userID, err)
+	}
+	return nil
+}
+
+// releaseCode 关联设备失败时恢复已消耗的配对码或邮件链接，condition 为定位记录的条件
+func (rs *RecoveryService) releaseCode(condition string, arg interface{}) {
+	if _, err := rs.db.Exec(`UPDATE auth_codes SET used_at = NULL WHERE `+condition, arg); err != nil {
+		log.Printf("Failed to release auth code: %v", err)
+	}
+}
+
+// authCode 通过邮件链接使用的 auth_codes 记录
+type authCode struct {
+	id              int64
+	userID          int64
+	email           string
+	deviceID        string
+	discardPrevious bool
+}
+
+// peekLink 校验邮件链接，返回对应的记录
+func (rs *RecoveryService) peekLink(purpose, token string) (*authCode, error) {
+	codeID, err := rs.signer.Verify(purpose, token)
+	if err != nil {
+		return nil, err
+	}
+
+	var code authCode
+	var email, deviceID sql.NullString
+	var usedAt sql.NullTime
+	err = rs.db.QueryRow(`
+		SELECT id, user_id, email, device_id, discard_previous, used_at FROM auth_codes WHERE id = ? AND purpose = ?
+	`, codeID, purpose).Scan(&code.id, &code.userID, &email, &deviceID, &code.discardPrevious, &usedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidLinkToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query link: %w", err)
+	}
+	if usedAt.Valid {
+		return nil, ErrAuthLinkUsed
+	}
+
+	code.email = email.String
+	code.deviceID = deviceID.String
+	return &code, nil
+}
+
+// redeemLink 校验并消耗邮件链接，每个链接只能使用一次
+func (rs *RecoveryService) redeemLink(purpose, token string) (*authCode, error) {
+	code, err := rs.peekLink(purpose, token)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := rs.db.Exec(`
+		UPDATE auth_codes SET used_at = CURRENT_TIMESTAMP WHERE id = ? AND used_at IS NULL
+	`, code.id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem link: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, ErrAuthLinkUsed
+	}
+	return code, nil
+}
+
+// linkURL 生成邮件中的链接
+func (rs *RecoveryService) linkURL(path, token string) string {
+	return strings.TrimRight(rs.config.Server.BaseURL, "/") + path + token
+}
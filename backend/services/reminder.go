@@ -0,0 +1,106 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deadornot/backend/models"
+)
+
+var ErrInvalidReminder = errors.New("invalid reminder schedule")
+
+// ReminderSlot 某一天的一个提醒时间点
+type ReminderSlot struct {
+	Clock       string    // HH:MM，用于生成唯一键
+	ScheduledAt time.Time // UTC
+}
+
+// NormalizeReminderTimes 校验提醒时间（HH:MM），去重并按时间排序
+func NormalizeReminderTimes(times []string) (models.StringArray, error) {
+	if len(times) == 0 {
+		return nil, fmt.Errorf("%w: at least one reminder time is required", ErrInvalidReminder)
+	}
+
+	normalized := models.StringArray{}
+	for _, t := range times {
+		clock, err := time.Parse("15:04", strings.TrimSpace(t))
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid time %q, expected HH:MM", ErrInvalidReminder, t)
+		}
+		value := clock.Format("15:04")
+		if !containsString(normalized, value) {
+			normalized = append(normalized, value)
+		}
+	}
+	if len(normalized) > models.MaxReminderTimes {
+		return nil, fmt.Errorf("%w: at most %d reminder times are allowed", ErrInvalidReminder, models.MaxReminderTimes)
+	}
+
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// NormalizeReminderDays 校验提醒星期（mon..sun），为空时表示每天
+func NormalizeReminderDays(days []string) (models.StringArray, error) {
+	selected := make(map[string]bool, len(days))
+	for _, d := range days {
+		day := strings.ToLower(strings.TrimSpace(d))
+		if !containsString(models.ReminderWeekdays, day) {
+			return nil, fmt.Errorf("%w: invalid day %q, expected one of %s", ErrInvalidReminder, d, strings.Join(models.ReminderWeekdays, ", "))
+		}
+		selected[day] = true
+	}
+	if len(selected) == 0 {
+		return models.DefaultReminderDays(), nil
+	}
+
+	// 按星期顺序输出
+	normalized := models.StringArray{}
+	for _, day := range models.ReminderWeekdays {
+		if selected[day] {
+			normalized = append(normalized, day)
+		}
+	}
+	return normalized, nil
+}
+
+// ReminderSlots 计算用户时区下今天需要提醒的时间点；不在提醒星期内时返回空
+func ReminderSlots(times, days models.StringArray, timezone string, now time.Time) ([]ReminderSlot, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(times) == 0 {
+		times = models.DefaultReminderTimes()
+	}
+	if len(days) == 0 {
+		days = models.DefaultReminderDays()
+	}
+
+	local := now.In(loc)
+	if !containsString(days, models.ReminderWeekdays[local.Weekday()]) {
+		return nil, nil
+	}
+
+	slots := make([]ReminderSlot, 0, len(times))
+	for _, t := range times {
+		clock, err := time.Parse("15:04", t)
+		if err != nil {
+			continue
+		}
+		scheduledAt := time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+		slots = append(slots, ReminderSlot{
+			Clock:       clock.Format("1504"),
+			ScheduledAt: scheduledAt.UTC(),
+		})
+	}
+
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].ScheduledAt.Before(slots[j].ScheduledAt)
+	})
+	return slots, nil
+}
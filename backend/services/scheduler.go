@@ -5,28 +5,43 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
 	"time"
 
 	"github.com/deadornot/backend/config"
+	"github.com/deadornot/backend/database"
 	"github.com/deadornot/backend/models"
+	"github.com/deadornot/backend/repository"
 	"github.com/deadornot/backend/utils"
 	"github.com/robfig/cron/v3"
 )
 
 // SchedulerService 定时任务服务
 type SchedulerService struct {
-	db                  *sql.DB
+	db                  *database.DB
+	repos               *repository.Repositories
 	notificationService *NotificationService
+	contactService      *ContactService
+	checkInLinkService  *CheckInLinkService
+	incidentService     *IncidentService
+	webhookService      *WebhookService
+	accountService      *AccountService
 	config              *config.Config
 	cron                *cron.Cron
 	emailTemplate       *EmailTemplate
 }
 
 // NewSchedulerService 创建定时任务服务
-func NewSchedulerService(db *sql.DB, notificationService *NotificationService, cfg *config.Config) *SchedulerService {
+func NewSchedulerService(db *database.DB, repos *repository.Repositories, notificationService *NotificationService, contactService *ContactService, checkInLinkService *CheckInLinkService, incidentService *IncidentService, webhookService *WebhookService, accountService *AccountService, cfg *config.Config) *SchedulerService {
 	return &SchedulerService{
 		db:                  db,
+		repos:               repos,
 		notificationService: notificationService,
+		contactService:      contactService,
+		checkInLinkService:  checkInLinkService,
+		incidentService:     incidentService,
+		webhookService:      webhookService,
+		accountService:      accountService,
 		config:              cfg,
 		cron:                cron.New(cron.WithSeconds()),
 		emailTemplate:       NewEmailTemplate(),
@@ -39,6 +54,9 @@ func (ss *SchedulerService) Start() {
 
 	// 通知发送处理器：每分钟执行一次
 	ss.cron.AddFunc("0 * * * * *", func() {
+		if err := ss.notificationService.RecoverStaleNotifications(); err != nil {
+			log.Printf("Error recovering stale notifications: %v", err)
+		}
 		if err := ss.notificationService.ProcessPendingNotifications(); err != nil {
 			log.Printf("Error processing pending notifications: %v", err)
 		}
@@ -47,15 +65,34 @@ func (ss *SchedulerService) Start() {
 		}
 	})
 
-	// 每日推送提醒：每天早上9点（根据用户时区）
-	// 每小时检查一次，为每个时区的用户安排当天的提醒
+	// 每日推送提醒：按用户设置的提醒时间和星期（根据用户时区）
+	// 每小时检查一次，为每个用户安排接下来一小时内的提醒
 	ss.cron.AddFunc("0 0 * * * *", func() {
 		ss.scheduleDailyPushReminders()
 	})
 
-	// 三天未打卡邮件提醒：每小时检查一次
-	ss.cron.AddFunc("0 0 * * * *", func() {
-		ss.checkThreeDaysMissedCheckIns()
+	// 未打卡升级提醒和截止提醒：每 10 分钟按用户的升级策略检查一次，有截止时间的用户需要及时发现超时
+	ss.cron.AddFunc("0 */10 * * * *", func() {
+		ss.checkMissedCheckIns()
+	})
+
+	// 清理过期的一键打卡链接：每天凌晨执行一次
+	ss.cron.AddFunc("0 30 3 * * *", func() {
+		ss.cleanupCheckInLinks()
+	})
+
+	// 清理 Refresh Token 已过期的登录 Token、过期的配对码和邮件链接、已补满的限流令牌桶：每天凌晨执行一次
+	ss.cron.AddFunc("0 40 3 * * *", func() {
+		ss.cleanupExpiredTokens()
+		ss.cleanupAuthCodes()
+		ss.cleanupRateLimitBuckets()
+	})
+
+	// 删除注销宽限期已结束的账号：每天凌晨执行一次
+	ss.cron.AddFunc("0 50 3 * * *", func() {
+		if err := ss.accountService.PurgeDueDeletions(); err != nil {
+			log.Printf("Error purging deleted accounts: %v", err)
+		}
 	})
 
 	ss.cron.Start()
@@ -68,53 +105,59 @@ func (ss *SchedulerService) Stop() {
 	log.Println("Scheduler service stopped")
 }
 
-// scheduleDailyPushReminders 安排每日推送提醒
+// reminderLookahead 每日提醒的提前安排时长，与提醒任务的执行间隔一致
+const reminderLookahead = time.Hour
+
+// deadlineLookahead 截止提醒的提前安排时长，与升级检查的执行间隔一致
+const deadlineLookahead = 10 * time.Minute
+
+// scheduleDailyPushReminders 按用户设置的提醒时间安排推送，同时向用户的 webhook 投递提醒事件
+// 每小时执行一次，只安排接下来一小时内的提醒，避免用户打卡后仍收到当天较晚的提醒
 func (ss *SchedulerService) scheduleDailyPushReminders() {
-	// 查询所有启用推送的用户
-	rows, err := ss.db.Query(`
-		SELECT id, apns_token, timezone, push_enabled
-		FROM users
-		WHERE push_enabled = TRUE AND apns_token != '' AND apns_token IS NOT NULL
-	`)
+	users, err := ss.repos.Users.List()
 	if err != nil {
 		log.Printf("Failed to query users for push reminders: %v", err)
 		return
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var userID int64
-		var apnsToken sql.NullString
-		var timezone string
-		var pushEnabled bool
+	pausedUserIDs, err := ss.repos.Pauses.ListActiveUserIDs(time.Now().UTC())
+	if err != nil {
+		log.Printf("Failed to query paused users for push reminders: %v", err)
+		return
+	}
+	paused := make(map[int64]bool, len(pausedUserIDs))
+	for _, id := range pausedUserIDs {
+		paused[id] = true
+	}
 
-		if err := rows.Scan(&userID, &apnsToken, &timezone, &pushEnabled); err != nil {
-			log.Printf("Failed to scan user: %v", err)
+	for _, user := range users {
+		// 已申请注销或暂停中的用户不再提醒；按间隔打卡的用户没有每日提醒，超时后由升级策略提醒
+		if user.DeletionScheduledAt != nil || paused[user.ID] || user.CheckInIntervalMinutes > 0 {
 			continue
 		}
 
-		// 跳过无效的 token
-		if !apnsToken.Valid || apnsToken.String == "" {
+		userID := user.ID
+		timezone := user.Timezone
+
+		now := time.Now()
+		slots, err := ReminderSlots(user.ReminderTimes, user.ReminderDays, timezone, now)
+		if err != nil {
+			log.Printf("Failed to get reminder slots for timezone %s: %v", timezone, err)
 			continue
 		}
-
-		if timezone == "" {
-			timezone = "UTC"
+		if len(slots) == 0 {
+			continue
 		}
 
 		// 获取用户时区的今天日期
-		today, err := utils.GetTodayInTimezone(timezone)
+		dateStr, err := utils.GetDateStringInTimezone(now, timezone)
 		if err != nil {
 			log.Printf("Failed to get today for timezone %s: %v", timezone, err)
 			continue
 		}
 
 		// 检查今天是否已打卡
-		var exists bool
-		err = ss.db.QueryRow(`
-			SELECT EXISTS(SELECT 1 FROM checkins WHERE user_id = ? AND DATE(checkin_datetime) = DATE(?))
-		`, userID, today).Scan(&exists)
-
+		exists, err := ss.repos.CheckIns.ExistsOnDate(userID, dateStr)
 		if err != nil {
 			log.Printf("Failed to check checkin: %v", err)
 			continue
@@ -125,165 +168,552 @@ func (ss *SchedulerService) scheduleDailyPushReminders() {
 			continue
 		}
 
-		// 计算今天早上9点的UTC时间
-		scheduledAt, err := utils.GetTimeInTimezone(timezone, 9, 0)
-		if err != nil {
-			log.Printf("Failed to get scheduled time: %v", err)
-			continue
-		}
+		for i, slot := range slots {
+			// 还没到安排时间的提醒留给之后的执行
+			if slot.ScheduledAt.After(now.Add(reminderLookahead)) {
+				break
+			}
+			// 已经过去且后面还有已到时间的提醒，只补发最近的一个
+			if i+1 < len(slots) && !slots[i+1].ScheduledAt.After(now) {
+				continue
+			}
+
+			// 如果已经过了提醒时间，立即发送
+			scheduledAt := slot.ScheduledAt
+			if scheduledAt.Before(now) {
+				scheduledAt = now
+			}
+
+			err = ss.webhookService.Dispatch(WebhookEvent{
+				Type:        models.WebhookEventReminder,
+				Key:         fmt.Sprintf("reminder_%s_%s", dateStr, slot.Clock),
+				UserID:      userID,
+				ScheduledAt: scheduledAt,
+				Data: map[string]interface{}{
+					"date": dateStr,
+					"time": slot.ScheduledAt.Format(time.RFC3339),
+				},
+			})
+			if err != nil {
+				log.Printf("Failed to dispatch reminder webhook for user %d: %v", userID, err)
+			}
+
+			// 跳过未启用推送或无效的 token
+			if !user.PushEnabled || user.APNSToken == "" {
+				continue
+			}
 
-		// 如果已经过了9点，立即发送
-		if scheduledAt.Before(time.Now()) {
-			scheduledAt = time.Now()
+			// 每个提醒时间点单独生成唯一键，前一个提醒被忽略时后面的仍会发送
+			uniqueKey := fmt.Sprintf("%d_push_%s_%s", userID, dateStr, slot.Clock)
+			ss.schedulePushReminder(userID, user.APNSToken, timezone, scheduledAt, uniqueKey, "今天还没有打卡，快打开\"死了么\"打个卡吧！")
 		}
+	}
+}
 
-		// 生成唯一键
-		dateStr, _ := utils.GetDateStringInTimezone(scheduledAt, timezone)
-		uniqueKey := fmt.Sprintf("%d_push_%s", userID, dateStr)
+// schedulePushReminder 创建一条打卡提醒推送，同一唯一键只创建一次
+func (ss *SchedulerService) schedulePushReminder(userID int64, apnsToken, timezone string, scheduledAt time.Time, uniqueKey, body string) {
+	// 检查是否已创建过该时间点的提醒
+	count, err := ss.repos.Notifications.CountActiveByUniqueKey(uniqueKey)
+	if err != nil || count > 0 {
+		return
+	}
 
-		// 检查是否已创建过今天的提醒
-		var count int
-		err = ss.db.QueryRow(`
-			SELECT COUNT(*) FROM notifications 
-			WHERE unique_key = ? AND status != 'failed'
-		`, uniqueKey).Scan(&count)
+	// 推送中附带一键打卡令牌
+	link, err := ss.checkInLinkService.Create(userID)
+	if err != nil {
+		log.Printf("Failed to create checkin link for user %d: %v", userID, err)
+		return
+	}
 
-		if err == nil && count == 0 {
-			// 创建推送通知记录
-			content := models.NotificationContent{
-				Subject: "打卡提醒",
-				Body:    "今天还没有打卡，快打开\"死了么\"打个卡吧！",
-			}
+	// 创建推送通知记录
+	content := models.NotificationContent{
+		Subject: "打卡提醒",
+		Body:    body,
+		Data:    checkInLinkData(link),
+	}
 
-			err = ss.notificationService.CreateNotification(
-				userID, "push", apnsToken.String, timezone, scheduledAt, content, uniqueKey,
-			)
+	err = ss.notificationService.CreateNotification(
+		userID, "push", apnsToken, timezone, scheduledAt, content, uniqueKey,
+	)
+	if err != nil {
+		log.Printf("Failed to create push notification for user %d: %v", userID, err)
+	}
+}
 
-			if err != nil {
-				log.Printf("Failed to create push notification for user %d: %v", userID, err)
-			}
-		}
+// scheduleDeadlinePush 在截止时间发送最后一次提醒，告诉用户宽限时间结束后将开始升级
+// 只提醒 since 之后的第一个截止时间，宽限时间结束后由升级策略继续提醒；没有宽限时间时直接开始升级
+func (ss *SchedulerService) scheduleDeadlinePush(user *escalationUser, since, now time.Time) {
+	if user.Cadence.Grace <= 0 || !user.PushEnabled || user.APNSToken == "" {
+		return
+	}
+
+	deadline := user.Cadence.NextDeadline(since)
+	graceEnd := deadline.Add(user.Cadence.Grace)
+	if deadline.After(now.Add(deadlineLookahead)) || !now.Before(graceEnd) {
+		return
+	}
+
+	scheduledAt := deadline
+	if scheduledAt.Before(now) {
+		scheduledAt = now
 	}
+
+	body := fmt.Sprintf("已到打卡截止时间，请在 %s 前打开\"死了么\"打卡，之后将按您的设置开始升级提醒。",
+		graceEnd.In(user.Cadence.Location).Format("01-02 15:04"))
+	uniqueKey := fmt.Sprintf("%d_deadline_%d", user.ID, deadline.Unix())
+	ss.schedulePushReminder(user.ID, user.APNSToken, user.Timezone, scheduledAt, uniqueKey, body)
+}
+
+// escalationUser 升级检查所需的用户信息
+type escalationUser struct {
+	ID            int64
+	Name          string
+	Email         string
+	Phone         string
+	APNSToken     string
+	Timezone      string
+	PushEnabled   bool
+	EmailEnabled  bool
+	Cadence       CheckInCadence
+	Sharing       models.CheckInSharing // 紧急提醒中可以分享给联系人的打卡信息
+	Steps         models.EscalationSteps
+	LastCheckinAt *time.Time
+	TotalCheckins int
+	Incident      *models.Incident
+	OverdueDays   int    // 未打卡天数
+	Overdue       string // 未打卡时长的描述，用于通知内容
 }
 
-// checkThreeDaysMissedCheckIns 检查三天未打卡的用户并发送邮件提醒
-func (ss *SchedulerService) checkThreeDaysMissedCheckIns() {
-	// 查询所有启用邮件提醒的用户
+// checkMissedCheckIns 按用户的升级策略检查未打卡用户并安排通知
+func (ss *SchedulerService) checkMissedCheckIns() {
+	// 暂停中和已申请注销的用户不做升级
+	now := time.Now().UTC()
 	rows, err := ss.db.Query(`
-		SELECT id, name, emergency_contact_emails, timezone, email_enabled
-		FROM users
-		WHERE email_enabled = TRUE
-	`)
+		SELECT u.id, u.name, u.email, u.phone, u.apns_token,
+		       u.timezone, u.push_enabled, u.email_enabled,
+		       u.checkin_interval_minutes, u.checkin_deadline, u.checkin_grace_minutes,
+		       u.share_mood, u.share_note, u.share_battery, u.share_location, ep.steps
+		FROM users u
+		LEFT JOIN escalation_policies ep ON ep.user_id = u.id
+		WHERE u.deletion_scheduled_at IS NULL
+		  AND NOT EXISTS (
+		      SELECT 1 FROM user_pauses p
+		      WHERE p.user_id = u.id AND p.starts_at <= ? AND p.ends_at > ?
+		  )
+	`, now, now)
 	if err != nil {
-		log.Printf("Failed to query users for email reminders: %v", err)
+		log.Printf("Failed to query users for escalation: %v", err)
 		return
 	}
 	defer rows.Close()
 
+	var users []escalationUser
 	for rows.Next() {
-		var userID int64
-		var name, emailsJSON, timezone string
-		var emailEnabled bool
-
-		if err := rows.Scan(&userID, &name, &emailsJSON, &timezone, &emailEnabled); err != nil {
+		var user escalationUser
+		var email, phone, apnsToken, checkInDeadline, stepsJSON sql.NullString
+		var intervalMinutes, graceMinutes int
+
+		if err := rows.Scan(
+			&user.ID, &user.Name, &email, &phone, &apnsToken,
+			&user.Timezone, &user.PushEnabled, &user.EmailEnabled,
+			&intervalMinutes, &checkInDeadline, &graceMinutes,
+			&user.Sharing.Mood, &user.Sharing.Note, &user.Sharing.Battery, &user.Sharing.Location, &stepsJSON,
+		); err != nil {
 			log.Printf("Failed to scan user: %v", err)
 			continue
 		}
 
-		if timezone == "" {
-			timezone = "UTC"
+		user.Email = email.String
+		user.Phone = phone.String
+		user.APNSToken = apnsToken.String
+		if user.Timezone == "" {
+			user.Timezone = "UTC"
 		}
+		user.Cadence = NewCheckInCadence(intervalMinutes, checkInDeadline.String, graceMinutes, user.Timezone)
 
-		// 解析紧急联系人邮箱
-		var emails []string
-		if err := json.Unmarshal([]byte(emailsJSON), &emails); err != nil || len(emails) == 0 {
-			continue
+		// 未自定义策略的用户使用默认策略
+		if stepsJSON.Valid {
+			if err := json.Unmarshal([]byte(stepsJSON.String), &user.Steps); err != nil {
+				log.Printf("Invalid escalation policy for user %d: %v", user.ID, err)
+				continue
+			}
+		} else {
+			user.Steps = models.DefaultEscalationSteps()
 		}
 
-		// 获取最后打卡时间
-		var lastCheckIn sql.NullTime
-		err = ss.db.QueryRow(`
-			SELECT MAX(checkin_datetime) FROM checkins WHERE user_id = ?
-		`, userID).Scan(&lastCheckIn)
+		users = append(users, user)
+	}
+	rows.Close()
 
-		if err != nil && err != sql.ErrNoRows {
-			log.Printf("Failed to get last checkin: %v", err)
-			continue
+	for _, user := range users {
+		ss.escalateUser(&user)
+	}
+}
+
+// escalateUser 评估单个用户的升级策略
+func (ss *SchedulerService) escalateUser(user *escalationUser) {
+	// 获取最后打卡时间和打卡日期（用户时区的本地日期）
+	last, err := ss.repos.CheckIns.Latest(user.ID)
+
+	// 从未打卡的用户不做升级
+	if err == repository.ErrNotFound {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get last checkin: %v", err)
+		return
+	}
+	lastCheckIn := last.CheckInDateTime.UTC()
+	user.LastCheckinAt = &lastCheckIn
+
+	// 计算距离最后打卡日期的天数（基于用户时区）
+	daysSince, err := utils.DaysSinceLocalDate(last.CheckInDate, user.Timezone)
+	if err != nil {
+		log.Printf("Failed to calculate days since: %v", err)
+		return
+	}
+
+	// 暂停结束后从暂停结束的日期重新计算，暂停期间未打卡的天数不计入
+	now := time.Now().UTC()
+	since := lastCheckIn
+	pause, err := ss.repos.Pauses.LatestEnded(user.ID, now)
+	if err != nil && err != repository.ErrNotFound {
+		log.Printf("Failed to get last pause for user %d: %v", user.ID, err)
+		return
+	}
+	if err == nil && pause.EndsAt.After(lastCheckIn) {
+		since = pause.EndsAt
+		daysSince, err = utils.DaysSinceInTimezone(pause.EndsAt, user.Timezone)
+		if err != nil {
+			log.Printf("Failed to calculate days since pause: %v", err)
+			return
 		}
+	}
+
+	// 升级策略的第 N 步：没有截止时间的用户为未打卡第 N 天
+	// 有截止时间的用户（按间隔打卡或设置了每天的截止时间）为第 N 个截止时间的宽限时间结束
+	missed := daysSince
+	user.OverdueDays = daysSince
+	user.Overdue = fmt.Sprintf("%d 天", daysSince)
+	if user.Cadence.HasDeadline() {
+		ss.scheduleDeadlinePush(user, since, now)
+
+		missed = user.Cadence.MissedDeadlines(since, now)
+		user.OverdueDays = int(now.Sub(since) / (24 * time.Hour))
+		user.Overdue = FormatOverdue(now.Sub(since))
+	}
+
+	var matched []models.EscalationStep
+	for _, step := range user.Steps {
+		if step.Matches(missed) {
+			matched = append(matched, step)
+		}
+	}
+	if len(matched) == 0 {
+		return
+	}
 
-		// 计算距离最后打卡的天数（基于用户时区）
-		var daysSince int
-		if lastCheckIn.Valid {
-			daysSince, err = utils.DaysSinceInTimezone(lastCheckIn.Time, timezone)
+	// 获取累计打卡天数
+	user.TotalCheckins, err = ss.repos.CheckIns.CountDays(user.ID)
+	if err != nil {
+		user.TotalCheckins = 0
+	}
+
+	// 没有截止时间的用户每个步骤每天触发一次，有截止时间的用户每个截止时间触发一次
+	period, _ := utils.GetDateStringInTimezone(now, user.Timezone)
+	if user.Cadence.HasDeadline() {
+		period = fmt.Sprintf("i%d-%d", since.Unix(), missed)
+	}
+
+	notifyContacts := false
+	for _, step := range matched {
+		if step.Target == models.EscalationTargetContacts {
+			notifyContacts = true
+			break
+		}
+	}
+
+	// 第一次通知紧急联系人时开启紧急事件，只提醒用户本人的步骤沿用已有的事件
+	if notifyContacts {
+		user.Incident, err = ss.incidentService.Open(user.ID, user.LastCheckinAt)
+	} else {
+		user.Incident, err = ss.incidentService.GetActive(user.ID)
+	}
+	if err != nil {
+		log.Printf("Failed to get incident for user %d: %v", user.ID, err)
+		return
+	}
+
+	// 只通知已确认且未退订的紧急联系人；有联系人确认跟进时暂停向联系人升级
+	paused := user.Incident != nil && user.Incident.IsPaused(time.Now())
+	var contacts []*models.EmergencyContact
+	if notifyContacts && !paused {
+		contacts, err = ss.contactService.ListAlertable(user.ID)
+		if err != nil {
+			log.Printf("Failed to get contacts for user %d: %v", user.ID, err)
+			return
+		}
+	}
+
+	for _, step := range matched {
+		keyPrefix := fmt.Sprintf("%d_escalation_%s_%d_%s_%s", user.ID, period, step.Day, step.Channel, step.Target)
+		ss.runEscalationStep(user, contacts, step, keyPrefix)
+		if step.Target != models.EscalationTargetContacts || !paused {
+			ss.dispatchEscalation(user, contacts, step, missed, keyPrefix)
+		}
+	}
+}
+
+// dispatchEscalation 向用户的 webhook 以及本次通知到的联系人的 webhook 投递升级事件
+// 有截止时间的用户额外带上错过的截止时间个数
+func (ss *SchedulerService) dispatchEscalation(user *escalationUser, contacts []*models.EmergencyContact, step models.EscalationStep, missed int, keyPrefix string) {
+	// 只提醒用户本人、还没有通知联系人时没有紧急事件
+	var incidentID *int64
+	if user.Incident != nil {
+		incidentID = &user.Incident.ID
+	}
+	data := map[string]interface{}{
+		"incident_id":     incidentID,
+		"days_since":      user.OverdueDays,
+		"last_checkin_at": user.LastCheckinAt,
+		"step":            step,
+	}
+	if user.Cadence.HasDeadline() {
+		data["missed_deadlines"] = missed
+	}
+	if user.Cadence.Interval > 0 {
+		data["checkin_interval_minutes"] = int(user.Cadence.Interval / time.Minute)
+	}
+
+	err := ss.webhookService.Dispatch(WebhookEvent{
+		Type:   models.WebhookEventEscalation,
+		Key:    keyPrefix,
+		UserID: user.ID,
+		Data:   data,
+	})
+	if err != nil {
+		log.Printf("Failed to dispatch escalation webhook for user %d: %v", user.ID, err)
+	}
+
+	if step.Target != models.EscalationTargetContacts {
+		return
+	}
+	for _, contact := range contacts {
+		err := ss.webhookService.Dispatch(WebhookEvent{
+			Type:      models.WebhookEventEscalation,
+			Key:       keyPrefix,
+			UserID:    user.ID,
+			ContactID: contact.ID,
+			Data:      data,
+		})
+		if err != nil {
+			log.Printf("Failed to dispatch escalation webhook to contact %d: %v", contact.ID, err)
+		}
+	}
+}
+
+// runEscalationStep 为一个升级步骤创建通知
+func (ss *SchedulerService) runEscalationStep(user *escalationUser, contacts []*models.EmergencyContact, step models.EscalationStep, keyPrefix string) {
+	switch step.Channel {
+	case models.EscalationChannelPush:
+		if !user.PushEnabled || user.APNSToken == "" {
+			return
+		}
+		ss.enqueueOnce(user, "push", user.APNSToken, keyPrefix, func() (models.NotificationContent, error) {
+			link, err := ss.checkInLinkService.Create(user.ID)
 			if err != nil {
-				log.Printf("Failed to calculate days since: %v", err)
-				continue
+				return models.NotificationContent{}, err
 			}
-		} else {
-			// 从未打卡，从今天开始计算
-			daysSince = 0
+			return models.NotificationContent{
+				Subject: "打卡提醒",
+				Body:    fmt.Sprintf("您已经 %s没有打卡了，快打开\"死了么\"打个卡吧！", user.Overdue),
+				Data:    checkInLinkData(link),
+			}, nil
+		})
+
+	case models.EscalationChannelEmail:
+		if !user.EmailEnabled {
+			return
+		}
+		if step.Target == models.EscalationTargetUser {
+			if user.Email == "" {
+				return
+			}
+			ss.enqueueOnce(user, "email", user.Email, keyPrefix, func() (models.NotificationContent, error) {
+				link, err := ss.checkInLinkService.Create(user.ID)
+				if err != nil {
+					return models.NotificationContent{}, err
+				}
+				dateStr, _ := utils.GetDateStringInTimezone(time.Now(), user.Timezone)
+				subject, body := ss.emailTemplate.BuildDailyReminderEmail(DailyReminderData{
+					Name:         user.Name,
+					ReminderTime: dateStr,
+					CheckInURL:   link.URL,
+				})
+				return models.NotificationContent{Subject: subject, Body: body}, nil
+			})
+			return
 		}
 
-		// 获取累计打卡天数
-		var totalCheckins int
-		err = ss.db.QueryRow(`
-			SELECT COUNT(*) FROM checkins WHERE user_id = ?
-		`, userID).Scan(&totalCheckins)
-		if err != nil {
-			totalCheckins = 0
+		details := ss.sharedCheckInDetails(user)
+		for _, contact := range contacts {
+			ss.enqueueOnce(user, "email", contact.Email, keyPrefix+"_"+contact.Email, func() (models.NotificationContent, error) {
+				ackURL, err := ss.incidentService.RecordAlert(user.Incident.ID, contact.ID)
+				if err != nil {
+					return models.NotificationContent{}, err
+				}
+				subject, body := ss.emailTemplate.BuildEmergencyReminderEmail(EmergencyReminderData{
+					Name:          user.Name,
+					Overdue:       user.Overdue,
+					LastCheckinAt: user.LastCheckinAt,
+					TotalCheckins: user.TotalCheckins,
+					OptOutURL:     ss.contactService.OptOutURL(contact.ID),
+					AckURL:        ackURL,
+					Details:       details,
+				})
+				return models.NotificationContent{Subject: subject, Body: body}, nil
+			})
 		}
 
-		// 如果超过3天未打卡，但小于7天，则发送邮件提醒
-		if daysSince >= 3 && daysSince < 7 {
-			// 获取用户时区的今天日期字符串
-			today, _ := utils.GetTodayInTimezone(timezone)
-			dateStr, _ := utils.GetDateStringInTimezone(today, timezone)
-			uniqueKey := fmt.Sprintf("%d_email_%s", userID, dateStr)
-
-			// 检查今天是否已发送过邮件
-			var count int
-			err = ss.db.QueryRow(`
-				SELECT COUNT(*) FROM notifications 
-				WHERE unique_key = ? AND status = 'sent'
-			`, uniqueKey).Scan(&count)
-
-			if err == nil && count == 0 {
-				// 为每个紧急联系人创建邮件通知
-				for _, email := range emails {
-					if email == "" {
-						continue
-					}
-
-					// 使用新的邮件模板
-					var lastCheckinTime *time.Time
-					if lastCheckIn.Valid {
-						lastCheckinTime = &lastCheckIn.Time
-					}
-
-					templateData := EmergencyReminderData{
-						Name:          name,
-						DaysSince:     daysSince,
-						LastCheckinAt: lastCheckinTime,
-						TotalCheckins: totalCheckins,
-					}
-
-					subject, body := ss.emailTemplate.BuildEmergencyReminderEmail(templateData)
-
-					content := models.NotificationContent{
-						Subject: subject,
-						Body:    body,
-					}
-
-					// 立即发送
-					err = ss.notificationService.CreateNotification(
-						userID, "email", email, timezone, time.Now(), content, uniqueKey+"_"+email,
-					)
-
-					if err != nil {
-						log.Printf("Failed to create email notification for user %d: %v", userID, err)
-					}
+	case models.EscalationChannelSMS:
+		if !ss.notificationService.Supports("sms") {
+			return
+		}
+		if step.Target == models.EscalationTargetUser {
+			if user.Phone == "" {
+				return
+			}
+			ss.enqueueOnce(user, "sms", user.Phone, keyPrefix, func() (models.NotificationContent, error) {
+				link, err := ss.checkInLinkService.Create(user.ID)
+				if err != nil {
+					return models.NotificationContent{}, err
 				}
+				return userSMSContent(user, link), nil
+			})
+			return
+		}
+
+		content := contactSMSContent(user)
+		for _, contact := range contacts {
+			// 旧数据中的手机号未经校验，发送前统一为 E.164 格式
+			phone, err := ss.contactService.NormalizePhone(contact.Phone)
+			if err != nil || phone == "" {
+				continue
 			}
+			ss.enqueueOnce(user, "sms", phone, keyPrefix+"_"+phone, func() (models.NotificationContent, error) {
+				if _, err := ss.incidentService.RecordAlert(user.Incident.ID, contact.ID); err != nil {
+					return models.NotificationContent{}, err
+				}
+				return content, nil
+			})
 		}
 	}
 }
+
+// sharedCheckInDetails 用户授权分享的最近上报的状态信息，没有授权或查询失败时为空
+func (ss *SchedulerService) sharedCheckInDetails(user *escalationUser) []CheckInDetailItem {
+	if !user.Sharing.Any() {
+		return nil
+	}
+	records, err := ss.repos.CheckIns.ListWithDetails(user.ID, lastKnownDetailsLimit)
+	if err != nil {
+		log.Printf("Failed to get check-in details for user %d: %v", user.ID, err)
+		return nil
+	}
+	return LastKnownCheckInDetails(records, user.Sharing, user.Cadence.Location)
+}
+
+// userSMSContent 提醒用户本人打卡的短信，一键打卡链接同时作为模板变量 link 传入
+func userSMSContent(user *escalationUser, link *CheckInLink) models.NotificationContent {
+	body := fmt.Sprintf("【死了么】您已经 %s没有打卡了，点击链接打卡：%s", user.Overdue, link.URL)
+	return models.NotificationContent{Body: body, Data: smsTemplateData(user, body, link.URL)}
+}
+
+// contactSMSContent 通知紧急联系人的短信
+func contactSMSContent(user *escalationUser) models.NotificationContent {
+	body := fmt.Sprintf("【死了么】%s 已连续 %s未打卡，请尽快联系确认其安全。", user.Name, user.Overdue)
+	return models.NotificationContent{Body: body, Data: smsTemplateData(user, body, "")}
+}
+
+// smsTemplateData 短信模板变量，供阿里云等模板类服务商使用
+// 模板类服务商只发送模板内容，正文和链接需要作为变量传入：content 为完整正文，link 为一键打卡链接（只有发给用户本人时有）
+func smsTemplateData(user *escalationUser, body, link string) map[string]interface{} {
+	params := map[string]interface{}{
+		"name":    user.Name,
+		"days":    strconv.Itoa(user.OverdueDays),
+		"overdue": user.Overdue,
+		"content": body,
+	}
+	if link != "" {
+		params["link"] = link
+	}
+	return map[string]interface{}{"template_params": params}
+}
+
+// enqueueOnce 创建通知，同一唯一键只创建一次；内容在确认需要创建后才生成
+func (ss *SchedulerService) enqueueOnce(user *escalationUser, notificationType, recipient, uniqueKey string, buildContent func() (models.NotificationContent, error)) {
+	count, err := ss.repos.Notifications.CountActiveByUniqueKey(uniqueKey)
+	if err != nil || count > 0 {
+		return
+	}
+
+	content, err := buildContent()
+	if err != nil {
+		log.Printf("Failed to build %s notification for user %d: %v", notificationType, user.ID, err)
+		return
+	}
+
+	// 立即发送
+	err = ss.notificationService.CreateNotification(
+		user.ID, notificationType, recipient, user.Timezone, time.Now(), content, uniqueKey,
+	)
+	if err != nil {
+		log.Printf("Failed to create %s notification for user %d: %v", notificationType, user.ID, err)
+	}
+}
+
+// checkInLinkData 推送中携带的一键打卡数据
+func checkInLinkData(link *CheckInLink) map[string]interface{} {
+	return map[string]interface{}{
+		"checkin_token": link.Token,
+		"checkin_url":   link.URL,
+	}
+}
+
+// cleanupCheckInLinks 清理过期的一键打卡链接
+func (ss *SchedulerService) cleanupCheckInLinks() {
+	_, err := ss.db.Exec(`
+		DELETE FROM checkin_links WHERE expires_at < ?
+	`, time.Now().AddDate(0, 0, -7))
+	if err != nil {
+		log.Printf("Failed to cleanup checkin links: %v", err)
+	}
+}
+
+// cleanupExpiredTokens 清理 Refresh Token 已过期的登录 Token
+// 已刷新的 Token 保留到过期，以便识别被再次使用的旧 Refresh Token
+func (ss *SchedulerService) cleanupExpiredTokens() {
+	if err := ss.repos.Tokens.DeleteExpired(time.Now()); err != nil {
+		log.Printf("Failed to cleanup expired tokens: %v", err)
+	}
+}
+
+// cleanupAuthCodes 清理过期的配对码和账号邮件链接
+func (ss *SchedulerService) cleanupAuthCodes() {
+	_, err := ss.db.Exec(`
+		DELETE FROM auth_codes WHERE expires_at < ?
+	`, time.Now().AddDate(0, 0, -7))
+	if err != nil {
+		log.Printf("Failed to cleanup auth codes: %v", err)
+	}
+}
+
+// cleanupRateLimitBuckets 清理已补满的限流令牌桶（RATE_LIMIT_STORE=database 时使用）
+func (ss *SchedulerService) cleanupRateLimitBuckets() {
+	_, err := ss.db.Exec(`
+		DELETE FROM rate_limit_buckets WHERE full_at_ms < ?
+	`, time.Now().UnixMilli())
+	if err != nil {
+		log.Printf("Failed to cleanup rate limit buckets: %v", err)
+	}
+}
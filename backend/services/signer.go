@@ -0,0 +1,141 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deadornot/backend/config"
+)
+
+var (
+	ErrInvalidLinkToken = errors.New("invalid link token")
+	ErrExpiredLinkToken = errors.New("link token has expired")
+)
+
+// LinkSigner 签名链接服务，生成和校验邮件中携带的令牌
+type LinkSigner struct {
+	secret []byte
+}
+
+// NewLinkSigner 创建签名链接服务
+func NewLinkSigner(cfg *config.Config) *LinkSigner {
+	secret := []byte(cfg.Server.SecretKey)
+	if len(secret) == 0 {
+		// 未配置密钥时使用随机密钥，重启后之前发出的链接全部失效
+		log.Println("APP_SECRET is not configured, signed links will not survive restarts")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatalf("Failed to generate link secret: %v", err)
+		}
+	}
+
+	return &LinkSigner{
+		secret: secret,
+	}
+}
+
+// Sign 为指定用途和对象生成令牌，格式为 base64(purpose|subject|exp).base64(hmac)
+func (ls *LinkSigner) Sign(purpose string, subjectID int64, ttl time.Duration) string {
+	payload := fmt.Sprintf("%s|%d|%d", purpose, subjectID, time.Now().Add(ttl).Unix())
+	return ls.encode(payload)
+}
+
+// SignBound 生成绑定到额外数据（如邮箱）的令牌，数据变化后令牌失效
+// 令牌中只携带绑定数据的摘要，格式为 base64(purpose|subject|exp|digest).base64(hmac)
+func (ls *LinkSigner) SignBound(purpose string, subjectID int64, binding string, ttl time.Duration) string {
+	payload := fmt.Sprintf("%s|%d|%d|%s", purpose, subjectID, time.Now().Add(ttl).Unix(), ls.bindingDigest(binding))
+	return ls.encode(payload)
+}
+
+// Verify 校验令牌并返回对象ID
+func (ls *LinkSigner) Verify(purpose, token string) (int64, error) {
+	parts, err := ls.decode(purpose, token, 3)
+	if err != nil {
+		return 0, err
+	}
+	return parseSubjectAndExpiry(parts)
+}
+
+// VerifyBound 校验绑定令牌，lookup 根据对象ID返回当前的绑定数据，不一致时令牌无效
+func (ls *LinkSigner) VerifyBound(purpose, token string, lookup func(subjectID int64) (string, error)) (int64, error) {
+	parts, err := ls.decode(purpose, token, 4)
+	if err != nil {
+		return 0, err
+	}
+	subjectID, err := parseSubjectAndExpiry(parts)
+	if err != nil {
+		return 0, err
+	}
+
+	binding, err := lookup(subjectID)
+	if err != nil {
+		return 0, err
+	}
+	if !hmac.Equal([]byte(parts[3]), []byte(ls.bindingDigest(binding))) {
+		return 0, ErrInvalidLinkToken
+	}
+	return subjectID, nil
+}
+
+// encode 编码载荷并附加签名
+func (ls *LinkSigner) encode(payload string) string {
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + ls.signature(encoded)
+}
+
+// decode 校验签名和用途，返回载荷各字段
+func (ls *LinkSigner) decode(purpose, token string, fields int) ([]string, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(ls.signature(encoded))) {
+		return nil, ErrInvalidLinkToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidLinkToken
+	}
+
+	parts := strings.Split(string(payload), "|")
+	if len(parts) != fields || parts[0] != purpose {
+		return nil, ErrInvalidLinkToken
+	}
+	return parts, nil
+}
+
+// parseSubjectAndExpiry 解析对象ID并检查是否过期
+func parseSubjectAndExpiry(parts []string) (int64, error) {
+	subjectID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidLinkToken
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidLinkToken
+	}
+	if time.Now().Unix() > expiresAt {
+		return 0, ErrExpiredLinkToken
+	}
+
+	return subjectID, nil
+}
+
+// bindingDigest 计算绑定数据的摘要，避免在链接中暴露原文
+func (ls *LinkSigner) bindingDigest(binding string) string {
+	return ls.signature("binding|" + binding)[:22]
+}
+
+// signature 计算 HMAC-SHA256 签名
+func (ls *LinkSigner) signature(data string) string {
+	mac := hmac.New(sha256.New, ls.secret)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
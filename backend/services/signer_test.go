@@ -0,0 +1,58 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/deadornot/backend/config"
+)
+
+func newTestSigner() *LinkSigner {
+	return NewLinkSigner(&config.Config{Server: config.ServerConfig{SecretKey: "test-secret"}})
+}
+
+func TestLinkSignerVerifyBound(t *testing.T) {
+	signer := newTestSigner()
+	token := signer.SignBound(linkPurposeContactConfirm, 42, "a@example.com", time.Hour)
+
+	lookup := func(email string) func(int64) (string, error) {
+		return func(id int64) (string, error) {
+			if id != 42 {
+				t.Errorf("lookup id = %d, want 42", id)
+			}
+			return email, nil
+		}
+	}
+
+	id, err := signer.VerifyBound(linkPurposeContactConfirm, token, lookup("a@example.com"))
+	if err != nil || id != 42 {
+		t.Fatalf("VerifyBound = %d, %v; want 42, nil", id, err)
+	}
+
+	// 邮箱修改后旧链接失效
+	if _, err := signer.VerifyBound(linkPurposeContactConfirm, token, lookup("b@example.com")); !errors.Is(err, ErrInvalidLinkToken) {
+		t.Errorf("VerifyBound with changed binding = %v, want ErrInvalidLinkToken", err)
+	}
+
+	// 绑定令牌不能当作普通令牌使用，反之亦然
+	if _, err := signer.Verify(linkPurposeContactConfirm, token); !errors.Is(err, ErrInvalidLinkToken) {
+		t.Errorf("Verify bound token = %v, want ErrInvalidLinkToken", err)
+	}
+	plain := signer.Sign(linkPurposeContactConfirm, 42, time.Hour)
+	if _, err := signer.VerifyBound(linkPurposeContactConfirm, plain, lookup("a@example.com")); !errors.Is(err, ErrInvalidLinkToken) {
+		t.Errorf("VerifyBound plain token = %v, want ErrInvalidLinkToken", err)
+	}
+}
+
+func TestLinkSignerVerifyBoundExpired(t *testing.T) {
+	signer := newTestSigner()
+	token := signer.SignBound(linkPurposeContactConfirm, 42, "a@example.com", -time.Minute)
+
+	_, err := signer.VerifyBound(linkPurposeContactConfirm, token, func(int64) (string, error) {
+		return "a@example.com", nil
+	})
+	if !errors.Is(err, ErrExpiredLinkToken) {
+		t.Errorf("VerifyBound expired = %v, want ErrExpiredLinkToken", err)
+	}
+}
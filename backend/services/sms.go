@@ -0,0 +1,253 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/deadornot/backend/config"
+	"github.com/deadornot/backend/models"
+)
+
+// SMSProvider 短信服务商
+type SMSProvider interface {
+	// Name 服务商名称
+	Name() string
+	// Send 发送短信，to 为 E.164 格式手机号；params 为模板变量（模板类服务商使用）
+	Send(to, body string, params map[string]string) error
+	// CheckConfig 检查配置是否完整
+	CheckConfig() error
+}
+
+// NewSMSProvider 根据配置创建短信服务商
+func NewSMSProvider(cfg *config.Config) (SMSProvider, error) {
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	switch cfg.SMS.Provider {
+	case "aliyun":
+		return &AliyunSMSProvider{config: cfg.SMS, client: client}, nil
+	case "twilio":
+		return &TwilioSMSProvider{config: cfg.SMS, client: client}, nil
+	default:
+		return nil, fmt.Errorf("unsupported SMS provider: %s", cfg.SMS.Provider)
+	}
+}
+
+// SMSNotifier 短信渠道
+type SMSNotifier struct {
+	provider    SMSProvider
+	retryPolicy RetryPolicy
+}
+
+// NewSMSNotifier 创建短信渠道
+func NewSMSNotifier(provider SMSProvider, cfg *config.Config) *SMSNotifier {
+	return &SMSNotifier{
+		provider:    provider,
+		retryPolicy: NewRetryPolicy(cfg.SMS.Retry),
+	}
+}
+
+// Channel 渠道名称
+func (sn *SMSNotifier) Channel() string {
+	return "sms"
+}
+
+// Send 发送短信，模板变量来自 Content.Data["template_params"]
+func (sn *SMSNotifier) Send(notif *models.Notification) error {
+	params := map[string]string{}
+	if raw, ok := notif.Content.Data["template_params"].(map[string]interface{}); ok {
+		for k, v := range raw {
+			params[k] = fmt.Sprint(v)
+		}
+	}
+	return sn.provider.Send(notif.Recipient, notif.Content.Body, params)
+}
+
+// RetryPolicy 重试策略
+func (sn *SMSNotifier) RetryPolicy() RetryPolicy {
+	return sn.retryPolicy
+}
+
+// HealthCheck 检查短信服务商配置
+func (sn *SMSNotifier) HealthCheck() error {
+	return sn.provider.CheckConfig()
+}
+
+// AliyunSMSProvider 阿里云短信服务
+type AliyunSMSProvider struct {
+	config config.SMSConfig
+	client *http.Client
+}
+
+// Name 服务商名称
+func (ap *AliyunSMSProvider) Name() string {
+	return "aliyun"
+}
+
+// CheckConfig 检查配置是否完整
+func (ap *AliyunSMSProvider) CheckConfig() error {
+	if ap.config.AliyunKey == "" || ap.config.AliyunSecret == "" {
+		return fmt.Errorf("Aliyun SMS access key or secret is not configured")
+	}
+	if ap.config.AliyunSignName == "" || ap.config.AliyunTemplateCode == "" {
+		return fmt.Errorf("Aliyun SMS sign name or template code is not configured")
+	}
+	return nil
+}
+
+// Send 通过阿里云短信服务发送，内容由短信模板决定
+func (ap *AliyunSMSProvider) Send(to, body string, params map[string]string) error {
+	if err := ap.CheckConfig(); err != nil {
+		return err
+	}
+
+	// 模板没有变量定义时，把正文作为 content 变量传入
+	if len(params) == 0 {
+		params = map[string]string{"content": body}
+	}
+	templateParam, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal template params: %w", err)
+	}
+
+	// 公共参数
+	timestamp := time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	form := url.Values{}
+	form.Set("Format", "JSON")
+	form.Set("Version", "2017-05-25")
+	form.Set("AccessKeyId", ap.config.AliyunKey)
+	form.Set("SignatureMethod", "HMAC-SHA1")
+	form.Set("Timestamp", timestamp)
+	form.Set("SignatureVersion", "1.0")
+	form.Set("SignatureNonce", fmt.Sprintf("%d", time.Now().UnixNano()))
+
+	// 业务参数
+	form.Set("Action", "SendSms")
+	form.Set("PhoneNumbers", aliyunPhoneNumber(to))
+	form.Set("SignName", ap.config.AliyunSignName)
+	form.Set("TemplateCode", ap.config.AliyunTemplateCode)
+	form.Set("TemplateParam", string(templateParam))
+
+	form.Set("Signature", calculateAliyunSignature("POST", ap.config.AliyunSecret, form))
+
+	resp, err := ap.client.PostForm(ap.config.AliyunEndpoint, form)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var result struct {
+		Code    string `json:"Code"`
+		Message string `json:"Message"`
+		BizID   string `json:"BizId"`
+	}
+	if err := json.Unmarshal(bodyBytes, &result); err != nil {
+		return fmt.Errorf("aliyun SMS API error: %s", string(bodyBytes))
+	}
+	if resp.StatusCode != http.StatusOK || result.Code != "OK" {
+		return fmt.Errorf("aliyun SMS API error: %s %s", result.Code, result.Message)
+	}
+
+	log.Printf("SMS sent successfully to %s via Aliyun (BizId %s)", to, result.BizID)
+	return nil
+}
+
+// aliyunPhoneNumber 阿里云短信的号码格式：国内号码不带区号，国际号码为区号+号码且不带 +
+func aliyunPhoneNumber(e164 string) string {
+	number := strings.TrimPrefix(e164, "+")
+	if strings.HasPrefix(number, "86") && len(number) == 13 {
+		return number[2:]
+	}
+	return number
+}
+
+// TwilioSMSProvider Twilio 兼容的短信 REST API
+type TwilioSMSProvider struct {
+	config config.SMSConfig
+	client *http.Client
+}
+
+// Name 服务商名称
+func (tp *TwilioSMSProvider) Name() string {
+	return "twilio"
+}
+
+// CheckConfig 检查配置是否完整
+func (tp *TwilioSMSProvider) CheckConfig() error {
+	if tp.config.TwilioAccountSID == "" || tp.config.TwilioAuthToken == "" {
+		return fmt.Errorf("Twilio account SID or auth token is not configured")
+	}
+	if tp.config.TwilioFrom == "" {
+		return fmt.Errorf("Twilio sender is not configured")
+	}
+	return nil
+}
+
+// Send 通过 Twilio Messages API 发送短信正文
+func (tp *TwilioSMSProvider) Send(to, body string, params map[string]string) error {
+	if err := tp.CheckConfig(); err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json",
+		strings.TrimRight(tp.config.TwilioBaseURL, "/"), url.PathEscape(tp.config.TwilioAccountSID))
+
+	form := url.Values{}
+	form.Set("To", to)
+	form.Set("Body", body)
+	// MG 开头的是 Messaging Service SID，否则视为发送号码
+	if strings.HasPrefix(tp.config.TwilioFrom, "MG") {
+		form.Set("MessagingServiceSid", tp.config.TwilioFrom)
+	} else {
+		form.Set("From", tp.config.TwilioFrom)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(tp.config.TwilioAccountSID, tp.config.TwilioAuthToken)
+
+	resp, err := tp.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(bodyBytes, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("twilio API error %d: %s", apiErr.Code, apiErr.Message)
+		}
+		return fmt.Errorf("twilio API error: status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var result struct {
+		SID string `json:"sid"`
+	}
+	json.Unmarshal(bodyBytes, &result)
+
+	log.Printf("SMS sent successfully to %s via Twilio (sid %s)", to, result.SID)
+	return nil
+}
@@ -0,0 +1,304 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/deadornot/backend/config"
+	"github.com/deadornot/backend/models"
+)
+
+// popPercentEncode 按阿里云 POP 签名规范独立实现的编码，用于校验服务端收到的签名
+func popPercentEncode(s string) string {
+	encoded := url.QueryEscape(s)
+	encoded = strings.ReplaceAll(encoded, "+", "%20")
+	encoded = strings.ReplaceAll(encoded, "*", "%2A")
+	return strings.ReplaceAll(encoded, "%7E", "~")
+}
+
+// popSignature 按规范计算请求参数（不含 Signature）的签名
+func popSignature(method, secret string, form url.Values) string {
+	keys := []string{}
+	for k := range form {
+		if k != "Signature" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, popPercentEncode(k)+"="+popPercentEncode(form.Get(k)))
+	}
+	stringToSign := method + "&" + popPercentEncode("/") + "&" + popPercentEncode(strings.Join(pairs, "&"))
+
+	mac := hmac.New(sha1.New, []byte(secret+"&"))
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestCalculateAliyunSignatureDocumentedExample(t *testing.T) {
+	// 阿里云短信服务文档中的签名示例
+	params := url.Values{}
+	params.Set("AccessKeyId", "testId")
+	params.Set("Action", "SendSms")
+	params.Set("Format", "XML")
+	params.Set("OutId", "123")
+	params.Set("PhoneNumbers", "15300000001")
+	params.Set("RegionId", "cn-hangzhou")
+	params.Set("SignName", "阿里云短信测试专用")
+	params.Set("SignatureMethod", "HMAC-SHA1")
+	params.Set("SignatureNonce", "45e25e9b-0a6f-4070-8c85-2956eda1b466")
+	params.Set("SignatureVersion", "1.0")
+	params.Set("TemplateCode", "SMS_71390007")
+	params.Set("TemplateParam", `{"customer":"test"}`)
+	params.Set("Timestamp", "2017-07-12T02:42:19Z")
+	params.Set("Version", "2017-05-25")
+
+	if got, want := calculateAliyunSignature("GET", "testSecret", params), "zJDF+Lrzhj/ThnlvIToysFRq6t4="; got != want {
+		t.Fatalf("signature = %q, want %q", got, want)
+	}
+}
+
+func newTestAliyunProvider(endpoint string, client *http.Client) *AliyunSMSProvider {
+	return &AliyunSMSProvider{
+		config: config.SMSConfig{
+			AliyunEndpoint:     endpoint,
+			AliyunKey:          "test-key",
+			AliyunSecret:       "test-secret",
+			AliyunSignName:     "死了么",
+			AliyunTemplateCode: "SMS_123456",
+		},
+		client: client,
+	}
+}
+
+func TestAliyunSMSProviderSend(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("parse form: %v", err)
+		}
+		form = r.PostForm
+		w.Write([]byte(`{"Code":"OK","Message":"OK","BizId":"biz-1"}`))
+	}))
+	defer server.Close()
+
+	provider := newTestAliyunProvider(server.URL, server.Client())
+	if err := provider.Send("+8613800138000", "", map[string]string{"name": "张 三", "days": "2"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	want := map[string]string{
+		"Action":           "SendSms",
+		"Version":          "2017-05-25",
+		"Format":           "JSON",
+		"AccessKeyId":      "test-key",
+		"SignatureMethod":  "HMAC-SHA1",
+		"SignatureVersion": "1.0",
+		"PhoneNumbers":     "13800138000",
+		"SignName":         "死了么",
+		"TemplateCode":     "SMS_123456",
+	}
+	for key, value := range want {
+		if got := form.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+	for _, key := range []string{"Timestamp", "SignatureNonce"} {
+		if form.Get(key) == "" {
+			t.Errorf("%s is missing", key)
+		}
+	}
+
+	var params map[string]string
+	if err := json.Unmarshal([]byte(form.Get("TemplateParam")), &params); err != nil {
+		t.Fatalf("TemplateParam: %v", err)
+	}
+	if params["name"] != "张 三" || params["days"] != "2" {
+		t.Errorf("TemplateParam = %v", params)
+	}
+
+	// 参数中带空格时签名也必须符合规范
+	if got, want := form.Get("Signature"), popSignature("POST", "test-secret", form); got != want {
+		t.Errorf("Signature = %q, want %q", got, want)
+	}
+}
+
+func TestAliyunSMSProviderSendBodyAsContent(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.Write([]byte(`{"Code":"OK","BizId":"biz-2"}`))
+	}))
+	defer server.Close()
+
+	provider := newTestAliyunProvider(server.URL, server.Client())
+	if err := provider.Send("+14155550100", "hello world", nil); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if got := form.Get("PhoneNumbers"); got != "14155550100" {
+		t.Errorf("PhoneNumbers = %q, want international number without +", got)
+	}
+	if got := form.Get("TemplateParam"); got != `{"content":"hello world"}` {
+		t.Errorf("TemplateParam = %q", got)
+	}
+}
+
+func TestSMSNotifierSendsCheckInLinkToAliyunTemplate(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.Write([]byte(`{"Code":"OK","BizId":"biz-3"}`))
+	}))
+	defer server.Close()
+
+	user := &escalationUser{ID: 1, Name: "张三", OverdueDays: 2, Overdue: "2 天"}
+	link := &CheckInLink{Token: "token", URL: "https://example.com/checkin/token"}
+	content := userSMSContent(user, link)
+
+	// 通知内容保存为 JSON，发送时从数据库读出
+	data, err := json.Marshal(content)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	notif := &models.Notification{Recipient: "+8613800138000"}
+	if err := json.Unmarshal(data, &notif.Content); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	notifier := &SMSNotifier{provider: newTestAliyunProvider(server.URL, server.Client())}
+	if err := notifier.Send(notif); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	var params map[string]string
+	if err := json.Unmarshal([]byte(form.Get("TemplateParam")), &params); err != nil {
+		t.Fatalf("TemplateParam: %v", err)
+	}
+	if params["link"] != link.URL || params["overdue"] != "2 天" || params["name"] != "张三" {
+		t.Errorf("TemplateParam = %v, want link, overdue and name", params)
+	}
+	if params["content"] != content.Body || !strings.Contains(params["content"], link.URL) {
+		t.Errorf("content = %q, want body with check-in link", params["content"])
+	}
+}
+
+func TestAliyunSMSProviderSendAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Code":"isv.BUSINESS_LIMIT_CONTROL","Message":"触发流控"}`))
+	}))
+	defer server.Close()
+
+	provider := newTestAliyunProvider(server.URL, server.Client())
+	err := provider.Send("+8613800138000", "hi", nil)
+	if err == nil || !strings.Contains(err.Error(), "isv.BUSINESS_LIMIT_CONTROL") {
+		t.Fatalf("Send error = %v, want API error code", err)
+	}
+}
+
+func TestAliyunSMSProviderCheckConfig(t *testing.T) {
+	provider := &AliyunSMSProvider{config: config.SMSConfig{AliyunKey: "key", AliyunSecret: "secret"}}
+	if err := provider.Send("+8613800138000", "hi", nil); err == nil {
+		t.Fatal("Send without sign name and template code should fail")
+	}
+}
+
+func newTestTwilioProvider(baseURL, from string, client *http.Client) *TwilioSMSProvider {
+	return &TwilioSMSProvider{
+		config: config.SMSConfig{
+			TwilioBaseURL:    baseURL,
+			TwilioAccountSID: "AC123",
+			TwilioAuthToken:  "auth-token",
+			TwilioFrom:       from,
+		},
+		client: client,
+	}
+}
+
+func TestTwilioSMSProviderSend(t *testing.T) {
+	var (
+		path        string
+		contentType string
+		user, pass  string
+		hasAuth     bool
+		form        url.Values
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		contentType = r.Header.Get("Content-Type")
+		user, pass, hasAuth = r.BasicAuth()
+		r.ParseForm()
+		form = r.PostForm
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid":"SM1"}`))
+	}))
+	defer server.Close()
+
+	provider := newTestTwilioProvider(server.URL+"/", "+15005550006", server.Client())
+	if err := provider.Send("+8613800138000", "紧急提醒 & 测试", map[string]string{"ignored": "x"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if path != "/2010-04-01/Accounts/AC123/Messages.json" {
+		t.Errorf("path = %q", path)
+	}
+	if contentType != "application/x-www-form-urlencoded" {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+	if !hasAuth || user != "AC123" || pass != "auth-token" {
+		t.Errorf("basic auth = %q/%q (present %v)", user, pass, hasAuth)
+	}
+	if form.Get("To") != "+8613800138000" || form.Get("Body") != "紧急提醒 & 测试" || form.Get("From") != "+15005550006" {
+		t.Errorf("form = %v", form)
+	}
+	if form.Has("MessagingServiceSid") || form.Has("ignored") {
+		t.Errorf("unexpected form fields: %v", form)
+	}
+}
+
+func TestTwilioSMSProviderSendMessagingService(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	provider := newTestTwilioProvider(server.URL, "MG0123", server.Client())
+	if err := provider.Send("+14155550100", "hi", nil); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if form.Get("MessagingServiceSid") != "MG0123" || form.Has("From") {
+		t.Errorf("form = %v, want MessagingServiceSid only", form)
+	}
+}
+
+func TestTwilioSMSProviderSendAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":21211,"message":"Invalid 'To' Phone Number"}`))
+	}))
+	defer server.Close()
+
+	provider := newTestTwilioProvider(server.URL, "+15005550006", server.Client())
+	err := provider.Send("+1000", "hi", nil)
+	if err == nil || !strings.Contains(err.Error(), "21211") {
+		t.Fatalf("Send error = %v, want API error code", err)
+	}
+}
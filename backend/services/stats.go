@@ -0,0 +1,278 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/deadornot/backend/models"
+	"github.com/deadornot/backend/repository"
+)
+
+// CheckInStats 打卡统计
+type CheckInStats struct {
+	TotalDays int // 累计打卡天数
+	// CurrentStreak 当前连续打卡：每天打卡的用户为天数，今天未打卡且不在暂停中时为 0；
+	// 按间隔打卡的用户为次数，已超过宽限时间未打卡时为 0
+	CurrentStreak int
+	// StreakIncludingYesterday 今天还没打卡时从昨天起计算的连续打卡天数，今天打卡后仍能保持的连续打卡
+	// 按间隔打卡的用户与 CurrentStreak 相同
+	StreakIncludingYesterday int
+	LongestStreak            int // 最长连续打卡，单位与 CurrentStreak 相同
+	Month                    MonthlyCheckInStats
+	AverageCheckInTime       string     // 平均打卡时间（打卡时的本地时间，HH:MM），没有打卡记录时为空
+	WeekdayCounts            [7]int     // 按本地日期的星期统计的打卡次数，下标 0 为星期日
+	LastCheckInAt            *time.Time // 最晚一次打卡的时间，没有打卡记录时为 nil
+}
+
+// MonthlyCheckInStats 本月（用户时区）的打卡完成率
+// 应打卡天数从本月 1 日或注册当天起算，不含暂停覆盖的日期；今天只在已打卡时计入
+type MonthlyCheckInStats struct {
+	Month          string  `json:"month"` // yyyy-MM
+	CheckedInDays  int     `json:"checked_in_days"`
+	ExpectedDays   int     `json:"expected_days"`
+	CompletionRate float64 `json:"completion_rate"` // 0 到 1，没有应打卡天数时为 0
+}
+
+// CheckInStatsService 打卡统计服务
+// 连续打卡和平均打卡时间按打卡记录增量计算并缓存，每次只读取上次统计之后的新记录；
+// 累计天数和星期分布由数据库聚合，本月完成率只读取本月的记录
+type CheckInStatsService struct {
+	checkIns repository.CheckInRepository
+	cache    repository.CheckInStatsRepository
+	pauses   repository.PauseRepository
+}
+
+// NewCheckInStatsService 创建打卡统计服务
+func NewCheckInStatsService(repos *repository.Repositories) *CheckInStatsService {
+	return &CheckInStatsService{
+		checkIns: repos.CheckIns,
+		cache:    repos.CheckInStats,
+		pauses:   repos.Pauses,
+	}
+}
+
+// Compute 计算用户的打卡统计，暂停覆盖的日期未打卡时跳过，不中断连续打卡
+func (ss *CheckInStatsService) Compute(user *models.User, now time.Time) (*CheckInStats, error) {
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, loc)
+
+	cache, err := ss.cache.Get(user.ID)
+	if err == repository.ErrNotFound {
+		cache = &models.CheckInStatsCache{UserID: user.ID}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get check-in stats: %w", err)
+	}
+
+	records, err := ss.checkIns.ListAfterID(user.ID, cache.LastCheckInID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list check-ins: %w", err)
+	}
+	// 补打卡的记录早于已统计的打卡，会改变历史上的连续打卡，此时从头重新计算
+	if cache.LastCheckInID > 0 && len(records) > 0 && records[0].CheckInDateTime.Before(cache.LastCheckInAt) {
+		cache = &models.CheckInStatsCache{UserID: user.ID}
+		if records, err = ss.checkIns.ListAfterID(user.ID, 0); err != nil {
+			return nil, fmt.Errorf("failed to list check-ins: %w", err)
+		}
+	}
+
+	// 只需要已统计的最后一次打卡之后和本月内的暂停；从头计算时需要全部暂停
+	pausesSince := monthStart
+	if cache.LastCheckInID == 0 {
+		pausesSince = time.Time{}
+	} else if cache.LastCheckInAt.Before(pausesSince) {
+		pausesSince = cache.LastCheckInAt
+	}
+	pauses, err := ss.pauses.ListEndingAfter(user.ID, pausesSince)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pauses: %w", err)
+	}
+	paused := func(date string) bool {
+		for _, pause := range pauses {
+			if pause.CoversDate(date, loc) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(records) > 0 {
+		advanceCheckInStats(user, cache, records, pauses, paused, loc)
+		if err := ss.cache.Save(cache); err != nil {
+			return nil, fmt.Errorf("failed to save check-in stats: %w", err)
+		}
+	}
+
+	aggregate, err := ss.checkIns.Aggregate(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate check-ins: %w", err)
+	}
+	monthRecords, err := ss.checkIns.List(user.ID, today.Format("2006-01")+"-01", today.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list check-ins: %w", err)
+	}
+	checkedIn := map[string]bool{}
+	for _, record := range monthRecords {
+		checkedIn[record.CheckInDate.Format("2006-01-02")] = true
+	}
+
+	stats := &CheckInStats{
+		TotalDays:     aggregate.TotalDays,
+		WeekdayCounts: aggregate.WeekdayCounts,
+		Month:         monthlyCheckInStats(user, checkedIn, paused, today, loc),
+	}
+	if cache.LastCheckInID == 0 {
+		return stats, nil
+	}
+
+	lastCheckInAt := cache.LastCheckInAt
+	stats.LastCheckInAt = &lastCheckInAt
+	stats.AverageCheckInTime = averageCheckInTime(cache.TimeSin, cache.TimeCos)
+	stats.LongestStreak = cache.LongestStreak
+
+	if user.CheckInIntervalMinutes > 0 {
+		if now.Before(intervalGraceEnd(user, pauses, cache.LastCheckInAt, now)) {
+			stats.CurrentStreak = cache.StreakLength
+		}
+		stats.StreakIncludingYesterday = stats.CurrentStreak
+		return stats, nil
+	}
+
+	stats.CurrentStreak = dailyStreakEndingAt(cache, today, paused)
+	stats.StreakIncludingYesterday = stats.CurrentStreak
+	if cache.LastCheckInDate != today.Format("2006-01-02") {
+		stats.StreakIncludingYesterday = dailyStreakEndingAt(cache, today.AddDate(0, 0, -1), paused)
+	}
+	return stats, nil
+}
+
+// advanceCheckInStats 用新的打卡记录（按打卡时间正序）更新缓存中的连续打卡和打卡时间
+// 每天打卡的用户按本地日期计算连续天数，之间未打卡的日期都在暂停中时不中断；
+// 按间隔打卡的用户按次数计算，每次都需要在上一次的截止时间（含宽限时间）前打卡
+func advanceCheckInStats(user *models.User, cache *models.CheckInStatsCache, records []*models.CheckIn, pauses []*models.Pause, paused func(date string) bool, loc *time.Location) {
+	locations := map[string]*time.Location{}
+	for _, record := range records {
+		date := record.CheckInDate.Format("2006-01-02")
+		switch {
+		case cache.LastCheckInID == 0:
+			cache.StreakLength = 1
+		case user.CheckInIntervalMinutes > 0:
+			if record.CheckInDateTime.After(intervalGraceEnd(user, pauses, cache.LastCheckInAt, record.CheckInDateTime)) {
+				cache.StreakLength = 0
+			}
+			cache.StreakLength++
+		case date <= cache.LastCheckInDate:
+			// 同一天的多次打卡只算一天
+		case allPausedBetween(cache.LastCheckInDate, date, paused):
+			cache.StreakLength++
+		default:
+			cache.StreakLength = 1
+		}
+		if cache.StreakLength > cache.LongestStreak {
+			cache.LongestStreak = cache.StreakLength
+		}
+
+		// 打卡时间按打卡时记录的时区换算为本地时间，累加圆周分量
+		recordLoc, ok := locations[record.Timezone]
+		if !ok {
+			recordLoc = loc
+			if l, err := time.LoadLocation(record.Timezone); err == nil && record.Timezone != "" {
+				recordLoc = l
+			}
+			locations[record.Timezone] = recordLoc
+		}
+		recordLocal := record.CheckInDateTime.In(recordLoc)
+		angle := float64(recordLocal.Hour()*60+recordLocal.Minute()) / (24 * 60) * 2 * math.Pi
+		cache.TimeSin += math.Sin(angle)
+		cache.TimeCos += math.Cos(angle)
+
+		cache.LastCheckInID = record.ID
+		cache.LastCheckInAt = record.CheckInDateTime
+		if date > cache.LastCheckInDate {
+			cache.LastCheckInDate = date
+		}
+	}
+}
+
+// intervalGraceEnd 按间隔打卡时，since 那次打卡之后下一次打卡的宽限结束时间，暂停期间不计时
+func intervalGraceEnd(user *models.User, pauses []*models.Pause, since, at time.Time) time.Time {
+	cadence := UserCheckInCadence(user)
+	return cadence.NextDeadline(CheckInDeadlineSince(since, pauses, at)).Add(cadence.Grace)
+}
+
+// dailyStreakEndingAt 截至 day 的连续打卡天数：day 之前最后一次打卡之后的日期都在暂停中时为缓存的连续天数，否则为 0
+func dailyStreakEndingAt(cache *models.CheckInStatsCache, day time.Time, paused func(date string) bool) int {
+	date := day.Format("2006-01-02")
+	switch {
+	case date < cache.LastCheckInDate:
+		return 0
+	case date == cache.LastCheckInDate:
+		return cache.StreakLength
+	case allPausedBetween(cache.LastCheckInDate, day.AddDate(0, 0, 1).Format("2006-01-02"), paused):
+		return cache.StreakLength
+	default:
+		return 0
+	}
+}
+
+// allPausedBetween from 和 to（不含两端，yyyy-MM-dd）之间的日期是否都在暂停中
+func allPausedBetween(from, to string, paused func(date string) bool) bool {
+	day, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return false
+	}
+	for day = day.AddDate(0, 0, 1); day.Format("2006-01-02") < to; day = day.AddDate(0, 0, 1) {
+		if !paused(day.Format("2006-01-02")) {
+			return false
+		}
+	}
+	return true
+}
+
+// monthlyCheckInStats 计算 today 所在月份的打卡完成率，checkedIn 为本月已打卡的日期
+func monthlyCheckInStats(user *models.User, checkedIn map[string]bool, paused func(date string) bool, today time.Time, loc *time.Location) MonthlyCheckInStats {
+	stats := MonthlyCheckInStats{Month: today.Format("2006-01")}
+
+	start := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if !user.CreatedAt.IsZero() {
+		created := user.CreatedAt.In(loc)
+		createdDay := time.Date(created.Year(), created.Month(), created.Day(), 0, 0, 0, 0, time.UTC)
+		if createdDay.After(start) {
+			start = createdDay
+		}
+	}
+
+	for day := start; !day.After(today); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		switch {
+		case checkedIn[date]:
+			stats.CheckedInDays++
+			stats.ExpectedDays++
+		case day.Equal(today) || paused(date):
+			// 今天还没打卡、暂停覆盖的日期不计入应打卡天数
+		default:
+			stats.ExpectedDays++
+		}
+	}
+
+	if stats.ExpectedDays > 0 {
+		stats.CompletionRate = math.Round(float64(stats.CheckedInDays)/float64(stats.ExpectedDays)*1000) / 1000
+	}
+	return stats
+}
+
+// averageCheckInTime 由打卡时间的圆周分量之和计算平均打卡时间
+// 按圆周平均计算，23:50 和 00:10 的平均为 00:00
+func averageCheckInTime(sumSin, sumCos float64) string {
+	angle := math.Atan2(sumSin, sumCos)
+	if angle < 0 {
+		angle += 2 * math.Pi
+	}
+	minutes := int(math.Round(angle/(2*math.Pi)*24*60)) % (24 * 60)
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
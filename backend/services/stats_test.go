@@ -0,0 +1,213 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/deadornot/backend/models"
+	"github.com/deadornot/backend/repository"
+)
+
+// noStatsCache 不保存统计缓存，每次都从头计算，作为增量计算的对照
+type noStatsCache struct{}
+
+func (noStatsCache) Get(userID int64) (*models.CheckInStatsCache, error) {
+	return nil, repository.ErrNotFound
+}
+
+func (noStatsCache) Save(cache *models.CheckInStatsCache) error {
+	return nil
+}
+
+func TestCheckInStatsIncrementalMatchesFullComputation(t *testing.T) {
+	type pause struct{ start, end string }
+	tests := []struct {
+		name     string
+		timezone string
+		interval int
+		pauses   []pause
+		// checkIns 按插入顺序排列的打卡时间（用户时区），较早的时间排在后面表示补打卡
+		checkIns []string
+		now      string
+		want     CheckInStats
+	}{
+		{
+			name:     "pause days keep the streak",
+			timezone: "UTC",
+			pauses:   []pause{{"2026-05-04 00:00", "2026-05-06 00:00"}},
+			checkIns: []string{"2026-05-01 09:00", "2026-05-02 09:00", "2026-05-03 09:00", "2026-05-06 09:00", "2026-05-08 09:00"},
+			now:      "2026-05-08 12:00",
+			want: CheckInStats{
+				TotalDays: 5, CurrentStreak: 1, StreakIncludingYesterday: 1, LongestStreak: 4,
+				Month: MonthlyCheckInStats{Month: "2026-05", CheckedInDays: 5, ExpectedDays: 6},
+			},
+		},
+		{
+			name:     "daylight saving time",
+			timezone: "America/New_York",
+			checkIns: []string{
+				"2026-03-06 23:30", "2026-03-07 23:30", "2026-03-08 23:30", "2026-03-09 23:30",
+				"2026-10-31 23:30", "2026-11-01 23:30",
+			},
+			now: "2026-11-02 08:00",
+			want: CheckInStats{
+				TotalDays: 6, CurrentStreak: 0, StreakIncludingYesterday: 2, LongestStreak: 4,
+				Month: MonthlyCheckInStats{Month: "2026-11", CheckedInDays: 1, ExpectedDays: 1},
+			},
+		},
+		{
+			name:     "monthly rollover",
+			timezone: "Asia/Tokyo",
+			checkIns: []string{"2026-01-30 08:00", "2026-01-31 08:00", "2026-02-01 08:00", "2026-02-02 08:00"},
+			now:      "2026-02-02 20:00",
+			want: CheckInStats{
+				TotalDays: 4, CurrentStreak: 4, StreakIncludingYesterday: 4, LongestStreak: 4,
+				Month: MonthlyCheckInStats{Month: "2026-02", CheckedInDays: 2, ExpectedDays: 2},
+			},
+		},
+		{
+			name:     "pause ending before the month",
+			timezone: "UTC",
+			pauses:   []pause{{"2026-04-29 00:00", "2026-05-01 00:00"}},
+			checkIns: []string{"2026-04-27 09:00", "2026-04-28 09:00", "2026-05-01 09:00"},
+			now:      "2026-05-01 12:00",
+			want: CheckInStats{
+				TotalDays: 3, CurrentStreak: 3, StreakIncludingYesterday: 3, LongestStreak: 3,
+				Month: MonthlyCheckInStats{Month: "2026-05", CheckedInDays: 1, ExpectedDays: 1},
+			},
+		},
+		{
+			name:     "backfill rebuilds the streak",
+			timezone: "UTC",
+			checkIns: []string{"2026-05-01 09:00", "2026-05-03 09:00", "2026-05-02 20:00"},
+			now:      "2026-05-03 12:00",
+			want: CheckInStats{
+				TotalDays: 3, CurrentStreak: 3, StreakIncludingYesterday: 3, LongestStreak: 3,
+				Month: MonthlyCheckInStats{Month: "2026-05", CheckedInDays: 3, ExpectedDays: 3},
+			},
+		},
+		{
+			name:     "interval",
+			timezone: "UTC",
+			interval: 12 * 60,
+			checkIns: []string{"2026-05-01 00:00", "2026-05-01 12:00", "2026-05-02 00:00", "2026-05-03 12:00"},
+			now:      "2026-05-03 13:00",
+			want: CheckInStats{
+				TotalDays: 3, CurrentStreak: 1, StreakIncludingYesterday: 1, LongestStreak: 3,
+				Month: MonthlyCheckInStats{Month: "2026-05", CheckedInDays: 3, ExpectedDays: 3},
+			},
+		},
+		{
+			name:     "interval with pause",
+			timezone: "UTC",
+			interval: 12 * 60,
+			pauses:   []pause{{"2026-05-01 06:00", "2026-05-02 06:00"}},
+			checkIns: []string{"2026-05-01 00:00", "2026-05-02 10:00"},
+			now:      "2026-05-02 11:00",
+			want: CheckInStats{
+				TotalDays: 2, CurrentStreak: 2, StreakIncludingYesterday: 2, LongestStreak: 2,
+				Month: MonthlyCheckInStats{Month: "2026-05", CheckedInDays: 2, ExpectedDays: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			repos := repository.New(db)
+			incremental := NewCheckInStatsService(repos)
+			full := &CheckInStatsService{checkIns: repos.CheckIns, cache: noStatsCache{}, pauses: repos.Pauses}
+
+			loc, err := time.LoadLocation(tt.timezone)
+			if err != nil {
+				t.Fatalf("LoadLocation: %v", err)
+			}
+			parse := func(value string) time.Time {
+				at, err := time.ParseInLocation("2006-01-02 15:04", value, loc)
+				if err != nil {
+					t.Fatalf("parse %q: %v", value, err)
+				}
+				return at.UTC()
+			}
+
+			userID, err := db.Insert(`INSERT INTO users (device_id, timezone) VALUES ('device-1', ?)`, tt.timezone)
+			if err != nil {
+				t.Fatalf("insert user: %v", err)
+			}
+			user := &models.User{
+				ID:                     userID,
+				Timezone:               tt.timezone,
+				CheckInIntervalMinutes: tt.interval,
+				CheckInGraceMinutes:    60,
+				CreatedAt:              time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			}
+			for _, p := range tt.pauses {
+				if err := repos.Pauses.Create(&models.Pause{UserID: userID, StartsAt: parse(p.start), EndsAt: parse(p.end)}); err != nil {
+					t.Fatalf("create pause: %v", err)
+				}
+			}
+
+			compare := func(now time.Time) *CheckInStats {
+				t.Helper()
+				got, err := incremental.Compute(user, now)
+				if err != nil {
+					t.Fatalf("incremental Compute: %v", err)
+				}
+				want, err := full.Compute(user, now)
+				if err != nil {
+					t.Fatalf("full Compute: %v", err)
+				}
+				if !equalCheckInStats(got, want) {
+					t.Fatalf("at %v incremental = %+v, full = %+v", now, got, want)
+				}
+				return got
+			}
+
+			// 每次打卡后都用增量缓存计算一次，与从头计算的结果一致
+			for _, value := range tt.checkIns {
+				at := parse(value)
+				checkIn := &models.CheckIn{
+					UserID:          userID,
+					CheckInDateTime: at,
+					CheckInDate:     time.Date(at.In(loc).Year(), at.In(loc).Month(), at.In(loc).Day(), 0, 0, 0, 0, time.UTC),
+					Timezone:        tt.timezone,
+				}
+				if err := repos.CheckIns.Create(checkIn, false); err != nil {
+					t.Fatalf("create check-in %s: %v", value, err)
+				}
+				compare(at.Add(time.Hour))
+			}
+
+			got := compare(parse(tt.now))
+			if got.CurrentStreak != tt.want.CurrentStreak ||
+				got.StreakIncludingYesterday != tt.want.StreakIncludingYesterday ||
+				got.LongestStreak != tt.want.LongestStreak {
+				t.Errorf("streaks = %d/%d/%d, want %d/%d/%d",
+					got.CurrentStreak, got.StreakIncludingYesterday, got.LongestStreak,
+					tt.want.CurrentStreak, tt.want.StreakIncludingYesterday, tt.want.LongestStreak)
+			}
+			if got.Month.Month != tt.want.Month.Month ||
+				got.Month.CheckedInDays != tt.want.Month.CheckedInDays ||
+				got.Month.ExpectedDays != tt.want.Month.ExpectedDays {
+				t.Errorf("month = %+v, want %+v", got.Month, tt.want.Month)
+			}
+			if got.TotalDays != tt.want.TotalDays {
+				t.Errorf("total days = %d, want %d", got.TotalDays, tt.want.TotalDays)
+			}
+		})
+	}
+}
+
+// equalCheckInStats 比较两次统计，最后打卡时间按时刻比较
+func equalCheckInStats(a, b *CheckInStats) bool {
+	if (a.LastCheckInAt == nil) != (b.LastCheckInAt == nil) {
+		return false
+	}
+	if a.LastCheckInAt != nil && !a.LastCheckInAt.Equal(*b.LastCheckInAt) {
+		return false
+	}
+	x, y := *a, *b
+	x.LastCheckInAt, y.LastCheckInAt = nil, nil
+	return reflect.DeepEqual(x, y)
+}
@@ -0,0 +1,578 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/deadornot/backend/config"
+	"github.com/deadornot/backend/database"
+	"github.com/deadornot/backend/models"
+	"github.com/deadornot/backend/repository"
+)
+
+// MaxWebhooks 每个用户最多的 webhook 数量（含紧急联系人的）
+const MaxWebhooks = 10
+
+// Webhook 请求头
+const (
+	WebhookSignatureHeader = "X-DeadOrNot-Signature"
+	WebhookEventHeader     = "X-DeadOrNot-Event"
+	WebhookDeliveryHeader  = "X-DeadOrNot-Delivery"
+)
+
+const (
+	webhookUserAgent     = "DeadOrNot-Webhook/1.0"
+	webhookResponseLimit = 1024 // 失败时记录的响应内容长度上限
+)
+
+var (
+	ErrWebhookNotFound   = errors.New("webhook not found")
+	ErrTooManyWebhooks   = fmt.Errorf("at most %d webhooks are allowed", MaxWebhooks)
+	ErrInvalidWebhookReq = errors.New("invalid webhook")
+	ErrWebhookAddress    = errors.New("webhook address is not allowed")
+)
+
+// 可订阅的事件：紧急联系人的 webhook 只接收与其相关的升级和解除通知
+var (
+	userWebhookEvents    = []string{models.WebhookEventReminder, models.WebhookEventEscalation, models.WebhookEventAllClear, models.WebhookEventCheckIn}
+	contactWebhookEvents = []string{models.WebhookEventEscalation, models.WebhookEventAllClear}
+)
+
+// WebhookInput 创建或更新 webhook 的参数
+type WebhookInput struct {
+	URL       string   `json:"url"`
+	ContactID *int64   `json:"contact_id"` // 仅创建时有效
+	Events    []string `json:"events"`     // 为空时订阅全部事件
+	Enabled   *bool    `json:"enabled"`
+}
+
+// WebhookEvent 一次待投递的事件
+type WebhookEvent struct {
+	Type        string
+	Key         string // 事件唯一标识，同一 webhook 同一事件只投递一次
+	UserID      int64
+	ContactID   int64 // 为 0 时投递给用户本人的 webhook
+	ScheduledAt time.Time
+	Data        map[string]interface{}
+}
+
+// WebhookDelivery webhook 投递记录
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	Event          string     `json:"event"`
+	Status         string     `json:"status"`
+	ResponseStatus *int       `json:"response_status"`
+	RetryCount     int        `json:"retry_count"`
+	ErrorMessage   string     `json:"error_message,omitempty"`
+	ScheduledAt    time.Time  `json:"scheduled_at"`
+	SentAt         *time.Time `json:"sent_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// WebhookService webhook 服务
+type WebhookService struct {
+	db                  *database.DB
+	users               repository.UserRepository
+	notifications       repository.NotificationRepository
+	notificationService *NotificationService
+	config              *config.Config
+}
+
+// NewWebhookService 创建 webhook 服务
+func NewWebhookService(db *database.DB, repos *repository.Repositories, notificationService *NotificationService, cfg *config.Config) *WebhookService {
+	return &WebhookService{
+		db:                  db,
+		users:               repos.Users,
+		notifications:       repos.Notifications,
+		notificationService: notificationService,
+		config:              cfg,
+	}
+}
+
+const webhookColumns = `id, user_id, contact_id, url, events, enabled, created_at, updated_at`
+
+// scanWebhook 扫描一行 webhook（不含密钥）
+func scanWebhook(scanner interface{ Scan(...interface{}) error }) (*models.Webhook, error) {
+	var webhook models.Webhook
+	var contactID sql.NullInt64
+	err := scanner.Scan(
+		&webhook.ID, &webhook.UserID, &contactID, &webhook.URL,
+		&webhook.Events, &webhook.Enabled, &webhook.CreatedAt, &webhook.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if contactID.Valid {
+		webhook.ContactID = &contactID.Int64
+	}
+	return &webhook, nil
+}
+
+// List 获取用户的全部 webhook
+func (ws *WebhookService) List(userID int64) ([]*models.Webhook, error) {
+	rows, err := ws.db.Query(`SELECT `+webhookColumns+` FROM webhooks WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []*models.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// Get 获取用户的单个 webhook
+func (ws *WebhookService) Get(userID, webhookID int64) (*models.Webhook, error) {
+	webhook, err := scanWebhook(ws.db.QueryRow(`
+		SELECT `+webhookColumns+` FROM webhooks WHERE id = ? AND user_id = ?
+	`, webhookID, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+// Create 登记 webhook，返回的记录中包含签名密钥（之后不再返回）
+func (ws *WebhookService) Create(userID int64, input WebhookInput) (*models.Webhook, error) {
+	var contactID int64
+	if input.ContactID != nil {
+		contactID = *input.ContactID
+		var exists bool
+		err := ws.db.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM emergency_contacts WHERE id = ? AND user_id = ?)
+		`, contactID, userID).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query contact: %w", err)
+		}
+		if !exists {
+			return nil, ErrContactNotFound
+		}
+	}
+
+	events, err := ws.normalizeInput(&input, contactID != 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int
+	if err := ws.db.QueryRow(`SELECT COUNT(*) FROM webhooks WHERE user_id = ?`, userID).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to count webhooks: %w", err)
+	}
+	if count >= MaxWebhooks {
+		return nil, ErrTooManyWebhooks
+	}
+
+	random, err := generateRandomString(24)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	secret := "whsec_" + random
+
+	enabled := input.Enabled == nil || *input.Enabled
+	webhookID, err := ws.db.Insert(`
+		INSERT INTO webhooks (user_id, contact_id, url, secret, events, enabled)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, userID, sql.NullInt64{Int64: contactID, Valid: contactID != 0}, input.URL, secret, events, enabled)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	webhook, err := ws.Get(userID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	webhook.Secret = secret
+	return webhook, nil
+}
+
+// Update 更新 webhook 的地址、订阅事件和启用状态
+func (ws *WebhookService) Update(userID, webhookID int64, input WebhookInput) (*models.Webhook, error) {
+	existing, err := ws.Get(userID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := ws.normalizeInput(&input, existing.ContactID != nil)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := existing.Enabled
+	if input.Enabled != nil {
+		enabled = *input.Enabled
+	}
+
+	_, err = ws.db.Exec(`
+		UPDATE webhooks SET url = ?, events = ?, enabled = ?
+		WHERE id = ? AND user_id = ?
+	`, input.URL, events, enabled, webhookID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update webhook: %w", err)
+	}
+
+	return ws.Get(userID, webhookID)
+}
+
+// Delete 删除 webhook
+func (ws *WebhookService) Delete(userID, webhookID int64) error {
+	result, err := ws.db.Exec(`DELETE FROM webhooks WHERE id = ? AND user_id = ?`, webhookID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// ListDeliveries 获取 webhook 最近的投递记录
+func (ws *WebhookService) ListDeliveries(userID, webhookID int64, limit int) ([]*WebhookDelivery, error) {
+	if _, err := ws.Get(userID, webhookID); err != nil {
+		return nil, err
+	}
+
+	notifications, err := ws.notifications.ListByWebhook(userID, webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deliveries: %w", err)
+	}
+
+	deliveries := make([]*WebhookDelivery, 0, len(notifications))
+	for _, notif := range notifications {
+		deliveries = append(deliveries, &WebhookDelivery{
+			ID:             notif.ID,
+			Event:          notif.Content.Subject,
+			Status:         notif.Status,
+			ResponseStatus: notif.ResponseStatus,
+			RetryCount:     notif.RetryCount,
+			ErrorMessage:   notif.ErrorMessage,
+			ScheduledAt:    notif.ScheduledAt,
+			SentAt:         notif.SentAt,
+			CreatedAt:      notif.CreatedAt,
+		})
+	}
+	return deliveries, nil
+}
+
+// Dispatch 将事件投递给订阅了该事件的 webhook，事件内容在创建时固定，重试时重新签名
+func (ws *WebhookService) Dispatch(event WebhookEvent) error {
+	if !ws.notificationService.Supports("webhook") {
+		return nil
+	}
+
+	query := `SELECT id, url, events FROM webhooks WHERE user_id = ? AND enabled = TRUE AND contact_id IS NULL`
+	args := []interface{}{event.UserID}
+	if event.ContactID != 0 {
+		query = `SELECT id, url, events FROM webhooks WHERE user_id = ? AND enabled = TRUE AND contact_id = ?`
+		args = append(args, event.ContactID)
+	}
+
+	rows, err := ws.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	type target struct {
+		id  int64
+		url string
+	}
+	var targets []target
+	for rows.Next() {
+		var t target
+		var events models.StringArray
+		if err := rows.Scan(&t.id, &t.url, &events); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		if len(events) == 0 || containsString(events, event.Type) {
+			targets = append(targets, t)
+		}
+	}
+	rows.Close()
+
+	if len(targets) == 0 {
+		return nil
+	}
+
+	user, err := ws.users.Get(event.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to query user: %w", err)
+	}
+
+	scheduledAt := event.ScheduledAt
+	if scheduledAt.IsZero() {
+		scheduledAt = time.Now()
+	}
+
+	for _, t := range targets {
+		uniqueKey := fmt.Sprintf("%d_webhook_%d_%s", event.UserID, t.id, event.Key)
+
+		count, err := ws.notifications.CountActiveByUniqueKey(uniqueKey)
+		if err != nil || count > 0 {
+			continue
+		}
+
+		payload, err := json.Marshal(map[string]interface{}{
+			"id":         uniqueKey,
+			"event":      event.Type,
+			"created_at": time.Now().UTC().Format(time.RFC3339),
+			"user": map[string]interface{}{
+				"id":   event.UserID,
+				"name": user.Name,
+			},
+			"data": event.Data,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal webhook payload: %w", err)
+		}
+
+		content := models.NotificationContent{
+			Subject: event.Type,
+			Body:    string(payload),
+			Data:    map[string]interface{}{"webhook_id": t.id},
+		}
+		if err := ws.notificationService.CreateNotification(
+			event.UserID, "webhook", t.url, "UTC", scheduledAt, content, uniqueKey,
+		); err != nil {
+			log.Printf("Failed to create webhook delivery for webhook %d: %v", t.id, err)
+		}
+	}
+
+	return nil
+}
+
+// normalizeInput 校验 webhook 参数，返回规范化后的订阅事件
+func (ws *WebhookService) normalizeInput(input *WebhookInput, forContact bool) (models.StringArray, error) {
+	input.URL = strings.TrimSpace(input.URL)
+	if err := ws.validateURL(input.URL); err != nil {
+		return nil, err
+	}
+
+	allowed := userWebhookEvents
+	if forContact {
+		allowed = contactWebhookEvents
+	}
+
+	events := models.StringArray{}
+	for _, event := range input.Events {
+		event = strings.TrimSpace(event)
+		if !containsString(allowed, event) {
+			return nil, fmt.Errorf("%w: unsupported event %q", ErrInvalidWebhookReq, event)
+		}
+		if !containsString(events, event) {
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 {
+		events = append(events, allowed...)
+	}
+	return events, nil
+}
+
+// validateURL 校验回调地址：必须为 https（调试模式允许 http），且不能指向本机或内网地址
+func (ws *WebhookService) validateURL(rawURL string) error {
+	if rawURL == "" {
+		return fmt.Errorf("%w: url is required", ErrInvalidWebhookReq)
+	}
+	if len(rawURL) > 255 {
+		return fmt.Errorf("%w: url is too long", ErrInvalidWebhookReq)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%w: invalid url", ErrInvalidWebhookReq)
+	}
+
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if !ws.config.Webhook.AllowInsecure {
+			return fmt.Errorf("%w: url must use https", ErrInvalidWebhookReq)
+		}
+	default:
+		return fmt.Errorf("%w: url must use https", ErrInvalidWebhookReq)
+	}
+
+	if ws.config.Webhook.AllowInsecure {
+		return nil
+	}
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") {
+		return fmt.Errorf("%w: url must not point to a local address", ErrInvalidWebhookReq)
+	}
+	if ip := net.ParseIP(host); ip != nil && isInternalIP(ip) {
+		return fmt.Errorf("%w: url must not point to a local address", ErrInvalidWebhookReq)
+	}
+	return nil
+}
+
+// isInternalIP 判断是否为本机、内网、链路本地或未指定地址
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// newWebhookHTTPClient 创建投递 webhook 使用的 HTTP 客户端
+// 域名可能解析到内网地址，因此在建立连接时按实际连接的 IP 再校验一次；allowInternal 仅用于调试
+func newWebhookHTTPClient(timeout time.Duration, allowInternal bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+	}
+	if !allowInternal {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrWebhookAddress, address)
+			}
+			if ip := net.ParseIP(host); ip == nil || isInternalIP(ip) {
+				return fmt.Errorf("%w: %s", ErrWebhookAddress, host)
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// 不使用环境变量中的代理，保证连接校验作用于回调地址本身
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+		// 不跟随重定向，避免被引导到内网地址
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// containsString 判断字符串是否在列表中
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookNotifier webhook 渠道
+type WebhookNotifier struct {
+	db          *database.DB
+	client      *http.Client
+	retryPolicy RetryPolicy
+}
+
+// NewWebhookNotifier 创建 webhook 渠道
+func NewWebhookNotifier(db *database.DB, cfg *config.Config) *WebhookNotifier {
+	return &WebhookNotifier{
+		db:          db,
+		client:      newWebhookHTTPClient(cfg.Webhook.Timeout, cfg.Webhook.AllowInsecure),
+		retryPolicy: NewRetryPolicy(cfg.Webhook.Retry),
+	}
+}
+
+// Channel 渠道名称
+func (wn *WebhookNotifier) Channel() string {
+	return "webhook"
+}
+
+// Send 投递事件，签名为 HMAC-SHA256(secret, "<timestamp>.<body>")，响应状态码记录在通知上
+func (wn *WebhookNotifier) Send(notif *models.Notification) error {
+	webhookID, err := webhookIDFromContent(notif.Content)
+	if err != nil {
+		return err
+	}
+
+	var secret string
+	var enabled bool
+	err = wn.db.QueryRow(`
+		SELECT secret, enabled FROM webhooks WHERE id = ? AND user_id = ?
+	`, webhookID, notif.UserID).Scan(&secret, &enabled)
+	if err == sql.ErrNoRows {
+		return ErrWebhookNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get webhook: %w", err)
+	}
+	if !enabled {
+		return fmt.Errorf("webhook %d is disabled", webhookID)
+	}
+
+	body := notif.Content.Body
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, notif.Recipient, strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", webhookUserAgent)
+	req.Header.Set(WebhookEventHeader, notif.Content.Subject)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(notif.ID, 10))
+	req.Header.Set(WebhookSignatureHeader, "t="+timestamp+",v1="+signWebhookPayload(secret, timestamp, body))
+
+	resp, err := wn.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	status := resp.StatusCode
+	notif.ResponseStatus = &status
+
+	if status < 200 || status >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+		return fmt.Errorf("webhook responded with status %d: %s", status, string(respBody))
+	}
+	return nil
+}
+
+// RetryPolicy 重试策略
+func (wn *WebhookNotifier) RetryPolicy() RetryPolicy {
+	return wn.retryPolicy
+}
+
+// HealthCheck webhook 地址由用户登记，渠道本身始终可用
+func (wn *WebhookNotifier) HealthCheck() error {
+	return nil
+}
+
+// signWebhookPayload 计算 webhook 签名
+func signWebhookPayload(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookIDFromContent 从通知内容中取出 webhook ID（JSON 解析后为 float64）
+func webhookIDFromContent(content models.NotificationContent) (int64, error) {
+	switch v := content.Data["webhook_id"].(type) {
+	case float64:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	default:
+		return 0, fmt.Errorf("webhook id missing in notification content")
+	}
+}
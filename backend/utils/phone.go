@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidPhone = errors.New("invalid phone number, expected E.164 format like +8613800138000")
+
+	e164Pattern = regexp.MustCompile(`^\+[1-9]\d{6,14}$`)
+)
+
+// NormalizePhoneE164 将手机号规范化为 E.164 格式（+国际区号号码）
+// 去掉空格、横线和括号；00 开头视为国际前缀；没有国际区号时使用 defaultCountryCode
+func NormalizePhoneE164(phone, defaultCountryCode string) (string, error) {
+	phone = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "").Replace(strings.TrimSpace(phone))
+	if phone == "" {
+		return "", nil
+	}
+
+	switch {
+	case strings.HasPrefix(phone, "+"):
+	case strings.HasPrefix(phone, "00"):
+		phone = "+" + phone[2:]
+	case defaultCountryCode != "":
+		phone = "+" + strings.TrimPrefix(defaultCountryCode, "+") + strings.TrimPrefix(phone, "0")
+	default:
+		return "", ErrInvalidPhone
+	}
+
+	if !e164Pattern.MatchString(phone) {
+		return "", ErrInvalidPhone
+	}
+	return phone, nil
+}
@@ -0,0 +1,46 @@
+package utils
+
+import "testing"
+
+func TestNormalizePhoneE164(t *testing.T) {
+	tests := []struct {
+		name               string
+		phone              string
+		defaultCountryCode string
+		want               string
+		wantErr            bool
+	}{
+		{name: "already E.164", phone: "+8613800138000", defaultCountryCode: "86", want: "+8613800138000"},
+		{name: "E.164 ignores default country code", phone: "+14155550100", defaultCountryCode: "86", want: "+14155550100"},
+		{name: "separators removed", phone: " +1 (415) 555-0100 ", want: "+14155550100"},
+		{name: "dots removed", phone: "+44.20.7946.0958", want: "+442079460958"},
+		{name: "00 international prefix", phone: "0044 20 7946 0958", defaultCountryCode: "86", want: "+442079460958"},
+		{name: "national number uses default country code", phone: "138 0013 8000", defaultCountryCode: "86", want: "+8613800138000"},
+		{name: "default country code with plus", phone: "13800138000", defaultCountryCode: "+86", want: "+8613800138000"},
+		{name: "national trunk prefix dropped", phone: "020 7946 0958", defaultCountryCode: "44", want: "+442079460958"},
+		{name: "empty is allowed", phone: "   ", defaultCountryCode: "86", want: ""},
+		{name: "national number without default country code", phone: "13800138000", wantErr: true},
+		{name: "country code cannot start with 0", phone: "+0123456789", wantErr: true},
+		{name: "too short", phone: "+123456", wantErr: true},
+		{name: "too long", phone: "+1234567890123456", wantErr: true},
+		{name: "letters", phone: "+86138abc38000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizePhoneE164(tt.phone, tt.defaultCountryCode)
+			if tt.wantErr {
+				if err != ErrInvalidPhone {
+					t.Fatalf("NormalizePhoneE164(%q, %q) error = %v, want ErrInvalidPhone", tt.phone, tt.defaultCountryCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizePhoneE164(%q, %q) error = %v", tt.phone, tt.defaultCountryCode, err)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizePhoneE164(%q, %q) = %q, want %q", tt.phone, tt.defaultCountryCode, got, tt.want)
+			}
+		})
+	}
+}
@@ -72,3 +72,17 @@ func GetDateStringInTimezone(utcTime time.Time, timezone string) (string, error)
 	timeInTZ := utcTime.In(loc)
 	return timeInTZ.Format("2006-01-02"), nil
 }
+
+// DaysSinceLocalDate 计算指定时区的今天距离某个本地日期（DATE 字段）的天数
+func DaysSinceLocalDate(localDate time.Time, timezone string) (int, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	date := time.Date(localDate.Year(), localDate.Month(), localDate.Day(), 0, 0, 0, 0, time.UTC)
+
+	return int(today.Sub(date).Hours() / 24), nil
+}